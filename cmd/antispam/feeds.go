@@ -0,0 +1,63 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"time"
+
+	"spamfilter/internal/config"
+	"spamfilter/internal/feeds"
+)
+
+const feedsUsage = `usage:
+  antispam feeds sync   [-config feeds.json] [-out feeds.list]
+  antispam feeds lookup [-out feeds.list] <domain|address|ip|url>`
+
+// runFeeds implements the "feeds" subcommand and returns the exit code.
+func runFeeds(cfg config.Config, args []string) int {
+	if len(args) == 0 {
+		fmt.Fprintln(os.Stderr, feedsUsage)
+		return 2
+	}
+	fs := flag.NewFlagSet("feeds "+args[0], flag.ContinueOnError)
+	configPath := fs.String("config", cfg.FeedsConfig, "feed definitions (JSON)")
+	out := fs.String("out", cfg.FeedsOutput, "list file written by sync; add it to BLOCKLIST_PATHS")
+	if err := fs.Parse(args[1:]); err != nil {
+		return 2
+	}
+
+	switch args[0] {
+	case "sync":
+		defs, err := feeds.LoadConfig(*configPath)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "feeds: %v\n", err)
+			return 1
+		}
+		report, err := feeds.Sync(defs, *out, time.Now())
+		report.Write(os.Stdout)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "feeds: %v\n", err)
+			return 1
+		}
+		return 0
+	case "lookup":
+		if fs.NArg() != 1 {
+			fmt.Fprintln(os.Stderr, feedsUsage)
+			return 2
+		}
+		entry, err := feeds.Lookup(*out, fs.Arg(0))
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "feeds: %v\n", err)
+			return 1
+		}
+		if entry == nil {
+			fmt.Printf("%s is not listed by any feed\n", fs.Arg(0))
+			return 0
+		}
+		fmt.Printf("%s matched by %s\n", fs.Arg(0), entry.Describe())
+		return 0
+	}
+	fmt.Fprintln(os.Stderr, feedsUsage)
+	return 2
+}
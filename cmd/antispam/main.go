@@ -2,56 +2,292 @@ package main
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"log"
 	"os"
 	"path/filepath"
+	"strconv"
+	"strings"
 	"time"
 
-	"spamfilter/internal/adversarial"
+	"spamfilter/internal/attachment"
+	"spamfilter/internal/clamav"
 	"spamfilter/internal/config"
+	"spamfilter/internal/directory"
 	"spamfilter/internal/email"
+	"spamfilter/internal/lists"
 	"spamfilter/internal/llm"
+	"spamfilter/internal/pipeline"
+	"spamfilter/internal/publicsuffix"
 	"spamfilter/internal/recommendation"
 	"spamfilter/internal/spamassassin"
 )
 
 func main() {
 	cfg := config.Load()
+	if len(os.Args) > 1 && os.Args[1] == "feeds" {
+		os.Exit(runFeeds(cfg, os.Args[2:]))
+	}
+
 	log.Printf("Loading emails from %s", cfg.SampleDir)
 	emails, err := email.LoadEmailsFromDir(cfg.SampleDir)
 	if err != nil {
 		log.Fatalf("failed to load emails: %v", err)
 	}
 	if len(emails) == 0 {
-		log.Printf("No .eml files found in %s", cfg.SampleDir)
+		log.Printf("No .eml or .msg files found in %s", cfg.SampleDir)
 		return
 	}
 
-	var llmClient *llm.Client
-	if client, err := llm.New(cfg.LLMApiKey, cfg.LLMBaseURL, cfg.LLMModel); err != nil {
+	var llmCache *llm.Cache
+	if cfg.LLMCacheTTL > 0 {
+		if llmCache, err = llm.NewCache(cfg.LLMCacheTTL, cfg.LLMCacheSize, cfg.LLMCacheFile); err != nil {
+			log.Printf("LLM cache starts empty: %v", err)
+		}
+	}
+	llmBudget, err := llm.NewBudget(int64(cfg.LLMBudgetTokens), cfg.LLMBudgetCost, cfg.LLMBudgetFile)
+	if err != nil {
+		log.Printf("LLM budget starts at zero: %v", err)
+	}
+	llmBudget.PromptPrice, llmBudget.CompletionPrice = cfg.LLMPricePrompt, cfg.LLMPriceOutput
+	llmClient, err := newLLM(cfg, llmCache, llmBudget)
+	if err != nil {
 		log.Printf("LLM disabled: %v", err)
 	} else {
-		llmClient = client
+		log.Printf("LLM: %s", llmClient.Name())
+	}
+
+	if cfg.PublicSuffixFile != "" {
+		if list, err := publicsuffix.LoadFile(cfg.PublicSuffixFile); err != nil {
+			log.Printf("Using embedded public suffix list: %v", err)
+		} else {
+			publicsuffix.SetDefault(list)
+		}
+	}
+
+	matchMode, err := lists.ParseMatchMode(cfg.BlocklistMatch)
+	if err != nil {
+		log.Printf("BLOCKLIST_MATCH: %v; using %s", err, matchMode)
+	}
+	store := lists.NewStore(matchMode)
+	if err := store.AddStatic(lists.Block, cfg.Blocklist, "MALICIOUS_DOMAINS"); err != nil {
+		log.Printf("MALICIOUS_DOMAINS: %v", err)
+	}
+	store.SetPrefilter(cfg.ListsBloomFP)
+	store.SetPaths(lists.Block, cfg.BlocklistPaths)
+	store.SetPaths(lists.Allow, cfg.AllowlistPaths)
+	if err := store.Reload(); err != nil {
+		log.Printf("Lists not loaded: %v", err)
+	}
+	log.Printf("Lists: %d blocklist / %d allowlist entries", store.Len(lists.Block), store.Len(lists.Allow))
+
+	dir := directory.New(cfg.InternalDomains)
+	if cfg.DirectoryFile != "" {
+		if err := dir.Load(cfg.DirectoryFile); err != nil {
+			log.Printf("Directory not loaded: %v", err)
+		} else {
+			log.Printf("Loaded %d people from %s", len(dir.People), cfg.DirectoryFile)
+		}
 	}
 
-	ctx := context.Background()
+	var av *clamav.Client
+	avMode, err := clamav.ParseMode(cfg.ClamAVMode)
+	if err != nil {
+		log.Printf("CLAMAV_MODE: %v; using %s", err, avMode)
+	}
+	if cfg.ClamAVAddress != "" {
+		av = clamav.New(cfg.ClamAVAddress)
+		if version, err := av.Version(); err != nil {
+			log.Printf("ClamAV not reachable, attachments will not be scanned: %v", err)
+			av = nil
+		} else {
+			log.Printf("ClamAV: %s (%s mode)", version, avMode)
+		}
+	}
+
+	ctx, stop := context.WithCancel(context.Background())
+	defer stop()
+	if len(cfg.BlocklistPaths)+len(cfg.AllowlistPaths) > 0 {
+		go store.Watch(ctx, cfg.ListsReload, func(err error) { logReload(store, err) })
+		reloadOnSignal(ctx, store)
+	}
+
+	checker := pipeline.Checker{Store: store, Directory: dir, Limits: attachment.DefaultLimits, MaxDepth: cfg.NestedMaxDepth}
+	skipped := 0
 	for _, em := range emails {
 		fmt.Println("==============================")
 		fmt.Printf("Email: %s\n", em.ID)
-		summarize(&em, cfg, llmClient, ctx)
+		if sc := summarize(&em, cfg, store, checker, llmClient, av, avMode, ctx); sc.Details.LLMSkipped != "" {
+			skipped++
+		}
+	}
+	if llmClient != nil {
+		asked := len(emails) - skipped
+		log.Printf("LLM: asked about %d of %d messages (%.0f%%)", asked, len(emails), float64(asked)/float64(len(emails))*100)
+		logLLMStats(llmClient, llmCache, llmBudget)
+	}
+}
+
+// logLLMStats reports the LLM calls and spending of the batch and saves
+// the cache and the budget.
+func logLLMStats(s llm.Scorer, cache *llm.Cache, budget *llm.Budget) {
+	st := s.Stats()
+	log.Printf("LLM: %d calls, %d failed, %d refused; %d prompt + %d completion tokens", st.Calls, st.Failures, st.Refused, st.PromptTokens, st.CompletionTokens)
+	spent := budget.Spent()
+	log.Printf("LLM budget today: %d tokens, cost %.4f", spent.PromptTokens+spent.CompletionTokens, spent.Cost)
+	if err := budget.Save(); err != nil {
+		log.Printf("LLM budget not saved: %v", err)
+	}
+	if cache == nil {
+		return
+	}
+	rate := 0.0
+	if n := st.CacheHits + st.CacheMisses; n > 0 {
+		rate = float64(st.CacheHits) / float64(n) * 100
 	}
+	log.Printf("LLM cache: %d hits, %d misses (%.0f%% hit rate), %d entries", st.CacheHits, st.CacheMisses, rate, cache.Len())
+	if err := cache.Save(); err != nil {
+		log.Printf("LLM cache not saved: %v", err)
+	}
+}
+
+// newLLM builds the client for LLM_PROVIDER, or an ensemble of the
+// models in LLM_ENSEMBLE. Without a provider, OpenAI is used when its key
+// is set and Gemini when only GEMINI_API_KEY is. On-premise servers are
+// checked up front so a missing model disables the LLM, or drops it from
+// the ensemble, instead of failing every message.
+func newLLM(cfg config.Config, cache *llm.Cache, budget *llm.Budget) (llm.Scorer, error) {
+	prompts := llm.DefaultPrompts()
+	if cfg.PromptDir != "" {
+		if p, err := llm.LoadPrompts(os.DirFS(cfg.PromptDir), cfg.PromptName); err != nil {
+			log.Printf("Using built-in prompts: %v", err)
+		} else {
+			prompts = p
+		}
+	}
+	newClient := func(name, model string) (*llm.Client, error) {
+		provider, err := newProvider(cfg, name, model)
+		if err != nil {
+			return nil, err
+		}
+		client := llm.New(provider)
+		client.Prompts, client.Cache, client.Budget = prompts, cache, budget
+		client.Limiter = llm.NewLimiter(cfg.LLMRate, cfg.LLMBurst, cfg.LLMConcurrency)
+		if cfg.LLMBreakerFails > 0 {
+			client.Breaker = llm.NewBreaker(cfg.LLMBreakerFails, cfg.LLMBreakerWait)
+		}
+		timeout := 10 * time.Second
+		if cfg.OllamaPull {
+			timeout = 30 * time.Minute // the first pull downloads gigabytes
+		}
+		ctx, cancel := context.WithTimeout(context.Background(), timeout)
+		defer cancel()
+		if err := client.Check(ctx); err != nil {
+			return nil, err
+		}
+		return client, nil
+	}
+
+	if len(cfg.LLMEnsemble) == 0 {
+		name := cfg.LLMProvider
+		if name == "" && cfg.LLMApiKey == "" && cfg.GeminiAPIKey != "" {
+			name = "gemini"
+		}
+		client, err := newClient(name, "")
+		if err != nil {
+			return nil, err
+		}
+		return client, nil
+	}
+
+	strategy, err := llm.ParseStrategy(cfg.LLMStrategy)
+	if err != nil {
+		log.Printf("LLM_ENSEMBLE_STRATEGY: %v; using %s", err, strategy)
+	}
+	ensemble := &llm.Ensemble{Strategy: strategy}
+	for _, spec := range cfg.LLMEnsemble {
+		name, model, weight, err := parseMember(spec)
+		if err == nil {
+			var client *llm.Client
+			if client, err = newClient(name, model); err == nil {
+				ensemble.Members = append(ensemble.Members, llm.Member{Client: client, Weight: weight})
+				continue
+			}
+		}
+		log.Printf("LLM_ENSEMBLE: %s left out: %v", spec, err)
+	}
+	if len(ensemble.Members) == 0 {
+		return nil, errors.New("no LLM_ENSEMBLE model is available")
+	}
+	return ensemble, nil
 }
 
-func summarize(em *email.Email, cfg config.Config, llmClient *llm.Client, ctx context.Context) {
+// parseMember reads an LLM_ENSEMBLE entry, provider[/model][=weight],
+// e.g. "ollama/qwen2.5:7b=2".
+func parseMember(spec string) (name, model string, weight float64, err error) {
+	if i := strings.LastIndex(spec, "="); i >= 0 {
+		if weight, err = strconv.ParseFloat(spec[i+1:], 64); err != nil || weight <= 0 {
+			return "", "", 0, fmt.Errorf("invalid weight %q", spec[i+1:])
+		}
+		spec = spec[:i]
+	}
+	name, model, _ = strings.Cut(spec, "/")
+	return name, model, weight, nil
+}
+
+// newProvider builds the named provider with model, or with the model
+// configured for it when model is empty.
+func newProvider(cfg config.Config, name, model string) (llm.Provider, error) {
+	pick := func(configured string) string {
+		if model != "" {
+			return model
+		}
+		return configured
+	}
+	switch name {
+	case "", "openai":
+		openai, err := llm.NewOpenAI(cfg.LLMApiKey, cfg.LLMBaseURL, pick(cfg.LLMModel))
+		if err != nil {
+			return nil, err
+		}
+		if cfg.LLMStructured != "" {
+			openai.Structured = cfg.LLMStructured
+		}
+		return openai, nil
+	case "gemini":
+		return llm.NewGemini(cfg.GeminiAPIKey, cfg.GeminiBaseURL, pick(cfg.GeminiModel))
+	case "ollama":
+		ollama := llm.NewOllama(cfg.OllamaURL, pick(cfg.OllamaModel))
+		ollama.KeepAlive, ollama.Pull = cfg.OllamaKeepAlive, cfg.OllamaPull
+		return ollama, nil
+	case "llamacpp":
+		llamacpp := llm.NewLlamaCpp(cfg.LlamaCppURL, pick(cfg.LlamaCppModel))
+		llamacpp.Grammar = cfg.LlamaCppGrammar
+		return llamacpp, nil
+	}
+	return nil, fmt.Errorf("unknown LLM provider %q", name)
+}
+
+func logReload(store *lists.Store, err error) {
+	if err != nil {
+		log.Printf("Lists reload failed, keeping previous entries: %v", err)
+		return
+	}
+	log.Printf("Lists reloaded: %d blocklist / %d allowlist entries", store.Len(lists.Block), store.Len(lists.Allow))
+}
+
+func summarize(em *email.Email, cfg config.Config, store *lists.Store, checker pipeline.Checker, llmClient llm.Scorer, av *clamav.Client, avMode clamav.Mode, ctx context.Context) recommendation.Scorecard {
 	// 1. DKIM
 	dkimResults, _ := email.CheckDKIM(em.Raw)
 
 	// 2. SPF
 	spfResult, _ := email.CheckSPF(em.Envelope, cfg.SourceIP, cfg.HELODomain)
 
-	// 3. Domain
-	domainCheck := email.CheckDomainBlocklist(em.Envelope, cfg.Blocklist)
+	// 3. Content: sender domain, impersonation, headers, attachments,
+	// calendar invites, links and prompt injection
+	content := checker.Content(em, email.SenderAuth{DKIM: dkimResults, SPF: spfResult, MailFrom: cfg.EnvelopeFrom})
+	ipCheck := email.CheckSourceIP(cfg.SourceIP, store)
 
 	// 4. SpamAssassin
 	var saResult *spamassassin.Result
@@ -60,36 +296,142 @@ func summarize(em *email.Email, cfg config.Config, llmClient *llm.Client, ctx co
 		saResult = saRes
 	}
 
-	// 5. LLM
-	var llmScore *llm.Score
-	if llmClient != nil {
+	// 5. Messages attached to this one, checked the same way
+	nested := checker.Nested(em)
+
+	// 6. Antivirus
+	var avReport *clamav.Report
+	if av != nil {
+		rep := av.ScanEmail(em, avMode)
+		for _, e := range rep.Errors {
+			log.Printf("ClamAV: %s", e)
+		}
+		avReport = &rep
+	}
+
+	input := recommendation.Input{
+		DKIM:          dkimResults,
+		SPF:           spfResult,
+		Domain:        content.Domain,
+		SpamAssassin:  saResult,
+		Adversarial:   &content.Adversarial,
+		Impersonation: &content.Impersonation,
+		Headers:       &content.Headers,
+		SourceIP:      &ipCheck,
+		Links:         &content.Links,
+		Attachments:   &content.Attachments,
+		Calendar:      &content.Calendar,
+		ClamAV:        avReport,
+		Nested:        nested,
+	}
+
+	// 7. LLM, last so that in cascade mode the other checks can tell
+	// whether it is worth asking
+	if llmClient != nil && cfg.LLMCascade {
+		cascade := recommendation.Cascade{Low: cfg.LLMCascadeLow, High: cfg.LLMCascadeHigh}
+		input.LLMSkipped = cascade.SkipLLM(recommendation.Build(input))
+	}
+	if llmClient != nil && input.LLMSkipped == "" {
 		ctx, cancel := context.WithTimeout(ctx, 20*time.Second)
 		defer cancel()
-		if score, err := llmClient.ScoreEmail(ctx, *em); err == nil {
-			llmScore = &score
+		score, err := llmClient.ScoreEmail(ctx, *em, llm.AuthResults(dkimResults, spfResult))
+		switch {
+		case err == nil:
+			input.LLM = &score
+		case errors.Is(err, llm.ErrBudgetExceeded), errors.Is(err, llm.ErrCircuitOpen):
+			// Scored without the LLM, like in cascade mode.
+			input.LLMSkipped = err.Error()
+		default:
+			input.LLMError = err
 		}
 	}
 
-	// 6. Adversarial Check
-	advResult := adversarial.Check(string(em.Raw))
-
 	// Build Scorecard
-	scorecard := recommendation.Build(dkimResults, spfResult, domainCheck, llmScore, saResult, &advResult)
+	scorecard := recommendation.Build(input)
 
 	fmt.Println("\n----- EMAIL SCORECARD -----")
 	fmt.Printf("FINAL DECISION: %s (Score: %.1f/10.0)\n", scorecard.Status, scorecard.DecisionScore)
+	if scorecard.Category != "" {
+		fmt.Printf("ACTION: %s (LLM category: %s)\n", scorecard.Action, scorecard.Category)
+	} else {
+		fmt.Printf("ACTION: %s\n", scorecard.Action)
+	}
 	fmt.Println("---------------------------")
 	fmt.Println("Detailed Breakdown:")
 	fmt.Printf(" [ ] Domain: %s\n", scorecard.Details.Domain)
 	fmt.Printf(" [ ] SPF:    %s\n", scorecard.Details.SPF)
 	fmt.Printf(" [ ] DKIM:   %s\n", scorecard.Details.DKIM)
+	if imp := scorecard.Details.Impersonation; imp != nil && len(imp.Findings) > 0 {
+		fmt.Printf(" [!] Sender: %q <%s> impersonation suspected\n", imp.DisplayName, imp.Address)
+	} else {
+		fmt.Println(" [ ] Sender: OK")
+	}
+	if h := scorecard.Details.Headers; h != nil && len(h.Findings) > 0 {
+		fmt.Printf(" [!] Headers: %d mismatch(es)\n", len(h.Findings))
+	} else {
+		fmt.Println(" [ ] Headers: consistent")
+	}
+	if a := scorecard.Details.Attachments; a != nil {
+		for _, f := range a.Attachments {
+			printAttachment(f, "")
+		}
+	}
+	if c := scorecard.Details.Calendar; c != nil {
+		for _, inv := range c.Invites {
+			printInvite(inv, len(c.Findings) > 0)
+		}
+	}
+	for _, n := range scorecard.Details.Nested {
+		mark := " "
+		if len(n.Findings) > 0 {
+			mark = "!"
+		}
+		fmt.Printf(" [%s] Attached message: %s, from %s, %q, %d finding(s)\n", mark, n.Path, orNone(n.From), n.Subject, len(n.Findings))
+	}
+	if rep := scorecard.Details.ClamAV; rep == nil {
+		fmt.Println(" [ ] AV:     N/A")
+	} else {
+		for _, d := range rep.Detections {
+			fmt.Printf(" [!] AV:     %s in %s\n", d.Virus, d.Object)
+		}
+		switch {
+		case len(rep.Errors) > 0:
+			fmt.Printf(" [!] AV:     error, %d of %d object(s) not scanned\n", len(rep.Errors), len(rep.Errors)+rep.Scanned)
+		case rep.Infected():
+		case rep.Scanned == 0:
+			fmt.Println(" [ ] AV:     nothing to scan")
+		default:
+			fmt.Printf(" [ ] AV:     clean (%d scanned)\n", rep.Scanned)
+		}
+	}
 	if scorecard.Details.SpamAssassin != nil {
 		fmt.Printf(" [ ] SA:     Score %.1f\n", scorecard.Details.SpamAssassin.Score)
 	} else {
 		fmt.Println(" [ ] SA:     N/A")
 	}
-	if scorecard.Details.LLMScore != nil {
-		fmt.Printf(" [ ] LLM:    Score %.1f\n", scorecard.Details.LLMScore.Score)
+	if llmScore := scorecard.Details.LLMScore; llmScore != nil {
+		provider := llmScore.Provider
+		if llmScore.Recovered != "" {
+			provider += ", " + llmScore.Recovered
+		}
+		provider += ", prompt " + scorecard.Details.LLMPrompt
+		if scorecard.Details.LLMCache == "hit" {
+			provider += ", cached"
+		}
+		if llmScore.Compromised != "" {
+			fmt.Printf(" [!] LLM:    Score %.1f (%s), discarded: %s\n", llmScore.Score, provider, llmScore.Compromised)
+		} else {
+			fmt.Printf(" [ ] LLM:    Score %.1f (%s)\n", llmScore.Score, provider)
+		}
+		printVotes(scorecard.Details.LLMVotes, scorecard.Details.LLMDisagree)
+		printCues(*llmScore)
+	} else if scorecard.Details.LLMSkipped != "" {
+		fmt.Printf(" [ ] LLM:    skipped (%s)\n", scorecard.Details.LLMSkipped)
+	} else if scorecard.Details.LLMError != "" {
+		fmt.Printf(" [!] LLM:    N/A (%s)\n", scorecard.Details.LLMError)
+		if scorecard.Details.LLMPrompt != "" {
+			fmt.Printf("     prompt %s\n", scorecard.Details.LLMPrompt)
+		}
 	} else {
 		fmt.Println(" [ ] LLM:    N/A")
 	}
@@ -104,10 +446,15 @@ func summarize(em *email.Email, cfg config.Config, llmClient *llm.Client, ctx co
 
 	// ACTION: Move file
 	targetDir := cfg.CleanDir
-	if scorecard.Status == "SPAM" {
+	switch scorecard.Action {
+	case recommendation.ActionIsolate:
+		targetDir = cfg.MalwareDir
+	case recommendation.ActionJunk:
 		targetDir = cfg.SpamDir
-	} else if scorecard.Status == "QUARANTINE" {
+	case recommendation.ActionQuarantine, recommendation.ActionReport, recommendation.ActionVerify:
 		targetDir = cfg.QuarantineDir
+	case recommendation.ActionBulk:
+		targetDir = cfg.BulkDir
 	}
 
 	if err := moveEmail(em.Path, targetDir); err != nil {
@@ -115,6 +462,118 @@ func summarize(em *email.Email, cfg config.Config, llmClient *llm.Client, ctx co
 	} else {
 		fmt.Printf("Moved to: %s\n", targetDir)
 	}
+	return scorecard
+}
+
+// printVotes prints the verdict of each model of an ensemble.
+func printVotes(votes []llm.Vote, disagreement float64) {
+	if len(votes) == 0 {
+		return
+	}
+	fmt.Printf("     ensemble disagreement: %.0f%%\n", disagreement*100)
+	for _, v := range votes {
+		switch {
+		case v.Error != "":
+			fmt.Printf("     - %s (x%g): N/A (%s)\n", v.Provider, v.Weight, v.Error)
+		case v.Compromised != "":
+			fmt.Printf("     - %s (x%g): discarded: %s\n", v.Provider, v.Weight, v.Compromised)
+		default:
+			verdict := "clean"
+			if v.Spam {
+				verdict = "spam"
+			}
+			fmt.Printf("     - %s (x%g): %s %.2f %s\n", v.Provider, v.Weight, verdict, v.Score, v.Category)
+		}
+	}
+}
+
+// printCues prints the cues and indicators the LLM extracted.
+func printCues(s llm.Score) {
+	if len(s.Urgency) > 0 {
+		fmt.Printf("     urgency: %q\n", s.Urgency)
+	}
+	if len(s.Impersonation) > 0 {
+		fmt.Printf("     impersonation: %q\n", s.Impersonation)
+	}
+	ind := s.Indicators
+	if ind.Organization != "" {
+		fmt.Printf("     claims to be: %s\n", ind.Organization)
+	}
+	for _, list := range []struct {
+		name  string
+		items []string
+	}{{"URL", ind.URLs}, {"phone", ind.Phones}, {"IBAN", ind.IBANs}} {
+		for _, it := range list.items {
+			fmt.Printf("     IOC %s: %s\n", list.name, it)
+		}
+	}
+}
+
+// printAttachment prints one attachment and, indented, the members of an archive.
+func printAttachment(a attachment.Attachment, indent string) {
+	mark := " "
+	if len(a.Findings) > 0 {
+		mark = "!"
+	}
+	name := fmt.Sprintf("%q", a.Filename)
+	if a.Filename == "" {
+		name = "(unnamed)"
+	}
+	if indent == "" {
+		fmt.Printf(" [%s] Attachment: %s %s, detected %s, %d bytes\n", mark, name, a.ContentType, orNone(a.DetectedType), a.Size)
+	} else {
+		fmt.Printf(" [%s] %s%s detected %s, %d bytes\n", mark, indent, name, orNone(a.DetectedType), a.Size)
+	}
+	if a.Hashes.SHA256 != "" {
+		fmt.Printf("     %s  sha256 %s\n", indent, a.Hashes.SHA256)
+	}
+	if a.KnownGood != nil {
+		fmt.Printf("     %s  known good: %s\n", indent, a.KnownGood.Describe())
+	}
+	for _, code := range a.QRCodes {
+		fmt.Printf("     %s  QR code %q\n", indent, code)
+	}
+	for _, u := range a.URLs {
+		fmt.Printf("     %s  link %s\n", indent, u)
+	}
+	if arc := a.Archive; arc != nil {
+		if arc.Encrypted {
+			state := "not opened"
+			if arc.Password != "" {
+				state = fmt.Sprintf("opened with %q from the body", arc.Password)
+			}
+			fmt.Printf("     %s  encrypted %s archive, %s\n", indent, arc.Format, state)
+		}
+		for _, m := range arc.Members {
+			printAttachment(m, indent+"  ")
+		}
+	}
+}
+
+// printInvite prints a calendar invite with its organizer and links.
+func printInvite(inv email.Invite, flagged bool) {
+	mark := " "
+	if flagged {
+		mark = "!"
+	}
+	organizer := "none"
+	if inv.Organizer != nil {
+		organizer = inv.Organizer.String()
+	}
+	fmt.Printf(" [%s] Invite: %q, organizer %s, %d attendee(s)\n", mark, inv.Summary, organizer, len(inv.Attendees))
+	if inv.Location != "" {
+		fmt.Printf("       location %s\n", inv.Location)
+	}
+	for _, u := range inv.URLs {
+		fmt.Printf("       link %s\n", u)
+	}
+}
+
+func orNone(s string) string {
+	if s == "" {
+		return "none"
+	}
+	return s
 }
 
 func moveEmail(srcPath, destDir string) error {
@@ -0,0 +1,29 @@
+//go:build !windows
+
+package main
+
+import (
+	"context"
+	"os"
+	"os/signal"
+	"syscall"
+
+	"spamfilter/internal/lists"
+)
+
+// reloadOnSignal reloads the block/allow lists whenever the process receives SIGHUP.
+func reloadOnSignal(ctx context.Context, store *lists.Store) {
+	sig := make(chan os.Signal, 1)
+	signal.Notify(sig, syscall.SIGHUP)
+	go func() {
+		defer signal.Stop(sig)
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-sig:
+				logReload(store, store.Reload())
+			}
+		}
+	}()
+}
@@ -0,0 +1,13 @@
+//go:build windows
+
+package main
+
+import (
+	"context"
+
+	"spamfilter/internal/lists"
+)
+
+// reloadOnSignal is a no-op on Windows, which has no SIGHUP; the lists are
+// still reloaded by the file watcher.
+func reloadOnSignal(ctx context.Context, store *lists.Store) {}
@@ -16,7 +16,7 @@ hostnamectl set-hostname $HOSTNAME
 
 echo "Installing Dependencies..."
 apt-get update
-apt-get install -y postfix spamassassin spamc
+apt-get install -y postfix spamassassin spamc clamav-daemon clamav-freshclam
 
 echo "Configuring Network (Forwarding)..."
 # Enable IP Forwarding if needed for transparent proxy, but for SMTP relay typical setup is enough.
@@ -41,6 +41,9 @@ cp ./deployment/spamassassin/local.cf /etc/spamassassin/local.cf
 echo "Enabling Services..."
 systemctl enable spamassassin
 systemctl start spamassassin
+systemctl enable clamav-freshclam clamav-daemon
+systemctl start clamav-freshclam clamav-daemon
+# antispam: CLAMAV_ADDRESS=unix:///run/clamav/clamd.ctl
 systemctl enable postfix
 systemctl restart postfix
 
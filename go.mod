@@ -6,6 +6,8 @@ require (
 	github.com/emersion/go-msgauth v0.6.3
 	github.com/jhillyerd/enmime v0.11.0
 	github.com/sashabaranov/go-openai v1.22.0
+	golang.org/x/net v0.48.0
+	golang.org/x/text v0.32.0
 )
 
 require (
@@ -19,6 +21,4 @@ require (
 	github.com/ssor/bom v0.0.0-20170718123548-6386211fdfcf // indirect
 	github.com/stretchr/testify v1.11.1 // indirect
 	golang.org/x/crypto v0.46.0 // indirect
-	golang.org/x/net v0.48.0 // indirect
-	golang.org/x/text v0.32.0 // indirect
 )
@@ -0,0 +1,307 @@
+package attachment
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bytes"
+	"compress/gzip"
+	"errors"
+	"fmt"
+	"io"
+	"path"
+	"regexp"
+	"strings"
+
+	"spamfilter/internal/email"
+	"spamfilter/internal/lists"
+)
+
+// Limits bound the work spent unpacking archives, so a crafted archive
+// (zip bomb, deep nesting, thousands of members) cannot stall the filter.
+// They apply to a whole message.
+type Limits struct {
+	MaxDepth int   // nesting depth of archives inside archives
+	MaxFiles int   // archive members inspected
+	MaxSize  int64 // bytes unpacked in total
+}
+
+var DefaultLimits = Limits{MaxDepth: 3, MaxFiles: 200, MaxSize: 32 << 20}
+
+// Archive describes the contents of an archive attachment.
+type Archive struct {
+	Format    string // zip, tar or gzip
+	Members   []Attachment
+	Encrypted bool
+	Password  string // password from the message body that opened it
+	Truncated string // the limit that stopped inspection, if any
+	Error     string
+}
+
+var errTooLarge = errors.New("size limit reached")
+
+// Budget is what has been spent of the limits on inspecting attachments.
+// Inspect calls sharing one Budget, such as those for the messages attached
+// to a message, stay within the limits together. The zero value is unspent.
+type Budget struct {
+	attempts int   // decryption attempts made so far
+	qrPixels int64 // image area searched for QR codes so far
+	files    int
+	size     int64
+}
+
+// inspector carries the limits and the budget left while walking the
+// attachments of one message.
+type inspector struct {
+	*Budget
+	limits    Limits
+	hashes    *lists.Store
+	passwords []string
+	hinted    bool // the body talks about a password
+}
+
+// archiveFormat decides whether content should be unpacked. Office Open
+// XML and Java packages are zip files but are not opened as archives.
+func archiveFormat(detected, ext string) string {
+	switch detected {
+	case TypeZip:
+		if ext == "zip" || extFamily(ext) != TypeZip && !executableExts[ext] {
+			return "zip"
+		}
+	case TypeTar:
+		return "tar"
+	case TypeGzip:
+		return "gzip"
+	}
+	return ""
+}
+
+func (in *inspector) archive(label, format string, data []byte, depth int) (*Archive, []email.Finding) {
+	arc := &Archive{Format: format}
+	if depth > in.limits.MaxDepth {
+		arc.Truncated = "depth"
+	} else {
+		switch format {
+		case "zip":
+			in.zip(arc, label, data, depth)
+		case "tar":
+			in.tar(arc, label, data, depth)
+		case "gzip":
+			in.gzip(arc, label, data, depth)
+		}
+	}
+
+	var findings []email.Finding
+	finding := func(check string, weight float64, format string, args ...any) {
+		findings = append(findings, email.Finding{Check: check, Weight: weight, Reason: label + ": " + fmt.Sprintf(format, args...)})
+	}
+	if arc.Encrypted {
+		if arc.Password != "" {
+			finding("archive-encrypted", 2.0, "encrypted %s archive", format)
+			finding("archive-password-in-body", 3.0, "archive opens with %q, given in the message itself", arc.Password)
+		} else {
+			finding("archive-encrypted", 2.0, "encrypted %s archive; its contents cannot be scanned", format)
+			if in.hinted {
+				finding("archive-password-in-body", 2.0, "message body supplies a password for the encrypted archive")
+			}
+		}
+	}
+	if arc.Truncated != "" {
+		finding("archive-limit", 1.0, "archive exceeds the %s limit; the rest was not inspected", arc.Truncated)
+	}
+	for _, m := range arc.Members {
+		findings = append(findings, m.Findings...)
+	}
+	return arc, findings
+}
+
+// take reserves one member from the file budget.
+func (in *inspector) take(arc *Archive) bool {
+	if in.files >= in.limits.MaxFiles {
+		arc.Truncated = "file count"
+		return false
+	}
+	in.files++
+	return true
+}
+
+// read reads r within the remaining size budget.
+func (in *inspector) read(arc *Archive, r io.Reader) []byte {
+	remaining := in.limits.MaxSize - in.size
+	data, err := io.ReadAll(io.LimitReader(r, remaining+1))
+	if int64(len(data)) > remaining {
+		arc.Truncated = "size"
+		in.size = in.limits.MaxSize
+		return nil
+	}
+	in.size += int64(len(data))
+	if err != nil && arc.Error == "" {
+		arc.Error = err.Error()
+	}
+	return data
+}
+
+func (in *inspector) member(arc *Archive, label, name string, data []byte, depth int) {
+	m := in.file(label+"/"+name, name, "", data, depth)
+	arc.Members = append(arc.Members, m)
+}
+
+func (in *inspector) zip(arc *Archive, label string, data []byte, depth int) {
+	zr, err := zip.NewReader(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		arc.Error = err.Error()
+		return
+	}
+	for _, f := range zr.File {
+		if f.FileInfo().IsDir() {
+			continue
+		}
+		if arc.Truncated != "" || !in.take(arc) {
+			return
+		}
+		var content []byte
+		if f.Flags&0x1 != 0 {
+			arc.Encrypted = true
+			content = in.decrypt(arc, f)
+		} else if rc, err := f.Open(); err == nil {
+			content = in.read(arc, rc)
+			rc.Close()
+		}
+		in.member(arc, label, f.Name, content, depth)
+	}
+}
+
+// decrypt tries the passwords found in the message body on an encrypted
+// member; the one that worked is tried first on the next member. Attempts
+// are bounded per message, AES members, whose key derivation is slow, get
+// only the first few candidates, and once a member rejects every candidate
+// the rest of the message's members are not tried.
+func (in *inspector) decrypt(arc *Archive, f *zip.File) []byte {
+	if len(in.passwords) == 0 || in.attempts >= maxPasswordAttempts {
+		return nil
+	}
+	rr, err := f.OpenRaw()
+	if err != nil {
+		return nil
+	}
+	raw := in.read(arc, rr)
+	if raw == nil {
+		return nil
+	}
+	candidates := in.passwords
+	if f.Method == 99 && len(candidates) > maxAESCandidates {
+		candidates = candidates[:maxAESCandidates]
+	}
+	for i, pw := range candidates {
+		if in.attempts >= maxPasswordAttempts {
+			return nil
+		}
+		in.attempts++
+		var data []byte
+		if f.Method == 99 {
+			data, err = decryptAES(f, raw, pw, in.limits.MaxSize-in.size)
+		} else {
+			data, err = decryptZipCrypto(f, raw, pw, in.limits.MaxSize-in.size)
+		}
+		switch {
+		case err == nil:
+			arc.Password = pw
+			in.passwords[0], in.passwords[i] = in.passwords[i], in.passwords[0]
+			in.size += int64(len(data))
+			return data
+		case errors.Is(err, errTooLarge):
+			arc.Password = pw
+			arc.Truncated = "size"
+			return nil
+		case errors.Is(err, zip.ErrAlgorithm):
+			return nil
+		}
+	}
+	in.passwords = nil
+	return nil
+}
+
+func (in *inspector) tar(arc *Archive, label string, data []byte, depth int) {
+	tr := tar.NewReader(bytes.NewReader(data))
+	for {
+		h, err := tr.Next()
+		if err != nil {
+			if err != io.EOF {
+				arc.Error = err.Error()
+			}
+			return
+		}
+		if h.Typeflag != tar.TypeReg {
+			continue
+		}
+		if arc.Truncated != "" || !in.take(arc) {
+			return
+		}
+		in.member(arc, label, h.Name, in.read(arc, tr), depth)
+	}
+}
+
+func (in *inspector) gzip(arc *Archive, label string, data []byte, depth int) {
+	zr, err := gzip.NewReader(bytes.NewReader(data))
+	if err != nil {
+		arc.Error = err.Error()
+		return
+	}
+	defer zr.Close()
+	name := zr.Name
+	if name == "" {
+		base := path.Base(label)
+		switch ext := strings.ToLower(path.Ext(base)); ext {
+		case ".tgz":
+			name = strings.TrimSuffix(base, path.Ext(base)) + ".tar"
+		case ".gz":
+			name = strings.TrimSuffix(base, path.Ext(base))
+		default:
+			name = base
+		}
+	}
+	if !in.take(arc) {
+		return
+	}
+	in.member(arc, label, name, in.read(arc, zr), depth)
+}
+
+var (
+	passwordHint  = regexp.MustCompile(`(?i)\b(password|passwd|pwd|pass|parol[aăe]|parola|kennwort|contrase[nñ]a|mot de passe|senha)\b`)
+	passwordAfter = regexp.MustCompile(`(?i)\b(?:password|passwd|pwd|pass|parol[aăe]|kennwort|contrase[nñ]a|mot de passe|senha)\b[^\n:=]{0,40}?(?:[:=]|\bis\b|\beste\b|\bes\b|\best\b)\s*["'“«]?([^\s"'”»<]{3,64})`)
+	wordRe        = regexp.MustCompile(`[^\s"'“”«»<>()\[\]]{3,32}`)
+)
+
+const (
+	// maxPasswordCandidates bounds the body words kept as candidates.
+	maxPasswordCandidates = 200
+	// maxPasswordAttempts bounds the decryption attempts per Budget.
+	maxPasswordAttempts = 50
+	// maxAESCandidates bounds the candidates tried on an AES member; the
+	// values given after "password:" and the like come first.
+	maxAESCandidates = 5
+)
+
+// passwordCandidates lists the strings of text that may open an encrypted
+// archive: values after "password:" and the like first, then every other
+// word, since "the password is in the body" does not always say so.
+func passwordCandidates(text string) (candidates []string, hinted bool) {
+	seen := map[string]bool{}
+	add := func(s string) {
+		if len(s) >= 3 && !seen[s] && len(candidates) < maxPasswordCandidates {
+			seen[s] = true
+			candidates = append(candidates, s)
+		}
+	}
+	// Trailing punctuation is usually the sentence's, but may be the password's.
+	both := func(s string) {
+		add(strings.TrimRight(s, ".,;:!?"))
+		add(s)
+	}
+	for _, m := range passwordAfter.FindAllStringSubmatch(text, -1) {
+		both(m[1])
+	}
+	for _, w := range wordRe.FindAllString(text, -1) {
+		both(w)
+	}
+	return candidates, passwordHint.MatchString(text)
+}
@@ -0,0 +1,267 @@
+package attachment
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bytes"
+	"compress/gzip"
+	"crypto/aes"
+	"crypto/hmac"
+	"crypto/pbkdf2"
+	"crypto/sha1"
+	"encoding/binary"
+	"fmt"
+	"hash/crc32"
+	"strings"
+	"testing"
+
+	"spamfilter/internal/email"
+
+	"github.com/jhillyerd/enmime"
+)
+
+type zipMember struct {
+	name     string
+	data     []byte
+	password string // encrypt with ZipCrypto
+	aes      string // encrypt with WinZip AES-256
+}
+
+func makeZip(t *testing.T, members ...zipMember) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	zw := zip.NewWriter(&buf)
+	for _, m := range members {
+		switch {
+		case m.password != "":
+			crc := crc32.ChecksumIEEE(m.data)
+			header := []byte("0123456789a\x00")
+			header[11] = byte(crc >> 24)
+			plain := append(header, m.data...)
+			z := newZipCrypto(m.password)
+			enc := make([]byte, len(plain))
+			for i, p := range plain {
+				t := uint16(z.k2 | 2)
+				enc[i] = p ^ byte((uint32(t)*uint32(t^1))>>8)
+				z.update(p)
+			}
+			writeRaw(t, zw, &zip.FileHeader{Name: m.name, Method: zip.Store, Flags: 0x1, CRC32: crc,
+				CompressedSize64: uint64(len(enc)), UncompressedSize64: uint64(len(m.data))}, enc)
+		case m.aes != "":
+			salt := []byte("0123456789abcdef")
+			key, _ := pbkdf2.Key(sha1.New, m.aes, salt, 1000, 66)
+			block, _ := aes.NewCipher(key[:32])
+			enc := make([]byte, len(m.data))
+			var counter, stream [16]byte
+			for i := 0; i < len(enc); i += 16 {
+				binary.LittleEndian.PutUint64(counter[:], uint64(i/16+1))
+				block.Encrypt(stream[:], counter[:])
+				for j := i; j < min(i+16, len(enc)); j++ {
+					enc[j] = m.data[j] ^ stream[j-i]
+				}
+			}
+			h := hmac.New(sha1.New, key[32:64])
+			h.Write(enc)
+			raw := append(append(append(append([]byte{}, salt...), key[64:]...), enc...), h.Sum(nil)[:10]...)
+			extra := []byte{0x01, 0x99, 7, 0, 2, 0, 'A', 'E', 3, 0, 0}
+			writeRaw(t, zw, &zip.FileHeader{Name: m.name, Method: 99, Flags: 0x1, Extra: extra,
+				CompressedSize64: uint64(len(raw)), UncompressedSize64: uint64(len(m.data))}, raw)
+		default:
+			w, err := zw.Create(m.name)
+			if err != nil {
+				t.Fatal(err)
+			}
+			w.Write(m.data)
+		}
+	}
+	if err := zw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func writeRaw(t *testing.T, zw *zip.Writer, fh *zip.FileHeader, data []byte) {
+	t.Helper()
+	w, err := zw.CreateRaw(fh)
+	if err != nil {
+		t.Fatal(err)
+	}
+	w.Write(data)
+}
+
+func makeTarGz(t *testing.T, name string, data []byte) []byte {
+	var tarBuf bytes.Buffer
+	tw := tar.NewWriter(&tarBuf)
+	tw.WriteHeader(&tar.Header{Name: name, Mode: 0o644, Size: int64(len(data)), Typeflag: tar.TypeReg})
+	tw.Write(data)
+	tw.Close()
+	var gzBuf bytes.Buffer
+	gw := gzip.NewWriter(&gzBuf)
+	gw.Write(tarBuf.Bytes())
+	gw.Close()
+	return gzBuf.Bytes()
+}
+
+func inspectMessage(t *testing.T, body, name string, data []byte, limits Limits) Report {
+	t.Helper()
+	raw := "From: a@example.com\r\nSubject: documente\r\nMIME-Version: 1.0\r\n" +
+		"Content-Type: multipart/mixed; boundary=b\r\n\r\n" +
+		"--b\r\nContent-Type: text/plain\r\n\r\n" + body + "\r\n" +
+		part(name, "application/zip", data) + "--b--\r\n"
+	env, err := enmime.ReadEnvelope(strings.NewReader(raw))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return InspectWith(env, limits)
+}
+
+func checkSet(findings []email.Finding) map[string]bool {
+	got := map[string]bool{}
+	for _, f := range findings {
+		got[f.Check] = true
+	}
+	return got
+}
+
+func TestArchiveMembers(t *testing.T) {
+	data := makeZip(t,
+		zipMember{name: "scan.pdf", data: pdf},
+		zipMember{name: "acte/factura.pdf.exe", data: pe},
+	)
+	rep := inspectMessage(t, "Vedeti atasamentul.", "acte.zip", data, DefaultLimits)
+	a := rep.Attachments[0]
+	if a.Archive == nil || len(a.Archive.Members) != 2 {
+		t.Fatalf("expected 2 archive members, got %+v", a.Archive)
+	}
+	got := checkSet(rep.Findings)
+	if !got["attachment-double-extension"] || !got["attachment-executable"] {
+		t.Errorf("member findings missing: %v", rep.Findings)
+	}
+	for _, f := range rep.Findings {
+		if !strings.HasPrefix(f.Reason, "acte.zip/acte/factura.pdf.exe: ") {
+			t.Errorf("finding should carry the member path: %q", f.Reason)
+		}
+	}
+}
+
+func TestArchiveTarGz(t *testing.T) {
+	data := makeTarGz(t, "run.vbs", []byte("WScript.Echo 1"))
+	a := InspectFile("update.tar.gz", "application/gzip", data)
+	if a.Archive == nil || a.Archive.Members[0].Archive == nil {
+		t.Fatalf("expected gzip wrapping a tar archive, got %+v", a.Archive)
+	}
+	if !checkSet(a.Findings)["attachment-script"] {
+		t.Errorf("script inside tar.gz not flagged: %v", a.Findings)
+	}
+}
+
+func TestArchiveLimits(t *testing.T) {
+	inner := makeZip(t, zipMember{name: "a.txt", data: []byte("hello")})
+	nested := makeZip(t, zipMember{name: "inner.zip", data: makeZip(t, zipMember{name: "inner.zip", data: inner})})
+	bomb := makeZip(t, zipMember{name: "zeros.bin", data: make([]byte, 1<<20)})
+	many := make([]zipMember, 10)
+	for i := range many {
+		many[i] = zipMember{name: strings.Repeat("x", i+1) + ".txt", data: []byte("x")}
+	}
+
+	cases := []struct {
+		name   string
+		data   []byte
+		limits Limits
+		want   string
+	}{
+		{"depth", nested, Limits{MaxDepth: 1, MaxFiles: 100, MaxSize: 1 << 20}, "depth"},
+		{"size", bomb, Limits{MaxDepth: 3, MaxFiles: 100, MaxSize: 4096}, "size"},
+		{"count", makeZip(t, many...), Limits{MaxDepth: 3, MaxFiles: 5, MaxSize: 1 << 20}, "file count"},
+	}
+	for _, tc := range cases {
+		rep := inspectMessage(t, "", tc.name+".zip", tc.data, tc.limits)
+		if !checkSet(rep.Findings)["archive-limit"] {
+			t.Errorf("%s: expected archive-limit finding, got %v", tc.name, rep.Findings)
+		}
+		if !strings.Contains(strings.Join(reasons(rep.Findings), "\n"), "the "+tc.want+" limit") {
+			t.Errorf("%s: limit not named: %v", tc.name, rep.Findings)
+		}
+	}
+}
+
+func TestEncryptedArchivePasswordInBody(t *testing.T) {
+	for _, enc := range []string{"zipcrypto", "aes"} {
+		m := zipMember{name: "factura.pdf.exe", data: pe}
+		if enc == "aes" {
+			m.aes = "Plata-2026!"
+		} else {
+			m.password = "Plata-2026!"
+		}
+		data := makeZip(t, m)
+
+		rep := inspectMessage(t, "Buna ziua,\r\nFactura este atasata. Parola arhivei este: Plata-2026!\r\nMultumim", "factura.zip", data, DefaultLimits)
+		a := rep.Attachments[0]
+		if !a.Archive.Encrypted || a.Archive.Password != "Plata-2026!" {
+			t.Errorf("%s: expected archive opened with the body password, got %+v", enc, a.Archive)
+		}
+		got := checkSet(rep.Findings)
+		for _, want := range []string{"archive-encrypted", "archive-password-in-body", "attachment-executable"} {
+			if !got[want] {
+				t.Errorf("%s: missing %s in %v", enc, want, rep.Findings)
+			}
+		}
+		if a.Archive.Members[0].DetectedType != TypeExecutable {
+			t.Errorf("%s: decrypted member not sniffed: %+v", enc, a.Archive.Members[0])
+		}
+
+		// The password sent separately: only the encryption is reported.
+		rep = inspectMessage(t, "Va trimit arhiva.", "factura.zip", data, DefaultLimits)
+		got = checkSet(rep.Findings)
+		if !got["archive-encrypted"] || got["archive-password-in-body"] {
+			t.Errorf("%s without password: unexpected findings %v", enc, rep.Findings)
+		}
+	}
+}
+
+func TestEncryptedArchiveAttempts(t *testing.T) {
+	var words []string
+	for i := 0; i < maxPasswordCandidates; i++ {
+		words = append(words, fmt.Sprintf("word%03d", i))
+	}
+	body := strings.Join(words, " ")
+	for _, enc := range []string{"zipcrypto", "aes"} {
+		members := make([]zipMember, 5)
+		for i := range members {
+			members[i] = zipMember{name: fmt.Sprintf("f%d.exe", i), data: pe}
+			if enc == "aes" {
+				members[i].aes = "not-in-the-body"
+			} else {
+				members[i].password = "not-in-the-body"
+			}
+		}
+		in := &inspector{Budget: &Budget{}, limits: DefaultLimits}
+		in.passwords, in.hinted = passwordCandidates(body)
+		arc, _ := in.archive("x.zip", "zip", makeZip(t, members...), 1)
+		if !arc.Encrypted || arc.Password != "" {
+			t.Fatalf("%s: %+v", enc, arc)
+		}
+		want := maxPasswordAttempts
+		if enc == "aes" {
+			want = maxAESCandidates
+		}
+		if in.attempts != want {
+			t.Errorf("%s: %d attempts, want %d", enc, in.attempts, want)
+		}
+	}
+}
+
+func TestPasswordCandidates(t *testing.T) {
+	cands, hinted := passwordCandidates("Your invoice is attached.\nThe password is: 4471, thanks")
+	if !hinted || len(cands) == 0 || cands[0] != "4471" {
+		t.Errorf("expected 4471 first, got %v (hinted %v)", cands, hinted)
+	}
+}
+
+func reasons(findings []email.Finding) []string {
+	var out []string
+	for _, f := range findings {
+		out = append(out, f.Reason)
+	}
+	return out
+}
@@ -0,0 +1,436 @@
+// Package attachment inspects the files attached to a message: dangerous
+// extensions, disguised names and content that does not match what the
+// message claims it is.
+package attachment
+
+import (
+	"crypto/md5"
+	"crypto/sha1"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"html"
+	"image"
+	"mime"
+	"path"
+	"regexp"
+	"strings"
+	"unicode/utf8"
+
+	"spamfilter/internal/email"
+	"spamfilter/internal/lists"
+
+	"github.com/jhillyerd/enmime"
+)
+
+// Attachment summarizes one inspected file.
+type Attachment struct {
+	Filename     string
+	ContentType  string // as declared in the message
+	DetectedType string // from the content's magic bytes, see Sniff
+	Size         int
+	Inline       bool
+	Hashes       Hashes
+	KnownGood    *lists.Entry // allowlist entry of the file's SHA-256; its own findings are dropped
+	URLs         []string     // links in an HTML page, a PDF or a QR code
+	QRCodes      []string     // contents of the QR codes in an image or PDF
+	Archive      *Archive     // set when the file is an archive that was opened
+	Findings     []email.Finding
+}
+
+// Hashes are the hex digests of a file's content, kept for hunting even
+// when nothing matched.
+type Hashes struct {
+	MD5, SHA1, SHA256 string
+}
+
+func hashContent(data []byte) Hashes {
+	m, s1, s256 := md5.Sum(data), sha1.Sum(data), sha256.Sum256(data)
+	return Hashes{MD5: hex.EncodeToString(m[:]), SHA1: hex.EncodeToString(s1[:]), SHA256: hex.EncodeToString(s256[:])}
+}
+
+// Report is the outcome of inspecting every attachment of a message.
+// Findings holds the findings of all attachments, each naming its file;
+// URLs the links found in all of them, archive members included.
+type Report struct {
+	Attachments []Attachment
+	Findings    []email.Finding
+	URLs        []string
+}
+
+// Inspector holds the settings for inspecting attachments.
+type Inspector struct {
+	Limits Limits
+	// Hashes, when set, is searched for the digests of every attachment
+	// and archive member: blocklisted hashes are reported, allowlisted
+	// ones mark the file as known good.
+	Hashes *lists.Store
+	// Budget, when set, is spent instead of a fresh one, so that the
+	// limits hold across several messages.
+	Budget *Budget
+}
+
+// Inspect examines the attachments, inline parts and other named parts of
+// env, unpacking archives within DefaultLimits.
+func Inspect(env *enmime.Envelope) Report {
+	return InspectWith(env, DefaultLimits)
+}
+
+// InspectWith is Inspect with custom archive limits.
+func InspectWith(env *enmime.Envelope, limits Limits) Report {
+	return Inspector{Limits: limits}.Inspect(env)
+}
+
+// Inspect examines the attachments of env like the package-level Inspect.
+func (x Inspector) Inspect(env *enmime.Envelope) Report {
+	var rep Report
+	if env == nil {
+		return rep
+	}
+	budget := x.Budget
+	if budget == nil {
+		budget = &Budget{}
+	}
+	in := &inspector{Budget: budget, limits: x.Limits, hashes: x.Hashes}
+	in.passwords, in.hinted = passwordCandidates(bodyText(env))
+	var urls linkSet
+	var qrLabel, qrLink string
+	var collect func(label string, a Attachment)
+	collect = func(label string, a Attachment) {
+		urls.addAll(a.URLs)
+		for _, code := range a.QRCodes {
+			if u := linkPattern.FindString(code); u != "" && qrLink == "" {
+				qrLabel, qrLink = label, u
+			}
+		}
+		if a.Archive != nil {
+			for _, m := range a.Archive.Members {
+				collect(label+"/"+m.Filename, m)
+			}
+		}
+	}
+	inspect := func(label, name, contentType string, data []byte, inline bool) {
+		a := in.file(label, name, contentType, data, 0)
+		a.Inline = inline
+		rep.Attachments = append(rep.Attachments, a)
+		rep.Findings = append(rep.Findings, a.Findings...)
+		if label == "" {
+			label = "(unnamed " + a.ContentType + ")"
+		}
+		collect(label, a)
+	}
+
+	// Unnamed inline parts are skipped unless they are images, which may be
+	// referenced from the HTML body by Content-ID.
+	add := func(parts []*enmime.Part, inline bool) {
+		for _, p := range parts {
+			label := p.FileName
+			if label == "" {
+				image := strings.HasPrefix(strings.ToLower(p.ContentType), "image/")
+				if inline && !image {
+					continue
+				}
+				if image && p.ContentID != "" {
+					label = "cid:" + p.ContentID
+				}
+			}
+			inspect(label, p.FileName, p.ContentType, p.Content, inline)
+		}
+	}
+	add(env.Attachments, false)
+	add(env.Inlines, true)
+	add(env.OtherParts, false)
+	for i, img := range bodyImages(env.HTML) {
+		inspect(fmt.Sprintf("(body image %d)", i+1), "", img.contentType, img.data, true)
+	}
+	rep.URLs = urls.list
+
+	if qrLink != "" {
+		if reason := qrCallToAction(env); reason != "" {
+			rep.Findings = append(rep.Findings, email.Finding{
+				Check:  "qr-call-to-action",
+				Weight: 3.0,
+				Reason: fmt.Sprintf("%s: QR code linking to %s is the message's call to action; %s", qrLabel, qrLink, reason),
+			})
+		}
+	}
+	return rep
+}
+
+var (
+	bodyImage = regexp.MustCompile(`(?i)src\s*=\s*["']?data:(image/(?:png|jpeg|jpg|gif));base64,([A-Za-z0-9+/=\s]+)`)
+	scanAsk   = regexp.MustCompile(`(?i)\b(scan\w*|qr)\b`)
+)
+
+// maxBodyImages bounds the data: URI images taken from the HTML body.
+const maxBodyImages = 10
+
+type inlineImage struct {
+	contentType string
+	data        []byte
+}
+
+// bodyImages decodes the images embedded in the HTML body as data: URIs.
+func bodyImages(htmlBody string) []inlineImage {
+	var out []inlineImage
+	for _, m := range bodyImage.FindAllStringSubmatch(htmlBody, maxBodyImages) {
+		data, err := base64.StdEncoding.DecodeString(strings.Join(strings.Fields(m[2]), ""))
+		if err == nil && len(data) > 0 {
+			out = append(out, inlineImage{strings.ToLower(m[1]), data})
+		}
+	}
+	return out
+}
+
+// maxCTAWords is the body length under which a message counts as
+// image-only.
+const maxCTAWords = 50
+
+// qrCallToAction explains why a QR code stands in for the message's link,
+// or returns "" when the body carries its own links. QR codes keep the
+// destination out of reach of URL filters and on the user's phone.
+func qrCallToAction(env *enmime.Envelope) string {
+	if len(email.ExtractURLs(env)) > 0 {
+		return ""
+	}
+	text := messageText(env)
+	words := len(strings.Fields(text))
+	switch {
+	case words <= maxCTAWords:
+		return fmt.Sprintf("the body has no links and only %d words", words)
+	case scanAsk.MatchString(text):
+		return "the body has no links and asks the reader to scan the code"
+	}
+	return ""
+}
+
+// InspectFile applies the attachment rules to a single file.
+func InspectFile(name, contentType string, data []byte) Attachment {
+	in := &inspector{Budget: &Budget{}, limits: DefaultLimits}
+	return in.file(name, name, contentType, data, 0)
+}
+
+// file inspects one attachment or archive member; label is the path shown
+// in findings ("invoice.zip/invoice.pdf.exe").
+func (in *inspector) file(label, name, contentType string, data []byte, depth int) Attachment {
+	a := Attachment{
+		Filename:     name,
+		ContentType:  strings.ToLower(contentType),
+		DetectedType: Sniff(data),
+		Size:         len(data),
+	}
+	if len(data) > 0 {
+		a.Hashes = hashContent(data)
+	}
+	if mt, _, err := mime.ParseMediaType(contentType); err == nil {
+		a.ContentType = mt
+	}
+	if label == "" {
+		label = "(unnamed " + a.ContentType + ")"
+	}
+	finding := func(check string, weight float64, format string, args ...any) {
+		a.Findings = append(a.Findings, email.Finding{
+			Check:  check,
+			Weight: weight,
+			Reason: fmt.Sprintf("%s: ", label) + fmt.Sprintf(format, args...),
+		})
+	}
+
+	if in.hashes != nil && len(data) > 0 {
+		h := a.Hashes
+		if e := in.hashes.MatchHash(lists.Block, h.SHA256, h.SHA1, h.MD5); e != nil {
+			finding("attachment-hash-blocklist", 10.0*e.Weight(), "file hash in blocklist: %s", e.Describe())
+		} else if e := in.hashes.MatchHash(lists.Allow, h.SHA256); e != nil {
+			// Only SHA-256 vouches for a file: MD5 and SHA-1 collisions can
+			// be crafted.
+			a.KnownGood = e
+		}
+	}
+
+	if strings.ContainsAny(name, "\u202e\u202b\u2067") {
+		shown := DisplayName(name)
+		finding("attachment-rtlo", 4.0, "filename contains a right-to-left override and displays as %q", shown)
+	}
+
+	exts := extensions(name)
+	ext := ""
+	if len(exts) > 0 {
+		ext = exts[len(exts)-1]
+	}
+	switch {
+	case executableExts[ext]:
+		finding("attachment-executable", 4.0, "executable file type .%s", ext)
+	case scriptExts[ext]:
+		finding("attachment-script", 4.0, "script file type .%s", ext)
+	case riskyExts[ext]:
+		finding("attachment-risky-type", 2.5, ".%s files are rarely sent legitimately and often carry malware", ext)
+	case macroExts[ext]:
+		finding("attachment-macro", 2.5, "macro-enabled Office document .%s", ext)
+	}
+	if len(exts) >= 2 && dangerous(ext) && decoyExts[exts[len(exts)-2]] {
+		finding("attachment-double-extension", 3.0, "double extension .%s.%s hides the real type", exts[len(exts)-2], ext)
+	}
+
+	if a.DetectedType == TypeOLE && !macroExts[ext] && oleHasMacros(data) {
+		finding("attachment-macro", 2.5, "legacy Office document contains a VBA macro project")
+	}
+	if a.DetectedType == TypeZip && !macroExts[ext] && ooxmlHasMacros(data) {
+		finding("attachment-macro", 2.5, "Office document contains a VBA macro project despite its .%s name", ext)
+	}
+
+	a.Findings = append(a.Findings, mismatches(label, ext, a.ContentType, a.DetectedType)...)
+
+	switch {
+	case a.DetectedType == TypeHTML, a.DetectedType == TypeText && extFamily(ext) == TypeHTML:
+		a.URLs = inspectHTML(finding, data)
+	case a.DetectedType == TypePDF:
+		var images []image.Image
+		a.URLs, images = inspectPDF(finding, data)
+		a.QRCodes = in.qrCodes(images...)
+	case a.DetectedType == TypeImage:
+		if img, ok := decodeImage(data); ok {
+			a.QRCodes = in.qrCodes(img)
+		}
+	}
+	if len(a.QRCodes) > 0 {
+		urls := linkSet{}
+		urls.addAll(a.URLs)
+		for _, code := range a.QRCodes {
+			urls.addAll(linkPattern.FindAllString(code, -1))
+		}
+		a.URLs = urls.list
+	}
+
+	// A known file's own findings are dropped, but an archive's members
+	// are still judged on their own.
+	if a.KnownGood != nil {
+		a.Findings = nil
+	}
+	if format := archiveFormat(a.DetectedType, ext); format != "" {
+		var findings []email.Finding
+		a.Archive, findings = in.archive(label, format, data, depth+1)
+		a.Findings = append(a.Findings, findings...)
+	}
+	return a
+}
+
+var htmlTag = regexp.MustCompile(`<[^>]*>`)
+
+// bodyText is the text searched for archive passwords.
+func bodyText(env *enmime.Envelope) string {
+	return env.GetHeader("Subject") + "\n" + messageText(env)
+}
+
+// messageText is the text body, or the HTML body stripped of its tags.
+func messageText(env *enmime.Envelope) string {
+	if strings.TrimSpace(env.Text) != "" {
+		return env.Text
+	}
+	return html.UnescapeString(htmlTag.ReplaceAllString(env.HTML, " "))
+}
+
+// mismatches compares the detected content type with the declared
+// Content-Type and the file extension.
+func mismatches(label, ext, contentType, detected string) []email.Finding {
+	if detected == "" || detected == TypeText || detected == TypeBinary {
+		return nil
+	}
+	var out []email.Finding
+	for _, claim := range []struct{ what, family string }{
+		{"extension ." + ext, extFamily(ext)},
+		{"Content-Type " + contentType, typeFamily(contentType)},
+	} {
+		if claim.family == "" || compatible(claim.family, detected) {
+			continue
+		}
+		if detected == TypeExecutable {
+			out = append(out, email.Finding{
+				Check:  "attachment-disguised-executable",
+				Weight: 4.0,
+				Reason: fmt.Sprintf("%s: executable content behind %s", label, claim.what),
+			})
+			// One disguise is enough to report.
+			return out
+		}
+		out = append(out, email.Finding{
+			Check:  "attachment-type-mismatch",
+			Weight: 1.5,
+			Reason: fmt.Sprintf("%s: content is %s but %s claims %s", label, detected, claim.what, claim.family),
+		})
+	}
+	return out
+}
+
+// compatible reports whether content sniffed as detected may legitimately
+// be declared as family (e.g. a .docx is a zip file).
+func compatible(family, detected string) bool {
+	if family == detected {
+		return true
+	}
+	switch family {
+	case TypeText:
+		return detected == TypeHTML || detected == TypeRTF
+	case TypeHTML:
+		return detected == TypeText
+	}
+	return false
+}
+
+// extensions returns the lowercased dot-separated extensions of name,
+// ignoring bidi control characters and trailing dots or spaces.
+func extensions(name string) []string {
+	name = stripBidi(name)
+	base := strings.ToLower(strings.TrimRight(path.Base(strings.ReplaceAll(name, "\\", "/")), ". "))
+	parts := strings.Split(base, ".")
+	if len(parts) < 2 {
+		return nil
+	}
+	out := parts[1:]
+	for i := range out {
+		out[i] = strings.TrimSpace(out[i])
+	}
+	return out
+}
+
+func dangerous(ext string) bool {
+	return executableExts[ext] || scriptExts[ext] || riskyExts[ext]
+}
+
+// bidiControls are the characters that reorder how a filename is shown.
+const bidiControls = "\u202a\u202b\u202c\u202d\u202e\u2066\u2067\u2068\u2069\u200e\u200f"
+
+// DisplayName approximates how a filename with a right-to-left override is
+// rendered: the text after U+202E, up to the closing U+202C or U+2069,
+// appears reversed ("doc\u202efdp.exe" shows as "docexe.pdf").
+func DisplayName(name string) string {
+	var b strings.Builder
+	rest := name
+	for {
+		before, after, found := strings.Cut(rest, "\u202e")
+		b.WriteString(stripBidi(before))
+		if !found {
+			return b.String()
+		}
+		span, tail := after, ""
+		if j := strings.IndexAny(after, "\u202c\u2069"); j >= 0 {
+			_, size := utf8.DecodeRuneInString(after[j:])
+			span, tail = after[:j], after[j+size:]
+		}
+		runes := []rune(stripBidi(span))
+		for l, r := 0, len(runes)-1; l < r; l, r = l+1, r-1 {
+			runes[l], runes[r] = runes[r], runes[l]
+		}
+		b.WriteString(string(runes))
+		rest = tail
+	}
+}
+
+func stripBidi(s string) string {
+	return strings.Map(func(r rune) rune {
+		if strings.ContainsRune(bidiControls, r) {
+			return -1
+		}
+		return r
+	}, s)
+}
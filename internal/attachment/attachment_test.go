@@ -0,0 +1,198 @@
+package attachment
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/base64"
+	"fmt"
+	"sort"
+	"strings"
+	"testing"
+
+	"spamfilter/internal/lists"
+
+	"github.com/jhillyerd/enmime"
+)
+
+var (
+	pe  = append([]byte("MZ\x90\x00\x03\x00\x00\x00"), make([]byte, 120)...)
+	pdf = []byte("%PDF-1.7\n1 0 obj\n<< /Type /Catalog >>\nendobj\n%%EOF\n")
+	png = []byte("\x89PNG\r\n\x1a\n\x00\x00\x00\rIHDR")
+)
+
+func checks(a Attachment) string {
+	var got []string
+	for _, f := range a.Findings {
+		got = append(got, f.Check)
+	}
+	sort.Strings(got)
+	return strings.Join(got, ",")
+}
+
+func TestInspectFile(t *testing.T) {
+	cases := []struct {
+		name, contentType string
+		data              []byte
+		want              string
+	}{
+		{"invoice.pdf", "application/pdf", pdf, ""},
+		{"logo.png", "image/png", png, ""},
+		{"notes.txt", "text/plain", []byte("hello"), ""},
+		{"report.docx", "application/vnd.openxmlformats-officedocument.wordprocessingml.document", ooxml(t, false), ""},
+		{"setup.exe", "application/octet-stream", pe, "attachment-executable"},
+		{"factura.pdf.exe", "application/pdf", pe, "attachment-disguised-executable,attachment-double-extension,attachment-executable"},
+		{"plata.js", "text/plain", []byte("var a = new ActiveXObject('WScript.Shell');"), "attachment-script"},
+		{"scan\u202efdp.scr", "application/pdf", pe, "attachment-disguised-executable,attachment-executable,attachment-rtlo"},
+		{"buget.xlsm", "application/vnd.ms-excel.sheet.macroEnabled.12", ooxml(t, true), "attachment-macro"},
+		{"buget.xlsx", "application/vnd.openxmlformats-officedocument.spreadsheetml.sheet", ooxml(t, true), "attachment-macro"},
+		{"contract.doc", "application/msword", ole(true), "attachment-macro"},
+		{"contract.doc", "application/msword", ole(false), ""},
+		{"poza.jpg", "image/jpeg", pdf, "attachment-type-mismatch,attachment-type-mismatch"},
+		{"comanda.iso", "application/octet-stream", []byte("CD001"), "attachment-risky-type"},
+	}
+	for _, tc := range cases {
+		a := InspectFile(tc.name, tc.contentType, tc.data)
+		if got := checks(a); got != tc.want {
+			t.Errorf("%q: expected findings [%s], got [%s]", tc.name, tc.want, got)
+		}
+	}
+}
+
+func TestDisplayName(t *testing.T) {
+	if got := DisplayName("scan\u202efdp.scr"); got != "scanrcs.pdf" {
+		t.Errorf("DisplayName = %q", got)
+	}
+	if got := DisplayName("a\u202ecod\u202c.exe"); got != "adoc.exe" {
+		t.Errorf("DisplayName with closing PDF = %q", got)
+	}
+}
+
+func TestInspect(t *testing.T) {
+	raw := "From: a@example.com\r\nSubject: factura\r\nMIME-Version: 1.0\r\n" +
+		"Content-Type: multipart/mixed; boundary=b\r\n\r\n" +
+		"--b\r\nContent-Type: text/plain\r\n\r\nVedeti factura atasata.\r\n" +
+		part("factura.pdf", "application/pdf", pdf) +
+		part("factura.pdf.exe", "application/octet-stream", pe) +
+		"--b--\r\n"
+	env, err := enmime.ReadEnvelope(strings.NewReader(raw))
+	if err != nil {
+		t.Fatal(err)
+	}
+	rep := Inspect(env)
+	if len(rep.Attachments) != 2 {
+		t.Fatalf("expected 2 attachments, got %d", len(rep.Attachments))
+	}
+	if rep.Attachments[1].DetectedType != TypeExecutable || len(rep.Attachments[0].Findings) != 0 {
+		t.Errorf("unexpected summary: %+v", rep.Attachments)
+	}
+	for _, f := range rep.Findings {
+		if !strings.HasPrefix(f.Reason, "factura.pdf.exe: ") {
+			t.Errorf("finding should name its file: %q", f.Reason)
+		}
+	}
+}
+
+func TestInspectUnnamed(t *testing.T) {
+	raw := "From: a@example.com\r\nSubject: factura\r\nMIME-Version: 1.0\r\n" +
+		"Content-Type: multipart/mixed; boundary=b\r\n\r\n" +
+		"--b\r\nContent-Type: text/plain\r\n\r\nFactura atasata.\r\n" +
+		"--b\r\nContent-Type: text/plain\r\nContent-Disposition: inline\r\n\r\nSemnatura.\r\n" +
+		"--b\r\nContent-Type: application/pdf\r\nContent-Disposition: attachment\r\nContent-Transfer-Encoding: base64\r\n\r\n" +
+		base64.StdEncoding.EncodeToString(pe) + "\r\n--b--\r\n"
+	env, err := enmime.ReadEnvelope(strings.NewReader(raw))
+	if err != nil {
+		t.Fatal(err)
+	}
+	rep := Inspect(env)
+	if len(rep.Attachments) != 1 || rep.Attachments[0].DetectedType != TypeExecutable {
+		t.Fatalf("expected only the unnamed attachment, got %+v", rep.Attachments)
+	}
+	if !strings.Contains(strings.Join(reasons(rep.Findings), "\n"), "(unnamed application/pdf): ") {
+		t.Errorf("unnamed attachment not inspected: %v", rep.Findings)
+	}
+}
+
+func TestInspectHashes(t *testing.T) {
+	form := []byte("%PDF-1.7\n% formular concediu\n%%EOF\n")
+	formHash := hashContent(form).SHA256
+	store := lists.NewStore(lists.MatchExact)
+	if err := store.AddStatic(lists.Block, []string{"md5:" + hashContent(pe).MD5 + " source=soc"}, "test"); err != nil {
+		t.Fatal(err)
+	}
+	tools := makeZip(t, zipMember{name: "tool.bin", data: pe})
+	decoy := []byte("MZ decoy allowlisted by MD5")
+	if err := store.AddStatic(lists.Allow, []string{
+		formHash + " # formular HR",
+		hashContent(tools).SHA256 + " # arhiva IT",
+		"md5:" + hashContent(decoy).MD5,
+	}, "test"); err != nil {
+		t.Fatal(err)
+	}
+
+	raw := "From: a@example.com\r\nSubject: acte\r\nMIME-Version: 1.0\r\n" +
+		"Content-Type: multipart/mixed; boundary=b\r\n\r\n" +
+		"--b\r\nContent-Type: text/plain\r\n\r\nVedeti atasamentele.\r\n" +
+		part("acte.zip", "application/zip", makeZip(t, zipMember{name: "tool.bin", data: pe})) +
+		part("concediu.pdf.exe", "application/pdf", form) +
+		part("it.zip", "application/zip", tools) +
+		part("update.exe", "application/octet-stream", decoy) +
+		"--b--\r\n"
+	env, err := enmime.ReadEnvelope(strings.NewReader(raw))
+	if err != nil {
+		t.Fatal(err)
+	}
+	rep := Inspector{Limits: DefaultLimits, Hashes: store}.Inspect(env)
+
+	member := rep.Attachments[0].Archive.Members[0]
+	if member.Hashes.SHA256 == "" || member.Hashes.SHA1 == "" {
+		t.Errorf("archive member not hashed: %+v", member.Hashes)
+	}
+	if got := checks(member); !strings.Contains(got, "attachment-hash-blocklist") {
+		t.Errorf("blocklisted member hash not flagged: [%s]", got)
+	}
+	doc := rep.Attachments[1]
+	if doc.KnownGood == nil || doc.Hashes.SHA256 != formHash || len(doc.Findings) != 0 {
+		t.Errorf("allowlisted document should be known good without findings: %+v", doc)
+	}
+	arc := rep.Attachments[2]
+	if arc.KnownGood == nil || !strings.Contains(checks(arc.Archive.Members[0]), "attachment-hash-blocklist") {
+		t.Errorf("members of an allowlisted archive should still be inspected: %+v", arc)
+	}
+	if exe := rep.Attachments[3]; exe.KnownGood != nil || !strings.Contains(checks(exe), "attachment-executable") {
+		t.Errorf("an MD5 allowlist entry should not vouch for a file: %+v", exe)
+	}
+}
+
+func part(name, contentType string, data []byte) string {
+	return fmt.Sprintf("--b\r\nContent-Type: %s; name=%q\r\nContent-Disposition: attachment; filename=%q\r\n"+
+		"Content-Transfer-Encoding: base64\r\n\r\n%s\r\n", contentType, name, name, base64.StdEncoding.EncodeToString(data))
+}
+
+func ooxml(t *testing.T, macros bool) []byte {
+	var buf bytes.Buffer
+	zw := zip.NewWriter(&buf)
+	names := []string{"[Content_Types].xml", "xl/workbook.xml"}
+	if macros {
+		names = append(names, "xl/vbaProject.bin")
+	}
+	for _, n := range names {
+		w, err := zw.Create(n)
+		if err != nil {
+			t.Fatal(err)
+		}
+		w.Write([]byte("<x/>"))
+	}
+	if err := zw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func ole(macros bool) []byte {
+	data := append([]byte("\xd0\xcf\x11\xe0\xa1\xb1\x1a\xe1"), make([]byte, 504)...)
+	data = append(data, utf16le("WordDocument")...)
+	if macros {
+		data = append(data, utf16le("_VBA_PROJECT")...)
+	}
+	return data
+}
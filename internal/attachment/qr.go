@@ -0,0 +1,55 @@
+package attachment
+
+import (
+	"bytes"
+	"image"
+	_ "image/gif"
+	_ "image/jpeg"
+	_ "image/png"
+
+	"spamfilter/internal/qr"
+)
+
+// maxImagePixels and maxImageSide bound the images decoded for QR codes,
+// so a small file declaring huge dimensions cannot exhaust memory. Sides
+// are checked first so that their product cannot overflow.
+const (
+	maxImagePixels = 25 << 20
+	maxImageSide   = 16384
+)
+
+// imageFits reports whether a w by h image is within the bounds.
+func imageFits(w, h int) bool {
+	return w > 0 && h > 0 && w <= maxImageSide && h <= maxImageSide && w*h <= maxImagePixels
+}
+
+// decodeImage decodes a PNG, JPEG or GIF within maxImagePixels.
+func decodeImage(data []byte) (image.Image, bool) {
+	cfg, _, err := image.DecodeConfig(bytes.NewReader(data))
+	if err != nil || !imageFits(cfg.Width, cfg.Height) {
+		return nil, false
+	}
+	img, _, err := image.Decode(bytes.NewReader(data))
+	return img, err == nil
+}
+
+// maxQRPixels bounds the image area searched for QR codes per Budget.
+const maxQRPixels = 2 * maxImagePixels
+
+// qrCodes decodes the QR codes in images, skipping those that would take
+// the budget past maxQRPixels.
+func (in *inspector) qrCodes(images ...image.Image) []string {
+	var out []string
+	for _, img := range images {
+		if img == nil {
+			continue
+		}
+		size := img.Bounds().Size()
+		if in.qrPixels+int64(size.X)*int64(size.Y) > maxQRPixels {
+			continue
+		}
+		in.qrPixels += int64(size.X) * int64(size.Y)
+		out = append(out, qr.Decode(img)...)
+	}
+	return out
+}
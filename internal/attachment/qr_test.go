@@ -0,0 +1,143 @@
+package attachment
+
+import (
+	"bytes"
+	"compress/zlib"
+	"encoding/base64"
+	"fmt"
+	"image"
+	"image/color"
+	"image/jpeg"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/jhillyerd/enmime"
+)
+
+const qrURL = "https://igsu-alert-system.net/verificare?id=4471"
+
+func qrPNG(t *testing.T) []byte {
+	t.Helper()
+	data, err := os.ReadFile("testdata/qr.png")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return data
+}
+
+func readEnvelope(t *testing.T, raw string) *enmime.Envelope {
+	t.Helper()
+	env, err := enmime.ReadEnvelope(strings.NewReader(raw))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return env
+}
+
+func TestQRCallToAction(t *testing.T) {
+	png := base64.StdEncoding.EncodeToString(qrPNG(t))
+	inline := func(body string) string {
+		return "From: alerte@igsu-alert-system.net\r\nSubject: Confirmare cont\r\nMIME-Version: 1.0\r\n" +
+			"Content-Type: multipart/related; boundary=b\r\n\r\n" +
+			"--b\r\nContent-Type: text/html; charset=utf-8\r\n\r\n" + body + "\r\n" +
+			"--b\r\nContent-Type: image/png\r\nContent-ID: <qr1>\r\nContent-Disposition: inline\r\nContent-Transfer-Encoding: base64\r\n\r\n" + png + "\r\n" +
+			"--b--\r\n"
+	}
+
+	rep := Inspect(readEnvelope(t, inline(`<p>Scanati codul pentru a va confirma contul.</p><img src="cid:qr1">`)))
+	if len(rep.URLs) != 1 || rep.URLs[0] != qrURL {
+		t.Fatalf("QR link not extracted: %q", rep.URLs)
+	}
+	var reason string
+	for _, f := range rep.Findings {
+		if f.Check == "qr-call-to-action" {
+			reason = f.Reason
+		}
+	}
+	if !strings.HasPrefix(reason, "cid:qr1: QR code linking to "+qrURL) {
+		t.Errorf("expected a qr-call-to-action finding for cid:qr1, got %v", rep.Findings)
+	}
+
+	// A newsletter with its own links and a QR code in the footer.
+	rep = Inspect(readEnvelope(t, inline(`<p>Noutati: <a href="https://example.com/stiri">citeste</a></p><img src="cid:qr1">`)))
+	if checkSet(rep.Findings)["qr-call-to-action"] || len(rep.URLs) != 1 {
+		t.Errorf("QR code beside body links: findings %v, URLs %q", rep.Findings, rep.URLs)
+	}
+
+	// The same code embedded as a data: URI in the HTML body.
+	raw := "From: a@example.com\r\nSubject: MFA\r\nMIME-Version: 1.0\r\nContent-Type: text/html\r\n\r\n" +
+		`<p>Scan to keep MFA active.</p><img src="data:image/png;base64,` + png + `">` + "\r\n"
+	rep = Inspect(readEnvelope(t, raw))
+	if !checkSet(rep.Findings)["qr-call-to-action"] || len(rep.Attachments) != 1 || !rep.Attachments[0].Inline {
+		t.Errorf("data: URI QR code: %+v", rep)
+	}
+}
+
+func TestQRBudget(t *testing.T) {
+	img, ok := decodeImage(qrPNG(t))
+	if !ok {
+		t.Fatal("fixture not decoded")
+	}
+	in := &inspector{Budget: &Budget{}, limits: DefaultLimits}
+	if got := in.qrCodes(img); len(got) != 1 || got[0] != qrURL {
+		t.Fatalf("got %q", got)
+	}
+	in.qrPixels = maxQRPixels - 1
+	if got := in.qrCodes(img); got != nil {
+		t.Errorf("image past the message budget was searched: %q", got)
+	}
+}
+
+func TestQRInPDF(t *testing.T) {
+	src, _, err := image.Decode(bytes.NewReader(qrPNG(t)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	w, h := src.Bounds().Dx(), src.Bounds().Dy()
+
+	// 1-bit samples, packed rows, as PDF writers store QR codes.
+	bits := make([]byte, (w+7)/8*h)
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			if color.GrayModel.Convert(src.At(x, y)).(color.Gray).Y > 127 {
+				bits[y*((w+7)/8)+x/8] |= 0x80 >> (x % 8)
+			}
+		}
+	}
+	// 8-bit gray with PNG "up" prediction.
+	var predicted []byte
+	prev := make([]byte, w)
+	for y := 0; y < h; y++ {
+		predicted = append(predicted, 2)
+		for x := 0; x < w; x++ {
+			v := color.GrayModel.Convert(src.At(x, y)).(color.Gray).Y
+			predicted = append(predicted, v-prev[x])
+			prev[x] = v
+		}
+	}
+	var jpg bytes.Buffer
+	jpeg.Encode(&jpg, src, nil)
+
+	flate := func(data []byte) []byte {
+		var b bytes.Buffer
+		zw := zlib.NewWriter(&b)
+		zw.Write(data)
+		zw.Close()
+		return b.Bytes()
+	}
+	object := func(dict string, data []byte) string {
+		return fmt.Sprintf("<< /Type /XObject /Subtype /Image /Width %d /Height %d %s /Length %d >>\nstream\n%s\nendstream", w, h, dict, len(data), data)
+	}
+	cases := map[string]string{
+		"1-bit flate":     object("/BitsPerComponent 1 /ColorSpace /DeviceGray /Filter /FlateDecode", flate(bits)),
+		"8-bit predictor": object("/BitsPerComponent 8 /ColorSpace 7 0 R /Filter /FlateDecode /DecodeParms << /Predictor 15 >>", flate(predicted)),
+		"jpeg":            object("/BitsPerComponent 8 /ColorSpace /DeviceRGB /Filter /DCTDecode", jpg.Bytes()),
+	}
+	for name, obj := range cases {
+		a := InspectFile("Amenda.pdf", "application/pdf", makePDF("<< /Type /Catalog >>", obj))
+		if len(a.QRCodes) != 1 || len(a.URLs) != 1 || a.URLs[0] != qrURL {
+			t.Errorf("%s: QR codes %q, URLs %q", name, a.QRCodes, a.URLs)
+		}
+	}
+}
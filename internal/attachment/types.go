@@ -0,0 +1,193 @@
+package attachment
+
+import (
+	"archive/zip"
+	"bytes"
+	"net/http"
+	"strings"
+	"unicode/utf16"
+)
+
+// Content types reported by Sniff and used as families for declared types.
+const (
+	TypeExecutable = "executable"
+	TypeZip        = "zip"
+	TypePDF        = "pdf"
+	TypeOLE        = "ole" // legacy Office, Outlook .msg, .msi
+	TypeImage      = "image"
+	TypeText       = "text"
+	TypeHTML       = "html"
+	TypeRTF        = "rtf"
+	TypeGzip       = "gzip"
+	TypeTar        = "tar"
+	TypeRAR        = "rar"
+	Type7z         = "7z"
+	TypeBinary     = "binary" // unrecognized binary data
+)
+
+var executableExts = set("exe", "scr", "com", "pif", "cpl", "dll", "msi", "msp", "msc", "sys", "ocx", "gadget", "application", "appref-ms", "jar")
+
+var scriptExts = set("js", "jse", "vbs", "vbe", "vb", "wsf", "wsh", "wsc", "ps1", "psm1", "psd1", "bat", "cmd", "hta", "sct", "sh")
+
+var riskyExts = set("lnk", "iso", "img", "vhd", "vhdx", "reg", "inf", "scf", "url", "chm", "xll", "one", "appx", "msix", "settingcontent-ms", "library-ms")
+
+var macroExts = set("docm", "dotm", "xlsm", "xltm", "xlam", "pptm", "potm", "ppam", "ppsm", "sldm")
+
+// decoyExts are the harmless-looking types put in front of a dangerous one.
+var decoyExts = set("pdf", "doc", "docx", "xls", "xlsx", "ppt", "pptx", "txt", "rtf", "csv", "jpg", "jpeg", "png", "gif", "zip", "htm", "html", "odt", "mp3", "mp4", "wav")
+
+var extFamilies = map[string][]string{
+	TypeExecutable: {"exe", "dll", "scr", "cpl", "sys", "ocx"},
+	TypeZip: {"zip", "jar", "apk", "epub", "docx", "docm", "dotx", "dotm", "xlsx", "xlsm", "xltx", "xltm", "xlam",
+		"pptx", "pptm", "potx", "potm", "ppam", "ppsx", "ppsm", "odt", "ods", "odp"},
+	TypeOLE:   {"doc", "dot", "xls", "xlt", "ppt", "pps", "msg", "msi", "pub", "vsd"},
+	TypePDF:   {"pdf"},
+	TypeImage: {"png", "jpg", "jpeg", "gif", "webp", "tif", "tiff"},
+	TypeText:  {"txt", "csv", "log"},
+	TypeHTML:  {"htm", "html", "shtml"},
+	TypeRTF:   {"rtf"},
+	TypeGzip:  {"gz", "tgz"},
+	TypeTar:   {"tar"},
+	TypeRAR:   {"rar"},
+	Type7z:    {"7z"},
+}
+
+var extFamily = func() func(string) string {
+	m := map[string]string{}
+	for family, exts := range extFamilies {
+		for _, e := range exts {
+			m[e] = family
+		}
+	}
+	return func(ext string) string { return m[ext] }
+}()
+
+// typeFamily maps a declared media type to a family; generic types such as
+// application/octet-stream make no claim and return "".
+func typeFamily(mt string) string {
+	switch {
+	case mt == "application/pdf":
+		return TypePDF
+	case mt == "image/png", mt == "image/jpeg", mt == "image/gif", mt == "image/webp", mt == "image/tiff":
+		return TypeImage
+	case mt == "text/plain", mt == "text/csv":
+		return TypeText
+	case mt == "text/html":
+		return TypeHTML
+	case mt == "text/rtf", mt == "application/rtf":
+		return TypeRTF
+	case mt == "application/zip", mt == "application/x-zip-compressed", mt == "application/java-archive",
+		strings.HasPrefix(mt, "application/vnd.openxmlformats-officedocument."),
+		strings.HasPrefix(mt, "application/vnd.oasis.opendocument."),
+		strings.HasPrefix(mt, "application/vnd.ms-") && strings.Contains(mt, "macroenabled"):
+		return TypeZip
+	case mt == "application/msword", mt == "application/vnd.ms-excel", mt == "application/vnd.ms-powerpoint",
+		mt == "application/vnd.ms-outlook", mt == "application/x-msi":
+		return TypeOLE
+	case mt == "application/x-msdownload", mt == "application/x-dosexec", mt == "application/x-executable",
+		mt == "application/vnd.microsoft.portable-executable":
+		return TypeExecutable
+	case mt == "application/gzip", mt == "application/x-gzip":
+		return TypeGzip
+	case mt == "application/x-tar":
+		return TypeTar
+	case mt == "application/vnd.rar", mt == "application/x-rar-compressed":
+		return TypeRAR
+	case mt == "application/x-7z-compressed":
+		return Type7z
+	}
+	return ""
+}
+
+var magics = []struct {
+	prefix string
+	typ    string
+}{
+	{"MZ", TypeExecutable},
+	{"\x7fELF", TypeExecutable},
+	{"\xcf\xfa\xed\xfe", TypeExecutable}, // Mach-O 64-bit
+	{"\xce\xfa\xed\xfe", TypeExecutable}, // Mach-O 32-bit
+	{"PK\x03\x04", TypeZip},
+	{"PK\x05\x06", TypeZip},
+	{"%PDF-", TypePDF},
+	{"\xd0\xcf\x11\xe0\xa1\xb1\x1a\xe1", TypeOLE},
+	{"\x89PNG\r\n\x1a\n", TypeImage},
+	{"\xff\xd8\xff", TypeImage},
+	{"GIF87a", TypeImage},
+	{"GIF89a", TypeImage},
+	{"II*\x00", TypeImage},
+	{"MM\x00*", TypeImage},
+	{"{\\rtf", TypeRTF},
+	{"\x1f\x8b", TypeGzip},
+	{"Rar!\x1a\x07", TypeRAR},
+	{"7z\xbc\xaf\x27\x1c", Type7z},
+}
+
+// Sniff identifies data by its magic bytes. It returns "" for empty data
+// and TypeBinary for binary content it does not recognize.
+func Sniff(data []byte) string {
+	if len(data) == 0 {
+		return ""
+	}
+	for _, m := range magics {
+		if bytes.HasPrefix(data, []byte(m.prefix)) {
+			return m.typ
+		}
+	}
+	if len(data) >= 262 && string(data[257:262]) == "ustar" {
+		return TypeTar
+	}
+	if len(data) >= 12 && string(data[:4]) == "RIFF" && string(data[8:12]) == "WEBP" {
+		return TypeImage
+	}
+	// PDF readers accept a header anywhere in the first KiB.
+	if bytes.Contains(data[:min(len(data), 1024)], []byte("%PDF-")) {
+		return TypePDF
+	}
+	switch ct := http.DetectContentType(data); {
+	case strings.HasPrefix(ct, "text/html"):
+		return TypeHTML
+	case strings.HasPrefix(ct, "text/"):
+		return TypeText
+	}
+	return TypeBinary
+}
+
+// vbaStream is the name of the VBA project stream as stored in an OLE directory.
+var vbaStream = utf16le("_VBA_PROJECT")
+
+// oleHasMacros reports whether a legacy Office file carries a VBA project.
+func oleHasMacros(data []byte) bool {
+	return bytes.Contains(data, vbaStream)
+}
+
+// ooxmlHasMacros reports whether an Office Open XML package includes a VBA
+// project part, whatever its extension says.
+func ooxmlHasMacros(data []byte) bool {
+	zr, err := zip.NewReader(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		return false
+	}
+	for _, f := range zr.File {
+		if strings.HasSuffix(strings.ToLower(f.Name), "vbaproject.bin") {
+			return true
+		}
+	}
+	return false
+}
+
+func utf16le(s string) []byte {
+	var out []byte
+	for _, u := range utf16.Encode([]rune(s)) {
+		out = append(out, byte(u), byte(u>>8))
+	}
+	return out
+}
+
+func set(values ...string) map[string]bool {
+	m := make(map[string]bool, len(values))
+	for _, v := range values {
+		m[v] = true
+	}
+	return m
+}
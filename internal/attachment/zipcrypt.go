@@ -0,0 +1,170 @@
+package attachment
+
+import (
+	"archive/zip"
+	"bytes"
+	"compress/flate"
+	"crypto/aes"
+	"crypto/hmac"
+	"crypto/pbkdf2"
+	"crypto/sha1"
+	"encoding/binary"
+	"errors"
+	"hash/crc32"
+	"io"
+)
+
+var errBadPassword = errors.New("wrong password")
+
+// zipCrypto is the traditional PKWARE stream cipher.
+type zipCrypto struct {
+	k0, k1, k2 uint32
+}
+
+func newZipCrypto(password string) *zipCrypto {
+	z := &zipCrypto{0x12345678, 0x23456789, 0x34567890}
+	for i := 0; i < len(password); i++ {
+		z.update(password[i])
+	}
+	return z
+}
+
+func (z *zipCrypto) update(b byte) {
+	z.k0 = crc32.IEEETable[byte(z.k0)^b] ^ (z.k0 >> 8)
+	z.k1 = (z.k1+(z.k0&0xff))*134775813 + 1
+	z.k2 = crc32.IEEETable[byte(z.k2)^byte(z.k1>>24)] ^ (z.k2 >> 8)
+}
+
+func (z *zipCrypto) decrypt(buf []byte) {
+	for i, c := range buf {
+		t := uint16(z.k2 | 2)
+		p := c ^ byte((uint32(t)*uint32(t^1))>>8)
+		z.update(p)
+		buf[i] = p
+	}
+}
+
+// zipCryptoCheck decrypts the 12-byte encryption header and compares its
+// last byte with the check byte, which rejects about 255 of 256 wrong
+// passwords without touching the file data.
+func zipCryptoCheck(f *zip.File, raw []byte, password string) (*zipCrypto, bool) {
+	if len(raw) < 12 {
+		return nil, false
+	}
+	z := newZipCrypto(password)
+	header := append([]byte(nil), raw[:12]...)
+	z.decrypt(header)
+	check := byte(f.CRC32 >> 24)
+	if f.Flags&0x8 != 0 {
+		check = byte(f.ModifiedTime >> 8)
+	}
+	return z, header[11] == check
+}
+
+// decryptZipCrypto returns the plaintext of a ZipCrypto-encrypted member.
+func decryptZipCrypto(f *zip.File, raw []byte, password string, limit int64) ([]byte, error) {
+	z, ok := zipCryptoCheck(f, raw, password)
+	if !ok {
+		return nil, errBadPassword
+	}
+	body := append([]byte(nil), raw[12:]...)
+	z.decrypt(body)
+	data, err := decompress(f.Method, body, limit)
+	if err != nil {
+		return nil, err
+	}
+	if crc32.ChecksumIEEE(data) != f.CRC32 {
+		return nil, errBadPassword
+	}
+	return data, nil
+}
+
+// aesExtra is the WinZip AES extra field (0x9901).
+type aesExtra struct {
+	strength byte   // 1, 2, 3 for AES-128, 192, 256
+	method   uint16 // compression method of the plaintext
+}
+
+func parseAESExtra(extra []byte) (aesExtra, bool) {
+	for len(extra) >= 4 {
+		id := binary.LittleEndian.Uint16(extra)
+		size := int(binary.LittleEndian.Uint16(extra[2:]))
+		if len(extra) < 4+size {
+			break
+		}
+		if id == 0x9901 && size >= 7 {
+			field := extra[4 : 4+size]
+			return aesExtra{strength: field[4], method: binary.LittleEndian.Uint16(field[5:])}, true
+		}
+		extra = extra[4+size:]
+	}
+	return aesExtra{}, false
+}
+
+// decryptAES returns the plaintext of a WinZip AES-encrypted member. The
+// two-byte password verifier rejects most wrong passwords before the data
+// is decrypted; the HMAC then confirms the right one.
+func decryptAES(f *zip.File, raw []byte, password string, limit int64) ([]byte, error) {
+	ae, ok := parseAESExtra(f.Extra)
+	if !ok || ae.strength < 1 || ae.strength > 3 {
+		return nil, zip.ErrAlgorithm
+	}
+	keyLen := 8 + 8*int(ae.strength)
+	saltLen := keyLen / 2
+	if len(raw) < saltLen+2+10 {
+		return nil, errBadPassword
+	}
+	salt, verifier := raw[:saltLen], raw[saltLen:saltLen+2]
+	body, mac := raw[saltLen+2:len(raw)-10], raw[len(raw)-10:]
+
+	key, err := pbkdf2.Key(sha1.New, password, salt, 1000, 2*keyLen+2)
+	if err != nil {
+		return nil, err
+	}
+	if !bytes.Equal(key[2*keyLen:], verifier) {
+		return nil, errBadPassword
+	}
+	h := hmac.New(sha1.New, key[keyLen:2*keyLen])
+	h.Write(body)
+	if !hmac.Equal(h.Sum(nil)[:10], mac) {
+		return nil, errBadPassword
+	}
+
+	block, err := aes.NewCipher(key[:keyLen])
+	if err != nil {
+		return nil, err
+	}
+	// WinZip uses CTR mode with a little-endian counter starting at 1.
+	plain := make([]byte, len(body))
+	var counter, stream [aes.BlockSize]byte
+	for i := 0; i < len(body); i += aes.BlockSize {
+		binary.LittleEndian.PutUint64(counter[:], uint64(i/aes.BlockSize+1))
+		block.Encrypt(stream[:], counter[:])
+		for j := i; j < min(i+aes.BlockSize, len(body)); j++ {
+			plain[j] = body[j] ^ stream[j-i]
+		}
+	}
+	return decompress(ae.method, plain, limit)
+}
+
+func decompress(method uint16, data []byte, limit int64) ([]byte, error) {
+	var r io.Reader
+	switch method {
+	case zip.Store:
+		r = bytes.NewReader(data)
+	case zip.Deflate:
+		fr := flate.NewReader(bytes.NewReader(data))
+		defer fr.Close()
+		r = fr
+	default:
+		return nil, zip.ErrAlgorithm
+	}
+	out, err := io.ReadAll(io.LimitReader(r, limit+1))
+	if err != nil {
+		return nil, err
+	}
+	if int64(len(out)) > limit {
+		return nil, errTooLarge
+	}
+	return out, nil
+}
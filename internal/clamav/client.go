@@ -0,0 +1,142 @@
+package clamav
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"net"
+	"strings"
+	"time"
+)
+
+// Client talks to clamd over TCP or a unix socket using the
+// null-terminated ("z") form of the commands.
+type Client struct {
+	Network   string // "tcp" or "unix"
+	Address   string
+	Timeout   time.Duration
+	ChunkSize int // INSTREAM chunk size; must stay below clamd's StreamMaxLength
+}
+
+type Result struct {
+	Infected bool
+	Virus    string
+	Response string
+}
+
+// New accepts "host:port", "tcp://host:port", "unix:///path/clamd.sock" or
+// a plain socket path.
+func New(address string) *Client {
+	c := &Client{Network: "tcp", Address: address, Timeout: 30 * time.Second, ChunkSize: 64 << 10}
+	switch {
+	case strings.HasPrefix(address, "unix://"):
+		c.Network, c.Address = "unix", strings.TrimPrefix(address, "unix://")
+	case strings.HasPrefix(address, "tcp://"):
+		c.Address = strings.TrimPrefix(address, "tcp://")
+	case strings.HasPrefix(address, "/"):
+		c.Network = "unix"
+	}
+	return c
+}
+
+// Ping checks that clamd is up.
+func (c *Client) Ping() error {
+	resp, err := c.command("PING", nil)
+	if err != nil {
+		return err
+	}
+	if resp != "PONG" {
+		return fmt.Errorf("unexpected clamd PING response: %q", resp)
+	}
+	return nil
+}
+
+// Version returns the engine and signature database version.
+func (c *Client) Version() (string, error) {
+	return c.command("VERSION", nil)
+}
+
+// ScanBytes scans data with INSTREAM.
+func (c *Client) ScanBytes(data []byte) (Result, error) {
+	return c.Scan(bytes.NewReader(data))
+}
+
+// Scan streams r to clamd in chunks and parses the verdict.
+func (c *Client) Scan(r io.Reader) (Result, error) {
+	resp, err := c.command("INSTREAM", r)
+	if err != nil {
+		return Result{}, err
+	}
+	return parseResult(resp)
+}
+
+func parseResult(resp string) (Result, error) {
+	res := Result{Response: resp}
+	// "stream: OK", "stream: Eicar-Signature FOUND" or "... ERROR"
+	_, status, _ := strings.Cut(resp, ": ")
+	switch {
+	case status == "OK":
+		return res, nil
+	case strings.HasSuffix(status, " FOUND"):
+		res.Infected = true
+		res.Virus = strings.TrimSuffix(status, " FOUND")
+		return res, nil
+	}
+	return res, fmt.Errorf("clamd error: %s", resp)
+}
+
+func (c *Client) command(cmd string, stream io.Reader) (string, error) {
+	conn, err := net.DialTimeout(c.Network, c.Address, 5*time.Second)
+	if err != nil {
+		return "", fmt.Errorf("failed to connect to clamd: %w", err)
+	}
+	defer conn.Close()
+	if c.Timeout > 0 {
+		conn.SetDeadline(time.Now().Add(c.Timeout))
+	}
+
+	if _, err := conn.Write([]byte("z" + cmd + "\x00")); err != nil {
+		return "", err
+	}
+	if stream != nil {
+		if err := c.writeChunks(conn, stream); err != nil {
+			return "", err
+		}
+	}
+
+	resp, err := bufio.NewReader(conn).ReadString(0)
+	if err != nil && (err != io.EOF || resp == "") {
+		return "", fmt.Errorf("reading clamd response: %w", err)
+	}
+	return strings.TrimSpace(strings.TrimRight(resp, "\x00")), nil
+}
+
+// writeChunks sends each chunk prefixed by its length as a 4-byte
+// big-endian integer, then a zero-length chunk to end the stream.
+func (c *Client) writeChunks(w io.Writer, r io.Reader) error {
+	size := c.ChunkSize
+	if size <= 0 {
+		size = 64 << 10
+	}
+	buf := make([]byte, 4+size)
+	for {
+		n, err := io.ReadFull(r, buf[4:])
+		if n > 0 {
+			binary.BigEndian.PutUint32(buf, uint32(n))
+			if _, werr := w.Write(buf[:4+n]); werr != nil {
+				// clamd closes the connection once the stream is over its limit.
+				return fmt.Errorf("sending stream to clamd: %w", werr)
+			}
+		}
+		if err == io.EOF || err == io.ErrUnexpectedEOF {
+			break
+		}
+		if err != nil {
+			return err
+		}
+	}
+	_, err := w.Write([]byte{0, 0, 0, 0})
+	return err
+}
@@ -0,0 +1,157 @@
+package clamav
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"io"
+	"net"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"spamfilter/internal/email"
+
+	"github.com/jhillyerd/enmime"
+)
+
+const eicar = `X5O!P%@AP[4\PZX54(P^)7CC)7}$EICAR-STANDARD-ANTIVIRUS-TEST-FILE!$H+H*`
+
+// mockClamd answers like clamd: PONG, a version string, and for INSTREAM
+// FOUND when the reassembled stream contains the EICAR test string.
+type mockClamd struct {
+	listener net.Listener
+	chunks   chan int // number of chunks per stream
+}
+
+func startMock(t *testing.T, network, address string) *mockClamd {
+	t.Helper()
+	l, err := net.Listen(network, address)
+	if err != nil {
+		t.Fatalf("failed to start mock clamd: %v", err)
+	}
+	m := &mockClamd{listener: l, chunks: make(chan int, 16)}
+	t.Cleanup(func() { l.Close() })
+	go func() {
+		for {
+			conn, err := l.Accept()
+			if err != nil {
+				return
+			}
+			go m.serve(conn)
+		}
+	}()
+	return m
+}
+
+func (m *mockClamd) serve(conn net.Conn) {
+	defer conn.Close()
+	r := bufio.NewReader(conn)
+	cmd, err := r.ReadString(0)
+	if err != nil {
+		return
+	}
+	switch strings.TrimRight(cmd, "\x00") {
+	case "zPING":
+		conn.Write([]byte("PONG\x00"))
+	case "zVERSION":
+		conn.Write([]byte("ClamAV 1.3.1/27412/Mon Oct 12 08:00:00 2026\x00"))
+	case "zINSTREAM":
+		var data bytes.Buffer
+		n := 0
+		for {
+			var size uint32
+			if err := binary.Read(r, binary.BigEndian, &size); err != nil {
+				return
+			}
+			if size == 0 {
+				break
+			}
+			n++
+			if _, err := io.CopyN(&data, r, int64(size)); err != nil {
+				return
+			}
+		}
+		m.chunks <- n
+		if bytes.Contains(data.Bytes(), []byte("EICAR-STANDARD-ANTIVIRUS-TEST-FILE")) {
+			conn.Write([]byte("stream: Win.Test.EICAR_HDB-1 FOUND\x00"))
+		} else {
+			conn.Write([]byte("stream: OK\x00"))
+		}
+	default:
+		conn.Write([]byte("UNKNOWN COMMAND\x00"))
+	}
+}
+
+func TestClient_PingVersionScan(t *testing.T) {
+	m := startMock(t, "tcp", "127.0.0.1:0")
+	client := New("tcp://" + m.listener.Addr().String())
+	client.ChunkSize = 16
+
+	if err := client.Ping(); err != nil {
+		t.Fatalf("Ping failed: %v", err)
+	}
+	if v, err := client.Version(); err != nil || !strings.HasPrefix(v, "ClamAV 1.3.1") {
+		t.Errorf("Version = %q, %v", v, err)
+	}
+
+	res, err := client.ScanBytes([]byte(eicar))
+	if err != nil {
+		t.Fatalf("Scan failed: %v", err)
+	}
+	if !res.Infected || res.Virus != "Win.Test.EICAR_HDB-1" {
+		t.Errorf("expected EICAR detection, got %+v", res)
+	}
+	if n := <-m.chunks; n != (len(eicar)+15)/16 {
+		t.Errorf("expected the stream in %d chunks, got %d", (len(eicar)+15)/16, n)
+	}
+
+	res, err = client.ScanBytes([]byte("just a document"))
+	if err != nil || res.Infected {
+		t.Errorf("clean data: %+v, %v", res, err)
+	}
+}
+
+func TestClient_UnixSocket(t *testing.T) {
+	sock := filepath.Join(t.TempDir(), "clamd.sock")
+	startMock(t, "unix", sock)
+	client := New(sock)
+	if client.Network != "unix" {
+		t.Fatalf("expected a unix socket client, got %s", client.Network)
+	}
+	if err := client.Ping(); err != nil {
+		t.Fatalf("Ping over unix socket failed: %v", err)
+	}
+}
+
+func TestParseResult(t *testing.T) {
+	if _, err := parseResult("INSTREAM size limit exceeded. ERROR"); err == nil {
+		t.Error("expected an error for a clamd ERROR response")
+	}
+}
+
+func TestScanEmail(t *testing.T) {
+	m := startMock(t, "tcp", "127.0.0.1:0")
+	client := New(m.listener.Addr().String())
+
+	raw := "From: a@example.com\r\nSubject: test\r\nMIME-Version: 1.0\r\n" +
+		"Content-Type: multipart/mixed; boundary=b\r\n\r\n" +
+		"--b\r\nContent-Type: text/plain\r\n\r\nsee attached\r\n" +
+		"--b\r\nContent-Type: application/octet-stream; name=\"clean.txt\"\r\nContent-Disposition: attachment; filename=\"clean.txt\"\r\n\r\nhello\r\n" +
+		"--b\r\nContent-Type: application/octet-stream; name=\"eicar.com\"\r\nContent-Disposition: attachment; filename=\"eicar.com\"\r\n\r\n" + eicar + "\r\n" +
+		"--b--\r\n"
+	env, err := enmime.ReadEnvelope(strings.NewReader(raw))
+	if err != nil {
+		t.Fatal(err)
+	}
+	em := &email.Email{Raw: []byte(raw), Envelope: env}
+
+	rep := client.ScanEmail(em, ModeAttachments)
+	if rep.Scanned != 2 || len(rep.Detections) != 1 || rep.Detections[0].Object != "eicar.com" {
+		t.Errorf("attachments mode: %+v", rep)
+	}
+	rep = client.ScanEmail(em, ModeMessage)
+	if rep.Scanned != 1 || !rep.Infected() || rep.Detections[0].Object != "message" {
+		t.Errorf("message mode: %+v", rep)
+	}
+}
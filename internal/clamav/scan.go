@@ -0,0 +1,86 @@
+package clamav
+
+import (
+	"fmt"
+
+	"spamfilter/internal/email"
+
+	"github.com/jhillyerd/enmime"
+)
+
+// Mode selects what is sent to clamd.
+type Mode string
+
+const (
+	// ModeAttachments scans each decoded attachment, inline part and named
+	// part separately, so a detection names the file.
+	ModeAttachments Mode = "attachments"
+	// ModeMessage sends the raw message and lets clamd decode the MIME parts.
+	ModeMessage Mode = "message"
+)
+
+// ParseMode accepts "attachments" (the default) or "message".
+func ParseMode(s string) (Mode, error) {
+	switch Mode(s) {
+	case "", ModeAttachments:
+		return ModeAttachments, nil
+	case ModeMessage:
+		return ModeMessage, nil
+	}
+	return ModeAttachments, fmt.Errorf("unknown clamav scan mode %q", s)
+}
+
+// Detection is one infected object.
+type Detection struct {
+	Object string // attachment filename, or "message"
+	Virus  string
+}
+
+// Report is the outcome of scanning one message.
+type Report struct {
+	Mode       Mode
+	Scanned    int
+	Detections []Detection
+	Errors     []string
+}
+
+// Infected reports whether any object was flagged.
+func (r *Report) Infected() bool {
+	return r != nil && len(r.Detections) > 0
+}
+
+// ScanEmail scans em according to mode. Objects that could not be scanned
+// are listed in Errors; the others are still reported.
+func (c *Client) ScanEmail(em *email.Email, mode Mode) Report {
+	rep := Report{Mode: mode}
+	scan := func(object string, data []byte) {
+		res, err := c.ScanBytes(data)
+		if err != nil {
+			rep.Errors = append(rep.Errors, fmt.Sprintf("%s: %v", object, err))
+			return
+		}
+		rep.Scanned++
+		if res.Infected {
+			rep.Detections = append(rep.Detections, Detection{Object: object, Virus: res.Virus})
+		}
+	}
+
+	if mode == ModeMessage || em.Envelope == nil {
+		scan("message", em.Raw)
+		return rep
+	}
+	env := em.Envelope
+	for _, parts := range [][]*enmime.Part{env.Attachments, env.Inlines, env.OtherParts} {
+		for _, p := range parts {
+			if len(p.Content) == 0 {
+				continue
+			}
+			name := p.FileName
+			if name == "" {
+				name = "(unnamed " + p.ContentType + ")"
+			}
+			scan(name, p.Content)
+		}
+	}
+	return rep
+}
@@ -2,23 +2,72 @@ package config
 
 import (
 	"os"
+	"strconv"
 	"strings"
+	"time"
 )
 
 type Config struct {
 	SampleDir        string
 	SourceIP         string
 	HELODomain       string
+	EnvelopeFrom     string
+	LLMProvider      string
 	LLMApiKey        string
 	LLMModel         string
 	LLMBaseURL       string
+	LLMStructured    string
 	GeminiAPIKey     string
+	GeminiModel      string
+	GeminiBaseURL    string
+	OllamaURL        string
+	OllamaModel      string
+	OllamaKeepAlive  string
+	OllamaPull       bool
+	LlamaCppURL      string
+	LlamaCppModel    string
+	LlamaCppGrammar  bool
+	PromptDir        string
+	PromptName       string
+	LLMCacheTTL      time.Duration
+	LLMCacheSize     int
+	LLMCacheFile     string
+	LLMEnsemble      []string
+	LLMStrategy      string
+	LLMCascade       bool
+	LLMCascadeLow    float64
+	LLMCascadeHigh   float64
+	LLMRate          float64
+	LLMBurst         int
+	LLMConcurrency   int
+	LLMBreakerFails  int
+	LLMBreakerWait   time.Duration
+	LLMBudgetTokens  int
+	LLMBudgetCost    float64
+	LLMPricePrompt   float64
+	LLMPriceOutput   float64
+	LLMBudgetFile    string
 	Blocklist        []string
+	BlocklistMatch   string
+	BlocklistPaths   []string
+	AllowlistPaths   []string
+	ListsReload      time.Duration
+	ListsBloomFP     float64
+	FeedsConfig      string
+	FeedsOutput      string
+	PublicSuffixFile string
 	SpamAssassinHost string
 	SpamAssassinPort string
+	ClamAVAddress    string
+	ClamAVMode       string
 	QuarantineDir    string
 	SpamDir          string
 	CleanDir         string
+	MalwareDir       string
+	BulkDir          string
+	NestedMaxDepth   int
+	DirectoryFile    string
+	InternalDomains  []string
 }
 
 func Load() Config {
@@ -26,16 +75,63 @@ func Load() Config {
 		SampleDir:        getEnv("SAMPLE_DIR", "samples"),
 		SourceIP:         getEnv("SOURCE_IP", "203.0.113.1"),
 		HELODomain:       getEnv("HELO_DOMAIN", "example.com"),
+		EnvelopeFrom:     os.Getenv("ENVELOPE_FROM"),
+		LLMProvider:      os.Getenv("LLM_PROVIDER"),
 		LLMApiKey:        os.Getenv("OPENAI_API_KEY"),
 		LLMModel:         getEnv("OPENAI_MODEL", "gpt-3.5-turbo"),
 		LLMBaseURL:       os.Getenv("OPENAI_BASE_URL"),
+		LLMStructured:    os.Getenv("OPENAI_STRUCTURED"),
 		GeminiAPIKey:     os.Getenv("GEMINI_API_KEY"),
+		GeminiModel:      getEnv("GEMINI_MODEL", "gemini-1.5-flash"),
+		GeminiBaseURL:    os.Getenv("GEMINI_BASE_URL"),
+		OllamaURL:        os.Getenv("OLLAMA_URL"),
+		OllamaModel:      getEnv("OLLAMA_MODEL", "llama3.1:8b"),
+		OllamaKeepAlive:  os.Getenv("OLLAMA_KEEP_ALIVE"),
+		OllamaPull:       getBool("OLLAMA_PULL", false),
+		LlamaCppURL:      os.Getenv("LLAMACPP_URL"),
+		LlamaCppModel:    os.Getenv("LLAMACPP_MODEL"),
+		LlamaCppGrammar:  getBool("LLAMACPP_GRAMMAR", false),
+		PromptDir:        os.Getenv("PROMPT_DIR"),
+		PromptName:       getEnv("PROMPT_NAME", "classify"),
+		LLMCacheTTL:      getDuration("LLM_CACHE_TTL", 24*time.Hour),
+		LLMCacheSize:     getInt("LLM_CACHE_SIZE", 10000),
+		LLMCacheFile:     os.Getenv("LLM_CACHE_FILE"),
+		LLMEnsemble:      getList("LLM_ENSEMBLE", nil),
+		LLMStrategy:      os.Getenv("LLM_ENSEMBLE_STRATEGY"),
+		LLMCascade:       getBool("LLM_CASCADE", false),
+		LLMCascadeLow:    getFloat("LLM_CASCADE_LOW", 1.0),
+		LLMCascadeHigh:   getFloat("LLM_CASCADE_HIGH", 5.0),
+		LLMRate:          getFloat("LLM_RATE", 0),
+		LLMBurst:         getInt("LLM_BURST", 5),
+		LLMConcurrency:   getInt("LLM_MAX_CONCURRENT", 4),
+		LLMBreakerFails:  getInt("LLM_BREAKER_FAILURES", 5),
+		LLMBreakerWait:   getDuration("LLM_BREAKER_COOLDOWN", time.Minute),
+		LLMBudgetTokens:  getInt("LLM_BUDGET_TOKENS", 0),
+		LLMBudgetCost:    getFloat("LLM_BUDGET_COST", 0),
+		LLMPricePrompt:   getFloat("LLM_PRICE_PROMPT", 0),
+		LLMPriceOutput:   getFloat("LLM_PRICE_COMPLETION", 0),
+		LLMBudgetFile:    os.Getenv("LLM_BUDGET_FILE"),
 		Blocklist:        getList("MALICIOUS_DOMAINS", []string{"spam.com", "spamsite.biz", "badmailer.test"}),
+		BlocklistMatch:   getEnv("BLOCKLIST_MATCH", "subdomain"),
+		BlocklistPaths:   getPaths("BLOCKLIST_PATHS"),
+		AllowlistPaths:   getPaths("ALLOWLIST_PATHS"),
+		ListsReload:      getDuration("LISTS_RELOAD_INTERVAL", 30*time.Second),
+		ListsBloomFP:     getFloat("LISTS_BLOOM_FP", 0),
+		FeedsConfig:      getEnv("FEEDS_CONFIG", "deployment/feeds/feeds.json"),
+		FeedsOutput:      getEnv("FEEDS_OUTPUT", "deployment/lists/feeds/feeds.list"),
+		PublicSuffixFile: os.Getenv("PUBLIC_SUFFIX_FILE"),
 		SpamAssassinHost: getEnv("SPAMASSASSIN_HOST", "127.0.0.1"),
 		SpamAssassinPort: getEnv("SPAMASSASSIN_PORT", "783"),
+		ClamAVAddress:    os.Getenv("CLAMAV_ADDRESS"),
+		ClamAVMode:       getEnv("CLAMAV_MODE", "attachments"),
 		QuarantineDir:    getEnv("QUARANTINE_DIR", "quarantine"),
 		SpamDir:          getEnv("SPAM_DIR", "spam"),
 		CleanDir:         getEnv("CLEAN_DIR", "clean"),
+		MalwareDir:       getEnv("MALWARE_DIR", "malware"),
+		BulkDir:          getEnv("BULK_DIR", "bulk"),
+		NestedMaxDepth:   getInt("NESTED_MAX_DEPTH", 3),
+		DirectoryFile:    os.Getenv("DIRECTORY_FILE"),
+		InternalDomains:  getList("INTERNAL_DOMAINS", []string{"igsu.ro"}),
 	}
 }
 
@@ -62,3 +158,50 @@ func getList(key string, fallback []string) []string {
 	}
 	return fallback
 }
+
+// getPaths splits a comma-separated list of paths, keeping their case.
+func getPaths(key string) []string {
+	var out []string
+	for _, p := range strings.Split(os.Getenv(key), ",") {
+		if p = strings.TrimSpace(p); p != "" {
+			out = append(out, p)
+		}
+	}
+	return out
+}
+
+func getDuration(key string, fallback time.Duration) time.Duration {
+	if v := os.Getenv(key); v != "" {
+		if d, err := time.ParseDuration(v); err == nil {
+			return d
+		}
+	}
+	return fallback
+}
+
+func getInt(key string, fallback int) int {
+	if v := os.Getenv(key); v != "" {
+		if n, err := strconv.Atoi(v); err == nil {
+			return n
+		}
+	}
+	return fallback
+}
+
+func getFloat(key string, fallback float64) float64 {
+	if v := os.Getenv(key); v != "" {
+		if f, err := strconv.ParseFloat(v, 64); err == nil {
+			return f
+		}
+	}
+	return fallback
+}
+
+func getBool(key string, fallback bool) bool {
+	if v := os.Getenv(key); v != "" {
+		if b, err := strconv.ParseBool(v); err == nil {
+			return b
+		}
+	}
+	return fallback
+}
@@ -0,0 +1,312 @@
+package directory
+
+import (
+	"bufio"
+	"encoding/base64"
+	"encoding/csv"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"unicode"
+
+	"spamfilter/internal/lists"
+
+	"golang.org/x/text/runes"
+	"golang.org/x/text/transform"
+	"golang.org/x/text/unicode/norm"
+)
+
+// Person is an internal user whose name may be abused in a From display name.
+type Person struct {
+	Name    string
+	Email   string
+	Title   string
+	Aliases []string
+}
+
+// Directory holds the internal people and the domains considered internal.
+type Directory struct {
+	People  []Person
+	Domains []string
+
+	internal *lists.DomainList
+}
+
+// New returns a directory for the given internal domains. Domains of people
+// added later are treated as internal as well.
+func New(domains []string) *Directory {
+	d := &Directory{internal: lists.NewDomainList(nil, lists.MatchSubdomain)}
+	for _, dom := range domains {
+		d.addDomain(dom)
+	}
+	return d
+}
+
+// Load reads people from a CSV or LDIF file, chosen by file extension.
+func (d *Directory) Load(path string) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".ldif":
+		err = d.LoadLDIF(f)
+	default:
+		err = d.LoadCSV(f)
+	}
+	if err != nil {
+		return fmt.Errorf("load %s: %w", path, err)
+	}
+	return nil
+}
+
+// LoadCSV reads people from CSV. A header row naming the columns (name, email,
+// title, aliases) is optional; without it the columns are name,email[,title].
+// Multiple aliases are separated by ";".
+func (d *Directory) LoadCSV(r io.Reader) error {
+	cr := csv.NewReader(r)
+	cr.FieldsPerRecord = -1
+	cr.TrimLeadingSpace = true
+	cr.Comment = '#'
+
+	cols := map[string]int{"name": 0, "email": 1, "title": 2, "aliases": 3}
+	first := true
+	for {
+		rec, err := cr.Read()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if first {
+			first = false
+			if header := csvHeader(rec); header != nil {
+				cols = header
+				continue
+			}
+		}
+		p := Person{
+			Name:  csvField(rec, cols, "name"),
+			Email: strings.ToLower(csvField(rec, cols, "email")),
+			Title: csvField(rec, cols, "title"),
+		}
+		for _, a := range strings.Split(csvField(rec, cols, "aliases"), ";") {
+			if a = strings.TrimSpace(a); a != "" {
+				p.Aliases = append(p.Aliases, a)
+			}
+		}
+		d.Add(p)
+	}
+}
+
+func csvHeader(rec []string) map[string]int {
+	cols := map[string]int{}
+	for i, h := range rec {
+		switch strings.ToLower(strings.TrimSpace(h)) {
+		case "name", "cn", "displayname", "display_name":
+			cols["name"] = i
+		case "email", "mail", "address":
+			cols["email"] = i
+		case "title", "role":
+			cols["title"] = i
+		case "aliases", "alias":
+			cols["aliases"] = i
+		}
+	}
+	if _, ok := cols["name"]; !ok {
+		return nil
+	}
+	return cols
+}
+
+func csvField(rec []string, cols map[string]int, name string) string {
+	i, ok := cols[name]
+	if !ok || i >= len(rec) {
+		return ""
+	}
+	return strings.TrimSpace(rec[i])
+}
+
+// LoadLDIF reads people from an LDIF export. The cn/displayName, mail, title
+// and givenName+sn attributes are used; base64 values and folded lines are
+// supported.
+func (d *Directory) LoadLDIF(r io.Reader) error {
+	scanner := bufio.NewScanner(r)
+	attrs := map[string][]string{}
+	var pending string // the current line, unfolded so far
+	var comment bool   // the current line is a comment
+
+	// parse adds the attribute on the unfolded line. Base64 values are
+	// decoded only now, as folding may split them anywhere.
+	parse := func() error {
+		line := pending
+		pending = ""
+		key, value, ok := strings.Cut(line, ":")
+		if !ok {
+			return nil
+		}
+		key = strings.ToLower(key)
+		if strings.HasPrefix(value, ":") {
+			decoded, err := base64.StdEncoding.DecodeString(strings.TrimSpace(value[1:]))
+			if err != nil {
+				return fmt.Errorf("attribute %s: %w", key, err)
+			}
+			value = string(decoded)
+		}
+		attrs[key] = append(attrs[key], strings.TrimSpace(value))
+		return nil
+	}
+	flush := func() {
+		if len(attrs) > 0 {
+			d.addLDIFEntry(attrs)
+		}
+		attrs = map[string][]string{}
+	}
+
+	for scanner.Scan() {
+		line := strings.TrimRight(scanner.Text(), "\r")
+		if strings.HasPrefix(line, " ") && (pending != "" || comment) {
+			if !comment {
+				pending += line[1:]
+			}
+			continue
+		}
+		if err := parse(); err != nil {
+			return err
+		}
+		comment = strings.HasPrefix(line, "#")
+		switch {
+		case line == "":
+			flush()
+		case !comment:
+			pending = line
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return err
+	}
+	if err := parse(); err != nil {
+		return err
+	}
+	flush()
+	return nil
+}
+
+func (d *Directory) addLDIFEntry(attrs map[string][]string) {
+	p := Person{}
+	names := append(attrs["displayname"], attrs["cn"]...)
+	if given, sn := first(attrs["givenname"]), first(attrs["sn"]); given != "" && sn != "" {
+		names = append(names, given+" "+sn)
+	}
+	if len(names) == 0 {
+		return
+	}
+	p.Name = names[0]
+	for _, n := range names[1:] {
+		if NormalizeName(n) != NormalizeName(p.Name) {
+			p.Aliases = append(p.Aliases, n)
+		}
+	}
+	p.Email = strings.ToLower(first(attrs["mail"]))
+	p.Title = first(attrs["title"])
+	d.Add(p)
+}
+
+func first(vals []string) string {
+	if len(vals) == 0 {
+		return ""
+	}
+	return vals[0]
+}
+
+// Add registers a person; the domain of their address becomes internal.
+func (d *Directory) Add(p Person) {
+	if strings.TrimSpace(p.Name) == "" {
+		return
+	}
+	d.People = append(d.People, p)
+	if _, domain, ok := strings.Cut(p.Email, "@"); ok {
+		d.addDomain(domain)
+	}
+}
+
+func (d *Directory) addDomain(domain string) {
+	domain = lists.NormalizeDomain(domain)
+	if domain == "" {
+		return
+	}
+	if entry, ok := d.internal.Match(domain); ok && entry.Value == domain {
+		return
+	}
+	d.Domains = append(d.Domains, domain)
+	d.internal.Add(domain)
+}
+
+// IsInternal reports whether domain is one of the internal domains or a subdomain of one.
+func (d *Directory) IsInternal(domain string) bool {
+	if d == nil {
+		return false
+	}
+	_, ok := d.internal.Match(domain)
+	return ok
+}
+
+// MatchName returns the person whose name (or alias) appears in displayName.
+// Word order, case, diacritics and extra words such as "(CEO)" are ignored;
+// single-word names are never matched to avoid trivial collisions.
+func (d *Directory) MatchName(displayName string) *Person {
+	if d == nil {
+		return nil
+	}
+	words := map[string]bool{}
+	for _, w := range strings.Fields(NormalizeName(displayName)) {
+		words[w] = true
+	}
+	if len(words) < 2 {
+		return nil
+	}
+	for i := range d.People {
+		p := &d.People[i]
+		for _, name := range append([]string{p.Name}, p.Aliases...) {
+			if containsAll(words, strings.Fields(NormalizeName(name))) {
+				return p
+			}
+		}
+	}
+	return nil
+}
+
+func containsAll(words map[string]bool, want []string) bool {
+	if len(want) < 2 {
+		return false
+	}
+	for _, w := range want {
+		if !words[w] {
+			return false
+		}
+	}
+	return true
+}
+
+var stripMarks = transform.Chain(norm.NFD, runes.Remove(runes.In(unicode.Mn)), norm.NFC)
+
+// NormalizeName lowercases a name, removes diacritics and punctuation and
+// collapses whitespace, so "Ștefan  POPESCU" becomes "stefan popescu".
+func NormalizeName(name string) string {
+	folded, _, err := transform.String(stripMarks, name)
+	if err != nil {
+		folded = name
+	}
+	folded = strings.Map(func(r rune) rune {
+		if unicode.IsLetter(r) || unicode.IsDigit(r) {
+			return unicode.ToLower(r)
+		}
+		return ' '
+	}, folded)
+	return strings.Join(strings.Fields(folded), " ")
+}
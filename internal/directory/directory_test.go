@@ -0,0 +1,103 @@
+package directory
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestLoadCSV(t *testing.T) {
+	d := New([]string{"igsu.ro"})
+	csvData := "name,email,title,aliases\n" +
+		"Ion Popescu,Ion.Popescu@igsu.ro,Director General,Popescu Ion;Nelu Popescu\n" +
+		"# comment line\n" +
+		"Maria Ionescu,maria.ionescu@isu.ro,Director Economic,\n"
+	if err := d.LoadCSV(strings.NewReader(csvData)); err != nil {
+		t.Fatalf("LoadCSV: %v", err)
+	}
+	if len(d.People) != 2 {
+		t.Fatalf("expected 2 people, got %d", len(d.People))
+	}
+	if d.People[0].Email != "ion.popescu@igsu.ro" {
+		t.Errorf("unexpected email: %s", d.People[0].Email)
+	}
+	if len(d.People[0].Aliases) != 2 {
+		t.Errorf("expected 2 aliases, got %v", d.People[0].Aliases)
+	}
+	if !d.IsInternal("isu.ro") {
+		t.Error("domain of a directory entry should be internal")
+	}
+	if !d.IsInternal("mail.igsu.ro") {
+		t.Error("subdomain of an internal domain should be internal")
+	}
+	if d.IsInternal("gmail.com") {
+		t.Error("gmail.com should not be internal")
+	}
+}
+
+func TestLoadCSV_NoHeader(t *testing.T) {
+	d := New(nil)
+	if err := d.LoadCSV(strings.NewReader("Andrei Stan,andrei.stan@igsu.ro\n")); err != nil {
+		t.Fatalf("LoadCSV: %v", err)
+	}
+	if len(d.People) != 1 || d.People[0].Email != "andrei.stan@igsu.ro" {
+		t.Fatalf("unexpected people: %+v", d.People)
+	}
+}
+
+func TestLoadLDIF(t *testing.T) {
+	d := New(nil)
+	ldif := "dn: cn=Stefan Dumitrescu,ou=people,dc=igsu,dc=ro\n" +
+		"cn: Stefan Dumitrescu\n" +
+		"# exported from\n" +
+		" ldap.igsu.ro\n" +
+		// "Ștefan Dumitrescu" in base64, folded mid-quantum
+		"displayName:: yJh0ZW\n" +
+		" ZhbiBEdW1pdHJlc2N1\n" +
+		"objectSid:: AQUAAAAAAAUVAAAA\n" +
+		" 0GHq9kp9DQI=\n" +
+		"mail: stefan.dumitrescu@igs\n" +
+		" u.ro\n" +
+		"title: Inspector General\n" +
+		"\n" +
+		"dn: cn=Ana Marin,ou=people,dc=igsu,dc=ro\n" +
+		"givenName: Ana\n" +
+		"sn: Marin\n" +
+		"mail: ana.marin@igsu.ro\n"
+	if err := d.LoadLDIF(strings.NewReader(ldif)); err != nil {
+		t.Fatalf("LoadLDIF: %v", err)
+	}
+	if len(d.People) != 2 {
+		t.Fatalf("expected 2 people, got %d", len(d.People))
+	}
+	p := d.People[0]
+	if p.Name != "Ștefan Dumitrescu" {
+		t.Errorf("unexpected name: %q", p.Name)
+	}
+	if p.Email != "stefan.dumitrescu@igsu.ro" {
+		t.Errorf("folded mail not joined: %q", p.Email)
+	}
+	if p.Title != "Inspector General" {
+		t.Errorf("unexpected title: %q", p.Title)
+	}
+	if d.People[1].Name != "Ana Marin" {
+		t.Errorf("givenName+sn not used: %q", d.People[1].Name)
+	}
+}
+
+func TestMatchName(t *testing.T) {
+	d := New([]string{"igsu.ro"})
+	d.Add(Person{Name: "Ștefan Dumitrescu", Email: "stefan.dumitrescu@igsu.ro"})
+	d.Add(Person{Name: "Ana", Email: "ana@igsu.ro"})
+
+	for _, display := range []string{"Stefan Dumitrescu", "DUMITRESCU, Ștefan", "Stefan Dumitrescu (Inspector General)"} {
+		if p := d.MatchName(display); p == nil || p.Email != "stefan.dumitrescu@igsu.ro" {
+			t.Errorf("%q should match Stefan Dumitrescu", display)
+		}
+	}
+	if p := d.MatchName("Stefan"); p != nil {
+		t.Errorf("single word should not match, got %s", p.Name)
+	}
+	if p := d.MatchName("Ana Popa"); p != nil {
+		t.Errorf("single-word directory names should not match, got %s", p.Name)
+	}
+}
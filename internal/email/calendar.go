@@ -0,0 +1,257 @@
+package email
+
+import (
+	"fmt"
+	"net"
+	"net/mail"
+	"net/url"
+	"strings"
+
+	"spamfilter/internal/directory"
+	"spamfilter/internal/publicsuffix"
+
+	"github.com/jhillyerd/enmime"
+)
+
+// Invite is one event from an iCalendar part or .ics attachment.
+type Invite struct {
+	Method      string // REQUEST, CANCEL, ... from the enclosing calendar
+	UID         string
+	Summary     string
+	Organizer   *mail.Address
+	Attendees   []string
+	Location    string
+	Description string
+	URLs        []string
+}
+
+type CalendarCheck struct {
+	Invites  []Invite
+	URLs     []string // links from every invite, for CheckLinks
+	Findings []Finding
+}
+
+// CheckCalendar parses the text/calendar parts and .ics attachments of env
+// and flags invites whose organizer does not match the sender, external
+// organizers presented as internal, and links built to hide where they go.
+// The same invite sent both inline and attached is reported once.
+func CheckCalendar(env *enmime.Envelope, dir *directory.Directory) CalendarCheck {
+	res := CalendarCheck{}
+	if env == nil || env.Root == nil {
+		return res
+	}
+	seen := map[string]bool{}
+	for _, p := range env.Root.BreadthMatchAll(isCalendarPart) {
+		for _, inv := range parseCalendar(string(p.Content)) {
+			key := inv.UID + "\x00" + inv.Summary + "\x00" + inv.Description
+			if seen[key] {
+				continue
+			}
+			seen[key] = true
+			res.Invites = append(res.Invites, inv)
+		}
+	}
+	if len(res.Invites) == 0 {
+		return res
+	}
+
+	reported := map[string]bool{}
+	add := func(f Finding) {
+		if !reported[f.Reason] {
+			reported[f.Reason] = true
+			res.Findings = append(res.Findings, f)
+		}
+	}
+	var from string
+	if m := senderMailbox(env); m != nil {
+		from = strings.ToLower(m.Address)
+	}
+	links := map[string]bool{}
+	for _, inv := range res.Invites {
+		for _, u := range inv.URLs {
+			if !links[u] {
+				links[u] = true
+				res.URLs = append(res.URLs, u)
+			}
+			if why := suspiciousLink(u); why != "" {
+				add(Finding{Check: "calendar-link", Weight: 2.0, Reason: fmt.Sprintf("invite link %s %s", u, why)})
+			}
+		}
+		if inv.Organizer == nil {
+			continue
+		}
+		for _, f := range checkOrganizer(inv.Organizer, from, dir) {
+			add(f)
+		}
+	}
+	return res
+}
+
+// checkOrganizer compares an invite's organizer with the message sender
+// and the internal directory.
+func checkOrganizer(org *mail.Address, from string, dir *directory.Directory) []Finding {
+	var out []Finding
+	addr := strings.ToLower(org.Address)
+	orgDomain, fromDomain := addressDomain(addr), addressDomain(from)
+
+	if person := dir.MatchName(org.Name); person != nil && !dir.IsInternal(orgDomain) {
+		out = append(out, Finding{
+			Check:  "calendar-impersonation",
+			Weight: 4.0,
+			Reason: fmt.Sprintf("invite organizer %s uses the name of internal person %s", addr, person.Name),
+		})
+	}
+	if from == "" || addr == from {
+		return out
+	}
+	if dir.IsInternal(orgDomain) && !dir.IsInternal(fromDomain) {
+		out = append(out, Finding{
+			Check:  "calendar-fake-internal",
+			Weight: 3.5,
+			Reason: fmt.Sprintf("invite names internal organizer %s but was sent from %s", addr, from),
+		})
+		return out
+	}
+	if publicsuffix.OrganizationalDomain(orgDomain) != publicsuffix.OrganizationalDomain(fromDomain) {
+		out = append(out, Finding{
+			Check:  "calendar-organizer",
+			Weight: 1.5,
+			Reason: fmt.Sprintf("invite organizer %s does not match sender %s", addr, from),
+		})
+	}
+	return out
+}
+
+// suspiciousLink says why u looks made to hide its destination, or "".
+func suspiciousLink(u string) string {
+	parsed, err := url.Parse(u)
+	if err != nil {
+		return ""
+	}
+	host := parsed.Hostname()
+	switch {
+	case parsed.User != nil:
+		return fmt.Sprintf("hides its host %s behind %q", host, parsed.User.Username()+"@")
+	case net.ParseIP(host) != nil:
+		return "points to a bare IP address"
+	case strings.HasPrefix(host, "xn--") || strings.Contains(host, ".xn--"):
+		return fmt.Sprintf("uses the punycode host %s", host)
+	}
+	return ""
+}
+
+func isCalendarPart(p *enmime.Part) bool {
+	ct := strings.ToLower(p.ContentType)
+	return ct == "text/calendar" || ct == "application/ics" ||
+		strings.HasSuffix(strings.ToLower(p.FileName), ".ics")
+}
+
+// parseCalendar reads the VEVENTs of an iCalendar (RFC 5545) document.
+// Unknown properties and components are ignored.
+func parseCalendar(data string) []Invite {
+	data = strings.NewReplacer("\r\n ", "", "\r\n\t", "", "\n ", "", "\n\t", "").Replace(data)
+	var out []Invite
+	var method string
+	var inv *Invite
+	var html, links string // X-ALT-DESC, URL and ATTACH values
+	for _, line := range strings.Split(data, "\n") {
+		name, params, value := parseProperty(strings.TrimRight(line, "\r"))
+		switch {
+		case name == "METHOD":
+			method = strings.ToUpper(value)
+		case name == "BEGIN" && strings.EqualFold(value, "VEVENT"):
+			inv, html, links = &Invite{Method: method}, "", ""
+		case inv == nil:
+		case name == "END" && strings.EqualFold(value, "VEVENT"):
+			inv.URLs = calendarURLs(inv, html, links)
+			out = append(out, *inv)
+			inv = nil
+		case name == "UID":
+			inv.UID = value
+		case name == "SUMMARY":
+			inv.Summary = unescapeText(value)
+		case name == "LOCATION":
+			inv.Location = unescapeText(value)
+		case name == "DESCRIPTION":
+			inv.Description = unescapeText(value)
+		case name == "X-ALT-DESC":
+			html = unescapeText(value)
+		case name == "URL" || name == "ATTACH":
+			links += value + "\n"
+		case name == "ORGANIZER":
+			inv.Organizer = &mail.Address{Name: params["CN"], Address: calAddress(value)}
+		case name == "ATTENDEE":
+			inv.Attendees = append(inv.Attendees, calAddress(value))
+		}
+	}
+	return out
+}
+
+// calendarURLs collects the http(s) links of an invite in order.
+func calendarURLs(inv *Invite, html, links string) []string {
+	seen := map[string]bool{}
+	var out []string
+	add := func(u string) {
+		u = strings.TrimRight(u, ".,;:!?")
+		if !seen[u] {
+			seen[u] = true
+			out = append(out, u)
+		}
+	}
+	for _, text := range []string{inv.Location, inv.Description, links, html} {
+		for _, m := range urlPattern.FindAllString(text, -1) {
+			add(m)
+		}
+	}
+	for _, m := range hrefPattern.FindAllStringSubmatch(html, -1) {
+		if strings.HasPrefix(strings.ToLower(m[1]), "http") {
+			add(m[1])
+		}
+	}
+	return out
+}
+
+// parseProperty splits a content line into its upper-cased name, its
+// parameters and its value. Colons and semicolons inside quoted parameter
+// values do not count as separators.
+func parseProperty(line string) (name string, params map[string]string, value string) {
+	params = map[string]string{}
+	quoted := false
+	start := 0
+	var fields []string
+	for i := 0; i < len(line); i++ {
+		switch c := line[i]; {
+		case c == '"':
+			quoted = !quoted
+		case quoted:
+		case c == ';' || c == ':':
+			fields = append(fields, line[start:i])
+			start = i + 1
+			if c == ':' {
+				value = line[i+1:]
+				i = len(line)
+			}
+		}
+	}
+	if len(fields) == 0 {
+		return "", params, ""
+	}
+	for _, f := range fields[1:] {
+		if k, v, ok := strings.Cut(f, "="); ok {
+			params[strings.ToUpper(k)] = strings.Trim(v, `"`)
+		}
+	}
+	return strings.ToUpper(fields[0]), params, value
+}
+
+func calAddress(value string) string {
+	value = strings.TrimSpace(value)
+	if len(value) > 7 && strings.EqualFold(value[:7], "mailto:") {
+		value = value[7:]
+	}
+	return strings.ToLower(value)
+}
+
+func unescapeText(s string) string {
+	return strings.NewReplacer(`\n`, "\n", `\N`, "\n", `\,`, ",", `\;`, ";", `\\`, `\`).Replace(s)
+}
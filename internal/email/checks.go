@@ -2,9 +2,13 @@ package email
 
 import (
 	"bytes"
+	"fmt"
 	"net"
 	"strings"
 
+	"spamfilter/internal/lists"
+	"spamfilter/internal/publicsuffix"
+
 	"github.com/emersion/go-msgauth/dkim"
 	"github.com/jhillyerd/enmime"
 )
@@ -75,7 +79,40 @@ func CheckSPF(env *enmime.Envelope, sourceIP, heloDomain string) (SPFResult, err
 	return result, nil
 }
 
-func CheckDomainBlocklist(env *enmime.Envelope, blocklist []string) DomainCheck {
+// SenderAuth is what authentication established about a message's sender:
+// the DKIM and SPF results and the SMTP envelope sender SPF was checked for.
+type SenderAuth struct {
+	DKIM     []DKIMResult
+	SPF      SPFResult
+	MailFrom string
+}
+
+// Aligned reports whether a DKIM signature or SPF passed for a domain with
+// the same organizational domain as fromDomain, as DMARC's relaxed
+// alignment has it. Without MailFrom SPF is taken for the Return-Path.
+func (a SenderAuth) Aligned(env *enmime.Envelope, fromDomain string) bool {
+	fromOrg := publicsuffix.OrganizationalDomain(fromDomain)
+	for _, d := range a.DKIM {
+		if d.Status == "pass" && publicsuffix.OrganizationalDomain(strings.ToLower(d.Domain)) == fromOrg {
+			return true
+		}
+	}
+	if a.SPF.Status != "pass" {
+		return false
+	}
+	mailFrom := a.MailFrom
+	if mailFrom == "" {
+		mailFrom = strings.Trim(env.GetHeader("Return-Path"), "<> ")
+	}
+	d := addressDomain(mailFrom)
+	return d != "" && publicsuffix.OrganizationalDomain(d) == fromOrg
+}
+
+// CheckDomainBlocklist matches the sender address and domain against the
+// store's blocklist and allowlist. The allowlist applies only to senders
+// authenticated by an aligned DKIM or SPF pass, so that a forged From
+// cannot borrow it; an allowlisted sender is never marked malicious.
+func CheckDomainBlocklist(env *enmime.Envelope, store *lists.Store, auth SenderAuth) DomainCheck {
 	res := DomainCheck{}
 	addr := SenderAddress(env)
 	parts := strings.Split(addr, "@")
@@ -84,15 +121,46 @@ func CheckDomainBlocklist(env *enmime.Envelope, blocklist []string) DomainCheck
 		res.Reason = "invalid sender address"
 		return res
 	}
-	domain := strings.ToLower(strings.TrimSpace(parts[len(parts)-1]))
+	domain := lists.NormalizeDomain(parts[len(parts)-1])
 	res.Domain = domain
-	for _, bad := range blocklist {
-		if domain == strings.ToLower(strings.TrimSpace(bad)) {
-			res.Malicious = true
-			res.Reason = "sender domain in blocklist"
-			return res
-		}
+	allowed := store.MatchAddress(lists.Allow, addr)
+	if allowed != nil && auth.Aligned(env, domain) {
+		res.Allowlisted = true
+		res.Entry = allowed
+		res.Reason = "sender in allowlist: " + allowed.Describe()
+		return res
+	}
+	if entry := store.MatchAddress(lists.Block, addr); entry != nil {
+		res.Malicious = true
+		res.Entry = entry
+		res.Reason = "sender in blocklist: " + entry.Describe()
+		return res
 	}
 	res.Reason = "not in blocklist"
+	if allowed != nil {
+		res.Reason += "; allowlist ignored, no aligned DKIM or SPF pass"
+	}
+	return res
+}
+
+// CheckSourceIP matches the connecting IP against the store's CIDR lists.
+func CheckSourceIP(ip string, store *lists.Store) IPCheck {
+	res := IPCheck{IP: ip}
+	if ip == "" {
+		return res
+	}
+	if entry := store.MatchIP(lists.Allow, ip); entry != nil {
+		res.Allowlisted = true
+		res.Entry = entry
+		return res
+	}
+	if entry := store.MatchIP(lists.Block, ip); entry != nil {
+		res.Entry = entry
+		res.Findings = append(res.Findings, Finding{
+			Check:  "ip-blocklist",
+			Weight: 5.0 * entry.Weight(),
+			Reason: fmt.Sprintf("source IP %s in blocklist: %s", ip, entry.Describe()),
+		})
+	}
 	return res
 }
@@ -4,11 +4,15 @@ import (
 	"bytes"
 	"fmt"
 	"io"
+	"log"
 	"net/mail"
 	"os"
 	"path/filepath"
 	"strings"
 
+	"spamfilter/internal/lists"
+	"spamfilter/internal/outlook"
+
 	"github.com/jhillyerd/enmime"
 )
 
@@ -41,9 +45,31 @@ type Analysis struct {
 }
 
 type DomainCheck struct {
-	Domain    string
-	Malicious bool
-	Reason    string
+	Domain      string
+	Malicious   bool
+	Allowlisted bool
+	Reason      string
+	Entry       *lists.Entry
+}
+
+type IPCheck struct {
+	IP          string
+	Allowlisted bool
+	Entry       *lists.Entry
+	Findings    []Finding
+}
+
+type LinkCheck struct {
+	URLs     []string
+	Findings []Finding
+}
+
+// Finding is a single weighted indicator raised by a check. Weight is added
+// to the decision score (0-10 scale) when the scorecard is built.
+type Finding struct {
+	Check  string
+	Weight float64
+	Reason string
 }
 
 func LoadEmailsFromDir(dir string) ([]Email, error) {
@@ -56,7 +82,8 @@ func LoadEmailsFromDir(dir string) ([]Email, error) {
 		if entry.IsDir() {
 			continue
 		}
-		if !strings.HasSuffix(strings.ToLower(entry.Name()), ".eml") {
+		ext := strings.ToLower(filepath.Ext(entry.Name()))
+		if ext != ".eml" && ext != ".msg" {
 			continue
 		}
 		path := filepath.Join(dir, entry.Name())
@@ -64,6 +91,14 @@ func LoadEmailsFromDir(dir string) ([]Email, error) {
 		if err != nil {
 			return nil, err
 		}
+		if ext == ".msg" {
+			// Outlook items are analysed in their RFC 822 form. One that
+			// cannot be converted is skipped rather than failing the run.
+			if raw, err = outlook.Convert(raw); err != nil {
+				log.Printf("Skipping %s: %v", path, err)
+				continue
+			}
+		}
 		env, err := parseEnvelope(raw)
 		if err != nil {
 			return nil, fmt.Errorf("parse %s: %w", entry.Name(), err)
@@ -77,6 +112,51 @@ func parseEnvelope(raw []byte) (*enmime.Envelope, error) {
 	return enmime.ReadEnvelope(bytes.NewReader(raw))
 }
 
+// AttachedMessages parses the messages attached to em, as message/rfc822
+// parts, .eml files or Outlook .msg files, into Emails of their own. Their
+// ID is the path from em, e.g. "report.eml/Fwd: invoice.eml"; unnamed
+// parts are numbered. Parts that do not parse as a message are skipped.
+func AttachedMessages(em *Email) []Email {
+	if em.Envelope == nil {
+		return nil
+	}
+	var out []Email
+	n := 0
+	env := em.Envelope
+	for _, parts := range [][]*enmime.Part{env.Attachments, env.Inlines, env.OtherParts} {
+		for _, p := range parts {
+			ct := strings.ToLower(p.ContentType)
+			name := p.FileName
+			ext := strings.ToLower(filepath.Ext(name))
+			raw := p.Content
+			switch {
+			case ct == "message/rfc822" || ext == ".eml":
+			case ct == "application/vnd.ms-outlook" || ext == ".msg":
+				var err error
+				if raw, err = outlook.Convert(raw); err != nil {
+					continue
+				}
+			default:
+				continue
+			}
+			n++
+			if name == "" {
+				name = fmt.Sprintf("message %d", n)
+			}
+			child, err := parseEnvelope(raw)
+			if err != nil || child.Root == nil || len(child.Root.Header) == 0 {
+				continue
+			}
+			id := name
+			if em.ID != "" {
+				id = em.ID + "/" + name
+			}
+			out = append(out, Email{ID: id, Raw: raw, Envelope: child})
+		}
+	}
+	return out
+}
+
 func SenderAddress(env *enmime.Envelope) string {
 	from := env.GetHeader("From")
 	addr, err := mail.ParseAddress(from)
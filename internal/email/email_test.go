@@ -1,13 +1,19 @@
 package email
 
 import (
+	"encoding/base64"
+	"os"
 	"path/filepath"
+	"strings"
 	"testing"
+
+	"spamfilter/internal/directory"
+	"spamfilter/internal/lists"
 )
 
 func loadSamples(t *testing.T) map[string]Email {
 	t.Helper()
-	dir := filepath.Clean("../../samples")
+	dir := filepath.Clean("testdata")
 	emails, err := LoadEmailsFromDir(dir)
 	if err != nil {
 		t.Fatalf("load samples: %v", err)
@@ -19,6 +25,15 @@ func loadSamples(t *testing.T) map[string]Email {
 	return m
 }
 
+func newStore(t *testing.T, mode lists.MatchMode, blocked ...string) *lists.Store {
+	t.Helper()
+	store := lists.NewStore(mode)
+	if err := store.AddStatic(lists.Block, blocked, "test"); err != nil {
+		t.Fatalf("AddStatic: %v", err)
+	}
+	return store
+}
+
 func TestLoadEmailsFromDir(t *testing.T) {
 	emails := loadSamples(t)
 	if len(emails) != 2 {
@@ -37,8 +52,8 @@ func TestDomainBlocklist(t *testing.T) {
 	spam := emails["spam.eml"]
 	ham := emails["ham.eml"]
 
-	blocklist := []string{"spamsite.biz"}
-	resSpam := CheckDomainBlocklist(spam.Envelope, blocklist)
+	blocklist := newStore(t, lists.MatchExact, "spamsite.biz")
+	resSpam := CheckDomainBlocklist(spam.Envelope, blocklist, SenderAuth{})
 	if !resSpam.Malicious {
 		t.Fatalf("spam domain should be flagged")
 	}
@@ -46,12 +61,78 @@ func TestDomainBlocklist(t *testing.T) {
 		t.Fatalf("unexpected domain: %s", resSpam.Domain)
 	}
 
-	resHam := CheckDomainBlocklist(ham.Envelope, blocklist)
+	resHam := CheckDomainBlocklist(ham.Envelope, blocklist, SenderAuth{})
 	if resHam.Malicious {
 		t.Fatalf("ham domain should not be flagged")
 	}
 }
 
+func TestDomainBlocklist_MatchModes(t *testing.T) {
+	em := parseMessage(t, "From: <promo@mail.spam.com>\r\nSubject: x\r\n\r\nbody\r\n")
+
+	if res := CheckDomainBlocklist(em.Envelope, newStore(t, lists.MatchExact, "spam.com"), SenderAuth{}); res.Malicious {
+		t.Errorf("exact mode should not block a subdomain")
+	}
+	if res := CheckDomainBlocklist(em.Envelope, newStore(t, lists.MatchSubdomain, "spam.com"), SenderAuth{}); !res.Malicious {
+		t.Errorf("subdomain mode should block mail.spam.com when spam.com is listed")
+	}
+	if res := CheckDomainBlocklist(em.Envelope, newStore(t, lists.MatchOrgDomain, "www.spam.com"), SenderAuth{}); !res.Malicious {
+		t.Errorf("org-domain mode should block a sibling host")
+	} else if res.Domain != "mail.spam.com" {
+		t.Errorf("unexpected domain: %s", res.Domain)
+	}
+}
+
+func TestDomainBlocklist_Allowlist(t *testing.T) {
+	em := parseMessage(t, "From: <alerts@partner.spam.com>\r\nSubject: x\r\n\r\nbody\r\n")
+	store := newStore(t, lists.MatchSubdomain, "spam.com  source=soc  # campaign 42")
+	if res := CheckDomainBlocklist(em.Envelope, store, SenderAuth{}); !res.Malicious || !strings.Contains(res.Reason, "source: soc") {
+		t.Fatalf("expected blocklist match with source tag, got %+v", res)
+	}
+	if err := store.AddStatic(lists.Allow, []string{"alerts@partner.spam.com"}, "test"); err != nil {
+		t.Fatal(err)
+	}
+	if res := CheckDomainBlocklist(em.Envelope, store, SenderAuth{}); !res.Malicious || res.Allowlisted {
+		t.Fatalf("allowlist should not apply to an unauthenticated sender, got %+v", res)
+	}
+	foreign := SenderAuth{DKIM: []DKIMResult{{Domain: "esp.example.net", Status: "pass"}}, SPF: SPFResult{Status: "pass"}, MailFrom: "bounce@esp.example.net"}
+	if res := CheckDomainBlocklist(em.Envelope, store, foreign); res.Allowlisted {
+		t.Fatalf("allowlist should not apply when only another domain passed, got %+v", res)
+	}
+	for _, auth := range []SenderAuth{
+		{DKIM: []DKIMResult{{Domain: "spam.com", Status: "pass"}}},
+		{SPF: SPFResult{Status: "pass"}, MailFrom: "bounce@mail.spam.com"},
+	} {
+		if res := CheckDomainBlocklist(em.Envelope, store, auth); res.Malicious || !res.Allowlisted {
+			t.Fatalf("allowlisted address should win over a blocked domain with %+v, got %+v", auth, res)
+		}
+	}
+}
+
+func TestCheckLinks(t *testing.T) {
+	em := parseMessage(t, "From: <a@example.com>\r\nContent-Type: text/html\r\n\r\n"+
+		`<p>Plan: <a href="http://bit.ly/fake-evacuation-plan">aici</a>, docs at https://docs.example.com/a.</p>`+"\r\n")
+	urls := ExtractURLs(em.Envelope)
+	if len(urls) != 2 {
+		t.Fatalf("expected 2 urls, got %v", urls)
+	}
+	store := newStore(t, lists.MatchSubdomain, "url:bit.ly/fake-*")
+	res := CheckLinks(urls, store)
+	if len(res.Findings) != 1 || !strings.Contains(res.Findings[0].Reason, "bit.ly/fake-evacuation-plan") {
+		t.Fatalf("expected the bit.ly link to be blocked, got %+v", res.Findings)
+	}
+}
+
+func TestCheckSourceIP(t *testing.T) {
+	store := newStore(t, lists.MatchSubdomain, "203.0.113.0/24 expires=2999-01-01")
+	if res := CheckSourceIP("203.0.113.7", store); len(res.Findings) != 1 {
+		t.Errorf("expected blocked IP, got %+v", res)
+	}
+	if res := CheckSourceIP("198.51.100.1", store); len(res.Findings) != 0 {
+		t.Errorf("unexpected findings: %+v", res.Findings)
+	}
+}
+
 func TestSPFHeaderAbsent(t *testing.T) {
 	emails := loadSamples(t)
 	spam := emails["spam.eml"]
@@ -67,3 +148,328 @@ func TestSPFHeaderAbsent(t *testing.T) {
 		t.Fatalf("unexpected detail: %s", spfRes.Detail)
 	}
 }
+
+func parseMessage(t *testing.T, raw string) Email {
+	t.Helper()
+	env, err := parseEnvelope([]byte(raw))
+	if err != nil {
+		t.Fatalf("parse message: %v", err)
+	}
+	return Email{ID: "inline.eml", Raw: []byte(raw), Envelope: env}
+}
+
+func TestCheckImpersonation(t *testing.T) {
+	dir := directory.New([]string{"igsu.ro"})
+	dir.Add(directory.Person{Name: "Ion Popescu", Email: "ion.popescu@igsu.ro", Title: "Director General"})
+	dir.Add(directory.Person{Name: "Maria Ionescu", Email: "maria.ionescu@igsu.ro"})
+
+	cases := []struct {
+		name   string
+		from   string
+		checks []string
+	}{
+		{"legitimate", `"Ion Popescu" <ion.popescu@igsu.ro>`, nil},
+		{"external", `"Popescu Ion (CEO)" <ceo.office@gmail.com>`, []string{"impersonation-external"}},
+		{"other mailbox", `"Maria Ionescu" <maria.i@igsu.ro>`, []string{"impersonation-address"}},
+		{"other internal domain", `"Maria Ionescu" <maria.ionescu@mail.igsu.ro>`, []string{"impersonation-domain"}},
+		{"address in name", `"ion.popescu@igsu.ro" <payroll@igsu-ro.net>`, []string{"display-name-address", "impersonation-external"}},
+		{"foreign address in name", `"billing@vendor.com" <payroll@vendor-pay.net>`, []string{"display-name-address"}},
+		{"own address in name", `"news@technews.com" <NEWS@technews.com>`, nil},
+		{"unknown person", `"Newsletter Tech" <news@technews.com>`, nil},
+	}
+	for _, tc := range cases {
+		em := parseMessage(t, "From: "+tc.from+"\r\nSubject: test\r\n\r\nbody\r\n")
+		res := CheckImpersonation(em.Envelope, dir)
+		var got []string
+		for _, f := range res.Findings {
+			got = append(got, f.Check)
+		}
+		if strings.Join(got, ",") != strings.Join(tc.checks, ",") {
+			t.Errorf("%s: expected findings %v, got %v", tc.name, tc.checks, got)
+		}
+	}
+}
+
+func TestCheckHeaderConsistency(t *testing.T) {
+	raw := "From: \"Achizitii\" <achizitii@furnizor.ro>\r\n" +
+		"Reply-To: <furnizor.plati@gmail.com>\r\n" +
+		"Sender: <list@lists.furnizor.ro>\r\n" +
+		"Return-Path: <bounce@esp.example.net>\r\n" +
+		"Subject: factura\r\n\r\nbody\r\n"
+	em := parseMessage(t, raw)
+
+	res := CheckHeaderConsistency(em.Envelope, "<bounce@other.example.org>")
+	got := map[string]float64{}
+	for _, f := range res.Findings {
+		got[f.Check] = f.Weight
+	}
+	if got["reply-to-freemail"] != 3.0 {
+		t.Errorf("expected freemail Reply-To finding, got %v", got)
+	}
+	if _, ok := got["sender-mismatch"]; ok {
+		t.Errorf("Sender on a subdomain of the From domain should not be flagged")
+	}
+	for _, check := range []string{"mail-from-mismatch", "return-path-forged"} {
+		if _, ok := got[check]; !ok {
+			t.Errorf("missing %s finding, got %v", check, got)
+		}
+	}
+	if _, ok := got["return-path-mismatch"]; ok {
+		t.Errorf("Return-Path should count only without MAIL FROM, got %v", got)
+	}
+
+	res = CheckHeaderConsistency(em.Envelope, "")
+	if len(res.Findings) != 2 || res.Findings[1].Check != "return-path-mismatch" || res.Findings[1].Weight != 0.5 {
+		t.Errorf("expected the Return-Path to stand in for MAIL FROM, got %+v", res.Findings)
+	}
+}
+
+func TestCheckHeaderConsistency_Aligned(t *testing.T) {
+	raw := "From: Alice <alice@example.com>\r\n" +
+		"Reply-To: <alice@mail.example.com>\r\n" +
+		"Return-Path: <bounces@example.com>\r\n" +
+		"Subject: hi\r\n\r\nbody\r\n"
+	em := parseMessage(t, raw)
+
+	res := CheckHeaderConsistency(em.Envelope, "bounces@example.com")
+	if len(res.Findings) != 0 {
+		t.Fatalf("expected no findings, got %+v", res.Findings)
+	}
+	if len(res.ReplyTo) != 1 || res.ReplyTo[0] != "alice@mail.example.com" {
+		t.Errorf("unexpected Reply-To: %v", res.ReplyTo)
+	}
+}
+
+func TestCheckHeaderConsistency_FreemailSender(t *testing.T) {
+	// A freemail From replying to another freemail mailbox is unusual but not the BEC pattern.
+	raw := "From: <someone@gmail.com>\r\nReply-To: <other@yahoo.com>\r\nSubject: hi\r\n\r\nbody\r\n"
+	em := parseMessage(t, raw)
+
+	res := CheckHeaderConsistency(em.Envelope, "")
+	if len(res.Findings) != 1 || res.Findings[0].Check != "reply-to-mismatch" {
+		t.Fatalf("expected a single reply-to-mismatch, got %+v", res.Findings)
+	}
+}
+
+// forward wraps inner as an attached message of a new one; name is the
+// attachment's file name, empty for none.
+func forward(subject, name, inner string) string {
+	disposition := "attachment"
+	if name != "" {
+		disposition += `; filename="` + name + `"`
+	}
+	return "From: Ana <ana@igsu.ro>\r\nTo: soc@igsu.ro\r\nSubject: " + subject + "\r\n" +
+		"MIME-Version: 1.0\r\nContent-Type: multipart/mixed; boundary=\"b-" + subject + "\"\r\n\r\n" +
+		"--b-" + subject + "\r\nContent-Type: text/plain\r\n\r\nSee attached.\r\n" +
+		"--b-" + subject + "\r\nContent-Type: message/rfc822\r\nContent-Disposition: " + disposition + "\r\n\r\n" +
+		inner + "\r\n--b-" + subject + "--\r\n"
+}
+
+func TestAttachedMessages(t *testing.T) {
+	original := "From: Plati <plati@anaf-ro.top>\r\nSubject: Factura restanta\r\n\r\nPlatiti aici.\r\n"
+	em := parseMessage(t, forward("outer", "", forward("middle", "fw.eml", original)))
+
+	children := AttachedMessages(&em)
+	if len(children) != 1 {
+		t.Fatalf("expected 1 attached message, got %d", len(children))
+	}
+	if children[0].ID != "inline.eml/message 1" {
+		t.Errorf("unnamed part ID = %q", children[0].ID)
+	}
+	if got := children[0].Envelope.GetHeader("Subject"); got != "middle" {
+		t.Errorf("Subject = %q, want middle", got)
+	}
+
+	grandchildren := AttachedMessages(&children[0])
+	if len(grandchildren) != 1 {
+		t.Fatalf("expected 1 message inside the attached one, got %d", len(grandchildren))
+	}
+	if grandchildren[0].ID != "inline.eml/message 1/fw.eml" {
+		t.Errorf("nested ID = %q", grandchildren[0].ID)
+	}
+	if got := SenderAddress(grandchildren[0].Envelope); got != "plati@anaf-ro.top" {
+		t.Errorf("sender = %q", got)
+	}
+	if len(AttachedMessages(&grandchildren[0])) != 0 {
+		t.Error("a plain message has no attached messages")
+	}
+}
+
+// invite returns a message from "from" carrying ics both as the
+// text/calendar alternative and as an invite.ics attachment.
+func invite(from, ics string) string {
+	ics = strings.ReplaceAll(ics, "\n", "\r\n")
+	return "From: " + from + "\r\nTo: ana@igsu.ro\r\nSubject: Invitatie\r\nMIME-Version: 1.0\r\n" +
+		"Content-Type: multipart/mixed; boundary=\"mixed\"\r\n\r\n" +
+		"--mixed\r\nContent-Type: multipart/alternative; boundary=\"alt\"\r\n\r\n" +
+		"--alt\r\nContent-Type: text/plain\r\n\r\nAveti o invitatie.\r\n" +
+		"--alt\r\nContent-Type: text/calendar; method=REQUEST\r\n\r\n" + ics + "\r\n--alt--\r\n" +
+		"--mixed\r\nContent-Type: application/ics\r\nContent-Disposition: attachment; filename=\"invite.ics\"\r\n\r\n" +
+		ics + "\r\n--mixed--\r\n"
+}
+
+func TestParseCalendar(t *testing.T) {
+	ics := "BEGIN:VCALENDAR\nMETHOD:REQUEST\nBEGIN:VEVENT\nUID:42@igsu.ro\n" +
+		"SUMMARY:Sedinta\\, urgent\n" +
+		"ORGANIZER;CN=\"Popescu, Ion: Director\":mailto:Ion.Popescu@igsu.ro\n" +
+		"ATTENDEE;ROLE=REQ-PARTICIPANT:MAILTO:ana@igsu.ro\n" +
+		"DESCRIPTION:Intrati la https://meet.example.com/j/\n 123 inainte de ora 10.\\nMultumim\n" +
+		"LOCATION:Sala 2\n" +
+		"X-ALT-DESC;FMTTYPE=text/html:<a href=\"https://docs.example.com/agenda\">agenda</a>\n" +
+		"END:VEVENT\nEND:VCALENDAR\n"
+
+	invites := parseCalendar(strings.ReplaceAll(ics, "\n", "\r\n"))
+	if len(invites) != 1 {
+		t.Fatalf("expected 1 invite, got %d", len(invites))
+	}
+	inv := invites[0]
+	if inv.Method != "REQUEST" || inv.UID != "42@igsu.ro" || inv.Summary != "Sedinta, urgent" || inv.Location != "Sala 2" {
+		t.Errorf("unexpected invite %+v", inv)
+	}
+	if inv.Organizer == nil || inv.Organizer.Name != "Popescu, Ion: Director" || inv.Organizer.Address != "ion.popescu@igsu.ro" {
+		t.Errorf("organizer = %+v", inv.Organizer)
+	}
+	if len(inv.Attendees) != 1 || inv.Attendees[0] != "ana@igsu.ro" {
+		t.Errorf("attendees = %v", inv.Attendees)
+	}
+	if !strings.HasSuffix(inv.Description, "ora 10.\nMultumim") {
+		t.Errorf("description not unfolded and unescaped: %q", inv.Description)
+	}
+	want := "https://meet.example.com/j/123,https://docs.example.com/agenda"
+	if got := strings.Join(inv.URLs, ","); got != want {
+		t.Errorf("URLs = %s, want %s", got, want)
+	}
+}
+
+func TestCheckCalendar(t *testing.T) {
+	dir := directory.New([]string{"igsu.ro"})
+	dir.Add(directory.Person{Name: "Ion Popescu", Email: "ion.popescu@igsu.ro"})
+	event := func(organizer, extra string) string {
+		return "BEGIN:VCALENDAR\nBEGIN:VEVENT\nUID:1\nSUMMARY:Sedinta\nORGANIZER" + organizer + "\n" + extra + "END:VEVENT\nEND:VCALENDAR"
+	}
+
+	cases := []struct {
+		name   string
+		from   string
+		ics    string
+		checks []string
+	}{
+		{"internal", "<ion.popescu@igsu.ro>", event(";CN=Ion Popescu:mailto:ion.popescu@igsu.ro", ""), nil},
+		{"same organization", "<calendar@mail.vendor.com>", event(":mailto:sales@vendor.com", ""), nil},
+		{"other organizer", "<events@vendor.com>", event(":mailto:someone@elsewhere.net", ""), []string{"calendar-organizer"}},
+		{"fake internal organizer", "<noreply@meet-invite.top>", event(":mailto:ion.popescu@igsu.ro", ""), []string{"calendar-fake-internal"}},
+		{"internal name, external address", "<director@gmail.com>", event(";CN=Ion Popescu:mailto:director@gmail.com", ""), []string{"calendar-impersonation"}},
+		{"suspicious links", "<events@vendor.com>", event(":mailto:events@vendor.com",
+			"DESCRIPTION:Login http://igsu.ro@198.51.100.7/login sau http://203.0.113.9/x\nURL:https://xn--igs-xma.ro/\n"),
+			[]string{"calendar-link", "calendar-link", "calendar-link"}},
+	}
+	for _, tc := range cases {
+		em := parseMessage(t, invite(tc.from, tc.ics))
+		res := CheckCalendar(em.Envelope, dir)
+		if len(res.Invites) != 1 {
+			t.Errorf("%s: expected the inline and attached invite once, got %d", tc.name, len(res.Invites))
+		}
+		var got []string
+		for _, f := range res.Findings {
+			got = append(got, f.Check)
+		}
+		if strings.Join(got, ",") != strings.Join(tc.checks, ",") {
+			t.Errorf("%s: expected findings %v, got %v", tc.name, tc.checks, res.Findings)
+		}
+	}
+
+	em := parseMessage(t, "From: a@b.ro\r\nSubject: x\r\n\r\nno invite\r\n")
+	if res := CheckCalendar(em.Envelope, dir); len(res.Invites)+len(res.Findings) != 0 {
+		t.Errorf("expected nothing for a plain message, got %+v", res)
+	}
+}
+
+func TestLoadEmailsFromDir_BrokenMsg(t *testing.T) {
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "broken.msg"), []byte("not a compound file"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, "ok.eml"), []byte("From: a@example.com\r\nSubject: x\r\n\r\nbody\r\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	emails, err := LoadEmailsFromDir(dir)
+	if err != nil || len(emails) != 1 || emails[0].ID != "ok.eml" {
+		t.Fatalf("expected ok.eml alone, got %v, %v", emails, err)
+	}
+}
+
+func TestLoadEmailsFromDir_Outlook(t *testing.T) {
+	emails, err := LoadEmailsFromDir(filepath.Join("testdata", "msg"))
+	if err != nil {
+		t.Fatalf("load: %v", err)
+	}
+	if len(emails) != 1 || emails[0].ID != "forwarded.msg" {
+		t.Fatalf("expected forwarded.msg, got %v", emails)
+	}
+	em := emails[0]
+	if got := SenderAddress(em.Envelope); got != "ion.popescu@igsu.ro" {
+		t.Errorf("sender = %q", got)
+	}
+	if !strings.Contains(em.Envelope.Text, "este legitim?") {
+		t.Errorf("body = %q", em.Envelope.Text)
+	}
+	if !strings.HasPrefix(string(em.Raw), "From: ") {
+		t.Errorf("Raw should hold the converted message, starts with %q", em.Raw[:min(len(em.Raw), 16)])
+	}
+
+	attached := AttachedMessages(&em)
+	if len(attached) != 1 || SenderAddress(attached[0].Envelope) != "premii@spamsite.biz" {
+		t.Fatalf("expected the forwarded Outlook item, got %d messages", len(attached))
+	}
+	urls := ExtractURLs(attached[0].Envelope)
+	if len(urls) != 1 || urls[0] != "http://premii.spamsite.biz/confirmare?id=8812" {
+		t.Errorf("URLs = %v", urls)
+	}
+}
+
+func TestAttachedMessages_Outlook(t *testing.T) {
+	data, err := os.ReadFile(filepath.Join("testdata", "msg", "forwarded.msg"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	raw := "From: Ana <ana@igsu.ro>\r\nSubject: de verificat\r\nMIME-Version: 1.0\r\n" +
+		"Content-Type: multipart/mixed; boundary=\"b\"\r\n\r\n" +
+		"--b\r\nContent-Type: text/plain\r\n\r\nVezi atasamentul.\r\n" +
+		"--b\r\nContent-Type: application/vnd.ms-outlook\r\nContent-Disposition: attachment; filename=\"Fw.msg\"\r\n" +
+		"Content-Transfer-Encoding: base64\r\n\r\n" + base64.StdEncoding.EncodeToString(data) + "\r\n--b--\r\n"
+	em := parseMessage(t, raw)
+
+	attached := AttachedMessages(&em)
+	if len(attached) != 1 || attached[0].ID != "inline.eml/Fw.msg" {
+		t.Fatalf("expected Fw.msg, got %v", attached)
+	}
+	if got := attached[0].Envelope.GetHeader("Subject"); got != "Fw: Ati castigat!" {
+		t.Errorf("Subject = %q", got)
+	}
+	if len(AttachedMessages(&attached[0])) != 1 {
+		t.Error("the item attached to the .msg should be found in turn")
+	}
+}
+
+func TestDetectLanguage(t *testing.T) {
+	cases := []struct{ text, want string }{
+		{"Stimate client, contul dumneavoastră a fost suspendat. Vă rugăm să confirmați datele în 24 de ore.", "ro"},
+		{"Stimate client, contul dumneavoastra a fost suspendat si va fi sters daca nu confirmati datele.", "ro"},
+		{"Dear customer, your account has been suspended. Please confirm your details within 24 hours.", "en"},
+		{"Kedves Ügyfelünk! Az Ön fiókja fel van függesztve, kérjük, hogy erősítse meg az adatait.", "hu"},
+		{"Sehr geehrter Kunde, Ihr Konto wurde gesperrt. Bitte bestätigen Sie die Daten mit dem Link.", "de"},
+		{"Cher client, votre compte est suspendu. Merci de confirmer vos données dans les 24 heures pour le débloquer.", "fr"},
+		{"Шановний клієнте, ваш обліковий запис заблоковано.", "uk"},
+		{"Уважаемый клиент, ваш аккаунт заблокирован.", "ru"},
+		{"Factura 2026-014", ""},
+	}
+	for _, tc := range cases {
+		if got := detectLanguage(tc.text); got != tc.want {
+			t.Errorf("detectLanguage(%q) = %q, want %q", tc.text, got, tc.want)
+		}
+	}
+	samples := loadSamples(t)
+	if got := DetectLanguage(samples["ham.eml"].Envelope); got != "ro" {
+		t.Errorf("ham.eml: %q", got)
+	}
+}
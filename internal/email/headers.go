@@ -0,0 +1,131 @@
+package email
+
+import (
+	"fmt"
+	"net/mail"
+	"strings"
+
+	"spamfilter/internal/publicsuffix"
+
+	"github.com/jhillyerd/enmime"
+)
+
+type HeaderCheck struct {
+	From       string
+	Sender     string
+	ReplyTo    []string
+	ReturnPath string
+	MailFrom   string
+	Findings   []Finding
+}
+
+var freemailDomains = map[string]bool{
+	"gmail.com": true, "googlemail.com": true,
+	"yahoo.com": true, "yahoo.ro": true, "ymail.com": true,
+	"outlook.com": true, "hotmail.com": true, "live.com": true, "msn.com": true,
+	"aol.com": true, "icloud.com": true, "me.com": true,
+	"gmx.com": true, "gmx.net": true, "gmx.de": true, "mail.com": true,
+	"proton.me": true, "protonmail.com": true, "tutanota.com": true, "zoho.com": true,
+	"yandex.com": true, "yandex.ru": true, "mail.ru": true,
+	"qq.com": true, "163.com": true,
+}
+
+// IsFreemail reports whether domain belongs to a public webmail provider.
+func IsFreemail(domain string) bool {
+	return freemailDomains[publicsuffix.OrganizationalDomain(domain)]
+}
+
+// CheckHeaderConsistency compares the organizational domains of From,
+// Sender, Reply-To, Return-Path and the envelope MAIL FROM (mailFrom, may be
+// empty). Each mismatch becomes a weighted finding; a freemail Reply-To on a
+// corporate sender is weighted highest since it is the usual BEC pattern,
+// while a different envelope sender alone is common with mailing services.
+func CheckHeaderConsistency(env *enmime.Envelope, mailFrom string) HeaderCheck {
+	res := HeaderCheck{MailFrom: strings.ToLower(strings.Trim(strings.TrimSpace(mailFrom), "<>"))}
+	if from := senderMailbox(env); from != nil {
+		res.From = strings.ToLower(from.Address)
+	}
+	res.Sender = headerAddress(env, "Sender")
+	res.ReturnPath = headerAddress(env, "Return-Path")
+	if list, err := env.AddressList("Reply-To"); err == nil {
+		for _, a := range list {
+			res.ReplyTo = append(res.ReplyTo, strings.ToLower(a.Address))
+		}
+	}
+
+	fromDomain := addressDomain(res.From)
+	if fromDomain == "" {
+		return res
+	}
+	fromOrg := publicsuffix.OrganizationalDomain(fromDomain)
+	corporate := !IsFreemail(fromDomain)
+
+	for _, rt := range res.ReplyTo {
+		rtDomain := addressDomain(rt)
+		if rtDomain == "" || publicsuffix.OrganizationalDomain(rtDomain) == fromOrg {
+			continue
+		}
+		if corporate && IsFreemail(rtDomain) {
+			res.Findings = append(res.Findings, Finding{
+				Check:  "reply-to-freemail",
+				Weight: 3.0,
+				Reason: fmt.Sprintf("replies to %s (freemail) for corporate sender %s", rt, res.From),
+			})
+			continue
+		}
+		res.Findings = append(res.Findings, Finding{
+			Check:  "reply-to-mismatch",
+			Weight: 1.5,
+			Reason: fmt.Sprintf("Reply-To domain %s differs from From domain %s", rtDomain, fromDomain),
+		})
+	}
+
+	if d := addressDomain(res.Sender); d != "" && publicsuffix.OrganizationalDomain(d) != fromOrg {
+		res.Findings = append(res.Findings, Finding{
+			Check:  "sender-mismatch",
+			Weight: 1.0,
+			Reason: fmt.Sprintf("Sender domain %s differs from From domain %s", d, fromDomain),
+		})
+	}
+
+	// Return-Path and MAIL FROM name the same envelope sender, usually a
+	// bounce domain of the sending service, so they count as one signal:
+	// MAIL FROM when it is known, the Return-Path header otherwise.
+	check, what, envelope := "mail-from-mismatch", "envelope MAIL FROM", res.MailFrom
+	if envelope == "" {
+		check, what, envelope = "return-path-mismatch", "Return-Path", res.ReturnPath
+	}
+	if d := addressDomain(envelope); d != "" && publicsuffix.OrganizationalDomain(d) != fromOrg {
+		weight := 0.5
+		if corporate && IsFreemail(d) {
+			weight = 2.0
+		}
+		res.Findings = append(res.Findings, Finding{
+			Check:  check,
+			Weight: weight,
+			Reason: fmt.Sprintf("%s domain %s differs from From domain %s", what, d, fromDomain),
+		})
+	}
+
+	if d := addressDomain(res.MailFrom); d != "" {
+		if rp := addressDomain(res.ReturnPath); rp != "" && publicsuffix.OrganizationalDomain(rp) != publicsuffix.OrganizationalDomain(d) {
+			res.Findings = append(res.Findings, Finding{
+				Check:  "return-path-forged",
+				Weight: 1.0,
+				Reason: fmt.Sprintf("Return-Path domain %s does not match envelope MAIL FROM domain %s", rp, d),
+			})
+		}
+	}
+	return res
+}
+
+func headerAddress(env *enmime.Envelope, name string) string {
+	value := strings.TrimSpace(env.GetHeader(name))
+	if value == "" || value == "<>" {
+		return ""
+	}
+	if addr, err := mail.ParseAddress(value); err == nil {
+		return strings.ToLower(addr.Address)
+	}
+	return strings.ToLower(strings.Trim(value, "<>"))
+}
@@ -0,0 +1,116 @@
+package email
+
+import (
+	"fmt"
+	"net/mail"
+	"regexp"
+	"strings"
+
+	"spamfilter/internal/directory"
+	"spamfilter/internal/publicsuffix"
+
+	"github.com/jhillyerd/enmime"
+)
+
+type ImpersonationCheck struct {
+	DisplayName string
+	Address     string
+	Person      *directory.Person
+	Findings    []Finding
+}
+
+var embeddedAddress = regexp.MustCompile(`[A-Za-z0-9._%+\-]+@[A-Za-z0-9.\-]+\.[A-Za-z]{2,}`)
+
+// CheckImpersonation compares the From display name with the internal
+// directory. It flags external senders using an internal person's name,
+// internal names sent from a different internal domain or mailbox, and
+// display names that show an address other than the sender's.
+func CheckImpersonation(env *enmime.Envelope, dir *directory.Directory) ImpersonationCheck {
+	res := ImpersonationCheck{}
+	from := senderMailbox(env)
+	if from == nil {
+		return res
+	}
+	res.DisplayName = from.Name
+	res.Address = strings.ToLower(from.Address)
+	domain := addressDomain(res.Address)
+
+	// A name that only repeats the sender's own address is common and
+	// harmless; one showing a different address hides the real sender.
+	if embedded := embeddedAddress.FindString(from.Name); embedded != "" && !strings.EqualFold(embedded, res.Address) {
+		res.Findings = append(res.Findings, Finding{
+			Check:  "display-name-address",
+			Weight: 2.5,
+			Reason: fmt.Sprintf("display name shows %s but mail comes from %s", strings.ToLower(embedded), res.Address),
+		})
+	}
+
+	person := dir.MatchName(from.Name)
+	if person == nil {
+		return res
+	}
+	res.Person = person
+	if person.Email != "" && person.Email == res.Address {
+		return res
+	}
+
+	switch {
+	case !dir.IsInternal(domain):
+		reason := fmt.Sprintf("external sender %s uses the name of internal person %s", res.Address, person.Name)
+		if person.Title != "" {
+			reason += " (" + person.Title + ")"
+		}
+		if lookalike := lookalikeOf(domain, dir); lookalike != "" {
+			reason += fmt.Sprintf("; domain %s imitates %s", domain, lookalike)
+		}
+		res.Findings = append(res.Findings, Finding{Check: "impersonation-external", Weight: 4.0, Reason: reason})
+	case person.Email != "" && addressDomain(person.Email) != domain:
+		res.Findings = append(res.Findings, Finding{
+			Check:  "impersonation-domain",
+			Weight: 2.0,
+			Reason: fmt.Sprintf("name %s is registered at %s but mail comes from %s", person.Name, addressDomain(person.Email), domain),
+		})
+	case person.Email != "":
+		res.Findings = append(res.Findings, Finding{
+			Check:  "impersonation-address",
+			Weight: 1.0,
+			Reason: fmt.Sprintf("name %s is used by %s instead of %s", person.Name, res.Address, person.Email),
+		})
+	}
+	return res
+}
+
+func senderMailbox(env *enmime.Envelope) *mail.Address {
+	if list, err := env.AddressList("From"); err == nil && len(list) > 0 {
+		return list[0]
+	}
+	from := env.GetHeader("From")
+	if from == "" {
+		return nil
+	}
+	if addr, err := mail.ParseAddress(from); err == nil {
+		return addr
+	}
+	return &mail.Address{Address: from}
+}
+
+func addressDomain(addr string) string {
+	at := strings.LastIndex(addr, "@")
+	if at < 0 {
+		return ""
+	}
+	return strings.ToLower(strings.TrimSpace(addr[at+1:]))
+}
+
+// lookalikeOf returns the internal domain whose registrable label appears
+// inside domain, e.g. igsu.ro for igsu-alert-system.net.
+func lookalikeOf(domain string, dir *directory.Directory) string {
+	for _, internal := range dir.Domains {
+		org := publicsuffix.OrganizationalDomain(internal)
+		label := strings.TrimSuffix(org, "."+publicsuffix.PublicSuffix(org))
+		if len(label) >= 3 && strings.Contains(domain, label) {
+			return internal
+		}
+	}
+	return ""
+}
@@ -0,0 +1,81 @@
+package email
+
+import (
+	"strings"
+	"unicode"
+
+	"github.com/jhillyerd/enmime"
+)
+
+// stopwords are frequent short words of the languages our mail arrives
+// in; counting them is enough to tell these languages apart.
+var stopwords = map[string][]string{
+	"ro": {"și", "si", "să", "sa", "în", "pentru", "este", "sunt", "care", "vă", "va", "dumneavoastră", "dumneavoastra",
+		"acest", "această", "aceasta", "fost", "sau", "mai", "din", "cu", "pe", "la", "nu", "contul", "vom", "ați", "ati"},
+	"en": {"the", "and", "to", "of", "you", "your", "is", "for", "this", "that", "please", "with", "are", "we",
+		"have", "be", "on", "not", "our", "will", "account", "from"},
+	"hu": {"és", "hogy", "nem", "egy", "van", "az", "ez", "meg", "kérjük", "köszönjük", "ön", "önt", "fiók", "vagy",
+		"már", "csak", "kell", "lesz", "volt"},
+	"de": {"und", "der", "die", "das", "ist", "nicht", "sie", "ihr", "ihre", "mit", "für", "zu", "den", "bitte",
+		"wir", "auf", "ein", "eine", "konto", "werden"},
+	"fr": {"le", "les", "et", "vous", "votre", "est", "pour", "des", "une", "pas", "nous", "que", "dans", "sur",
+		"avec", "compte", "être"},
+}
+
+// minStopwords is how many stopwords a language needs before it is
+// reported.
+const minStopwords = 3
+
+// DetectLanguage returns the ISO 639-1 code of the language the message
+// is written in, or "" when it cannot tell.
+func DetectLanguage(env *enmime.Envelope) string {
+	return detectLanguage(env.GetHeader("Subject") + "\n" + BodyPreview(env, 4000))
+}
+
+func detectLanguage(text string) string {
+	var letters, cyrillic, greek int
+	for _, r := range text {
+		if !unicode.IsLetter(r) {
+			continue
+		}
+		letters++
+		switch {
+		case unicode.Is(unicode.Cyrillic, r):
+			cyrillic++
+		case unicode.Is(unicode.Greek, r):
+			greek++
+		}
+	}
+	if letters > 0 && cyrillic*2 > letters {
+		// Ukrainian has letters Russian does not.
+		if strings.ContainsAny(text, "іїєґІЇЄҐ") {
+			return "uk"
+		}
+		return "ru"
+	}
+	if letters > 0 && greek*2 > letters {
+		return "el"
+	}
+
+	counts := map[string]int{}
+	for _, w := range strings.FieldsFunc(strings.ToLower(text), func(r rune) bool { return !unicode.IsLetter(r) }) {
+		for lang, words := range stopwords {
+			for _, s := range words {
+				if w == s {
+					counts[lang]++
+					break
+				}
+			}
+		}
+	}
+	best, bestCount := "", 0
+	for lang, n := range counts {
+		if n > bestCount || n == bestCount && lang < best {
+			best, bestCount = lang, n
+		}
+	}
+	if bestCount < minStopwords {
+		return ""
+	}
+	return best
+}
@@ -0,0 +1,61 @@
+package email
+
+import (
+	"fmt"
+	"html"
+	"regexp"
+	"strings"
+
+	"spamfilter/internal/lists"
+
+	"github.com/jhillyerd/enmime"
+)
+
+var (
+	urlPattern  = regexp.MustCompile(`(?i)\bhttps?://[^\s<>"'\)\]]+`)
+	hrefPattern = regexp.MustCompile(`(?i)\bhref\s*=\s*["']?([^"'\s>]+)`)
+)
+
+// ExtractURLs returns the unique http(s) links found in the text and HTML
+// bodies, in order of appearance.
+func ExtractURLs(env *enmime.Envelope) []string {
+	seen := map[string]bool{}
+	var out []string
+	add := func(u string) {
+		u = strings.TrimRight(html.UnescapeString(u), ".,;:!?")
+		if !strings.HasPrefix(strings.ToLower(u), "http") || seen[u] {
+			return
+		}
+		seen[u] = true
+		out = append(out, u)
+	}
+	for _, m := range urlPattern.FindAllString(env.Text, -1) {
+		add(m)
+	}
+	for _, m := range hrefPattern.FindAllStringSubmatch(env.HTML, -1) {
+		add(m[1])
+	}
+	for _, m := range urlPattern.FindAllString(env.HTML, -1) {
+		add(m)
+	}
+	return out
+}
+
+// CheckLinks matches every URL against the store's URL patterns and domain
+// lists; allowlisted links are skipped.
+func CheckLinks(urls []string, store *lists.Store) LinkCheck {
+	res := LinkCheck{URLs: urls}
+	for _, u := range urls {
+		if store.MatchURL(lists.Allow, u) != nil {
+			continue
+		}
+		if entry := store.MatchURL(lists.Block, u); entry != nil {
+			res.Findings = append(res.Findings, Finding{
+				Check:  "link-blocklist",
+				Weight: 5.0 * entry.Weight(),
+				Reason: fmt.Sprintf("link %s in blocklist: %s", u, entry.Describe()),
+			})
+		}
+	}
+	return res
+}
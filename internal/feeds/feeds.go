@@ -0,0 +1,90 @@
+package feeds
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// Feed describes one local indicator file exported by the SOC.
+type Feed struct {
+	Name       string   `json:"name"`
+	Path       string   `json:"path"`
+	Format     string   `json:"format"` // text, csv or misp; guessed from the extension when empty
+	TTL        Duration `json:"ttl"`
+	Confidence float64  `json:"confidence"`
+}
+
+// Duration is a time.Duration that unmarshals from strings such as "72h".
+type Duration struct {
+	time.Duration
+}
+
+func (d *Duration) UnmarshalJSON(b []byte) error {
+	var s string
+	if err := json.Unmarshal(b, &s); err != nil {
+		return fmt.Errorf("duration must be a string like \"72h\": %w", err)
+	}
+	v, err := time.ParseDuration(s)
+	if err != nil {
+		return err
+	}
+	d.Duration = v
+	return nil
+}
+
+type config struct {
+	Feeds []Feed `json:"feeds"`
+}
+
+// LoadConfig reads the feed definitions. Relative feed paths are resolved
+// against the directory of the config file.
+func LoadConfig(path string) ([]Feed, error) {
+	raw, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var cfg config
+	if err := json.Unmarshal(raw, &cfg); err != nil {
+		return nil, fmt.Errorf("parse %s: %w", path, err)
+	}
+	seen := map[string]bool{}
+	for i := range cfg.Feeds {
+		f := &cfg.Feeds[i]
+		if f.Name == "" || f.Path == "" {
+			return nil, fmt.Errorf("feed %d: name and path are required", i+1)
+		}
+		if seen[f.Name] {
+			return nil, fmt.Errorf("feed %q defined twice", f.Name)
+		}
+		seen[f.Name] = true
+		if !filepath.IsAbs(f.Path) {
+			f.Path = filepath.Join(filepath.Dir(path), f.Path)
+		}
+		if f.Format == "" {
+			f.Format = guessFormat(f.Path)
+		}
+		if f.Confidence <= 0 || f.Confidence > 1 {
+			f.Confidence = 1
+		}
+	}
+	return cfg.Feeds, nil
+}
+
+func guessFormat(path string) string {
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".csv":
+		return "csv"
+	case ".json":
+		return "misp"
+	}
+	return "text"
+}
+
+// Source is the tag written to list entries imported from the feed.
+func (f Feed) Source() string {
+	return "feed:" + f.Name
+}
@@ -0,0 +1,157 @@
+package feeds
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"spamfilter/internal/lists"
+)
+
+func TestParseFormats(t *testing.T) {
+	cases := []struct {
+		format string
+		input  string
+		want   []string
+		unsup  int
+	}{
+		{"text", "# header\nevil[.]example # phish kit\nhxxp://bad.example/x\n\n", []string{"evil.example", "http://bad.example/x"}, 0},
+		{"csv", "indicator,type,comment\n10.0.0.1,ip-dst,c2\nfoo.example,hostname,\nabc,sha256,hash\n", []string{"ip:10.0.0.1", "domain:foo.example"}, 1},
+		{"csv", "plain.example\nsecond.example,extra\n", []string{"plain.example", "second.example"}, 0},
+		{"misp", `{"Event":{"info":"x","Attribute":[{"type":"url","value":"https://p.example/login","to_ids":true},{"type":"ip-src","value":"192.0.2.1","to_ids":false},{"type":"md5","value":"d41d8cd98f00b204e9800998ecf8427e"}]}}`, []string{"url:https://p.example/login"}, 1},
+		{"misp", `{"response":{"Attribute":[{"type":"email-src","value":"a@b.example"},{"type":"ip-dst|port","value":"192.0.2.7|443"}]}}`, []string{"addr:a@b.example", "ip:192.0.2.7"}, 0},
+		{"misp", `[{"Event":{"Object":[{"Attribute":[{"type":"domain|ip","value":"c.example|192.0.2.9"}]}]}}]`, []string{"domain:c.example", "ip:192.0.2.9"}, 0},
+	}
+	for _, tc := range cases {
+		got, stats, err := Parse(tc.format, strings.NewReader(tc.input))
+		if err != nil {
+			t.Fatalf("%s: %v", tc.format, err)
+		}
+		var values []string
+		for _, ind := range got {
+			values = append(values, ind.Value)
+		}
+		if strings.Join(values, " ") != strings.Join(tc.want, " ") {
+			t.Errorf("%s: got %v, want %v", tc.format, values, tc.want)
+		}
+		if stats.Unsupported != tc.unsup {
+			t.Errorf("%s: unsupported = %d, want %d", tc.format, stats.Unsupported, tc.unsup)
+		}
+	}
+}
+
+func TestLoadConfig(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "feeds.json")
+	writeFile(t, path, `{"feeds":[{"name":"a","path":"a.csv","ttl":"72h","confidence":0.5},{"name":"b","path":"/abs/b.txt"}]}`)
+	feeds, err := LoadConfig(path)
+	if err != nil {
+		t.Fatalf("LoadConfig: %v", err)
+	}
+	if feeds[0].Path != filepath.Join(dir, "a.csv") || feeds[0].Format != "csv" || feeds[0].TTL.Duration != 72*time.Hour {
+		t.Errorf("unexpected feed a: %+v", feeds[0])
+	}
+	if feeds[1].Path != "/abs/b.txt" || feeds[1].Format != "text" || feeds[1].Confidence != 1 {
+		t.Errorf("unexpected feed b: %+v", feeds[1])
+	}
+}
+
+func writeFile(t *testing.T, path, content string) {
+	t.Helper()
+	if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestSync(t *testing.T) {
+	dir := t.TempDir()
+	writeFile(t, filepath.Join(dir, "soc.txt"), "shared.example\nsoc-only.example\nshared.example\ninvalid..example\n")
+	writeFile(t, filepath.Join(dir, "misp.json"), `{"Event":{"info":"campaign","Attribute":[{"type":"domain","value":"shared.example"}]}}`)
+	feeds := []Feed{
+		{Name: "soc", Path: filepath.Join(dir, "soc.txt"), Format: "text", TTL: Duration{24 * time.Hour}, Confidence: 0.5},
+		{Name: "misp", Path: filepath.Join(dir, "misp.json"), Format: "misp", TTL: Duration{48 * time.Hour}, Confidence: 0.9},
+		{Name: "missing", Path: filepath.Join(dir, "missing.csv"), Format: "csv", Confidence: 1},
+	}
+	out := filepath.Join(dir, "lists", "feeds.list")
+	// Lookup loads the file into a Store, which skips entries expired in wall-clock time.
+	now := time.Now().UTC().Truncate(time.Second)
+
+	report, err := Sync(feeds, out, now)
+	if err != nil {
+		t.Fatalf("Sync: %v", err)
+	}
+	if report.Total != 2 {
+		t.Errorf("expected 2 entries, got %d", report.Total)
+	}
+	soc := report.Feeds[0]
+	if soc.Read != 4 || soc.Imported != 2 || soc.Duplicates != 1 || soc.Invalid != 1 {
+		t.Errorf("unexpected soc report: %+v", soc)
+	}
+	if report.Feeds[1].Duplicates != 1 {
+		t.Errorf("cross-feed duplicate not counted: %+v", report.Feeds[1])
+	}
+	if report.Feeds[2].Err == nil {
+		t.Error("missing feed should report an error")
+	}
+
+	entry, err := Lookup(out, "www.shared.example")
+	if err != nil {
+		t.Fatalf("Lookup: %v", err)
+	}
+	if entry == nil || entry.Source != "feed:misp" || entry.Confidence != 0.9 {
+		t.Fatalf("shared indicator should be attributed to the most confident feed, got %+v", entry)
+	}
+	if !strings.Contains(entry.Comment, "also in feed:soc") {
+		t.Errorf("comment should name the other feed: %q", entry.Comment)
+	}
+	if want := now.Add(48 * time.Hour); !entry.Expires.Equal(want) {
+		t.Errorf("expected the longest TTL, got %v", entry.Expires)
+	}
+
+	// The SOC feed drops an indicator: it stays until its TTL, then disappears.
+	writeFile(t, filepath.Join(dir, "soc.txt"), "shared.example\n")
+	report, err = Sync(feeds, out, now.Add(12*time.Hour))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if report.Carried != 1 || report.Total != 2 {
+		t.Errorf("expected soc-only.example to be carried over, got %+v", report)
+	}
+	report, err = Sync(feeds, out, now.Add(25*time.Hour))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if report.Expired != 1 || report.Total != 1 {
+		t.Errorf("expected soc-only.example to expire, got %+v", report)
+	}
+
+	// A feed without a TTL: a withdrawn indicator goes on the next sync,
+	// but not while the feed cannot be read.
+	writeFile(t, filepath.Join(dir, "vendor.txt"), "kept.example\nwithdrawn.example\n")
+	vendor := []Feed{{Name: "vendor", Path: filepath.Join(dir, "vendor.txt"), Format: "text", Confidence: 1}}
+	if _, err := Sync(vendor, out, now); err != nil {
+		t.Fatal(err)
+	}
+	writeFile(t, filepath.Join(dir, "vendor.txt"), "kept.example\n")
+	if report, err = Sync(vendor, out, now); err != nil || report.Removed != 1 {
+		t.Errorf("expected withdrawn.example to be removed, got %+v, %v", report, err)
+	}
+	if e, _ := Lookup(out, "withdrawn.example"); e != nil {
+		t.Errorf("withdrawn indicator still listed: %+v", e)
+	}
+	os.Remove(filepath.Join(dir, "vendor.txt"))
+	if report, err = Sync(vendor, out, now); err != nil || report.Removed != 0 {
+		t.Errorf("entries of an unreadable feed should be kept, got %+v, %v", report, err)
+	}
+	if e, _ := Lookup(out, "kept.example"); e == nil {
+		t.Error("kept.example dropped while its feed could not be read")
+	}
+
+	store := lists.NewStore(lists.MatchSubdomain)
+	store.SetPaths(lists.Block, []string{out})
+	if err := store.Reload(); err != nil {
+		t.Fatalf("synced file must load into a Store: %v", err)
+	}
+}
@@ -0,0 +1,271 @@
+package feeds
+
+import (
+	"bufio"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// Indicator is one raw value read from a feed, in list-entry syntax
+// (optionally with a "domain:", "ip:", "url:" or "addr:" prefix).
+type Indicator struct {
+	Value   string
+	Comment string
+}
+
+// ParseStats counts what a parser skipped.
+type ParseStats struct {
+	Unsupported int
+}
+
+// Parse reads indicators from r using the feed's format.
+func Parse(format string, r io.Reader) ([]Indicator, ParseStats, error) {
+	switch strings.ToLower(format) {
+	case "text", "txt", "":
+		return parseText(r)
+	case "csv":
+		return parseCSV(r)
+	case "misp", "json":
+		return parseMISP(r)
+	}
+	return nil, ParseStats{}, fmt.Errorf("unknown feed format %q", format)
+}
+
+func parseText(r io.Reader) ([]Indicator, ParseStats, error) {
+	var out []Indicator
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") || strings.HasPrefix(line, ";") || strings.HasPrefix(line, "//") {
+			continue
+		}
+		ind := Indicator{}
+		if value, comment, ok := strings.Cut(line, " #"); ok {
+			line, ind.Comment = strings.TrimSpace(value), strings.TrimSpace(comment)
+		}
+		ind.Value = Refang(strings.Fields(line)[0])
+		out = append(out, ind)
+	}
+	return out, ParseStats{}, scanner.Err()
+}
+
+func parseCSV(r io.Reader) ([]Indicator, ParseStats, error) {
+	cr := csv.NewReader(r)
+	cr.FieldsPerRecord = -1
+	cr.TrimLeadingSpace = true
+	cr.Comment = '#'
+
+	var out []Indicator
+	var stats ParseStats
+	valueCol, typeCol, commentCol := 0, -1, -1
+	first := true
+	for {
+		rec, err := cr.Read()
+		if err == io.EOF {
+			return out, stats, nil
+		}
+		if err != nil {
+			return nil, stats, err
+		}
+		if first {
+			first = false
+			if v, t, c, ok := csvColumns(rec); ok {
+				valueCol, typeCol, commentCol = v, t, c
+				continue
+			}
+		}
+		if valueCol >= len(rec) || strings.TrimSpace(rec[valueCol]) == "" {
+			continue
+		}
+		values := []string{Refang(strings.TrimSpace(rec[valueCol]))}
+		if typeCol >= 0 && typeCol < len(rec) {
+			values = typedValues(strings.TrimSpace(rec[typeCol]), values[0])
+			if values == nil {
+				stats.Unsupported++
+				continue
+			}
+		}
+		comment := ""
+		if commentCol >= 0 && commentCol < len(rec) {
+			comment = strings.TrimSpace(rec[commentCol])
+		}
+		for _, v := range values {
+			out = append(out, Indicator{Value: v, Comment: comment})
+		}
+	}
+}
+
+func csvColumns(header []string) (value, typ, comment int, ok bool) {
+	value, typ, comment = -1, -1, -1
+	for i, h := range header {
+		switch strings.ToLower(strings.TrimSpace(h)) {
+		case "indicator", "value", "ioc", "observable":
+			value = i
+		case "type", "indicator_type", "kind":
+			typ = i
+		case "comment", "description", "note":
+			comment = i
+		}
+	}
+	return value, typ, comment, value >= 0
+}
+
+type mispAttribute struct {
+	Type    string `json:"type"`
+	Value   string `json:"value"`
+	Comment string `json:"comment"`
+	ToIDS   *bool  `json:"to_ids"`
+	Deleted bool   `json:"deleted"`
+}
+
+type mispEvent struct {
+	Info      string          `json:"info"`
+	Attribute []mispAttribute `json:"Attribute"`
+	Object    []struct {
+		Attribute []mispAttribute `json:"Attribute"`
+	} `json:"Object"`
+}
+
+type mispWrapper struct {
+	Event *mispEvent `json:"Event"`
+}
+
+// parseMISP accepts a single event ({"Event": ...}), a list of events, a
+// REST search export ({"response": [...]}) or an attribute search export
+// ({"response": {"Attribute": [...]}}). Attributes with to_ids=false are skipped.
+func parseMISP(r io.Reader) ([]Indicator, ParseStats, error) {
+	raw, err := io.ReadAll(r)
+	if err != nil {
+		return nil, ParseStats{}, err
+	}
+	var doc struct {
+		mispWrapper
+		Response json.RawMessage `json:"response"`
+	}
+	var events []mispEvent
+	var attrs []mispAttribute
+
+	trimmed := strings.TrimSpace(string(raw))
+	switch {
+	case strings.HasPrefix(trimmed, "["):
+		var list []mispWrapper
+		if err := json.Unmarshal(raw, &list); err != nil {
+			return nil, ParseStats{}, fmt.Errorf("parse MISP export: %w", err)
+		}
+		for _, w := range list {
+			if w.Event != nil {
+				events = append(events, *w.Event)
+			}
+		}
+	default:
+		if err := json.Unmarshal(raw, &doc); err != nil {
+			return nil, ParseStats{}, fmt.Errorf("parse MISP export: %w", err)
+		}
+		if doc.Event != nil {
+			events = append(events, *doc.Event)
+		}
+		if len(doc.Response) > 0 {
+			var list []mispWrapper
+			var search struct {
+				Attribute []mispAttribute `json:"Attribute"`
+			}
+			if err := json.Unmarshal(doc.Response, &list); err == nil {
+				for _, w := range list {
+					if w.Event != nil {
+						events = append(events, *w.Event)
+					}
+				}
+			} else if err := json.Unmarshal(doc.Response, &search); err == nil {
+				attrs = append(attrs, search.Attribute...)
+			} else {
+				return nil, ParseStats{}, fmt.Errorf("parse MISP response: %w", err)
+			}
+		}
+	}
+
+	var out []Indicator
+	var stats ParseStats
+	add := func(a mispAttribute, info string) {
+		if a.Deleted || (a.ToIDS != nil && !*a.ToIDS) {
+			return
+		}
+		values := typedValues(a.Type, a.Value)
+		if values == nil {
+			stats.Unsupported++
+			return
+		}
+		comment := strings.TrimSpace(strings.Join(nonEmpty(info, a.Comment), ": "))
+		for _, v := range values {
+			out = append(out, Indicator{Value: v, Comment: comment})
+		}
+	}
+	for _, ev := range events {
+		for _, a := range ev.Attribute {
+			add(a, ev.Info)
+		}
+		for _, obj := range ev.Object {
+			for _, a := range obj.Attribute {
+				add(a, ev.Info)
+			}
+		}
+	}
+	for _, a := range attrs {
+		add(a, "")
+	}
+	return out, stats, nil
+}
+
+// typedValues maps a MISP (or CSV) indicator type to list-entry values.
+// Unsupported types return nil.
+func typedValues(typ, value string) []string {
+	value = Refang(strings.TrimSpace(value))
+	if value == "" {
+		return nil
+	}
+	switch strings.ToLower(typ) {
+	case "domain", "hostname":
+		return []string{"domain:" + value}
+	case "ip", "ip-dst", "ip-src", "cidr", "ipv4", "ipv6":
+		return []string{"ip:" + value}
+	case "url", "uri":
+		return []string{"url:" + value}
+	case "email", "email-src", "email-reply-to", "email-address", "address":
+		return []string{"addr:" + value}
+	case "domain|ip":
+		d, ip, ok := strings.Cut(value, "|")
+		if !ok {
+			return nil
+		}
+		return []string{"domain:" + d, "ip:" + ip}
+	case "ip-dst|port", "ip-src|port", "hostname|port":
+		host, _, _ := strings.Cut(value, "|")
+		if strings.HasPrefix(typ, "hostname") {
+			return []string{"domain:" + host}
+		}
+		return []string{"ip:" + host}
+	}
+	return nil
+}
+
+func nonEmpty(vals ...string) []string {
+	var out []string
+	for _, v := range vals {
+		if v = strings.TrimSpace(v); v != "" {
+			out = append(out, v)
+		}
+	}
+	return out
+}
+
+// Refang undoes common defanging so "hxxp://evil[.]com" becomes "http://evil.com".
+func Refang(v string) string {
+	r := strings.NewReplacer(
+		"hxxps", "https", "hXXps", "https", "hxxp", "http", "hXXp", "http",
+		"[.]", ".", "(.)", ".", "{.}", ".", "[dot]", ".",
+		"[@]", "@", "[at]", "@", "[:]", ":",
+	)
+	return r.Replace(v)
+}
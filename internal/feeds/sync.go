@@ -0,0 +1,268 @@
+package feeds
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"spamfilter/internal/lists"
+)
+
+// FeedReport summarizes the import of one feed.
+type FeedReport struct {
+	Name        string
+	Read        int
+	Imported    int
+	Duplicates  int
+	Invalid     int
+	Unsupported int
+	Err         error
+}
+
+// Report summarizes a sync run.
+type Report struct {
+	Output  string
+	Feeds   []FeedReport
+	Carried int // entries kept from the previous sync whose TTL has not run out
+	Expired int // entries dropped because their TTL ran out
+	Removed int // entries without a TTL that no feed lists any more
+	Total   int
+}
+
+// Sync imports every feed into a single list file at outPath. Indicators are
+// deduplicated across feeds; the entry keeps the most confident feed as its
+// source and names the other feeds in its comment. Each import refreshes the
+// entry's expiry to now+TTL; entries from a previous sync that no feed lists
+// any more stay until their expiry, so a feed that is briefly unavailable
+// does not unblock anything. Entries without an expiry, from feeds without
+// a TTL, are dropped as soon as their feed no longer lists them, unless the
+// feed could not be read.
+func Sync(feeds []Feed, outPath string, now time.Time) (Report, error) {
+	report := Report{Output: outPath}
+
+	merged := map[string]*lists.Entry{}
+	also := map[string]map[string]bool{}
+	previous, err := readOutput(outPath)
+	if err != nil {
+		return report, err
+	}
+	for _, e := range previous {
+		if e.Expired(now) {
+			report.Expired++
+			continue
+		}
+		merged[key(e)] = e
+	}
+	fresh := map[string]bool{}
+	failed := map[string]bool{} // sources of the feeds that could not be read
+
+	for _, f := range feeds {
+		fr := FeedReport{Name: f.Name}
+		indicators, stats, err := parseFile(f)
+		fr.Unsupported = stats.Unsupported
+		if err != nil {
+			fr.Err = err
+			failed[f.Source()] = true
+			report.Feeds = append(report.Feeds, fr)
+			continue
+		}
+		seen := map[string]bool{}
+		for _, ind := range indicators {
+			fr.Read++
+			e, err := lists.ParseEntry(ind.Value)
+			if err != nil || e == nil {
+				fr.Invalid++
+				continue
+			}
+			e.Source = f.Source()
+			e.Confidence = f.Confidence
+			e.Comment = ind.Comment
+			if f.TTL.Duration > 0 {
+				e.Expires = now.Add(f.TTL.Duration)
+			}
+			k := key(e)
+			if seen[k] {
+				fr.Duplicates++
+				continue
+			}
+			seen[k] = true
+
+			existing, ok := merged[k]
+			if !ok || !fresh[k] {
+				merged[k] = e
+				fresh[k] = true
+				fr.Imported++
+				continue
+			}
+			// Already imported from another feed in this run.
+			fr.Duplicates++
+			if also[k] == nil {
+				also[k] = map[string]bool{}
+			}
+			if e.Weight() > existing.Weight() {
+				also[k][existing.Source] = true
+				e.Expires = later(e.Expires, existing.Expires)
+				merged[k] = e
+			} else {
+				also[k][e.Source] = true
+				existing.Expires = later(e.Expires, existing.Expires)
+			}
+		}
+		report.Feeds = append(report.Feeds, fr)
+	}
+
+	out := make([]*lists.Entry, 0, len(merged))
+	for k, e := range merged {
+		if !fresh[k] {
+			if e.Expires.IsZero() && !failed[e.Source] {
+				report.Removed++
+				continue
+			}
+			report.Carried++
+		}
+		if len(also[k]) > 0 {
+			others := make([]string, 0, len(also[k]))
+			for src := range also[k] {
+				others = append(others, src)
+			}
+			sort.Strings(others)
+			note := "also in " + strings.Join(others, ", ")
+			if e.Comment != "" {
+				note = e.Comment + "; " + note
+			}
+			e.Comment = note
+		}
+		out = append(out, e)
+	}
+	sort.Slice(out, func(i, j int) bool {
+		if out[i].Kind != out[j].Kind {
+			return out[i].Kind < out[j].Kind
+		}
+		return out[i].Value < out[j].Value
+	})
+	report.Total = len(out)
+	return report, writeOutput(outPath, out, now)
+}
+
+// later returns the later expiry; zero means never and wins.
+func later(a, b time.Time) time.Time {
+	if a.IsZero() || b.IsZero() {
+		return time.Time{}
+	}
+	if a.After(b) {
+		return a
+	}
+	return b
+}
+
+func key(e *lists.Entry) string {
+	return e.Kind.String() + ":" + e.Value
+}
+
+func parseFile(f Feed) ([]Indicator, ParseStats, error) {
+	file, err := os.Open(f.Path)
+	if err != nil {
+		return nil, ParseStats{}, err
+	}
+	defer file.Close()
+	return Parse(f.Format, file)
+}
+
+// readOutput loads the entries written by a previous sync; a missing file
+// is not an error.
+func readOutput(path string) ([]*lists.Entry, error) {
+	f, err := os.Open(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var out []*lists.Entry
+	scanner := bufio.NewScanner(f)
+	line := 0
+	for scanner.Scan() {
+		line++
+		e, err := lists.ParseEntry(scanner.Text())
+		if err != nil {
+			return nil, fmt.Errorf("%s:%d: %w", path, line, err)
+		}
+		if e != nil && strings.HasPrefix(e.Source, "feed:") {
+			out = append(out, e)
+		}
+	}
+	return out, scanner.Err()
+}
+
+// writeOutput replaces the list file atomically so a watching Store never
+// sees a half-written file.
+func writeOutput(path string, entries []*lists.Entry, now time.Time) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(path), "."+filepath.Base(path)+".tmp*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	w := bufio.NewWriter(tmp)
+	fmt.Fprintf(w, "# Generated by `antispam feeds sync` at %s. Do not edit; changes are overwritten.\n", now.UTC().Format(time.RFC3339))
+	for _, e := range entries {
+		fmt.Fprintln(w, e.String())
+	}
+	if err := w.Flush(); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
+
+// Write prints a human readable summary of the sync.
+func (r Report) Write(w io.Writer) {
+	fmt.Fprintf(w, "Feeds synced into %s\n", r.Output)
+	for _, f := range r.Feeds {
+		if f.Err != nil {
+			fmt.Fprintf(w, " [!] %-20s error: %v (previous entries kept until they expire)\n", f.Name, f.Err)
+			continue
+		}
+		fmt.Fprintf(w, " [ ] %-20s read %d, imported %d, duplicates %d, invalid %d, unsupported %d\n",
+			f.Name, f.Read, f.Imported, f.Duplicates, f.Invalid, f.Unsupported)
+	}
+	fmt.Fprintf(w, "Carried over %d, expired %d, removed %d, total %d entries\n", r.Carried, r.Expired, r.Removed, r.Total)
+}
+
+// Lookup reports which feed entry in the synced file matches indicator (a
+// domain, address, IP or URL), so a false positive can be traced to its feed.
+func Lookup(outPath, indicator string) (*lists.Entry, error) {
+	store := lists.NewStore(lists.MatchSubdomain)
+	store.SetPaths(lists.Block, []string{outPath})
+	if err := store.Reload(); err != nil {
+		return nil, err
+	}
+	e, err := lists.ParseEntry(Refang(indicator))
+	if err != nil || e == nil {
+		return nil, fmt.Errorf("invalid indicator %q", indicator)
+	}
+	switch e.Kind {
+	case lists.KindAddress:
+		return store.MatchAddress(lists.Block, e.Value), nil
+	case lists.KindCIDR:
+		return store.MatchIP(lists.Block, strings.Split(e.Value, "/")[0]), nil
+	case lists.KindURL:
+		return store.MatchURL(lists.Block, indicator), nil
+	}
+	return store.MatchDomain(lists.Block, e.Value), nil
+}
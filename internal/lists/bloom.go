@@ -0,0 +1,54 @@
+package lists
+
+import "math"
+
+// bloomFilter answers "definitely not listed" without touching the main
+// index. It is sized once for an expected number of keys and a target
+// false-positive rate.
+type bloomFilter struct {
+	bits []uint64
+	m    uint64
+	k    uint64
+}
+
+func newBloomFilter(n int, fpRate float64) *bloomFilter {
+	if n < 1 {
+		n = 1
+	}
+	m := uint64(math.Ceil(-float64(n) * math.Log(fpRate) / (math.Ln2 * math.Ln2)))
+	m = max(m, 64)
+	k := uint64(math.Round(float64(m) / float64(n) * math.Ln2))
+	k = max(k, 1)
+	return &bloomFilter{bits: make([]uint64, (m+63)/64), m: m, k: k}
+}
+
+// hashes derives the two base hashes used for double hashing.
+func (b *bloomFilter) hashes(key string) (uint64, uint64) {
+	// FNV-1a, inlined to avoid allocating per lookup.
+	h1 := uint64(14695981039346656037)
+	for i := 0; i < len(key); i++ {
+		h1 ^= uint64(key[i])
+		h1 *= 1099511628211
+	}
+	h2 := (h1 >> 33) | (h1 << 31)
+	return h1, h2 | 1
+}
+
+func (b *bloomFilter) add(key string) {
+	h1, h2 := b.hashes(key)
+	for i := uint64(0); i < b.k; i++ {
+		pos := (h1 + i*h2) % b.m
+		b.bits[pos/64] |= 1 << (pos % 64)
+	}
+}
+
+func (b *bloomFilter) mayContain(key string) bool {
+	h1, h2 := b.hashes(key)
+	for i := uint64(0); i < b.k; i++ {
+		pos := (h1 + i*h2) % b.m
+		if b.bits[pos/64]&(1<<(pos%64)) == 0 {
+			return false
+		}
+	}
+	return true
+}
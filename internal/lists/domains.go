@@ -0,0 +1,171 @@
+package lists
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"spamfilter/internal/publicsuffix"
+)
+
+// MatchMode selects how a host is compared against domain list entries.
+type MatchMode int
+
+const (
+	// MatchExact matches only the listed host itself.
+	MatchExact MatchMode = iota
+	// MatchSubdomain matches the listed host and every host below it.
+	MatchSubdomain
+	// MatchOrgDomain matches any host sharing the entry's organizational domain.
+	MatchOrgDomain
+)
+
+func (m MatchMode) String() string {
+	switch m {
+	case MatchExact:
+		return "exact"
+	case MatchSubdomain:
+		return "subdomain"
+	case MatchOrgDomain:
+		return "org-domain"
+	}
+	return fmt.Sprintf("MatchMode(%d)", int(m))
+}
+
+// ParseMatchMode accepts "exact", "subdomain" or "org-domain".
+func ParseMatchMode(s string) (MatchMode, error) {
+	switch strings.ToLower(strings.TrimSpace(s)) {
+	case "exact":
+		return MatchExact, nil
+	case "subdomain", "":
+		return MatchSubdomain, nil
+	case "org-domain", "orgdomain", "org":
+		return MatchOrgDomain, nil
+	}
+	return MatchSubdomain, fmt.Errorf("unknown match mode %q", s)
+}
+
+// DomainList is a set of domains matched with a fixed mode. Entries are
+// normalized once when added and kept in a reversed-label trie, so a lookup
+// costs one step per label of the host however long the list is. An
+// optional Bloom filter rejects most unlisted hosts before the trie walk.
+type DomainList struct {
+	mode  MatchMode
+	trie  domainTrie
+	bloom *bloomFilter
+}
+
+func NewDomainList(domains []string, mode MatchMode) *DomainList {
+	l := &DomainList{mode: mode}
+	for _, d := range domains {
+		l.Add(d)
+	}
+	return l
+}
+
+func (l *DomainList) Mode() MatchMode {
+	return l.mode
+}
+
+func (l *DomainList) Len() int {
+	if l == nil {
+		return 0
+	}
+	return l.trie.size
+}
+
+// Add inserts a domain; a leading "*." or "." is accepted and ignored.
+func (l *DomainList) Add(domain string) {
+	d := NormalizeDomain(domain)
+	if d == "" {
+		return
+	}
+	l.AddEntry(&Entry{Kind: KindDomain, Value: d})
+}
+
+// AddEntry inserts a parsed domain entry, replacing any entry with the same key.
+func (l *DomainList) AddEntry(e *Entry) {
+	key := l.key(e.Value)
+	l.trie.insert(key, e)
+	if l.bloom != nil {
+		l.bloom.add(key)
+	}
+}
+
+// EnablePrefilter builds a Bloom filter over the current entries with the
+// given false-positive rate (e.g. 0.01); entries added later are added to
+// it too. A rate outside (0,1) removes the filter.
+func (l *DomainList) EnablePrefilter(fpRate float64) {
+	if fpRate <= 0 || fpRate >= 1 {
+		l.bloom = nil
+		return
+	}
+	l.bloom = newBloomFilter(l.trie.size, fpRate)
+	l.trie.walk(func(key string) { l.bloom.add(key) })
+}
+
+// Match reports whether host is covered by the list and returns the entry that matched.
+func (l *DomainList) Match(host string) (*Entry, bool) {
+	e := l.match(host, time.Time{})
+	return e, e != nil
+}
+
+// match is Match that skips entries expired at now, so an expired
+// subdomain entry does not hide an active parent. A zero now keeps all.
+func (l *DomainList) match(host string, now time.Time) *Entry {
+	if l == nil || l.trie.size == 0 {
+		return nil
+	}
+	host = NormalizeDomain(host)
+	if host == "" {
+		return nil
+	}
+	switch l.mode {
+	case MatchOrgDomain:
+		key := publicsuffix.OrganizationalDomain(host)
+		if l.bloom != nil && !l.bloom.mayContain(key) {
+			return nil
+		}
+		return l.trie.lookup(key, false, now)
+	case MatchSubdomain:
+		if l.bloom != nil && !l.maySuffix(host) {
+			return nil
+		}
+		return l.trie.lookup(host, true, now)
+	default:
+		if l.bloom != nil && !l.bloom.mayContain(host) {
+			return nil
+		}
+		return l.trie.lookup(host, false, now)
+	}
+}
+
+// maySuffix asks the Bloom filter about host and each of its parents.
+func (l *DomainList) maySuffix(host string) bool {
+	for h := host; ; {
+		if l.bloom.mayContain(h) {
+			return true
+		}
+		i := strings.IndexByte(h, '.')
+		if i < 0 {
+			return false
+		}
+		h = h[i+1:]
+	}
+}
+
+func (l *DomainList) key(domain string) string {
+	if l.mode == MatchOrgDomain {
+		return publicsuffix.OrganizationalDomain(domain)
+	}
+	return domain
+}
+
+// NormalizeDomain lowercases a domain and strips wildcard prefixes,
+// surrounding whitespace and the trailing root dot.
+func NormalizeDomain(domain string) string {
+	d := strings.ToLower(strings.TrimSpace(domain))
+	d = strings.TrimPrefix(d, "*.")
+	d = strings.TrimPrefix(d, ".")
+	return strings.TrimSuffix(d, ".")
+}
@@ -0,0 +1,39 @@
+package lists
+
+import "testing"
+
+func TestDomainList_Match(t *testing.T) {
+	cases := []struct {
+		mode  MatchMode
+		entry string
+		host  string
+		want  bool
+	}{
+		{MatchExact, "spam.com", "spam.com", true},
+		{MatchExact, "spam.com", "mail.spam.com", false},
+		{MatchSubdomain, "spam.com", "mail.spam.com", true},
+		{MatchSubdomain, "*.spam.com", "a.b.spam.com", true},
+		{MatchSubdomain, "spam.com", "notspam.com", false},
+		{MatchSubdomain, "mail.spam.com", "spam.com", false},
+		{MatchOrgDomain, "mail.spam.com", "www.spam.com", true},
+		{MatchOrgDomain, "shop.example.co.uk", "other.co.uk", false},
+		{MatchOrgDomain, "shop.example.co.uk", "EXAMPLE.co.uk.", true},
+	}
+	for _, tc := range cases {
+		l := NewDomainList([]string{tc.entry}, tc.mode)
+		if _, got := l.Match(tc.host); got != tc.want {
+			t.Errorf("%s: %q vs %q = %v, want %v", tc.mode, tc.entry, tc.host, got, tc.want)
+		}
+	}
+}
+
+func TestParseMatchMode(t *testing.T) {
+	for in, want := range map[string]MatchMode{"exact": MatchExact, "": MatchSubdomain, "Org-Domain": MatchOrgDomain} {
+		if got, err := ParseMatchMode(in); err != nil || got != want {
+			t.Errorf("ParseMatchMode(%q) = %v, %v", in, got, err)
+		}
+	}
+	if _, err := ParseMatchMode("fuzzy"); err == nil {
+		t.Error("expected error for unknown mode")
+	}
+}
@@ -0,0 +1,357 @@
+package lists
+
+import (
+	"fmt"
+	"net"
+	"net/netip"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+)
+
+// Kind is the type of indicator an entry holds.
+type Kind int
+
+const (
+	KindDomain Kind = iota
+	KindAddress
+	KindCIDR
+	KindURL
+	KindHash // MD5, SHA-1 or SHA-256 of a file, lowercase hex
+)
+
+func (k Kind) String() string {
+	switch k {
+	case KindDomain:
+		return "domain"
+	case KindAddress:
+		return "address"
+	case KindCIDR:
+		return "cidr"
+	case KindURL:
+		return "url"
+	case KindHash:
+		return "hash"
+	}
+	return fmt.Sprintf("Kind(%d)", int(k))
+}
+
+// Entry is one list line together with its metadata.
+type Entry struct {
+	Kind    Kind
+	Value   string
+	Source  string
+	Comment string
+	Expires time.Time // zero means never
+	// Confidence scales the weight of a match (0-1); zero means full confidence.
+	Confidence float64
+	File       string
+	Line       int
+
+	prefix netip.Prefix
+}
+
+// Expired reports whether the entry has an expiry date before now.
+func (e *Entry) Expired(now time.Time) bool {
+	return !e.Expires.IsZero() && now.After(e.Expires)
+}
+
+// Weight returns the entry's confidence, defaulting to 1.
+func (e *Entry) Weight() float64 {
+	if e == nil || e.Confidence <= 0 {
+		return 1
+	}
+	return e.Confidence
+}
+
+// Describe renders the entry for scorecard reasons, e.g.
+// "spam.com (source: soc, expires 2026-12-31; phishing campaign)".
+func (e *Entry) Describe() string {
+	var meta []string
+	if e.Source != "" {
+		meta = append(meta, "source: "+e.Source)
+	}
+	if !e.Expires.IsZero() {
+		meta = append(meta, "expires "+e.Expires.Format("2006-01-02"))
+	}
+	if e.Confidence > 0 && e.Confidence < 1 {
+		meta = append(meta, fmt.Sprintf("confidence %.2f", e.Confidence))
+	}
+	out := e.Value
+	if len(meta) > 0 || e.Comment != "" {
+		out += " (" + strings.Join(meta, ", ")
+		if e.Comment != "" {
+			if len(meta) > 0 {
+				out += "; "
+			}
+			out += e.Comment
+		}
+		out += ")"
+	}
+	return out
+}
+
+// String formats the entry in the list file syntax understood by ParseEntry.
+// Line breaks and other control characters in the source and comment, which
+// may come from a feed, are replaced so that the entry stays on one line.
+func (e *Entry) String() string {
+	var b strings.Builder
+	switch e.Kind {
+	case KindURL:
+		b.WriteString("url:")
+	case KindAddress:
+		b.WriteString("addr:")
+	}
+	b.WriteString(e.Value)
+	if !e.Expires.IsZero() {
+		b.WriteString(" expires=" + e.Expires.UTC().Format(time.RFC3339))
+	}
+	if e.Source != "" {
+		b.WriteString(" source=" + strings.Join(strings.Fields(oneLine(e.Source)), "_"))
+	}
+	if e.Confidence > 0 && e.Confidence < 1 {
+		b.WriteString(" confidence=" + strconv.FormatFloat(e.Confidence, 'f', -1, 64))
+	}
+	if e.Comment != "" {
+		b.WriteString(" # " + strings.TrimSpace(oneLine(e.Comment)))
+	}
+	return b.String()
+}
+
+// oneLine replaces control characters, line breaks among them, with spaces.
+func oneLine(s string) string {
+	return strings.Map(func(r rune) rune {
+		if unicode.IsControl(r) || r == '\u2028' || r == '\u2029' {
+			return ' '
+		}
+		return r
+	}, s)
+}
+
+// ParseEntry parses a single list line:
+//
+//	value [expires=YYYY-MM-DD] [source=tag] [confidence=0-1] [# comment]
+//
+// The kind is inferred from the value (CIDR/IP, address, URL pattern, file
+// hash or domain) unless the value carries an explicit "domain:", "addr:",
+// "ip:", "url:" or "hash:" (also "md5:", "sha1:", "sha256:") prefix. An
+// unknown field, such as a misspelt "expiers=", is an error rather than
+// being dropped. Blank and comment-only lines return a nil entry.
+func ParseEntry(line string) (*Entry, error) {
+	line = strings.TrimSpace(line)
+	e := &Entry{}
+	if i := commentStart(line); i >= 0 {
+		e.Comment = strings.TrimSpace(line[i+1:])
+		line = strings.TrimSpace(line[:i])
+	}
+	if line == "" {
+		return nil, nil
+	}
+	fields := strings.Fields(line)
+	for _, f := range fields[1:] {
+		key, value, ok := strings.Cut(f, "=")
+		if !ok {
+			return nil, fmt.Errorf("unexpected %q after value", f)
+		}
+		switch strings.ToLower(key) {
+		case "expires":
+			t, err := parseDate(value)
+			if err != nil {
+				return nil, fmt.Errorf("expires: %w", err)
+			}
+			e.Expires = t
+		case "source":
+			e.Source = value
+		case "confidence":
+			c, err := strconv.ParseFloat(value, 64)
+			if err != nil || c <= 0 || c > 1 {
+				return nil, fmt.Errorf("confidence must be in (0, 1], got %q", value)
+			}
+			e.Confidence = c
+		default:
+			return nil, fmt.Errorf("unknown field %q", key)
+		}
+	}
+	if err := e.setValue(fields[0]); err != nil {
+		return nil, err
+	}
+	return e, nil
+}
+
+// commentStart finds a "#" at the start of the line or after whitespace, so
+// URL fragments such as "/page#login" are kept as part of the value.
+func commentStart(line string) int {
+	for i := 0; i < len(line); i++ {
+		if line[i] == '#' && (i == 0 || line[i-1] == ' ' || line[i-1] == '\t') {
+			return i
+		}
+	}
+	return -1
+}
+
+func (e *Entry) setValue(raw string) error {
+	kind, value, explicit := raw, "", false
+	if k, v, ok := strings.Cut(raw, ":"); ok && !strings.HasPrefix(v, "//") {
+		switch strings.ToLower(k) {
+		case "domain", "addr", "address", "ip", "cidr", "url", "hash", "md5", "sha1", "sha256":
+			kind, value, explicit = strings.ToLower(k), v, true
+		}
+	}
+	if !explicit {
+		value = raw
+		kind = guessKind(raw)
+	}
+
+	switch kind {
+	case "ip", "cidr":
+		p, err := parsePrefix(value)
+		if err != nil {
+			return err
+		}
+		e.Kind, e.Value, e.prefix = KindCIDR, p.String(), p
+	case "addr", "address":
+		if !strings.Contains(value, "@") {
+			return fmt.Errorf("invalid address %q", value)
+		}
+		e.Kind, e.Value = KindAddress, strings.ToLower(value)
+	case "hash", "md5", "sha1", "sha256":
+		h := strings.ToLower(value)
+		if !isHash(h) || kind != "hash" && hashLengths[kind] != len(h) {
+			return fmt.Errorf("invalid %s %q", kind, value)
+		}
+		e.Kind, e.Value = KindHash, h
+	case "url":
+		u := NormalizeURL(value)
+		if u == "" {
+			return fmt.Errorf("invalid URL %q", value)
+		}
+		e.Kind, e.Value = KindURL, u
+	default:
+		d := NormalizeDomain(value)
+		if !validDomain(d) {
+			return fmt.Errorf("invalid domain %q", value)
+		}
+		e.Kind, e.Value = KindDomain, d
+	}
+	return nil
+}
+
+func validDomain(d string) bool {
+	if d == "" || len(d) > 253 {
+		return false
+	}
+	for _, label := range strings.Split(d, ".") {
+		if label == "" || len(label) > 63 {
+			return false
+		}
+		for _, r := range label {
+			if !(r >= 'a' && r <= 'z' || r >= '0' && r <= '9' || r == '-' || r == '_' || r > 0x7f) {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+func guessKind(v string) string {
+	if _, err := parsePrefix(v); err == nil {
+		return "cidr"
+	}
+	switch {
+	case isHash(strings.ToLower(v)):
+		return "hash"
+	case strings.Contains(v, "://"), strings.Contains(v, "/"):
+		return "url"
+	case strings.Contains(v, "@"):
+		return "addr"
+	}
+	return "domain"
+}
+
+var hashLengths = map[string]int{"md5": 32, "sha1": 40, "sha256": 64}
+
+// isHash reports whether v is a lowercase hex MD5, SHA-1 or SHA-256.
+func isHash(v string) bool {
+	if len(v) != 32 && len(v) != 40 && len(v) != 64 {
+		return false
+	}
+	for i := 0; i < len(v); i++ {
+		if c := v[i]; !(c >= '0' && c <= '9' || c >= 'a' && c <= 'f') {
+			return false
+		}
+	}
+	return true
+}
+
+func parsePrefix(v string) (netip.Prefix, error) {
+	if strings.Contains(v, "/") {
+		p, err := netip.ParsePrefix(v)
+		if err != nil {
+			return netip.Prefix{}, err
+		}
+		return p.Masked(), nil
+	}
+	addr, err := netip.ParseAddr(v)
+	if err != nil {
+		return netip.Prefix{}, err
+	}
+	return netip.PrefixFrom(addr, addr.BitLen()), nil
+}
+
+func parseDate(v string) (time.Time, error) {
+	if t, err := time.Parse("2006-01-02", v); err == nil {
+		// A date expires at the end of that day.
+		return t.Add(24*time.Hour - time.Nanosecond), nil
+	}
+	return time.Parse(time.RFC3339, v)
+}
+
+// NormalizeURL lowercases the host and drops the scheme and "www." so
+// patterns and links compare uniformly: "HTTPS://Bit.ly/X" -> "bit.ly/X".
+func NormalizeURL(raw string) string {
+	u := strings.TrimSpace(raw)
+	if i := strings.Index(u, "://"); i >= 0 {
+		u = u[i+3:]
+	}
+	host, path, _ := strings.Cut(u, "/")
+	if at := strings.LastIndex(host, "@"); at >= 0 {
+		host = host[at+1:]
+	}
+	host = strings.TrimPrefix(strings.ToLower(host), "www.")
+	if path == "" && !strings.HasSuffix(u, "/") {
+		return host
+	}
+	return host + "/" + path
+}
+
+// URLHost returns the host part of a URL without port.
+func URLHost(raw string) string {
+	host, _, _ := strings.Cut(NormalizeURL(raw), "/")
+	if h, _, err := net.SplitHostPort(host); err == nil {
+		return h
+	}
+	return host
+}
+
+// matchURLPattern matches a normalized URL against a normalized pattern.
+// "*" matches any run of characters; a pattern without "*" matches as a prefix.
+func matchURLPattern(pattern, u string) bool {
+	if !strings.Contains(pattern, "*") {
+		return strings.HasPrefix(u, pattern)
+	}
+	parts := strings.Split(pattern, "*")
+	if !strings.HasPrefix(u, parts[0]) {
+		return false
+	}
+	u = u[len(parts[0]):]
+	last := len(parts) - 1
+	for _, p := range parts[1:last] {
+		i := strings.Index(u, p)
+		if i < 0 {
+			return false
+		}
+		u = u[i+len(p):]
+	}
+	return strings.HasSuffix(u, parts[last])
+}
@@ -0,0 +1,158 @@
+package lists
+
+import (
+	"fmt"
+	"math/rand"
+	"net/netip"
+	"runtime"
+	"testing"
+	"time"
+)
+
+// TestIndexesMatchLinearScan checks the trie, radix tree and Bloom
+// prefilter against the straightforward scan they replaced.
+func TestIndexesMatchLinearScan(t *testing.T) {
+	rng := rand.New(rand.NewSource(1))
+	var domains []string
+	var prefixes []netip.Prefix
+	for i := 0; i < 2000; i++ {
+		domains = append(domains, randomDomain(rng))
+		prefixes = append(prefixes, randomPrefix(rng))
+	}
+
+	for _, bloom := range []float64{0, 0.01} {
+		l := NewDomainList(domains, MatchSubdomain)
+		l.EnablePrefilter(bloom)
+		var tree cidrTree
+		for _, p := range prefixes {
+			tree.insert(&Entry{Kind: KindCIDR, Value: p.String(), prefix: p})
+		}
+
+		for i := 0; i < 5000; i++ {
+			host := randomDomain(rng)
+			if i%3 == 0 {
+				host = "x" + fmt.Sprint(i) + "." + domains[rng.Intn(len(domains))]
+			}
+			_, got := l.Match(host)
+			want := false
+			for _, d := range domains {
+				if host == d || (len(host) > len(d) && host[len(host)-len(d)-1:] == "."+d) {
+					want = true
+					break
+				}
+			}
+			if got != want {
+				t.Fatalf("bloom=%v Match(%q) = %v, want %v", bloom, host, got, want)
+			}
+
+			addr := randomPrefix(rng).Addr()
+			if i%3 == 0 {
+				addr = prefixes[rng.Intn(len(prefixes))].Addr()
+			}
+			best := -1
+			for _, p := range prefixes {
+				if p.Contains(addr) && p.Bits() > best {
+					best = p.Bits()
+				}
+			}
+			e := tree.lookup(addr, time.Time{})
+			if (e != nil) != (best >= 0) || (e != nil && e.prefix.Bits() != best) {
+				t.Fatalf("lookup(%s) = %v, want longest prefix /%d", addr, e, best)
+			}
+		}
+	}
+}
+
+func TestCIDRTreeSkipsExpired(t *testing.T) {
+	now := time.Date(2026, 5, 1, 0, 0, 0, 0, time.UTC)
+	var tree cidrTree
+	for _, line := range []string{"10.0.0.0/8", "10.1.0.0/16 expires=2026-01-01"} {
+		e, err := ParseEntry(line)
+		if err != nil {
+			t.Fatal(err)
+		}
+		tree.insert(e)
+	}
+	e := tree.lookup(netip.MustParseAddr("10.1.2.3"), now)
+	if e == nil || e.Value != "10.0.0.0/8" {
+		t.Errorf("expired /16 should fall back to the /8, got %v", e)
+	}
+}
+
+func randomDomain(rng *rand.Rand) string {
+	tlds := []string{"com", "net", "ro", "org", "info"}
+	return fmt.Sprintf("d%x.%s", rng.Int63(), tlds[rng.Intn(len(tlds))])
+}
+
+func randomPrefix(rng *rand.Rand) netip.Prefix {
+	var b [4]byte
+	rng.Read(b[:])
+	return netip.PrefixFrom(netip.AddrFrom4(b), 8+rng.Intn(25)).Masked()
+}
+
+// The benchmarks below load lists of growing size; ns/op should stay flat
+// and bytes/entry constant as the list grows.
+
+var benchSizes = []int{1_000, 100_000, 1_000_000}
+
+func BenchmarkDomainMatch(b *testing.B) {
+	for _, n := range benchSizes {
+		for _, bloom := range []float64{0, 0.01} {
+			b.Run(fmt.Sprintf("n=%d/bloom=%v", n, bloom), func(b *testing.B) {
+				rng := rand.New(rand.NewSource(1))
+				var l *DomainList
+				perEntry := measure(n, func() {
+					l = NewDomainList(nil, MatchSubdomain)
+					for i := 0; i < n; i++ {
+						l.Add(randomDomain(rng))
+					}
+					l.EnablePrefilter(bloom)
+				})
+				hosts := make([]string, 1024)
+				for i := range hosts {
+					hosts[i] = "mail.login." + randomDomain(rng)
+				}
+				b.ResetTimer()
+				for i := 0; i < b.N; i++ {
+					l.Match(hosts[i%len(hosts)])
+				}
+				b.ReportMetric(perEntry, "bytes/entry")
+			})
+		}
+	}
+}
+
+func BenchmarkCIDRMatch(b *testing.B) {
+	for _, n := range benchSizes {
+		b.Run(fmt.Sprintf("n=%d", n), func(b *testing.B) {
+			rng := rand.New(rand.NewSource(1))
+			var tree cidrTree
+			perEntry := measure(n, func() {
+				for i := 0; i < n; i++ {
+					p := randomPrefix(rng)
+					tree.insert(&Entry{Kind: KindCIDR, prefix: p})
+				}
+			})
+			addrs := make([]netip.Addr, 1024)
+			for i := range addrs {
+				addrs[i] = randomPrefix(rng).Addr()
+			}
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				tree.lookup(addrs[i%len(addrs)], time.Time{})
+			}
+			b.ReportMetric(perEntry, "bytes/entry")
+		})
+	}
+}
+
+// measure returns the heap growth per entry caused by build.
+func measure(n int, build func()) float64 {
+	var before, after runtime.MemStats
+	runtime.GC()
+	runtime.ReadMemStats(&before)
+	build()
+	runtime.GC()
+	runtime.ReadMemStats(&after)
+	return float64(after.HeapAlloc-before.HeapAlloc) / float64(n)
+}
@@ -0,0 +1,118 @@
+package lists
+
+import (
+	"math/bits"
+	"net/netip"
+	"time"
+)
+
+// cidrTree is a path-compressed binary radix tree of prefixes, one per
+// address family. A lookup visits at most one node per distinct prefix
+// length on the path, and every node holds either an entry or a branch.
+type cidrTree struct {
+	v4, v6 *radixNode
+	size   int
+}
+
+type radixNode struct {
+	prefix netip.Prefix
+	entry  *Entry
+	child  [2]*radixNode
+}
+
+func (t *cidrTree) insert(e *Entry) {
+	p := e.prefix
+	root := &t.v6
+	if p.Addr().Is4() {
+		root = &t.v4
+	}
+	if t.insertAt(root, p, e) {
+		t.size++
+	}
+}
+
+// insertAt returns true when a new prefix was added rather than replaced.
+func (t *cidrTree) insertAt(slot **radixNode, p netip.Prefix, e *Entry) bool {
+	for {
+		n := *slot
+		if n == nil {
+			*slot = &radixNode{prefix: p, entry: e}
+			return true
+		}
+		common := commonBits(n.prefix, p)
+		switch {
+		case common == n.prefix.Bits() && common == p.Bits():
+			added := n.entry == nil
+			n.entry = e
+			return added
+		case common == n.prefix.Bits():
+			// p is inside n: descend.
+			slot = &n.child[bitAt(p.Addr(), common)]
+		case common == p.Bits():
+			// p contains n: p becomes n's parent.
+			parent := &radixNode{prefix: p, entry: e}
+			parent.child[bitAt(n.prefix.Addr(), common)] = n
+			*slot = parent
+			return true
+		default:
+			// p and n diverge: add a branch node for their common prefix.
+			branch := &radixNode{prefix: netip.PrefixFrom(p.Addr(), common).Masked()}
+			leaf := &radixNode{prefix: p, entry: e}
+			branch.child[bitAt(n.prefix.Addr(), common)] = n
+			branch.child[bitAt(p.Addr(), common)] = leaf
+			*slot = branch
+			return true
+		}
+	}
+}
+
+// lookup returns the longest active prefix containing addr.
+func (t *cidrTree) lookup(addr netip.Addr, now time.Time) *Entry {
+	n := t.v6
+	if addr.Is4() {
+		n = t.v4
+	}
+	var best *Entry
+	for n != nil && n.prefix.Contains(addr) {
+		if n.entry != nil && (now.IsZero() || !n.entry.Expired(now)) {
+			best = n.entry
+		}
+		if n.prefix.Bits() == addr.BitLen() {
+			break
+		}
+		n = n.child[bitAt(addr, n.prefix.Bits())]
+	}
+	return best
+}
+
+// commonBits returns the length of the prefix shared by a and b.
+func commonBits(a, b netip.Prefix) int {
+	limit := min(a.Bits(), b.Bits())
+	ab, bb := addrBytes(a.Addr()), addrBytes(b.Addr())
+	n := 0
+	for i := range ab {
+		if x := ab[i] ^ bb[i]; x != 0 {
+			n += bits.LeadingZeros8(x)
+			break
+		}
+		n += 8
+		if n >= limit {
+			break
+		}
+	}
+	return min(n, limit)
+}
+
+func bitAt(addr netip.Addr, i int) int {
+	b := addrBytes(addr)
+	return int(b[i/8]>>(7-uint(i%8))) & 1
+}
+
+// addrBytes returns the address bytes without allocating: 4 for IPv4, 16 for IPv6.
+func addrBytes(addr netip.Addr) []byte {
+	b := addr.As16()
+	if addr.Is4() {
+		return b[12:]
+	}
+	return b[:]
+}
@@ -0,0 +1,341 @@
+package lists
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"net/netip"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ListType selects the blocklist or the allowlist of a Store.
+type ListType int
+
+const (
+	Block ListType = iota
+	Allow
+)
+
+func (t ListType) String() string {
+	if t == Allow {
+		return "allowlist"
+	}
+	return "blocklist"
+}
+
+// Set holds the entries of one list, indexed by kind: domains in a suffix
+// trie, CIDRs in a radix tree and URL patterns grouped by host, so lookups
+// stay cheap for lists with millions of entries.
+type Set struct {
+	domains   *DomainList
+	addresses map[string]*Entry
+	cidrs     cidrTree
+	urls      urlIndex
+	hashes    map[string]*Entry
+}
+
+func newSet(mode MatchMode) *Set {
+	return &Set{domains: NewDomainList(nil, mode), addresses: map[string]*Entry{}, hashes: map[string]*Entry{}}
+}
+
+func (s *Set) add(e *Entry) {
+	switch e.Kind {
+	case KindDomain:
+		s.domains.AddEntry(e)
+	case KindAddress:
+		s.addresses[e.Value] = e
+	case KindCIDR:
+		s.cidrs.insert(e)
+	case KindURL:
+		s.urls.add(e)
+	case KindHash:
+		s.hashes[e.Value] = e
+	}
+}
+
+// Len returns the number of entries in the set.
+func (s *Set) Len() int {
+	return s.domains.Len() + len(s.addresses) + s.cidrs.size + s.urls.size + len(s.hashes)
+}
+
+// urlIndex groups URL patterns whose host is fixed ("evil.com/login") by
+// that host. Patterns with a wildcard in the host, or without a path (which
+// match as a plain prefix), are checked one by one.
+type urlIndex struct {
+	byHost map[string][]*Entry
+	other  []*Entry
+	size   int
+}
+
+func (x *urlIndex) add(e *Entry) {
+	x.size++
+	host, _, hasPath := strings.Cut(e.Value, "/")
+	if !hasPath || strings.Contains(host, "*") {
+		x.other = append(x.other, e)
+		return
+	}
+	if x.byHost == nil {
+		x.byHost = map[string][]*Entry{}
+	}
+	x.byHost[host] = append(x.byHost[host], e)
+}
+
+// match returns the first active pattern matching the normalized URL u.
+func (x *urlIndex) match(u string, now time.Time) *Entry {
+	host, _, _ := strings.Cut(u, "/")
+	for _, e := range x.byHost[host] {
+		if matchURLPattern(e.Value, u) && !e.Expired(now) {
+			return e
+		}
+	}
+	for _, e := range x.other {
+		if matchURLPattern(e.Value, u) && !e.Expired(now) {
+			return e
+		}
+	}
+	return nil
+}
+
+// Store is a pair of block/allow lists built from static entries plus files
+// or directories on disk. Reload re-reads the files and swaps the lists
+// atomically, so lookups may run concurrently with a reload.
+type Store struct {
+	mode   MatchMode
+	bloom  float64
+	now    func() time.Time
+	paths  [2][]string
+	static [2][]*Entry
+
+	mu    sync.RWMutex
+	sets  [2]*Set
+	stamp string
+}
+
+func NewStore(mode MatchMode) *Store {
+	return &Store{
+		mode: mode,
+		now:  time.Now,
+		sets: [2]*Set{newSet(mode), newSet(mode)},
+	}
+}
+
+// AddStatic adds entries that are not backed by a file (e.g. from the
+// environment); they survive reloads.
+func (s *Store) AddStatic(list ListType, values []string, source string) error {
+	for _, v := range values {
+		e, err := ParseEntry(v)
+		if err != nil {
+			return fmt.Errorf("%s entry %q: %w", list, v, err)
+		}
+		if e == nil {
+			continue
+		}
+		if e.Source == "" {
+			e.Source = source
+		}
+		s.mu.Lock()
+		s.static[list] = append(s.static[list], e)
+		s.sets[list].add(e)
+		s.mu.Unlock()
+	}
+	return nil
+}
+
+// SetPrefilter enables a Bloom filter in front of the domain lists with the
+// given false-positive rate; 0 disables it. It applies to the current lists
+// and to every reload.
+func (s *Store) SetPrefilter(fpRate float64) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.bloom = fpRate
+	for _, set := range s.sets {
+		set.domains.EnablePrefilter(fpRate)
+	}
+}
+
+// SetPaths configures the files or directories a list is loaded from.
+// Call Reload afterwards to read them.
+func (s *Store) SetPaths(list ListType, paths []string) {
+	s.mu.Lock()
+	s.paths[list] = paths
+	s.mu.Unlock()
+}
+
+// Reload re-reads every configured file. On error the current lists are kept.
+func (s *Store) Reload() error {
+	s.mu.RLock()
+	paths := s.paths
+	static := s.static
+	bloom := s.bloom
+	s.mu.RUnlock()
+
+	now := s.now()
+	var sets [2]*Set
+	for list := range sets {
+		set := newSet(s.mode)
+		for _, e := range static[list] {
+			set.add(e)
+		}
+		files, err := expand(paths[list])
+		if err != nil {
+			return err
+		}
+		for _, f := range files {
+			if err := loadFile(set, f, now); err != nil {
+				return err
+			}
+		}
+		if bloom > 0 {
+			set.domains.EnablePrefilter(bloom)
+		}
+		sets[list] = set
+	}
+	stamp, _ := fingerprint(paths)
+
+	s.mu.Lock()
+	s.sets = sets
+	s.stamp = stamp
+	s.mu.Unlock()
+	return nil
+}
+
+// Len returns the number of entries loaded in list.
+func (s *Store) Len(list ListType) int {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.sets[list].Len()
+}
+
+// MatchDomain returns the entry of list covering host, if any.
+func (s *Store) MatchDomain(list ListType, host string) *Entry {
+	s.mu.RLock()
+	set := s.sets[list]
+	s.mu.RUnlock()
+	return set.domains.match(host, s.now())
+}
+
+// MatchAddress returns the entry of list for addr, checking the full
+// address first and then its domain.
+func (s *Store) MatchAddress(list ListType, addr string) *Entry {
+	addr = strings.ToLower(strings.TrimSpace(addr))
+	s.mu.RLock()
+	set := s.sets[list]
+	s.mu.RUnlock()
+	if e, ok := set.addresses[addr]; ok && !e.Expired(s.now()) {
+		return e
+	}
+	if at := strings.LastIndex(addr, "@"); at >= 0 {
+		return s.MatchDomain(list, addr[at+1:])
+	}
+	return nil
+}
+
+// MatchIP returns the entry of list whose CIDR contains ip.
+func (s *Store) MatchIP(list ListType, ip string) *Entry {
+	addr, err := netip.ParseAddr(strings.TrimSpace(ip))
+	if err != nil {
+		return nil
+	}
+	addr = addr.Unmap()
+	s.mu.RLock()
+	set := s.sets[list]
+	s.mu.RUnlock()
+	return set.cidrs.lookup(addr, s.now())
+}
+
+// MatchURL returns the entry of list matching rawURL, either through a URL
+// pattern or through the domain of its host.
+func (s *Store) MatchURL(list ListType, rawURL string) *Entry {
+	u := NormalizeURL(rawURL)
+	s.mu.RLock()
+	set := s.sets[list]
+	s.mu.RUnlock()
+	if e := set.urls.match(u, s.now()); e != nil {
+		return e
+	}
+	host := URLHost(rawURL)
+	if _, err := netip.ParseAddr(host); err == nil {
+		return s.MatchIP(list, host)
+	}
+	return s.MatchDomain(list, host)
+}
+
+// MatchHash returns the entry of list for the first of hashes (hex MD5,
+// SHA-1 or SHA-256 digests of the same file) that is listed.
+func (s *Store) MatchHash(list ListType, hashes ...string) *Entry {
+	s.mu.RLock()
+	set := s.sets[list]
+	s.mu.RUnlock()
+	now := s.now()
+	for _, h := range hashes {
+		if e, ok := set.hashes[strings.ToLower(h)]; ok && !e.Expired(now) {
+			return e
+		}
+	}
+	return nil
+}
+
+func loadFile(set *Set, path string, now time.Time) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	return readEntries(set, f, path, now)
+}
+
+func readEntries(set *Set, r io.Reader, path string, now time.Time) error {
+	source := strings.TrimSuffix(filepath.Base(path), filepath.Ext(path))
+	scanner := bufio.NewScanner(r)
+	line := 0
+	for scanner.Scan() {
+		line++
+		e, err := ParseEntry(scanner.Text())
+		if err != nil {
+			return fmt.Errorf("%s:%d: %w", path, line, err)
+		}
+		if e == nil || e.Expired(now) {
+			continue
+		}
+		if e.Source == "" {
+			e.Source = source
+		}
+		e.File, e.Line = path, line
+		set.add(e)
+	}
+	return scanner.Err()
+}
+
+// expand turns files and directories into a sorted list of files. Hidden
+// files and editor backups inside directories are skipped.
+func expand(paths []string) ([]string, error) {
+	var files []string
+	for _, p := range paths {
+		info, err := os.Stat(p)
+		if err != nil {
+			return nil, err
+		}
+		if !info.IsDir() {
+			files = append(files, p)
+			continue
+		}
+		entries, err := os.ReadDir(p)
+		if err != nil {
+			return nil, err
+		}
+		for _, entry := range entries {
+			name := entry.Name()
+			if entry.IsDir() || strings.HasPrefix(name, ".") || strings.HasSuffix(name, "~") {
+				continue
+			}
+			files = append(files, filepath.Join(p, name))
+		}
+	}
+	sort.Strings(files)
+	return files, nil
+}
@@ -0,0 +1,207 @@
+package lists
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestParseEntry(t *testing.T) {
+	cases := []struct {
+		line   string
+		kind   Kind
+		value  string
+		source string
+	}{
+		{"Spam.COM", KindDomain, "spam.com", ""},
+		{"*.spam.com  source=soc # seen in campaign", KindDomain, "spam.com", "soc"},
+		{"Bad@Actor.com", KindAddress, "bad@actor.com", ""},
+		{"10.1.2.0/24", KindCIDR, "10.1.2.0/24", ""},
+		{"192.0.2.10", KindCIDR, "192.0.2.10/32", ""},
+		{"2001:db8::/32", KindCIDR, "2001:db8::/32", ""},
+		{"http://Bit.ly/fake-*", KindURL, "bit.ly/fake-*", ""},
+		{"url:evil.example/login", KindURL, "evil.example/login", ""},
+		{"D41D8CD98F00B204E9800998ECF8427E", KindHash, "d41d8cd98f00b204e9800998ecf8427e", ""},
+		{"sha256:275a021bbfb6489e54d471899f7db9d1663fc695ec2fe2a2c4538aabf651fd0f source=eicar", KindHash, "275a021bbfb6489e54d471899f7db9d1663fc695ec2fe2a2c4538aabf651fd0f", "eicar"},
+	}
+	for _, tc := range cases {
+		e, err := ParseEntry(tc.line)
+		if err != nil {
+			t.Fatalf("ParseEntry(%q): %v", tc.line, err)
+		}
+		if e.Kind != tc.kind || e.Value != tc.value || e.Source != tc.source {
+			t.Errorf("ParseEntry(%q) = %s %q source %q", tc.line, e.Kind, e.Value, e.Source)
+		}
+	}
+
+	if e, err := ParseEntry("   # only a comment"); e != nil || err != nil {
+		t.Errorf("comment line should yield nothing, got %v %v", e, err)
+	}
+	if _, err := ParseEntry("spam.com expires=tomorrow"); err == nil {
+		t.Error("expected error for a bad expiry date")
+	}
+	if _, err := ParseEntry("spam.com expiers=2026-01-01"); err == nil || !strings.Contains(err.Error(), `unknown field "expiers"`) {
+		t.Errorf("misspelt field: err = %v", err)
+	}
+	if _, err := ParseEntry("sha1:d41d8cd98f00b204e9800998ecf8427e"); err == nil {
+		t.Error("expected error for an MD5 given as sha1")
+	}
+}
+
+func TestStore_MatchHash(t *testing.T) {
+	s := NewStore(MatchExact)
+	if err := s.AddStatic(Block, []string{
+		"275a021bbfb6489e54d471899f7db9d1663fc695ec2fe2a2c4538aabf651fd0f source=soc",
+		"md5:44d88612fea8a8f36de82e1278abb02f expires=2020-01-01",
+	}, "env"); err != nil {
+		t.Fatal(err)
+	}
+	if e := s.MatchHash(Block, "00", "275A021BBFB6489E54D471899F7DB9D1663FC695EC2FE2A2C4538AABF651FD0F"); e == nil || e.Source != "soc" {
+		t.Errorf("expected the SHA-256 entry, got %+v", e)
+	}
+	if e := s.MatchHash(Block, "44d88612fea8a8f36de82e1278abb02f"); e != nil {
+		t.Errorf("expired hash should be ignored, got %+v", e)
+	}
+	if n := s.Len(Block); n != 2 {
+		t.Errorf("Len = %d, want 2", n)
+	}
+}
+
+func TestEntryDescribe(t *testing.T) {
+	e, _ := ParseEntry("spam.com expires=2026-12-31 source=soc # campaign 42")
+	want := "spam.com (source: soc, expires 2026-12-31; campaign 42)"
+	if got := e.Describe(); got != want {
+		t.Errorf("Describe() = %q, want %q", got, want)
+	}
+}
+
+func TestEntryString_OneLine(t *testing.T) {
+	e, _ := ParseEntry("evil.example")
+	e.Source = "feed:soc\nintel"
+	e.Comment = "phishing\r\nevil2.example # injected\n"
+	got := e.String()
+	if strings.ContainsAny(got, "\r\n") {
+		t.Fatalf("String() = %q spans several lines", got)
+	}
+	back, err := ParseEntry(got)
+	if err != nil || back.Value != "evil.example" || back.Source != "feed:soc_intel" {
+		t.Errorf("ParseEntry(%q) = %+v, %v", got, back, err)
+	}
+}
+
+func writeFile(t *testing.T, path, content string) {
+	t.Helper()
+	if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestStore_FilesAndExpiry(t *testing.T) {
+	dir := t.TempDir()
+	writeFile(t, filepath.Join(dir, "soc.list"), strings.Join([]string{
+		"# SOC blocklist",
+		"evil.example",
+		"old.example expires=2020-01-01",
+		"198.51.100.0/24 source=abuse-desk",
+		"url:bit.ly/fake-*",
+	}, "\n"))
+	writeFile(t, filepath.Join(dir, ".hidden"), "hidden.example\n")
+	allow := filepath.Join(t.TempDir(), "allow.list")
+	writeFile(t, allow, "good.evil.example\n")
+
+	s := NewStore(MatchSubdomain)
+	s.SetPaths(Block, []string{dir})
+	s.SetPaths(Allow, []string{allow})
+	if err := s.Reload(); err != nil {
+		t.Fatalf("Reload: %v", err)
+	}
+
+	if e := s.MatchDomain(Block, "mx.evil.example"); e == nil || e.Source != "soc" || e.Line != 2 {
+		t.Errorf("expected soc entry from line 2, got %+v", e)
+	}
+	if e := s.MatchDomain(Block, "old.example"); e != nil {
+		t.Errorf("expired entry should be ignored, got %+v", e)
+	}
+	if e := s.MatchDomain(Block, "hidden.example"); e != nil {
+		t.Errorf("hidden files should be skipped")
+	}
+	if e := s.MatchIP(Block, "198.51.100.20"); e == nil || e.Source != "abuse-desk" {
+		t.Errorf("expected CIDR match, got %+v", e)
+	}
+	if e := s.MatchURL(Block, "https://bit.ly/fake-plan"); e == nil {
+		t.Error("expected URL pattern match")
+	}
+	if e := s.MatchURL(Block, "https://www.evil.example/x"); e == nil || e.Value != "evil.example" {
+		t.Errorf("expected URL host to match the domain list, got %+v", e)
+	}
+	if e := s.MatchAddress(Allow, "ceo@good.evil.example"); e == nil {
+		t.Error("expected allowlist match")
+	}
+}
+
+func TestStore_ExpiresWhileLoaded(t *testing.T) {
+	s := NewStore(MatchExact)
+	if err := s.AddStatic(Block, []string{"soon.example expires=2026-01-01"}, "env"); err != nil {
+		t.Fatal(err)
+	}
+	s.now = func() time.Time { return time.Date(2025, 12, 31, 12, 0, 0, 0, time.UTC) }
+	if s.MatchDomain(Block, "soon.example") == nil {
+		t.Fatal("entry should still be active")
+	}
+	s.now = func() time.Time { return time.Date(2026, 1, 2, 0, 0, 0, 0, time.UTC) }
+	if s.MatchDomain(Block, "soon.example") != nil {
+		t.Fatal("entry should have expired")
+	}
+}
+
+func TestStore_Watch(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "block.list")
+	writeFile(t, path, "first.example\n")
+
+	s := NewStore(MatchExact)
+	s.SetPaths(Block, []string{path})
+	if err := s.Reload(); err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	reloaded := make(chan error, 1)
+	go s.Watch(ctx, 10*time.Millisecond, func(err error) { reloaded <- err })
+
+	writeFile(t, path, "first.example\nsecond.example # added later\n")
+	// Make sure the change is visible even on filesystems with coarse mtimes.
+	os.Chtimes(path, time.Now().Add(time.Second), time.Now().Add(time.Second))
+
+	select {
+	case err := <-reloaded:
+		if err != nil {
+			t.Fatalf("reload: %v", err)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("store was not reloaded")
+	}
+	if s.MatchDomain(Block, "second.example") == nil {
+		t.Fatal("new entry not visible after reload")
+	}
+}
+
+func TestStore_ReloadErrorKeepsLists(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "block.list")
+	writeFile(t, path, "kept.example\n")
+	s := NewStore(MatchExact)
+	s.SetPaths(Block, []string{path})
+	if err := s.Reload(); err != nil {
+		t.Fatal(err)
+	}
+	writeFile(t, path, "kept.example expires=never\n")
+	if err := s.Reload(); err == nil {
+		t.Fatal("expected parse error")
+	}
+	if s.MatchDomain(Block, "kept.example") == nil {
+		t.Fatal("previous lists should stay active after a failed reload")
+	}
+}
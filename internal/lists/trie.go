@@ -0,0 +1,88 @@
+package lists
+
+import (
+	"strings"
+	"time"
+)
+
+// domainTrie stores domains by their labels in reverse order
+// (com -> spam -> mail), so a lookup costs one step per label of the host
+// no matter how many domains are listed. Labels are substrings of the
+// entry's value, and leaf nodes carry no child map.
+type domainTrie struct {
+	root trieNode
+	size int
+}
+
+type trieNode struct {
+	entry    *Entry
+	children map[string]*trieNode
+}
+
+// insert adds e under key, replacing an existing entry with the same key.
+func (t *domainTrie) insert(key string, e *Entry) {
+	n := &t.root
+	for rest := key; rest != ""; {
+		var label string
+		if i := strings.LastIndexByte(rest, '.'); i >= 0 {
+			label, rest = rest[i+1:], rest[:i]
+		} else {
+			label, rest = rest, ""
+		}
+		child := n.children[label]
+		if child == nil {
+			if n.children == nil {
+				n.children = make(map[string]*trieNode, 1)
+			}
+			child = &trieNode{}
+			n.children[label] = child
+		}
+		n = child
+	}
+	if n.entry == nil {
+		t.size++
+	}
+	n.entry = e
+}
+
+// lookup walks host from its last label. With subdomains it returns the
+// most specific active entry on the path; otherwise only an entry for the
+// whole host. Expired entries are skipped when now is not zero.
+func (t *domainTrie) lookup(host string, subdomains bool, now time.Time) *Entry {
+	var best *Entry
+	n := &t.root
+	for rest := host; rest != ""; {
+		var label string
+		if i := strings.LastIndexByte(rest, '.'); i >= 0 {
+			label, rest = rest[i+1:], rest[:i]
+		} else {
+			label, rest = rest, ""
+		}
+		n = n.children[label]
+		if n == nil {
+			return best
+		}
+		if n.entry != nil && (subdomains || rest == "") && (now.IsZero() || !n.entry.Expired(now)) {
+			best = n.entry
+		}
+	}
+	return best
+}
+
+// walk calls fn with the key of every entry.
+func (t *domainTrie) walk(fn func(key string)) {
+	var visit func(n *trieNode, suffix string)
+	visit = func(n *trieNode, suffix string) {
+		if n.entry != nil {
+			fn(suffix)
+		}
+		for label, child := range n.children {
+			key := label
+			if suffix != "" {
+				key = label + "." + suffix
+			}
+			visit(child, key)
+		}
+	}
+	visit(&t.root, "")
+}
@@ -0,0 +1,61 @@
+package lists
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+)
+
+// Watch polls the configured files every interval and reloads the store
+// when any of them is added, removed or modified. Reload errors are passed
+// to onReload (which may be nil) and the previous lists stay active.
+func (s *Store) Watch(ctx context.Context, interval time.Duration, onReload func(error)) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+		s.mu.RLock()
+		paths, last := s.paths, s.stamp
+		s.mu.RUnlock()
+
+		stamp, _ := fingerprint(paths)
+		if stamp == last {
+			continue
+		}
+		err := s.Reload()
+		if err != nil {
+			// Remember the broken state so the same error is not reported every tick.
+			s.mu.Lock()
+			s.stamp = stamp
+			s.mu.Unlock()
+		}
+		if onReload != nil {
+			onReload(err)
+		}
+	}
+}
+
+// fingerprint summarizes name, size and modification time of every file.
+func fingerprint(paths [2][]string) (string, error) {
+	var b strings.Builder
+	for list, ps := range paths {
+		files, err := expand(ps)
+		if err != nil {
+			return "", err
+		}
+		for _, f := range files {
+			info, err := os.Stat(f)
+			if err != nil {
+				return "", err
+			}
+			fmt.Fprintf(&b, "%d|%s|%d|%d\n", list, f, info.Size(), info.ModTime().UnixNano())
+		}
+	}
+	return b.String(), nil
+}
@@ -0,0 +1,215 @@
+package llm
+
+import (
+	"container/list"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"io/fs"
+	"net/mail"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Cache keeps verdicts so that a campaign sent to many mailboxes costs
+// one LLM call. Entries expire after TTL, the least recently used are
+// dropped beyond MaxEntries, and with a Path the cache survives restarts
+// through Save.
+type Cache struct {
+	TTL        time.Duration
+	MaxEntries int
+	Path       string
+
+	mu      sync.Mutex
+	entries map[string]*list.Element
+	order   *list.List // of *cacheEntry, most recently used first
+	now     func() time.Time
+}
+
+type cacheEntry struct {
+	Key       string    `json:"key"`
+	Score     Score     `json:"score"`
+	Recovered string    `json:"recovered,omitempty"`
+	Prompt    string    `json:"prompt"`
+	Expires   time.Time `json:"expires"`
+}
+
+// NewCache returns a cache, loading the entries saved at path if it is
+// set and exists.
+func NewCache(ttl time.Duration, maxEntries int, path string) (*Cache, error) {
+	c := &Cache{TTL: ttl, MaxEntries: maxEntries, Path: path, entries: map[string]*list.Element{}, order: list.New(), now: time.Now}
+	if path == "" {
+		return c, nil
+	}
+	data, err := os.ReadFile(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return c, nil
+	}
+	if err != nil {
+		return c, err
+	}
+	var saved []cacheEntry
+	if err := json.Unmarshal(data, &saved); err != nil {
+		return c, err
+	}
+	// Saved most recently used first; insert in reverse to keep that order.
+	for i := len(saved) - 1; i >= 0; i-- {
+		if e := saved[i]; c.now().Before(e.Expires) {
+			c.add(&e)
+		}
+	}
+	return c, nil
+}
+
+// Get returns the verdict stored under key, if it has not expired.
+func (c *Cache) Get(key string) (Score, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	el, ok := c.entries[key]
+	if !ok {
+		return Score{}, false
+	}
+	e := el.Value.(*cacheEntry)
+	if !c.now().Before(e.Expires) {
+		c.order.Remove(el)
+		delete(c.entries, key)
+		return Score{}, false
+	}
+	c.order.MoveToFront(el)
+	score := e.Score
+	score.Recovered, score.Prompt = e.Recovered, e.Prompt
+	return score, true
+}
+
+// Put stores a verdict under key.
+func (c *Cache) Put(key string, score Score) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if el, ok := c.entries[key]; ok {
+		c.order.Remove(el)
+		delete(c.entries, key)
+	}
+	c.add(&cacheEntry{Key: key, Score: score, Recovered: score.Recovered, Prompt: score.Prompt, Expires: c.now().Add(c.TTL)})
+}
+
+func (c *Cache) add(e *cacheEntry) {
+	c.entries[e.Key] = c.order.PushFront(e)
+	for c.MaxEntries > 0 && c.order.Len() > c.MaxEntries {
+		last := c.order.Back()
+		c.order.Remove(last)
+		delete(c.entries, last.Value.(*cacheEntry).Key)
+	}
+}
+
+// Len returns the number of entries, expired ones included until they
+// are looked up or saved.
+func (c *Cache) Len() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.order.Len()
+}
+
+// Save writes the live entries to Path, replacing the file atomically.
+// It does nothing for a cache without a Path.
+func (c *Cache) Save() error {
+	if c.Path == "" {
+		return nil
+	}
+	c.mu.Lock()
+	saved := make([]cacheEntry, 0, c.order.Len())
+	for el := c.order.Front(); el != nil; el = el.Next() {
+		if e := el.Value.(*cacheEntry); c.now().Before(e.Expires) {
+			saved = append(saved, *e)
+		}
+	}
+	c.mu.Unlock()
+
+	data, err := json.Marshal(saved)
+	if err != nil {
+		return err
+	}
+	return writeFile(c.Path, data)
+}
+
+// writeFile replaces the file at path with data, atomically so that a
+// crash never leaves a truncated file behind.
+func writeFile(path string, data []byte) error {
+	tmp, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
+
+var (
+	// longToken matches tracking and session identifiers: long runs of
+	// letters, digits, '-' and '_' with at least one digit.
+	longToken  = regexp.MustCompile(`[A-Za-z0-9_\-]*[0-9][A-Za-z0-9_\-]*`)
+	longNumber = regexp.MustCompile(`[0-9]{6,}`)
+	spaces     = regexp.MustCompile(`\s+`)
+)
+
+// cacheKey hashes the prompt the model is asked, normalized so that copies
+// of a campaign sent to different people share a key: the recipients'
+// addresses, names and mailbox names, tracking tokens and long numbers are
+// replaced, white space is collapsed and the random marker tag is fixed.
+// Hashing the rendered prompt rather than chosen fields keeps the key in
+// step with whatever the template shows. The provider and prompt are part
+// of the key, so changing either asks the model again.
+func cacheKey(provider, prompt, system, user string, d PromptData) string {
+	var replacer []string
+	for _, h := range []string{"To", "Cc", "Delivered-To", "X-Original-To"} {
+		addrs, _ := mail.ParseAddressList(d.Header(h))
+		for _, a := range addrs {
+			replacer = append(replacer, a.Address)
+			if local, _, ok := strings.Cut(a.Address, "@"); ok && len(local) >= 3 {
+				replacer = append(replacer, local)
+			}
+			if len(a.Name) >= 3 {
+				replacer = append(replacer, a.Name)
+			}
+		}
+	}
+	var rcpt *regexp.Regexp
+	if len(replacer) > 0 {
+		quoted := make([]string, len(replacer))
+		for i, s := range replacer {
+			quoted[i] = regexp.QuoteMeta(s)
+		}
+		rcpt = regexp.MustCompile(`(?i)` + strings.Join(quoted, "|"))
+	}
+	normalize := func(s string) string {
+		if rcpt != nil {
+			s = rcpt.ReplaceAllString(s, "<rcpt>")
+		}
+		s = longToken.ReplaceAllStringFunc(s, func(t string) string {
+			if len(t) >= 16 {
+				return "<tok>"
+			}
+			return t
+		})
+		s = longNumber.ReplaceAllString(s, "<n>")
+		return strings.TrimSpace(spaces.ReplaceAllString(s, " "))
+	}
+
+	markers := strings.NewReplacer(d.Open, openMarker(""), d.Close, closeMarker(""))
+	h := sha256.New()
+	for _, s := range []string{provider, prompt, normalize(markers.Replace(system)), normalize(markers.Replace(user))} {
+		h.Write([]byte(s))
+		h.Write([]byte{0})
+	}
+	return hex.EncodeToString(h.Sum(nil))
+}
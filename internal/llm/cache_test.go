@@ -0,0 +1,133 @@
+package llm
+
+import (
+	"context"
+	"path/filepath"
+	"strings"
+	"testing"
+	"testing/fstest"
+	"time"
+)
+
+func TestCache_ExpiryAndSize(t *testing.T) {
+	c, _ := NewCache(time.Hour, 2, "")
+	now := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	c.now = func() time.Time { return now }
+
+	c.Put("a", Score{Score: 0.1})
+	c.Put("b", Score{Score: 0.2})
+	c.Get("a") // b is now the least recently used
+	c.Put("c", Score{Score: 0.3})
+	if _, ok := c.Get("b"); ok || c.Len() != 2 {
+		t.Errorf("b kept beyond MaxEntries, len %d", c.Len())
+	}
+	if s, ok := c.Get("a"); !ok || s.Score != 0.1 {
+		t.Errorf("Get(a) = %+v, %v", s, ok)
+	}
+
+	now = now.Add(time.Hour)
+	if _, ok := c.Get("a"); ok {
+		t.Error("expired entry returned")
+	}
+}
+
+func TestCache_Persist(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "llm-cache.json")
+	c, err := NewCache(time.Hour, 10, path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	c.Put("k", Score{Spam: true, Score: 0.9, Category: CategoryScam, Recovered: "extracted", Prompt: "classify@1+abcdef01"})
+	if err := c.Save(); err != nil {
+		t.Fatal(err)
+	}
+
+	c, err = NewCache(time.Hour, 10, path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	s, ok := c.Get("k")
+	if !ok || !s.Spam || s.Category != CategoryScam || s.Recovered != "extracted" || s.Prompt != "classify@1+abcdef01" {
+		t.Errorf("loaded %+v, %v", s, ok)
+	}
+}
+
+// key renders p for d and returns its cache key, as ScoreEmail does.
+func key(t *testing.T, p *Prompt, provider string, d PromptData) string {
+	t.Helper()
+	system, user, err := p.render(d)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return cacheKey(provider, p.ID(), system, user, d)
+}
+
+func TestCacheKey_IgnoresRecipient(t *testing.T) {
+	campaign := func(to, name, token string) PromptData {
+		raw := "From: Posta Romana <livrari@posta-colet.biz>\r\nTo: " + name + " <" + to + ">\r\nSubject: Colet retinut\r\n\r\n" +
+			"Buna ziua " + name + ",\r\ncoletul pentru " + to + " este retinut. Plata: http://posta-colet.biz/p?id=" + token + "\r\n"
+		return newPromptData(testEmail(t, raw), Auth{SPF: "fail"}, newTag())
+	}
+	p := DefaultPrompts().For("ro")
+	a := key(t, p, "ollama/m", campaign("ion.popescu@igsu.ro", "Ion Popescu", "a8f3K29dLx02mQ7vZ1"))
+	b := key(t, p, "ollama/m", campaign("maria.ionescu@igsu.ro", "Maria Ionescu", "Zq71mB0xP4kT9sW2e6"))
+	if a != b {
+		t.Error("copies of a campaign to different recipients have different keys")
+	}
+	if key(t, p, "openai/m", campaign("ion.popescu@igsu.ro", "Ion Popescu", "a8f3K29dLx02mQ7vZ1")) == a {
+		t.Error("a different provider has the same key")
+	}
+	if key(t, DefaultPrompts().For("en"), "ollama/m", campaign("ion.popescu@igsu.ro", "Ion Popescu", "a8f3K29dLx02mQ7vZ1")) == a {
+		t.Error("a different prompt has the same key")
+	}
+	other := newPromptData(testEmail(t, lottery), Auth{SPF: "fail"}, newTag())
+	if key(t, p, "ollama/m", other) == a {
+		t.Error("a different message has the same key")
+	}
+}
+
+func TestCacheKey_FollowsTemplate(t *testing.T) {
+	ps, err := LoadPrompts(fstest.MapFS{"classify.tmpl": promptFile("1", "Date între {{.Open}} și {{.Close}}.",
+		`{{.Open}}{{.Date}} {{.Header "X-Campaign"}} {{.Subject}}{{.Close}}`, "{{.Error}}")}, "classify")
+	if err != nil {
+		t.Fatal(err)
+	}
+	p := ps.For("")
+	message := func(date, campaign string) PromptData {
+		raw := "From: a@spamsite.biz\r\nTo: ion.popescu@igsu.ro\r\nDate: " + date + "\r\nX-Campaign: " + campaign + "\r\nSubject: Oferta\r\n\r\nText.\r\n"
+		return newPromptData(testEmail(t, raw), Auth{}, newTag())
+	}
+	a := key(t, p, "ollama/m", message("Mon, 6 May 2024 10:00:00 +0300", "vara"))
+	if key(t, p, "ollama/m", message("Mon, 6 May 2024 10:00:00 +0300", "vara")) != a {
+		t.Error("the same message has different keys")
+	}
+	if key(t, p, "ollama/m", message("Tue, 7 May 2024 10:00:00 +0300", "vara")) == a {
+		t.Error("a different Date shown by the template has the same key")
+	}
+	if key(t, p, "ollama/m", message("Mon, 6 May 2024 10:00:00 +0300", "iarna")) == a {
+		t.Error("a different header shown by the template has the same key")
+	}
+}
+
+func TestScoreEmail_Cache(t *testing.T) {
+	srv, seen := chat(t, `{"spam": true, "score": 0.9, "category": "scam", "reason": "premiu"}`)
+	cache, _ := NewCache(time.Hour, 10, "")
+	client := New(NewOllama(srv.URL, "llama3.1:8b"))
+	client.Cache = cache
+
+	first, err := client.ScoreEmail(context.Background(), testEmail(t, lottery), Auth{})
+	if err != nil || first.Cache != "miss" {
+		t.Fatalf("first: %+v, %v", first, err)
+	}
+	again := strings.Replace(lottery, "ion.popescu@igsu.ro", "ana.marin@igsu.ro", 1)
+	second, err := client.ScoreEmail(context.Background(), testEmail(t, again), Auth{})
+	if err != nil || second.Cache != "hit" || second.Score != 0.9 || second.Provider != "ollama/llama3.1:8b" {
+		t.Errorf("second: %+v, %v", second, err)
+	}
+	if len(*seen) != 1 {
+		t.Errorf("%d requests, want 1", len(*seen))
+	}
+	if st := client.Stats(); st != (Stats{Calls: 1, CacheHits: 1, CacheMisses: 1}) {
+		t.Errorf("Stats = %+v", st)
+	}
+}
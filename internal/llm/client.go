@@ -6,62 +6,322 @@ import (
 	"errors"
 	"fmt"
 	"strings"
+	"sync/atomic"
+	"unicode/utf8"
 
 	"spamfilter/internal/email"
-
-	"github.com/sashabaranov/go-openai"
 )
 
+// Client scores messages with a Provider.
 type Client struct {
-	client *openai.Client
-	model  string
+	provider Provider
+	// Prompts are the templates the prompts are built from; New sets the
+	// built-in ones.
+	Prompts *Prompts
+	// Cache, when set, answers for messages the model was already asked
+	// about.
+	Cache *Cache
+	// Limiter, Breaker and Budget, when set, hold back calls to the
+	// provider; Budget may be shared between clients.
+	Limiter *Limiter
+	Breaker *Breaker
+	Budget  *Budget
+
+	calls, hits, misses, refused, failures atomic.Int64
+	promptTokens, completionTokens         atomic.Int64
 }
 
-type Score struct {
-	Spam   bool    `json:"spam"`
-	Score  float64 `json:"score"`
-	Reason string  `json:"reason"`
+// Stats counts what a Client did since it was created.
+type Stats struct {
+	Calls            int64 // requests sent to the provider, repairs included
+	Failures         int64 // calls that failed
+	Refused          int64 // calls held back by the Breaker or the Budget
+	CacheHits        int64
+	CacheMisses      int64
+	PromptTokens     int64
+	CompletionTokens int64
 }
 
-func New(apiKey, baseURL, model string) (*Client, error) {
-	if apiKey == "" {
-		return nil, errors.New("OPENAI_API_KEY not set; LLM classification disabled")
+// Stats returns the counters of c.
+func (c *Client) Stats() Stats {
+	return Stats{
+		Calls: c.calls.Load(), Failures: c.failures.Load(), Refused: c.refused.Load(),
+		CacheHits: c.hits.Load(), CacheMisses: c.misses.Load(),
+		PromptTokens: c.promptTokens.Load(), CompletionTokens: c.completionTokens.Load(),
 	}
-	cfg := openai.DefaultConfig(apiKey)
-	if baseURL != "" {
-		cfg.BaseURL = baseURL
+}
+
+type Score struct {
+	Spam     bool    `json:"spam"`
+	Score    float64 `json:"score"`
+	Category string  `json:"category"` // one of the Category* constants; "" when the model gave none
+	Reason   string  `json:"reason"`
+	// Urgency and Impersonation quote the cues the model found: pressure
+	// to act now, and claims to be someone the sender is not.
+	Urgency       []string   `json:"urgency_cues"`
+	Impersonation []string   `json:"impersonation_cues"`
+	Indicators    Indicators `json:"indicators"`
+	Provider      string     `json:"-"` // Provider.Name of the model that answered
+	// Recovered tells how a malformed answer was salvaged: "extracted"
+	// when the JSON was cut out of surrounding text, "repaired" when the
+	// model answered correctly only after a repair prompt.
+	Recovered string `json:"-"`
+	// Compromised says why the answer cannot be trusted, e.g. its reason
+	// repeats instructions written in the message.
+	Compromised string `json:"-"`
+	Prompt      string `json:"-"` // Prompt.ID of the template used
+	// Cache is "hit" when the verdict was given for an earlier copy of the
+	// message and "miss" when the model was asked; "" without a Cache.
+	Cache string `json:"-"`
+	// Votes are the verdicts of the members when an Ensemble answered, and
+	// Disagreement the share of their weight against the combined verdict.
+	Votes        []Vote  `json:"-"`
+	Disagreement float64 `json:"-"`
+}
+
+// ParseError reports an answer that was still unusable after the repair
+// attempts; Text is the last one.
+type ParseError struct {
+	Text     string
+	Attempts int
+	Prompt   string // Prompt.ID of the template used
+	Err      error
+}
+
+func (e *ParseError) Error() string {
+	return fmt.Sprintf("unusable LLM answer after %d attempt(s): %v", e.Attempts, e.Err)
+}
+
+func (e *ParseError) Unwrap() error { return e.Err }
+
+// maxRepairs is how many times a malformed answer is sent back to the
+// model along with what was wrong with it.
+const maxRepairs = 1
+
+// scoreSchema is the JSON schema of Score for constrained decoding.
+var scoreSchema = map[string]any{
+	"type": "object",
+	"properties": map[string]any{
+		"spam":               map[string]any{"type": "boolean"},
+		"score":              map[string]any{"type": "number", "minimum": 0, "maximum": 1},
+		"category":           map[string]any{"type": "string", "enum": categories},
+		"reason":             map[string]any{"type": "string"},
+		"urgency_cues":       stringList,
+		"impersonation_cues": stringList,
+		"indicators": map[string]any{
+			"type": "object",
+			"properties": map[string]any{
+				"urls":                 stringList,
+				"phones":               stringList,
+				"ibans":                stringList,
+				"claimed_organization": map[string]any{"type": "string"},
+			},
+			"required": []string{"urls", "phones", "ibans", "claimed_organization"},
+		},
+	},
+	"required": []string{"spam", "score", "category", "reason", "urgency_cues", "impersonation_cues", "indicators"},
+}
+
+var stringList = map[string]any{"type": "array", "items": map[string]any{"type": "string"}}
+
+func New(p Provider) *Client {
+	return &Client{provider: p, Prompts: DefaultPrompts()}
+}
+
+// Name returns the name of the provider behind c.
+func (c *Client) Name() string {
+	return c.provider.Name()
+}
+
+// Check asks the provider whether it is ready, when it can tell.
+func (c *Client) Check(ctx context.Context) error {
+	if checker, ok := c.provider.(Checker); ok {
+		return checker.Check(ctx)
 	}
-	return &Client{client: openai.NewClientWithConfig(cfg), model: model}, nil
+	return nil
 }
 
-func (c *Client) ScoreEmail(ctx context.Context, em email.Email) (Score, error) {
+// ScoreEmail asks the model for a verdict on em; auth is shown to the
+// model as trusted context.
+func (c *Client) ScoreEmail(ctx context.Context, em email.Email, auth Auth) (Score, error) {
 	if c == nil {
 		return Score{}, errors.New("LLM client is nil")
 	}
-	prompt := buildPrompt(em)
-	resp, err := c.client.CreateChatCompletion(ctx, openai.ChatCompletionRequest{
-		Model: c.model,
-		Messages: []openai.ChatCompletionMessage{
-			{Role: openai.ChatMessageRoleSystem, Content: "Ești un filtru anti-spam. Returnează doar JSON cu câmpurile spam (bool), score (0-1), reason (string)."},
-			{Role: openai.ChatMessageRoleUser, Content: prompt},
-		},
-		Temperature: 0.2,
-	})
+	data := newPromptData(em, auth, newTag())
+	prompt := c.Prompts.For(data.Language)
+	system, user, err := prompt.render(data)
 	if err != nil {
-		return Score{}, err
+		return Score{}, fmt.Errorf("prompt %s: %w", prompt.ID(), err)
 	}
-	if len(resp.Choices) == 0 {
-		return Score{}, fmt.Errorf("no choices returned")
+	var key string
+	if c.Cache != nil {
+		key = cacheKey(c.provider.Name(), prompt.ID(), system, user, data)
+		if score, ok := c.Cache.Get(key); ok {
+			c.hits.Add(1)
+			score.Provider, score.Cache = c.provider.Name(), "hit"
+			return c.finish(score, data), nil
+		}
+		c.misses.Add(1)
 	}
-	content := resp.Choices[0].Message.Content
+	req := Request{System: system, User: user, Temperature: 0.2, Schema: scoreSchema}
+	for attempt := 0; ; attempt++ {
+		resp, err := c.complete(ctx, req)
+		if err != nil {
+			return Score{}, err
+		}
+		score, extracted, err := parseScore(resp.Text)
+		if err != nil {
+			if attempt == maxRepairs {
+				return Score{}, &ParseError{Text: resp.Text, Attempts: attempt + 1, Prompt: prompt.ID(), Err: err}
+			}
+			repair := data
+			repair.Error, repair.Answer = err.Error(), truncate(resp.Text, 500)
+			text, rerr := prompt.execute("repair", repair)
+			if rerr != nil {
+				return Score{}, fmt.Errorf("prompt %s: %w", prompt.ID(), rerr)
+			}
+			req.User = user + "\n\n" + text
+			continue
+		}
+		switch {
+		case attempt > 0:
+			score.Recovered = "repaired"
+		case extracted:
+			score.Recovered = "extracted"
+		}
+		score.Provider = c.provider.Name()
+		score.Prompt = prompt.ID()
+		if c.Cache != nil {
+			c.Cache.Put(key, score)
+			score.Cache = "miss"
+		}
+		return c.finish(score, data), nil
+	}
+}
+
+// complete makes one call to the provider, within the limits set on c.
+func (c *Client) complete(ctx context.Context, req Request) (Response, error) {
+	if c.Budget != nil {
+		if err := c.Budget.Allow(); err != nil {
+			c.refused.Add(1)
+			return Response{}, err
+		}
+	}
+	if c.Breaker != nil {
+		if err := c.Breaker.Allow(); err != nil {
+			c.refused.Add(1)
+			return Response{}, fmt.Errorf("%s: %w", c.provider.Name(), err)
+		}
+	}
+	if c.Limiter != nil {
+		release, err := c.Limiter.Acquire(ctx)
+		if err != nil {
+			if c.Breaker != nil {
+				c.Breaker.Cancel()
+			}
+			return Response{}, fmt.Errorf("waiting for the rate limit: %w", err)
+		}
+		defer release()
+	}
+	c.calls.Add(1)
+	resp, err := c.provider.Complete(ctx, req)
+	if c.Breaker != nil {
+		c.Breaker.Record(err)
+	}
+	if err != nil {
+		c.failures.Add(1)
+		return Response{}, err
+	}
+	c.promptTokens.Add(int64(resp.Usage.PromptTokens))
+	c.completionTokens.Add(int64(resp.Usage.CompletionTokens))
+	if c.Budget != nil {
+		c.Budget.Add(resp.Usage)
+	}
+	return resp, nil
+}
+
+// finish checks a verdict against the message it is for. It runs on
+// cached verdicts too, since their copy of the message may differ. Only a
+// verdict that lets the message through is checked for repeated
+// instructions: a spam verdict may quote them as evidence.
+func (c *Client) finish(score Score, data PromptData) Score {
+	seen := data.untrusted()
+	score.Indicators = score.Indicators.ground(seen)
+	if score.Spam {
+		return score
+	}
+	if sentence := parrots(score.Reason, seen); sentence != "" {
+		score.Compromised = fmt.Sprintf("reason repeats the message's instruction %q", truncate(sentence, 80))
+	}
+	return score
+}
+
+// parseScore reads a verdict from an answer. When the answer is not a
+// bare JSON object, as with code fences or a preamble, it takes the
+// first valid verdict object in it and reports extracted.
+func parseScore(text string) (score Score, extracted bool, err error) {
+	text = strings.TrimSpace(text)
+	if score, err = decodeScore([]byte(text)); err == nil {
+		return score, false, nil
+	}
+	var invalid error // a JSON object that is not a valid verdict says more
+	for i := strings.IndexByte(text, '{'); i >= 0; {
+		var obj json.RawMessage
+		if json.NewDecoder(strings.NewReader(text[i:])).Decode(&obj) == nil {
+			s, verr := decodeScore(obj)
+			if verr == nil {
+				return s, true, nil
+			}
+			if invalid == nil {
+				invalid = verr
+			}
+		}
+		next := strings.IndexByte(text[i+1:], '{')
+		if next < 0 {
+			break
+		}
+		i += 1 + next
+	}
+	if invalid != nil {
+		return Score{}, false, invalid
+	}
+	return Score{}, false, errors.New("no JSON object in the answer")
+}
+
+// decodeScore decodes a verdict object and checks its fields.
+func decodeScore(data []byte) (Score, error) {
 	var score Score
-	if err := json.NewDecoder(strings.NewReader(content)).Decode(&score); err != nil {
-		return Score{}, fmt.Errorf("parse LLM JSON: %w", err)
+	if err := json.Unmarshal(data, &score); err != nil {
+		return Score{}, err
+	}
+	var present struct {
+		Spam  *bool    `json:"spam"`
+		Score *float64 `json:"score"`
 	}
+	json.Unmarshal(data, &present)
+	if present.Spam == nil || present.Score == nil {
+		return Score{}, errors.New("spam and score are required")
+	}
+	if score.Score < 0 || score.Score > 1 {
+		return Score{}, fmt.Errorf("score %g is outside 0-1", score.Score)
+	}
+	category, ok := normalizeCategory(score.Category)
+	if !ok {
+		return Score{}, fmt.Errorf("unknown category %q", score.Category)
+	}
+	if category == CategoryLegitimate && score.Spam {
+		return Score{}, errors.New("category legitimate contradicts spam true")
+	}
+	score.Category = category
 	return score, nil
 }
 
-func buildPrompt(em email.Email) string {
-	body := email.BodyPreview(em.Envelope, 1500)
-	return fmt.Sprintf("Subiect: %s\nFrom: %s\nBody:\n%s", em.Envelope.GetHeader("Subject"), em.Envelope.GetHeader("From"), body)
+func truncate(s string, n int) string {
+	if len(s) <= n {
+		return s
+	}
+	for n > 0 && !utf8.RuneStart(s[n]) {
+		n--
+	}
+	return s[:n] + "…"
 }
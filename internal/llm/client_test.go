@@ -0,0 +1,307 @@
+package llm
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"spamfilter/internal/email"
+
+	"github.com/jhillyerd/enmime"
+)
+
+const lottery = "From: \"Loteria Nationala\" <premii@spamsite.biz>\r\nTo: ion.popescu@igsu.ro\r\n" +
+	"Subject: Ati castigat!\r\n\r\nConfirmati datele cardului: http://premii.spamsite.biz/confirmare\r\n"
+
+func testEmail(t *testing.T, raw string) email.Email {
+	t.Helper()
+	env, err := enmime.ReadEnvelope(bytes.NewReader([]byte(raw)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return email.Email{ID: "test.eml", Raw: []byte(raw), Envelope: env}
+}
+
+// recorded is a request seen by a replay server.
+type recorded struct {
+	Path   string
+	Header http.Header
+	Body   map[string]any
+}
+
+// replay serves the recorded response in testdata/file with the given
+// status and keeps the requests it received.
+func replay(t *testing.T, status int, file string) (*httptest.Server, *[]recorded) {
+	t.Helper()
+	body, err := os.ReadFile(filepath.Join("testdata", file))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var seen []recorded
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		data, _ := io.ReadAll(r.Body)
+		rec := recorded{Path: r.URL.Path, Header: r.Header.Clone()}
+		json.Unmarshal(data, &rec.Body)
+		seen = append(seen, rec)
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(status)
+		w.Write(body)
+	}))
+	t.Cleanup(srv.Close)
+	return srv, &seen
+}
+
+func TestScoreEmail_OpenAI(t *testing.T) {
+	srv, seen := replay(t, http.StatusOK, "openai_chat.json")
+	provider, err := NewOpenAI("sk-test", srv.URL+"/v1", "gpt-4o-mini")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	score, err := New(provider).ScoreEmail(context.Background(), testEmail(t, lottery), Auth{})
+	if err != nil {
+		t.Fatalf("ScoreEmail: %v", err)
+	}
+	if !score.Spam || score.Score != 0.93 || score.Provider != "openai/gpt-4o-mini" {
+		t.Errorf("unexpected score %+v", score)
+	}
+
+	if len(*seen) != 1 {
+		t.Fatalf("expected 1 request, got %d", len(*seen))
+	}
+	req := (*seen)[0]
+	if req.Path != "/v1/chat/completions" || req.Header.Get("Authorization") != "Bearer sk-test" {
+		t.Errorf("request to %s with %q", req.Path, req.Header.Get("Authorization"))
+	}
+	if req.Body["model"] != "gpt-4o-mini" {
+		t.Errorf("model = %v", req.Body["model"])
+	}
+	messages, _ := req.Body["messages"].([]any)
+	if len(messages) != 2 {
+		t.Fatalf("expected system and user messages, got %v", req.Body["messages"])
+	}
+	if user, _ := messages[1].(map[string]any); !bytes.Contains([]byte(user["content"].(string)), []byte("Subiect: Ati castigat!")) {
+		t.Errorf("user message = %v", user["content"])
+	}
+}
+
+func TestScoreEmail_Gemini(t *testing.T) {
+	srv, seen := replay(t, http.StatusOK, "gemini_generate.json")
+	provider, err := NewGemini("AIza-test", srv.URL+"/v1beta/", "gemini-1.5-flash")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	score, err := New(provider).ScoreEmail(context.Background(), testEmail(t, lottery), Auth{})
+	if err != nil {
+		t.Fatalf("ScoreEmail: %v", err)
+	}
+	if !score.Spam || score.Score != 0.91 || score.Provider != "gemini/gemini-1.5-flash" {
+		t.Errorf("unexpected score %+v", score)
+	}
+
+	req := (*seen)[0]
+	if req.Path != "/v1beta/models/gemini-1.5-flash:generateContent" {
+		t.Errorf("path = %s", req.Path)
+	}
+	if req.Header.Get("x-goog-api-key") != "AIza-test" {
+		t.Errorf("API key header = %q", req.Header.Get("x-goog-api-key"))
+	}
+	system, _ := req.Body["systemInstruction"].(map[string]any)
+	if parts, _ := system["parts"].([]any); len(parts) != 1 {
+		t.Errorf("systemInstruction = %v", req.Body["systemInstruction"])
+	}
+	contents, _ := req.Body["contents"].([]any)
+	if len(contents) != 1 || contents[0].(map[string]any)["role"] != "user" {
+		t.Errorf("contents = %v", req.Body["contents"])
+	}
+}
+
+func TestGemini_Errors(t *testing.T) {
+	cases := []struct {
+		status int
+		file   string
+		want   string
+	}{
+		{http.StatusBadRequest, "gemini_error.json", "gemini: API key not valid. Please pass a valid API key. (400 INVALID_ARGUMENT)"},
+		{http.StatusOK, "gemini_blocked.json", "gemini: prompt blocked (SAFETY)"},
+	}
+	for _, tc := range cases {
+		srv, _ := replay(t, tc.status, tc.file)
+		provider, _ := NewGemini("AIza-test", srv.URL, "gemini-1.5-flash")
+		_, err := provider.Complete(context.Background(), Request{User: "x"})
+		if err == nil || err.Error() != tc.want {
+			t.Errorf("%s: error = %v, want %q", tc.file, err, tc.want)
+		}
+	}
+}
+
+func TestGemini_Usage(t *testing.T) {
+	srv, _ := replay(t, http.StatusOK, "gemini_generate.json")
+	provider, _ := NewGemini("AIza-test", srv.URL, "gemini-1.5-flash")
+	resp, err := provider.Complete(context.Background(), Request{User: "x"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.Usage != (Usage{PromptTokens: 198, CompletionTokens: 29}) {
+		t.Errorf("usage = %+v", resp.Usage)
+	}
+}
+
+func TestNewProviders_RequireKey(t *testing.T) {
+	if _, err := NewOpenAI("", "", "gpt-4o-mini"); err == nil {
+		t.Error("expected an error without OPENAI_API_KEY")
+	}
+	if _, err := NewGemini("", "", "gemini-1.5-flash"); err == nil {
+		t.Error("expected an error without GEMINI_API_KEY")
+	}
+}
+
+func TestParseScore(t *testing.T) {
+	cases := []struct {
+		name      string
+		text      string
+		want      Score
+		extracted bool
+		err       string
+	}{
+		{"bare", `{"spam": true, "score": 0.8, "reason": "phishing"}`, Score{Spam: true, Score: 0.8, Reason: "phishing"}, false, ""},
+		{"fenced", "```json\n{\"spam\": false, \"score\": 0.1, \"reason\": \"ok\"}\n```", Score{Score: 0.1, Reason: "ok"}, true, ""},
+		{"preamble", "Iată analiza: {\"spam\": true, \"score\": 1, \"reason\": \"{x}\"} Sper că ajută.", Score{Spam: true, Score: 1, Reason: "{x}"}, true, ""},
+		{"wrapped", `{"verdict": {"spam": true, "score": 0.7, "reason": "r"}}`, Score{Spam: true, Score: 0.7, Reason: "r"}, true, ""},
+		{"out of range", `{"spam": true, "score": 87, "reason": "r"}`, Score{}, false, "score 87 is outside 0-1"},
+		{"missing field", `Rezultat: {"spam": true}`, Score{}, false, "spam and score are required"},
+		{"prose", "Acest mesaj pare a fi spam.", Score{}, false, "no JSON object in the answer"},
+		{"unknown category", `{"spam": true, "score": 0.9, "category": "suspect"}`, Score{}, false, `unknown category "suspect"`},
+		{"contradiction", `{"spam": true, "score": 0.9, "category": "legitimate"}`, Score{}, false, "category legitimate contradicts spam true"},
+	}
+	for _, tc := range cases {
+		got, extracted, err := parseScore(tc.text)
+		if tc.err != "" {
+			if err == nil || err.Error() != tc.err {
+				t.Errorf("%s: error = %v, want %q", tc.name, err, tc.err)
+			}
+			continue
+		}
+		if err != nil || !reflect.DeepEqual(got, tc.want) || extracted != tc.extracted {
+			t.Errorf("%s: got %+v, %v, %v", tc.name, got, extracted, err)
+		}
+	}
+}
+
+// chat serves the given answers in order as Ollama chat responses and
+// keeps the requests it received.
+func chat(t *testing.T, answers ...string) (*httptest.Server, *[]recorded) {
+	t.Helper()
+	var seen []recorded
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		data, _ := io.ReadAll(r.Body)
+		rec := recorded{Path: r.URL.Path, Header: r.Header.Clone()}
+		json.Unmarshal(data, &rec.Body)
+		answer := answers[min(len(seen), len(answers)-1)]
+		seen = append(seen, rec)
+		json.NewEncoder(w).Encode(map[string]any{"message": map[string]string{"role": "assistant", "content": answer}, "done": true})
+	}))
+	t.Cleanup(srv.Close)
+	return srv, &seen
+}
+
+// userMessage returns the user message of an Ollama chat request.
+func userMessage(req recorded) string {
+	messages, _ := req.Body["messages"].([]any)
+	last, _ := messages[len(messages)-1].(map[string]any)
+	content, _ := last["content"].(string)
+	return content
+}
+
+func TestScoreEmail_Recovery(t *testing.T) {
+	srv, seen := chat(t, "Analiză:\n```json\n{\"spam\": true, \"score\": 0.9, \"reason\": \"premiu\"}\n```")
+	score, err := New(NewOllama(srv.URL, "llama3.1:8b")).ScoreEmail(context.Background(), testEmail(t, lottery), Auth{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if score.Score != 0.9 || score.Recovered != "extracted" || len(*seen) != 1 {
+		t.Errorf("score %+v after %d request(s)", score, len(*seen))
+	}
+
+	srv, seen = chat(t, `{"spam": true, "score": 90, "reason": "premiu"}`, `{"spam": true, "score": 0.9, "reason": "premiu"}`)
+	score, err = New(NewOllama(srv.URL, "llama3.1:8b")).ScoreEmail(context.Background(), testEmail(t, lottery), Auth{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if score.Score != 0.9 || score.Recovered != "repaired" || len(*seen) != 2 {
+		t.Errorf("score %+v after %d request(s)", score, len(*seen))
+	}
+	repair := userMessage((*seen)[1])
+	if !strings.Contains(repair, "Subiect: Ati castigat!") || !strings.Contains(repair, "score 90 is outside 0-1") {
+		t.Errorf("repair prompt = %q", repair)
+	}
+}
+
+func TestScoreEmail_ParseError(t *testing.T) {
+	srv, seen := chat(t, "Nu pot evalua acest mesaj.")
+	_, err := New(NewOllama(srv.URL, "llama3.1:8b")).ScoreEmail(context.Background(), testEmail(t, lottery), Auth{})
+	var perr *ParseError
+	if !errors.As(err, &perr) {
+		t.Fatalf("expected a ParseError, got %v", err)
+	}
+	if perr.Attempts != 1+maxRepairs || perr.Text != "Nu pot evalua acest mesaj." || len(*seen) != perr.Attempts {
+		t.Errorf("ParseError %+v after %d request(s)", perr, len(*seen))
+	}
+}
+
+func TestStructuredOutput(t *testing.T) {
+	srv, seen := replay(t, http.StatusOK, "openai_chat.json")
+	provider, _ := NewOpenAI("sk-test", srv.URL+"/v1", "gpt-4o-mini")
+	if provider.Structured != StructuredJSON {
+		t.Errorf("Structured = %q for a compatible endpoint, want json", provider.Structured)
+	}
+	provider.Structured = StructuredTools
+	provider.Complete(context.Background(), Request{User: "x", Schema: scoreSchema})
+	provider.Structured = StructuredJSON
+	provider.Complete(context.Background(), Request{User: "x", Schema: scoreSchema})
+
+	tools, _ := (*seen)[0].Body["tools"].([]any)
+	choice, _ := (*seen)[0].Body["tool_choice"].(map[string]any)
+	if len(tools) != 1 || choice["type"] != "function" {
+		t.Errorf("tools = %v, tool_choice = %v", (*seen)[0].Body["tools"], (*seen)[0].Body["tool_choice"])
+	}
+	format, _ := (*seen)[1].Body["response_format"].(map[string]any)
+	if format["type"] != "json_object" || (*seen)[1].Body["tools"] != nil {
+		t.Errorf("response_format = %v", (*seen)[1].Body["response_format"])
+	}
+
+	srv, seen = replay(t, http.StatusOK, "gemini_generate.json")
+	gemini, _ := NewGemini("AIza-test", srv.URL, "gemini-1.5-flash")
+	gemini.Complete(context.Background(), Request{User: "x", Schema: scoreSchema})
+	config, _ := (*seen)[0].Body["generationConfig"].(map[string]any)
+	schema, _ := config["responseSchema"].(map[string]any)
+	if config["responseMimeType"] != "application/json" || schema["type"] != "OBJECT" {
+		t.Errorf("generationConfig = %v", config)
+	}
+	if props, _ := schema["properties"].(map[string]any); props["score"].(map[string]any)["type"] != "NUMBER" {
+		t.Errorf("responseSchema = %v", schema)
+	}
+}
+
+func TestOpenAI_ToolCall(t *testing.T) {
+	srv, _ := replay(t, http.StatusOK, "openai_tool_call.json")
+	provider, _ := NewOpenAI("sk-test", srv.URL+"/v1", "gpt-4o-mini")
+	provider.Structured = StructuredTools
+	score, err := New(provider).ScoreEmail(context.Background(), testEmail(t, lottery), Auth{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !score.Spam || score.Score != 0.95 || score.Recovered != "" {
+		t.Errorf("unexpected score %+v", score)
+	}
+}
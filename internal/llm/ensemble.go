@@ -0,0 +1,251 @@
+package llm
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+
+	"spamfilter/internal/email"
+)
+
+// Scorer gives verdicts on messages: a Client, or an Ensemble of them.
+type Scorer interface {
+	Name() string
+	ScoreEmail(ctx context.Context, em email.Email, auth Auth) (Score, error)
+	Stats() Stats
+}
+
+// Strategy combines the verdicts of an ensemble.
+type Strategy string
+
+const (
+	// StrategyMajority takes the verdict with most of the weight behind it.
+	StrategyMajority Strategy = "majority"
+	// StrategyWeighted averages the scores by weight; 0.5 or more is spam.
+	StrategyWeighted Strategy = "weighted"
+	// StrategyAnyPhishing takes a phishing verdict from any model, and the
+	// majority otherwise.
+	StrategyAnyPhishing Strategy = "any-phishing"
+)
+
+// ParseStrategy accepts "majority" (the default), "weighted" or
+// "any-phishing".
+func ParseStrategy(s string) (Strategy, error) {
+	switch Strategy(s) {
+	case "", StrategyMajority:
+		return StrategyMajority, nil
+	case StrategyWeighted, StrategyAnyPhishing:
+		return Strategy(s), nil
+	}
+	return StrategyMajority, fmt.Errorf("unknown ensemble strategy %q", s)
+}
+
+// Member is one model of an ensemble.
+type Member struct {
+	Client *Client
+	Weight float64 // 0 counts as 1
+}
+
+// Ensemble asks several models at once and combines their verdicts, so
+// that no single model decides.
+type Ensemble struct {
+	Members  []Member
+	Strategy Strategy
+}
+
+// Vote is what one member of an ensemble answered.
+type Vote struct {
+	Provider    string
+	Weight      float64
+	Spam        bool
+	Score       float64
+	Category    string
+	Compromised string
+	Cache       string
+	Error       string // the member gave no verdict
+}
+
+func (e *Ensemble) Name() string {
+	names := make([]string, len(e.Members))
+	for i, m := range e.Members {
+		names[i] = m.Client.Name()
+	}
+	return fmt.Sprintf("ensemble/%s(%s)", e.Strategy, strings.Join(names, ", "))
+}
+
+// Stats adds up the counters of the members.
+func (e *Ensemble) Stats() Stats {
+	var st Stats
+	for _, m := range e.Members {
+		s := m.Client.Stats()
+		st.Calls += s.Calls
+		st.Failures += s.Failures
+		st.Refused += s.Refused
+		st.CacheHits += s.CacheHits
+		st.CacheMisses += s.CacheMisses
+		st.PromptTokens += s.PromptTokens
+		st.CompletionTokens += s.CompletionTokens
+	}
+	return st
+}
+
+// ScoreEmail asks every member at once, within the deadline of ctx, and
+// combines the verdicts that came back. Members that fail or whose
+// verdict is compromised do not vote; the ensemble fails only when none
+// answered.
+func (e *Ensemble) ScoreEmail(ctx context.Context, em email.Email, auth Auth) (Score, error) {
+	scores := make([]Score, len(e.Members))
+	errs := make([]error, len(e.Members))
+	var wg sync.WaitGroup
+	for i, m := range e.Members {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			scores[i], errs[i] = m.Client.ScoreEmail(ctx, em, auth)
+		}()
+	}
+	wg.Wait()
+
+	votes := make([]Vote, len(e.Members))
+	var valid []int
+	for i, m := range e.Members {
+		w := m.Weight
+		if w <= 0 {
+			w = 1
+		}
+		votes[i] = Vote{Provider: m.Client.Name(), Weight: w}
+		if errs[i] != nil {
+			votes[i].Error = errs[i].Error()
+			continue
+		}
+		s := scores[i]
+		votes[i].Spam, votes[i].Score, votes[i].Category = s.Spam, s.Score, s.Category
+		votes[i].Compromised, votes[i].Cache = s.Compromised, s.Cache
+		if s.Compromised == "" {
+			valid = append(valid, i)
+		}
+	}
+	if len(valid) == 0 {
+		for i := range scores {
+			if errs[i] == nil { // all answers were compromised
+				score := scores[i]
+				score.Provider, score.Votes = e.Name(), votes
+				return score, nil
+			}
+		}
+		return Score{}, errors.Join(errs...)
+	}
+
+	spam, phisher := e.decide(votes, valid)
+	score := Score{Spam: spam, Provider: e.Name(), Votes: votes}
+	var agree, total, scoreSum float64
+	categoryWeight := map[string]float64{}
+	lead := -1
+	for _, i := range valid {
+		v := votes[i]
+		total += v.Weight
+		if e.Strategy == StrategyWeighted {
+			scoreSum += v.Weight * v.Score
+		}
+		if v.Spam != spam {
+			continue
+		}
+		agree += v.Weight
+		if e.Strategy != StrategyWeighted {
+			scoreSum += v.Weight * v.Score
+		}
+		categoryWeight[v.Category] += v.Weight
+		if lead < 0 || v.Weight > votes[lead].Weight {
+			lead = i
+		}
+		mergeCues(&score, scores[i])
+	}
+	switch {
+	case phisher >= 0:
+		lead = phisher
+		score.Score, score.Category = votes[phisher].Score, CategoryPhishing
+	case e.Strategy == StrategyWeighted:
+		score.Score = scoreSum / total
+	default:
+		score.Score = scoreSum / agree
+	}
+	if score.Category == "" {
+		best := 0.0
+		for _, c := range categories {
+			if categoryWeight[c] > best {
+				score.Category, best = c, categoryWeight[c]
+			}
+		}
+	}
+	if lead < 0 { // a weighted average none of the members agrees with
+		lead = valid[0]
+	}
+	score.Reason, score.Recovered, score.Prompt = scores[lead].Reason, scores[lead].Recovered, scores[lead].Prompt
+	score.Disagreement = 1 - agree/total
+	score.Cache = "hit"
+	for _, i := range valid {
+		if votes[i].Cache != "hit" {
+			score.Cache = votes[i].Cache
+			break
+		}
+	}
+	return score, nil
+}
+
+// decide returns the combined verdict of the valid votes and, for
+// StrategyAnyPhishing, the vote that called the message phishing or -1.
+func (e *Ensemble) decide(votes []Vote, valid []int) (spam bool, phisher int) {
+	var spamWeight, total, scoreSum float64
+	phisher = -1
+	for _, i := range valid {
+		v := votes[i]
+		total += v.Weight
+		scoreSum += v.Weight * v.Score
+		if v.Spam {
+			spamWeight += v.Weight
+		}
+		if v.Spam && v.Category == CategoryPhishing && (phisher < 0 || v.Score > votes[phisher].Score) {
+			phisher = i
+		}
+	}
+	switch {
+	case e.Strategy == StrategyAnyPhishing && phisher >= 0:
+		return true, phisher
+	case e.Strategy == StrategyWeighted:
+		return scoreSum/total >= 0.5, -1
+	case spamWeight*2 == total: // a tie goes to the average score
+		return scoreSum/total >= 0.5, -1
+	}
+	return spamWeight*2 > total, -1
+}
+
+// mergeCues adds the cues and indicators of s to score, without repeats.
+func mergeCues(score *Score, s Score) {
+	score.Urgency = union(score.Urgency, s.Urgency)
+	score.Impersonation = union(score.Impersonation, s.Impersonation)
+	ind := &score.Indicators
+	ind.URLs = union(ind.URLs, s.Indicators.URLs)
+	ind.Phones = union(ind.Phones, s.Indicators.Phones)
+	ind.IBANs = union(ind.IBANs, s.Indicators.IBANs)
+	if ind.Organization == "" {
+		ind.Organization = s.Indicators.Organization
+	}
+}
+
+func union(a, b []string) []string {
+	for _, s := range b {
+		found := false
+		for _, t := range a {
+			if strings.EqualFold(s, t) {
+				found = true
+				break
+			}
+		}
+		if !found {
+			a = append(a, s)
+		}
+	}
+	return a
+}
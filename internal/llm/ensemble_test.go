@@ -0,0 +1,122 @@
+package llm
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+)
+
+// canned answers every request with the same text, or fails with err.
+type canned struct {
+	name string
+	text string
+	err  error
+}
+
+func (c canned) Name() string { return c.name }
+
+func (c canned) Complete(ctx context.Context, req Request) (Response, error) {
+	if c.err != nil {
+		return Response{}, c.err
+	}
+	return Response{Text: c.text}, nil
+}
+
+func ensemble(strategy Strategy, members ...Member) *Ensemble {
+	return &Ensemble{Members: members, Strategy: strategy}
+}
+
+func member(name, answer string, weight float64) Member {
+	return Member{Client: New(canned{name: name, text: answer}), Weight: weight}
+}
+
+const (
+	votePhishing = `{"spam": true, "score": 0.8, "category": "phishing", "reason": "cere parola"}`
+	voteScam     = `{"spam": true, "score": 0.9, "category": "scam", "reason": "premiu fals"}`
+	voteClean    = `{"spam": false, "score": 0.1, "category": "legitimate", "reason": "mesaj obisnuit"}`
+)
+
+func TestEnsemble_Strategies(t *testing.T) {
+	em := testEmail(t, lottery)
+	cases := []struct {
+		name         string
+		ens          *Ensemble
+		spam         bool
+		category     string
+		score        float64
+		disagreement float64
+	}{
+		{"majority", ensemble(StrategyMajority, member("a", voteScam, 1), member("b", voteScam, 1), member("c", voteClean, 1)),
+			true, CategoryScam, 0.9, 1.0 / 3},
+		{"majority by weight", ensemble(StrategyMajority, member("a", voteScam, 1), member("b", voteClean, 3)),
+			false, CategoryLegitimate, 0.1, 0.25},
+		{"weighted", ensemble(StrategyWeighted, member("a", voteScam, 1), member("b", voteClean, 2)),
+			false, CategoryLegitimate, (0.9 + 0.2) / 3, 1.0 / 3},
+		{"any phishing", ensemble(StrategyAnyPhishing, member("a", votePhishing, 1), member("b", voteClean, 1), member("c", voteClean, 1)),
+			true, CategoryPhishing, 0.8, 2.0 / 3},
+		{"any phishing without one", ensemble(StrategyAnyPhishing, member("a", voteScam, 1), member("b", voteClean, 1), member("c", voteClean, 1)),
+			false, CategoryLegitimate, 0.1, 1.0 / 3},
+	}
+	for _, tc := range cases {
+		score, err := tc.ens.ScoreEmail(context.Background(), em, Auth{})
+		if err != nil {
+			t.Fatalf("%s: %v", tc.name, err)
+		}
+		if score.Spam != tc.spam || score.Category != tc.category || !near(score.Score, tc.score) || !near(score.Disagreement, tc.disagreement) {
+			t.Errorf("%s: spam %v, category %q, score %g, disagreement %g", tc.name, score.Spam, score.Category, score.Score, score.Disagreement)
+		}
+		if len(score.Votes) != len(tc.ens.Members) {
+			t.Errorf("%s: %d votes", tc.name, len(score.Votes))
+		}
+	}
+}
+
+func near(a, b float64) bool { return a-b < 1e-9 && b-a < 1e-9 }
+
+func TestEnsemble_Failures(t *testing.T) {
+	em := testEmail(t, lottery)
+	down := Member{Client: New(canned{name: "down", err: errors.New("connection refused")})}
+	ens := ensemble(StrategyMajority, member("a", voteScam, 1), down)
+	score, err := ens.ScoreEmail(context.Background(), em, Auth{})
+	if err != nil || !score.Spam || score.Disagreement != 0 {
+		t.Fatalf("score %+v, %v", score, err)
+	}
+	if v := score.Votes[1]; v.Provider != "down" || !strings.Contains(v.Error, "connection refused") {
+		t.Errorf("vote of the failed member = %+v", v)
+	}
+
+	_, err = ensemble(StrategyMajority, down, down).ScoreEmail(context.Background(), em, Auth{})
+	if err == nil || !strings.Contains(err.Error(), "connection refused") {
+		t.Errorf("err = %v", err)
+	}
+}
+
+func TestEnsemble_Concurrent(t *testing.T) {
+	srvA, _ := chat(t, voteScam)
+	srvB, _ := chat(t, voteScam)
+	ens := ensemble(StrategyMajority,
+		Member{Client: New(NewOllama(srvA.URL, "llama3.1:8b"))},
+		Member{Client: New(NewOllama(srvB.URL, "qwen2.5:7b"))})
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	score, err := ens.ScoreEmail(ctx, testEmail(t, lottery), Auth{})
+	if err != nil || score.Provider != "ensemble/majority(ollama/llama3.1:8b, ollama/qwen2.5:7b)" {
+		t.Errorf("score %+v, %v", score, err)
+	}
+	if st := ens.Stats(); st.Calls != 2 {
+		t.Errorf("Stats = %+v", st)
+	}
+}
+
+func TestParseStrategy(t *testing.T) {
+	for in, want := range map[string]Strategy{"": StrategyMajority, "weighted": StrategyWeighted, "any-phishing": StrategyAnyPhishing} {
+		if got, err := ParseStrategy(in); err != nil || got != want {
+			t.Errorf("ParseStrategy(%q) = %q, %v", in, got, err)
+		}
+	}
+	if got, err := ParseStrategy("unanimous"); err == nil || got != StrategyMajority {
+		t.Errorf("ParseStrategy(unanimous) = %q, %v", got, err)
+	}
+}
@@ -0,0 +1,142 @@
+package llm
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+const DefaultGeminiURL = "https://generativelanguage.googleapis.com/v1beta"
+
+// Gemini calls the native generateContent API of the Gemini models.
+type Gemini struct {
+	APIKey  string
+	BaseURL string
+	Model   string
+	HTTP    *http.Client
+}
+
+func NewGemini(apiKey, baseURL, model string) (*Gemini, error) {
+	if apiKey == "" {
+		return nil, errors.New("GEMINI_API_KEY not set; LLM classification disabled")
+	}
+	if baseURL == "" {
+		baseURL = DefaultGeminiURL
+	}
+	return &Gemini{APIKey: apiKey, BaseURL: strings.TrimRight(baseURL, "/"), Model: model, HTTP: http.DefaultClient}, nil
+}
+
+func (p *Gemini) Name() string { return "gemini/" + p.Model }
+
+type geminiContent struct {
+	Role  string       `json:"role,omitempty"`
+	Parts []geminiPart `json:"parts"`
+}
+
+type geminiPart struct {
+	Text string `json:"text"`
+}
+
+type geminiRequest struct {
+	SystemInstruction *geminiContent  `json:"systemInstruction,omitempty"`
+	Contents          []geminiContent `json:"contents"`
+	GenerationConfig  struct {
+		Temperature      float32        `json:"temperature"`
+		ResponseMimeType string         `json:"responseMimeType,omitempty"`
+		ResponseSchema   map[string]any `json:"responseSchema,omitempty"`
+	} `json:"generationConfig"`
+}
+
+type geminiResponse struct {
+	Candidates []struct {
+		Content      geminiContent `json:"content"`
+		FinishReason string        `json:"finishReason"`
+	} `json:"candidates"`
+	PromptFeedback struct {
+		BlockReason string `json:"blockReason"`
+	} `json:"promptFeedback"`
+	UsageMetadata struct {
+		PromptTokenCount     int `json:"promptTokenCount"`
+		CandidatesTokenCount int `json:"candidatesTokenCount"`
+	} `json:"usageMetadata"`
+	Error *struct {
+		Code    int    `json:"code"`
+		Message string `json:"message"`
+		Status  string `json:"status"`
+	} `json:"error"`
+}
+
+func (p *Gemini) Complete(ctx context.Context, req Request) (Response, error) {
+	body := geminiRequest{Contents: []geminiContent{{Role: "user", Parts: []geminiPart{{Text: req.User}}}}}
+	if req.System != "" {
+		body.SystemInstruction = &geminiContent{Parts: []geminiPart{{Text: req.System}}}
+	}
+	body.GenerationConfig.Temperature = req.Temperature
+	if req.Schema != nil {
+		body.GenerationConfig.ResponseMimeType = "application/json"
+		body.GenerationConfig.ResponseSchema = geminiSchema(req.Schema)
+	}
+	url := fmt.Sprintf("%s/models/%s:generateContent", p.BaseURL, p.Model)
+	var out geminiResponse
+	status, err := callJSON(ctx, p.HTTP, http.MethodPost, url, http.Header{"X-Goog-Api-Key": {p.APIKey}}, body, &out)
+	if err != nil {
+		return Response{}, fmt.Errorf("gemini: %w", err)
+	}
+	if out.Error != nil {
+		return Response{}, fmt.Errorf("gemini: %s (%d %s)", out.Error.Message, out.Error.Code, out.Error.Status)
+	}
+	if status != http.StatusOK {
+		return Response{}, fmt.Errorf("gemini: HTTP %d", status)
+	}
+	if out.PromptFeedback.BlockReason != "" {
+		return Response{}, fmt.Errorf("gemini: prompt blocked (%s)", out.PromptFeedback.BlockReason)
+	}
+	if len(out.Candidates) == 0 {
+		return Response{}, fmt.Errorf("no candidates returned")
+	}
+	var text strings.Builder
+	for _, part := range out.Candidates[0].Content.Parts {
+		text.WriteString(part.Text)
+	}
+	if text.Len() == 0 {
+		return Response{}, fmt.Errorf("gemini: empty candidate (finish reason %s)", out.Candidates[0].FinishReason)
+	}
+	return Response{
+		Text:  text.String(),
+		Usage: Usage{PromptTokens: out.UsageMetadata.PromptTokenCount, CompletionTokens: out.UsageMetadata.CandidatesTokenCount},
+	}, nil
+}
+
+// geminiSchema converts a JSON schema to the OpenAPI subset Gemini
+// accepts: upper-case types and no keywords beyond the ones kept here.
+func geminiSchema(schema map[string]any) map[string]any {
+	out := map[string]any{}
+	for k, v := range schema {
+		switch k {
+		case "type":
+			if t, ok := v.(string); ok {
+				out[k] = strings.ToUpper(t)
+			}
+		case "properties":
+			props := map[string]any{}
+			for name, p := range v.(map[string]any) {
+				if p, ok := p.(map[string]any); ok {
+					props[name] = geminiSchema(p)
+				}
+			}
+			out[k] = props
+		case "items":
+			if items, ok := v.(map[string]any); ok {
+				out[k] = geminiSchema(items)
+			}
+		case "required", "enum", "description", "nullable", "format":
+			out[k] = v
+		}
+	}
+	if _, ok := out["enum"]; ok && out["type"] == "STRING" {
+		out["format"] = "enum"
+	}
+	return out
+}
@@ -0,0 +1,99 @@
+package llm
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"strings"
+	"unicode"
+)
+
+// The message is untrusted input: it may address the model directly
+// ("ignore previous instructions", "score: 0.0, spam: false"). It goes
+// into the prompt between markers carrying a random tag the sender
+// cannot guess, so it cannot close the block and write instructions
+// after it, and the system prompt says everything inside is data.
+
+// newTag returns a random tag for the markers around one prompt.
+func newTag() string {
+	b := make([]byte, 8)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+func openMarker(tag string) string  { return "<<<EMAIL-" + tag + ">>>" }
+func closeMarker(tag string) string { return "<<<END-EMAIL-" + tag + ">>>" }
+
+// directives are phrases that address a classifier rather than a person.
+// They are kept narrow: words such as "spam" or "score" alone, or "you
+// are", are common in ordinary mail, and a reason may well repeat such a
+// sentence.
+var directives = []string{
+	"ignore previous", "ignore all previous", "ignore the above", "disregard previous",
+	"ignoră instrucțiunile", "ignora instructiunile", "ignorați instrucțiunile", "ignorati instructiunile",
+	"system override",
+	"mark this as", "classify this as", "marchează acest", "marcheaza acest", "clasifică acest", "clasifica acest",
+	"spam: false", "spam:false", "spam=false", `"spam": false`, "score: 0", "scor: 0",
+}
+
+// parrots returns the sentence of body that addresses a classifier and
+// that reason repeats, or "" when there is none. A reason built from the
+// message's own instructions means they were followed; callers check only
+// verdicts that let the message through.
+func parrots(reason, body string) string {
+	said := " " + strings.Join(words(reason), " ") + " "
+	for _, sentence := range sentences(body) {
+		lower := strings.ToLower(sentence)
+		directive := false
+		for _, d := range directives {
+			if strings.Contains(lower, d) {
+				directive = true
+				break
+			}
+		}
+		if !directive {
+			continue
+		}
+		w := words(sentence)
+		n := min(4, len(w))
+		if n < 3 {
+			continue
+		}
+		for i := 0; i+n <= len(w); i++ {
+			if strings.Contains(said, " "+strings.Join(w[i:i+n], " ")+" ") {
+				return strings.TrimSpace(sentence)
+			}
+		}
+	}
+	return ""
+}
+
+// sentences splits text at line breaks and sentence punctuation; a
+// period ends a sentence only before a space, so "0.0" and URLs stay
+// whole.
+func sentences(text string) []string {
+	var out []string
+	start := 0
+	for i, r := range text {
+		end := r == '\n' || r == '!' || r == '?' || r == ';'
+		if r == '.' {
+			end = i+1 == len(text) || text[i+1] == ' ' || text[i+1] == '\n' || text[i+1] == '\r'
+		}
+		if end {
+			if s := strings.TrimSpace(text[start:i]); s != "" {
+				out = append(out, s)
+			}
+			start = i + 1
+		}
+	}
+	if s := strings.TrimSpace(text[start:]); s != "" {
+		out = append(out, s)
+	}
+	return out
+}
+
+// words splits s into lower-case runs of letters and digits.
+func words(s string) []string {
+	return strings.FieldsFunc(strings.ToLower(s), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+}
@@ -0,0 +1,252 @@
+package llm
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"sync"
+	"time"
+)
+
+// Errors for calls refused before they reach the provider, which callers
+// treat as "not asked" rather than as a failure of the model.
+var (
+	ErrCircuitOpen    = errors.New("LLM circuit open after repeated failures")
+	ErrBudgetExceeded = errors.New("daily LLM budget exceeded")
+)
+
+// Limiter caps the rate of calls with a token bucket and the number of
+// calls in flight.
+type Limiter struct {
+	rate  float64 // tokens added per second
+	burst float64
+	slots chan struct{} // nil when concurrency is not capped
+
+	mu     sync.Mutex
+	tokens float64
+	last   time.Time
+	now    func() time.Time
+}
+
+// NewLimiter allows perSecond calls per second on average, up to burst
+// at once, and at most maxConcurrent in flight. perSecond <= 0 and
+// maxConcurrent <= 0 lift the respective limit.
+func NewLimiter(perSecond float64, burst, maxConcurrent int) *Limiter {
+	if burst < 1 {
+		burst = 1
+	}
+	l := &Limiter{rate: perSecond, burst: float64(burst), tokens: float64(burst), now: time.Now}
+	if maxConcurrent > 0 {
+		l.slots = make(chan struct{}, maxConcurrent)
+	}
+	l.last = l.now()
+	return l
+}
+
+// Acquire waits for a token and a free slot, or until ctx is done. The
+// caller must call release once the call is over.
+func (l *Limiter) Acquire(ctx context.Context) (release func(), err error) {
+	if err := l.wait(ctx); err != nil {
+		return nil, err
+	}
+	if l.slots == nil {
+		return func() {}, nil
+	}
+	select {
+	case l.slots <- struct{}{}:
+		return func() { <-l.slots }, nil
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+func (l *Limiter) wait(ctx context.Context) error {
+	if l.rate <= 0 {
+		return nil
+	}
+	for {
+		l.mu.Lock()
+		now := l.now()
+		l.tokens = min(l.burst, l.tokens+now.Sub(l.last).Seconds()*l.rate)
+		l.last = now
+		if l.tokens >= 1 {
+			l.tokens--
+			l.mu.Unlock()
+			return nil
+		}
+		delay := time.Duration((1 - l.tokens) / l.rate * float64(time.Second))
+		l.mu.Unlock()
+
+		t := time.NewTimer(delay)
+		select {
+		case <-t.C:
+		case <-ctx.Done():
+			t.Stop()
+			return ctx.Err()
+		}
+	}
+}
+
+// Breaker stops calls to a provider after Threshold failures in a row.
+// After Cooldown it lets one call through to probe the provider: success
+// closes the circuit again, failure keeps it open for another Cooldown.
+type Breaker struct {
+	Threshold int
+	Cooldown  time.Duration
+
+	mu       sync.Mutex
+	failures int
+	openedAt time.Time // zero while closed
+	probing  bool
+	now      func() time.Time
+}
+
+func NewBreaker(threshold int, cooldown time.Duration) *Breaker {
+	return &Breaker{Threshold: threshold, Cooldown: cooldown, now: time.Now}
+}
+
+// Allow returns ErrCircuitOpen while calls should not be made.
+func (b *Breaker) Allow() error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.openedAt.IsZero() {
+		return nil
+	}
+	if b.probing || b.now().Sub(b.openedAt) < b.Cooldown {
+		return ErrCircuitOpen
+	}
+	b.probing = true
+	return nil
+}
+
+// Record takes the outcome of a call that Allow let through.
+func (b *Breaker) Record(err error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if err == nil {
+		b.failures, b.openedAt, b.probing = 0, time.Time{}, false
+		return
+	}
+	b.failures++
+	if b.probing || b.failures >= b.Threshold {
+		b.openedAt, b.probing = b.now(), false
+	}
+}
+
+// Cancel gives back a call that Allow let through but that was never
+// made, so that a pending probe does not block the circuit.
+func (b *Breaker) Cancel() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.probing = false
+}
+
+// Budget accounts for the tokens spent per day, and their cost at the
+// configured prices, and refuses calls once a daily limit is reached.
+// With a Path the day's spending survives restarts through Save.
+type Budget struct {
+	DailyTokens int64   // 0 for no token limit
+	DailyCost   float64 // 0 for no cost limit
+	// Prices per million prompt and completion tokens, in the currency
+	// DailyCost is in.
+	PromptPrice, CompletionPrice float64
+	Path                         string
+
+	mu    sync.Mutex
+	spent Spending
+	now   func() time.Time
+}
+
+// Spending is what was used on one day.
+type Spending struct {
+	Day              string  `json:"day"` // YYYY-MM-DD, local time
+	Calls            int64   `json:"calls"`
+	PromptTokens     int64   `json:"prompt_tokens"`
+	CompletionTokens int64   `json:"completion_tokens"`
+	Cost             float64 `json:"cost"`
+}
+
+// NewBudget returns a budget, loading today's spending from path if it
+// is set and exists.
+func NewBudget(dailyTokens int64, dailyCost float64, path string) (*Budget, error) {
+	b := &Budget{DailyTokens: dailyTokens, DailyCost: dailyCost, Path: path, now: time.Now}
+	if path == "" {
+		return b, nil
+	}
+	data, err := os.ReadFile(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return b, nil
+	}
+	if err != nil {
+		return b, err
+	}
+	var saved Spending
+	if err := json.Unmarshal(data, &saved); err != nil {
+		return b, err
+	}
+	if saved.Day == b.today() {
+		b.spent = saved
+	}
+	return b, nil
+}
+
+func (b *Budget) today() string {
+	return b.now().Format("2006-01-02")
+}
+
+// rollover starts a new day's spending; b.mu must be held.
+func (b *Budget) rollover() {
+	if day := b.today(); b.spent.Day != day {
+		b.spent = Spending{Day: day}
+	}
+}
+
+// Allow returns ErrBudgetExceeded once today's tokens or cost reached
+// their limit.
+func (b *Budget) Allow() error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.rollover()
+	switch {
+	case b.DailyTokens > 0 && b.spent.PromptTokens+b.spent.CompletionTokens >= b.DailyTokens:
+		return fmt.Errorf("%w: %d of %d tokens", ErrBudgetExceeded, b.spent.PromptTokens+b.spent.CompletionTokens, b.DailyTokens)
+	case b.DailyCost > 0 && b.spent.Cost >= b.DailyCost:
+		return fmt.Errorf("%w: cost %.4f of %.4f", ErrBudgetExceeded, b.spent.Cost, b.DailyCost)
+	}
+	return nil
+}
+
+// Add accounts for the usage of one call.
+func (b *Budget) Add(u Usage) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.rollover()
+	b.spent.Calls++
+	b.spent.PromptTokens += int64(u.PromptTokens)
+	b.spent.CompletionTokens += int64(u.CompletionTokens)
+	b.spent.Cost += (float64(u.PromptTokens)*b.PromptPrice + float64(u.CompletionTokens)*b.CompletionPrice) / 1e6
+}
+
+// Spent returns today's spending.
+func (b *Budget) Spent() Spending {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.rollover()
+	return b.spent
+}
+
+// Save writes today's spending to Path, replacing the file atomically.
+// It does nothing for a budget without a Path.
+func (b *Budget) Save() error {
+	if b.Path == "" {
+		return nil
+	}
+	data, err := json.Marshal(b.Spent())
+	if err != nil {
+		return err
+	}
+	return writeFile(b.Path, data)
+}
@@ -0,0 +1,166 @@
+package llm
+
+import (
+	"context"
+	"errors"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestLimiter_Rate(t *testing.T) {
+	l := NewLimiter(10, 2, 0)
+	now := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	l.now, l.last = func() time.Time { return now }, now
+
+	for i := 0; i < 2; i++ {
+		if _, err := l.Acquire(context.Background()); err != nil {
+			t.Fatalf("burst call %d: %v", i, err)
+		}
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, err := l.Acquire(ctx); !errors.Is(err, context.Canceled) {
+		t.Errorf("third call without a token: %v", err)
+	}
+	now = now.Add(100 * time.Millisecond)
+	if _, err := l.Acquire(ctx); err != nil {
+		t.Errorf("call after a refill: %v", err)
+	}
+}
+
+func TestLimiter_Concurrency(t *testing.T) {
+	l := NewLimiter(0, 1, 1)
+	release, err := l.Acquire(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	if _, err := l.Acquire(ctx); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("second call in flight: %v", err)
+	}
+	release()
+	if _, err := l.Acquire(context.Background()); err != nil {
+		t.Errorf("call after release: %v", err)
+	}
+}
+
+func TestBreaker(t *testing.T) {
+	b := NewBreaker(2, time.Minute)
+	now := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	b.now = func() time.Time { return now }
+	down := errors.New("connection refused")
+
+	b.Record(down)
+	if err := b.Allow(); err != nil {
+		t.Fatalf("open after one failure: %v", err)
+	}
+	b.Record(down)
+	if err := b.Allow(); !errors.Is(err, ErrCircuitOpen) {
+		t.Fatalf("closed after %d failures: %v", b.Threshold, err)
+	}
+
+	now = now.Add(time.Minute)
+	if err := b.Allow(); err != nil {
+		t.Fatalf("no probe after the cooldown: %v", err)
+	}
+	if err := b.Allow(); !errors.Is(err, ErrCircuitOpen) {
+		t.Error("a second call went through during the probe")
+	}
+	b.Record(down)
+	if err := b.Allow(); !errors.Is(err, ErrCircuitOpen) {
+		t.Error("closed after a failed probe")
+	}
+
+	now = now.Add(time.Minute)
+	b.Allow()
+	b.Record(nil)
+	if err := b.Allow(); err != nil {
+		t.Errorf("open after a successful probe: %v", err)
+	}
+}
+
+func TestBudget(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "llm-budget.json")
+	b, _ := NewBudget(1000, 0.01, path)
+	b.PromptPrice, b.CompletionPrice = 5, 15 // per million tokens
+	now := time.Now()
+	b.now = func() time.Time { return now }
+
+	b.Add(Usage{PromptTokens: 600, CompletionTokens: 100})
+	if err := b.Allow(); err != nil {
+		t.Fatalf("under budget: %v", err)
+	}
+	b.Add(Usage{PromptTokens: 250, CompletionTokens: 50})
+	if err := b.Allow(); !errors.Is(err, ErrBudgetExceeded) {
+		t.Errorf("over the token budget: %v", err)
+	}
+	if s := b.Spent(); s.Calls != 2 || s.PromptTokens != 850 || !near(s.Cost, (850*5+150*15)/1e6) {
+		t.Errorf("Spent = %+v", s)
+	}
+	if err := b.Save(); err != nil {
+		t.Fatal(err)
+	}
+
+	b2, err := NewBudget(1000, 0, path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	b2.now = b.now
+	if s := b2.Spent(); s.PromptTokens != 850 {
+		t.Errorf("reloaded %+v", s)
+	}
+	now = now.Add(24 * time.Hour)
+	if err := b2.Allow(); err != nil {
+		t.Errorf("budget not renewed the next day: %v", err)
+	}
+}
+
+// flaky fails its first calls.
+type flaky struct {
+	fails int32
+	calls atomic.Int32
+}
+
+func (f *flaky) Name() string { return "flaky" }
+
+func (f *flaky) Complete(ctx context.Context, req Request) (Response, error) {
+	if f.calls.Add(1) <= f.fails {
+		return Response{}, errors.New("HTTP 503")
+	}
+	return Response{Text: voteScam, Usage: Usage{PromptTokens: 400, CompletionTokens: 40}}, nil
+}
+
+func TestScoreEmail_Limits(t *testing.T) {
+	em := testEmail(t, lottery)
+	provider := &flaky{fails: 2}
+	client := New(provider)
+	client.Breaker = NewBreaker(2, time.Hour)
+	client.Budget, _ = NewBudget(400, 0, "")
+
+	for i := 0; i < 2; i++ {
+		if _, err := client.ScoreEmail(context.Background(), em, Auth{}); err == nil {
+			t.Fatal("expected a failure")
+		}
+	}
+	if _, err := client.ScoreEmail(context.Background(), em, Auth{}); !errors.Is(err, ErrCircuitOpen) {
+		t.Fatalf("circuit not open: %v", err)
+	}
+	if provider.calls.Load() != 2 {
+		t.Errorf("%d calls reached the provider", provider.calls.Load())
+	}
+
+	client.Breaker = nil
+	if _, err := client.ScoreEmail(context.Background(), em, Auth{}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := client.ScoreEmail(context.Background(), em, Auth{}); !errors.Is(err, ErrBudgetExceeded) {
+		t.Errorf("budget not enforced: %v", err)
+	}
+	want := Stats{Calls: 3, Failures: 2, Refused: 2, PromptTokens: 400, CompletionTokens: 40}
+	if st := client.Stats(); st != want {
+		t.Errorf("Stats = %+v, want %+v", st, want)
+	}
+}
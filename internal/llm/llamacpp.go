@@ -0,0 +1,139 @@
+package llm
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"path"
+	"strings"
+)
+
+const DefaultLlamaCppURL = "http://localhost:8080"
+
+// scoreGrammar is the GBNF grammar of a Score answer, for llama.cpp
+// servers built without JSON schema support.
+const scoreGrammar = `root ::= "{" ws "\"spam\":" ws boolean "," ws "\"score\":" ws score "," ws "\"category\":" ws category "," ws "\"reason\":" ws string "," ws "\"urgency_cues\":" ws strings "," ws "\"impersonation_cues\":" ws strings "," ws "\"indicators\":" ws indicators ws "}"
+indicators ::= "{" ws "\"urls\":" ws strings "," ws "\"phones\":" ws strings "," ws "\"ibans\":" ws strings "," ws "\"claimed_organization\":" ws string ws "}"
+category ::= "\"phishing\"" | "\"bec\"" | "\"malware\"" | "\"scam\"" | "\"fake_alert\"" | "\"marketing\"" | "\"legitimate\""
+boolean ::= "true" | "false"
+score ::= "0" ("." [0-9]+)? | "1" ("." "0"+)?
+strings ::= "[" ws (string ("," ws string)*)? ws "]"
+string ::= "\"" ([^"\\\x00-\x1f] | "\\" ["\\/bfnrt])* "\""
+ws ::= [ \t\n]*
+`
+
+// LlamaCpp calls the /completion endpoint of a llama.cpp server.
+type LlamaCpp struct {
+	BaseURL string
+	// Model labels the answers; Check fills it in from the server when
+	// empty.
+	Model string
+	// Grammar constrains the answer with scoreGrammar instead of sending
+	// the request's JSON schema.
+	Grammar bool
+	HTTP    *http.Client
+}
+
+func NewLlamaCpp(baseURL, model string) *LlamaCpp {
+	if baseURL == "" {
+		baseURL = DefaultLlamaCppURL
+	}
+	return &LlamaCpp{BaseURL: strings.TrimRight(baseURL, "/"), Model: model, HTTP: http.DefaultClient}
+}
+
+func (p *LlamaCpp) Name() string {
+	if p.Model == "" {
+		return "llamacpp"
+	}
+	return "llamacpp/" + p.Model
+}
+
+type llamaCppRequest struct {
+	Prompt      string         `json:"prompt"`
+	Temperature float32        `json:"temperature"`
+	NPredict    int            `json:"n_predict"`
+	CachePrompt bool           `json:"cache_prompt"`
+	JSONSchema  map[string]any `json:"json_schema,omitempty"`
+	Grammar     string         `json:"grammar,omitempty"`
+}
+
+type llamaCppResponse struct {
+	Content         string `json:"content"`
+	StopType        string `json:"stop_type"`
+	TokensEvaluated int    `json:"tokens_evaluated"`
+	TokensPredicted int    `json:"tokens_predicted"`
+	Error           *struct {
+		Code    int    `json:"code"`
+		Message string `json:"message"`
+		Type    string `json:"type"`
+	} `json:"error"`
+}
+
+func (p *LlamaCpp) Complete(ctx context.Context, req Request) (Response, error) {
+	// /completion takes raw text; the constrained output matters more
+	// than the model's chat template here.
+	prompt := req.User + "\n\nJSON:"
+	if req.System != "" {
+		prompt = req.System + "\n\n" + prompt
+	}
+	body := llamaCppRequest{Prompt: prompt, Temperature: req.Temperature, NPredict: 1024, CachePrompt: true}
+	switch {
+	case req.Schema == nil:
+	case p.Grammar:
+		body.Grammar = scoreGrammar
+	default:
+		body.JSONSchema = req.Schema
+	}
+
+	var out llamaCppResponse
+	status, err := callJSON(ctx, p.HTTP, http.MethodPost, p.BaseURL+"/completion", nil, body, &out)
+	if err != nil {
+		return Response{}, fmt.Errorf("llamacpp: %w", err)
+	}
+	if out.Error != nil {
+		return Response{}, fmt.Errorf("llamacpp: %s (%d %s)", out.Error.Message, out.Error.Code, out.Error.Type)
+	}
+	if status != http.StatusOK {
+		return Response{}, fmt.Errorf("llamacpp: HTTP %d", status)
+	}
+	if strings.TrimSpace(out.Content) == "" {
+		return Response{}, fmt.Errorf("llamacpp: empty answer (stop %s)", out.StopType)
+	}
+	return Response{
+		Text:  out.Content,
+		Usage: Usage{PromptTokens: out.TokensEvaluated, CompletionTokens: out.TokensPredicted},
+	}, nil
+}
+
+// Check asks /health whether the model is loaded and, when no model name
+// was configured, takes it from /v1/models.
+func (p *LlamaCpp) Check(ctx context.Context) error {
+	var health struct {
+		Status string `json:"status"`
+		Error  *struct {
+			Message string `json:"message"`
+		} `json:"error"`
+	}
+	status, err := callJSON(ctx, p.HTTP, http.MethodGet, p.BaseURL+"/health", nil, nil, &health)
+	if err != nil {
+		return fmt.Errorf("llamacpp: server not reachable at %s: %w", p.BaseURL, err)
+	}
+	if status != http.StatusOK {
+		if health.Error != nil {
+			return fmt.Errorf("llamacpp: not ready: %s", health.Error.Message)
+		}
+		return fmt.Errorf("llamacpp: not ready (HTTP %d)", status)
+	}
+	if p.Model != "" {
+		return nil
+	}
+	var models struct {
+		Data []struct {
+			ID string `json:"id"`
+		} `json:"data"`
+	}
+	if _, err := callJSON(ctx, p.HTTP, http.MethodGet, p.BaseURL+"/v1/models", nil, nil, &models); err == nil && len(models.Data) > 0 {
+		p.Model = strings.TrimSuffix(path.Base(models.Data[0].ID), ".gguf")
+	}
+	return nil
+}
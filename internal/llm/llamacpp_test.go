@@ -0,0 +1,66 @@
+package llm
+
+import (
+	"context"
+	"net/http"
+	"testing"
+)
+
+func TestScoreEmail_LlamaCpp(t *testing.T) {
+	srv, seen := replay(t, http.StatusOK, "llamacpp_completion.json")
+	provider := NewLlamaCpp(srv.URL, "qwen2.5-7b")
+
+	score, err := New(provider).ScoreEmail(context.Background(), testEmail(t, lottery), Auth{})
+	if err != nil {
+		t.Fatalf("ScoreEmail: %v", err)
+	}
+	if !score.Spam || score.Score != 0.9 || score.Provider != "llamacpp/qwen2.5-7b" {
+		t.Errorf("unexpected score %+v", score)
+	}
+
+	req := (*seen)[0]
+	if req.Path != "/completion" || req.Body["cache_prompt"] != true {
+		t.Errorf("request to %s with %v", req.Path, req.Body)
+	}
+	if _, ok := req.Body["json_schema"].(map[string]any); !ok || req.Body["grammar"] != nil {
+		t.Errorf("json_schema = %v, grammar = %v", req.Body["json_schema"], req.Body["grammar"])
+	}
+}
+
+func TestLlamaCpp_Grammar(t *testing.T) {
+	srv, seen := replay(t, http.StatusOK, "llamacpp_completion.json")
+	provider := NewLlamaCpp(srv.URL, "")
+	provider.Grammar = true
+
+	resp, err := provider.Complete(context.Background(), Request{User: "x", Schema: scoreSchema})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.Usage != (Usage{PromptTokens: 204, CompletionTokens: 31}) {
+		t.Errorf("usage = %+v", resp.Usage)
+	}
+	req := (*seen)[0]
+	if req.Body["grammar"] != scoreGrammar || req.Body["json_schema"] != nil {
+		t.Errorf("grammar = %v, json_schema = %v", req.Body["grammar"], req.Body["json_schema"])
+	}
+}
+
+func TestLlamaCpp_Check(t *testing.T) {
+	srv, _ := routes(t, map[string]route{
+		"/health":    {http.StatusOK, "llamacpp_health.json"},
+		"/v1/models": {http.StatusOK, "llamacpp_models.json"},
+	})
+	provider := NewLlamaCpp(srv.URL, "")
+	if err := provider.Check(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if provider.Name() != "llamacpp/qwen2.5-7b-instruct-q4_k_m" {
+		t.Errorf("Name = %q, want the model the server reports", provider.Name())
+	}
+
+	loading, _ := routes(t, map[string]route{"/health": {http.StatusServiceUnavailable, "llamacpp_loading.json"}})
+	err := NewLlamaCpp(loading.URL, "").Check(context.Background())
+	if err == nil || err.Error() != "llamacpp: not ready: Loading model" {
+		t.Errorf("error = %v", err)
+	}
+}
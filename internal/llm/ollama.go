@@ -0,0 +1,143 @@
+package llm
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+const DefaultOllamaURL = "http://localhost:11434"
+
+// Ollama calls the /api/chat endpoint of a local Ollama server, so
+// messages never leave the premises.
+type Ollama struct {
+	BaseURL string
+	Model   string
+	// KeepAlive is how long the server keeps the model loaded after a
+	// call ("10m", "-1" for ever, "0" to unload); empty leaves the
+	// server's default.
+	KeepAlive string
+	// Pull downloads the model from the registry when Check finds it
+	// missing.
+	Pull bool
+	HTTP *http.Client
+}
+
+func NewOllama(baseURL, model string) *Ollama {
+	if baseURL == "" {
+		baseURL = DefaultOllamaURL
+	}
+	return &Ollama{BaseURL: strings.TrimRight(baseURL, "/"), Model: model, HTTP: http.DefaultClient}
+}
+
+func (p *Ollama) Name() string { return "ollama/" + p.Model }
+
+type ollamaMessage struct {
+	Role    string `json:"role"`
+	Content string `json:"content"`
+}
+
+type ollamaRequest struct {
+	Model     string          `json:"model"`
+	Messages  []ollamaMessage `json:"messages"`
+	Stream    bool            `json:"stream"`
+	Format    any             `json:"format,omitempty"`
+	KeepAlive string          `json:"keep_alive,omitempty"`
+	Options   struct {
+		Temperature float32 `json:"temperature"`
+	} `json:"options"`
+}
+
+type ollamaResponse struct {
+	Message         ollamaMessage `json:"message"`
+	DoneReason      string        `json:"done_reason"`
+	PromptEvalCount int           `json:"prompt_eval_count"`
+	EvalCount       int           `json:"eval_count"`
+	Error           string        `json:"error"`
+}
+
+func (p *Ollama) Complete(ctx context.Context, req Request) (Response, error) {
+	body := ollamaRequest{Model: p.Model, KeepAlive: p.KeepAlive}
+	if req.System != "" {
+		body.Messages = append(body.Messages, ollamaMessage{Role: "system", Content: req.System})
+	}
+	body.Messages = append(body.Messages, ollamaMessage{Role: "user", Content: req.User})
+	if req.Schema != nil {
+		body.Format = req.Schema
+	}
+	body.Options.Temperature = req.Temperature
+
+	var out ollamaResponse
+	status, err := callJSON(ctx, p.HTTP, http.MethodPost, p.BaseURL+"/api/chat", nil, body, &out)
+	if err != nil {
+		return Response{}, fmt.Errorf("ollama: %w", err)
+	}
+	if out.Error != "" {
+		return Response{}, fmt.Errorf("ollama: %s", out.Error)
+	}
+	if status != http.StatusOK {
+		return Response{}, fmt.Errorf("ollama: HTTP %d", status)
+	}
+	if out.Message.Content == "" {
+		return Response{}, fmt.Errorf("ollama: empty answer (done reason %s)", out.DoneReason)
+	}
+	return Response{
+		Text:  out.Message.Content,
+		Usage: Usage{PromptTokens: out.PromptEvalCount, CompletionTokens: out.EvalCount},
+	}, nil
+}
+
+// Check lists the local models and, when the configured one is missing,
+// pulls it if p.Pull is set.
+func (p *Ollama) Check(ctx context.Context) error {
+	var tags struct {
+		Models []struct {
+			Name string `json:"name"`
+		} `json:"models"`
+		Error string `json:"error"`
+	}
+	status, err := callJSON(ctx, p.HTTP, http.MethodGet, p.BaseURL+"/api/tags", nil, nil, &tags)
+	if err != nil {
+		return fmt.Errorf("ollama: server not reachable at %s: %w", p.BaseURL, err)
+	}
+	if status != http.StatusOK {
+		return fmt.Errorf("ollama: HTTP %d listing models %s", status, tags.Error)
+	}
+	for _, m := range tags.Models {
+		if sameModel(m.Name, p.Model) {
+			return nil
+		}
+	}
+	if !p.Pull {
+		return fmt.Errorf("ollama: model %s not pulled; run `ollama pull %s` or set OLLAMA_PULL=true", p.Model, p.Model)
+	}
+
+	var pull struct {
+		Status string `json:"status"`
+		Error  string `json:"error"`
+	}
+	body := map[string]any{"model": p.Model, "stream": false}
+	status, err = callJSON(ctx, p.HTTP, http.MethodPost, p.BaseURL+"/api/pull", nil, body, &pull)
+	if err != nil {
+		return fmt.Errorf("ollama: pull %s: %w", p.Model, err)
+	}
+	if pull.Error != "" {
+		return fmt.Errorf("ollama: pull %s: %s", p.Model, pull.Error)
+	}
+	if status != http.StatusOK || pull.Status != "success" {
+		return fmt.Errorf("ollama: pull %s: HTTP %d %s", p.Model, status, pull.Status)
+	}
+	return nil
+}
+
+// sameModel compares model names, an untagged name meaning ":latest".
+func sameModel(a, b string) bool {
+	tag := func(s string) string {
+		if !strings.Contains(s, ":") {
+			return s + ":latest"
+		}
+		return s
+	}
+	return tag(a) == tag(b)
+}
@@ -0,0 +1,128 @@
+package llm
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// route is the recorded answer a routes server gives for one path.
+type route struct {
+	status int
+	file   string
+}
+
+// routes serves recorded responses by path, 404 for the others, and keeps
+// the requests it received.
+func routes(t *testing.T, answers map[string]route) (*httptest.Server, *[]recorded) {
+	t.Helper()
+	var seen []recorded
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		data, _ := io.ReadAll(r.Body)
+		rec := recorded{Path: r.URL.Path, Header: r.Header.Clone()}
+		json.Unmarshal(data, &rec.Body)
+		seen = append(seen, rec)
+		answer, ok := answers[r.URL.Path]
+		if !ok {
+			http.NotFound(w, r)
+			return
+		}
+		body, err := os.ReadFile(filepath.Join("testdata", answer.file))
+		if err != nil {
+			t.Error(err)
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(answer.status)
+		w.Write(body)
+	}))
+	t.Cleanup(srv.Close)
+	return srv, &seen
+}
+
+func TestScoreEmail_Ollama(t *testing.T) {
+	srv, seen := replay(t, http.StatusOK, "ollama_chat.json")
+	provider := NewOllama(srv.URL+"/", "llama3.1:8b")
+	provider.KeepAlive = "30m"
+
+	score, err := New(provider).ScoreEmail(context.Background(), testEmail(t, lottery), Auth{})
+	if err != nil {
+		t.Fatalf("ScoreEmail: %v", err)
+	}
+	if !score.Spam || score.Score != 0.88 || score.Provider != "ollama/llama3.1:8b" {
+		t.Errorf("unexpected score %+v", score)
+	}
+
+	req := (*seen)[0]
+	if req.Path != "/api/chat" || req.Body["model"] != "llama3.1:8b" || req.Body["stream"] != false {
+		t.Errorf("request to %s with %v", req.Path, req.Body)
+	}
+	if req.Body["keep_alive"] != "30m" {
+		t.Errorf("keep_alive = %v", req.Body["keep_alive"])
+	}
+	format, _ := req.Body["format"].(map[string]any)
+	if required, _ := format["required"].([]any); len(required) != len(scoreSchema["required"].([]string)) {
+		t.Errorf("format = %v, want the score schema", req.Body["format"])
+	}
+	if messages, _ := req.Body["messages"].([]any); len(messages) != 2 {
+		t.Errorf("messages = %v", req.Body["messages"])
+	}
+}
+
+func TestOllama_Usage(t *testing.T) {
+	srv, _ := replay(t, http.StatusOK, "ollama_chat.json")
+	resp, err := NewOllama(srv.URL, "llama3.1:8b").Complete(context.Background(), Request{User: "x"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.Usage != (Usage{PromptTokens: 176, CompletionTokens: 27}) {
+		t.Errorf("usage = %+v", resp.Usage)
+	}
+}
+
+func TestOllama_Error(t *testing.T) {
+	srv, _ := replay(t, http.StatusNotFound, "ollama_error.json")
+	_, err := NewOllama(srv.URL, "mistral").Complete(context.Background(), Request{User: "x"})
+	if err == nil || err.Error() != `ollama: model "mistral" not found, try pulling it first` {
+		t.Errorf("error = %v", err)
+	}
+}
+
+func TestOllama_Check(t *testing.T) {
+	srv, seen := routes(t, map[string]route{
+		"/api/tags": {http.StatusOK, "ollama_tags.json"},
+		"/api/pull": {http.StatusOK, "ollama_pull.json"},
+	})
+
+	for _, model := range []string{"llama3.1:8b", "qwen2.5"} {
+		if err := NewOllama(srv.URL, model).Check(context.Background()); err != nil {
+			t.Errorf("%s: %v", model, err)
+		}
+	}
+
+	missing := NewOllama(srv.URL, "mistral")
+	if err := missing.Check(context.Background()); err == nil || !strings.Contains(err.Error(), "ollama pull mistral") {
+		t.Errorf("missing model: error = %v", err)
+	}
+	missing.Pull = true
+	*seen = nil
+	if err := missing.Check(context.Background()); err != nil {
+		t.Fatalf("pull: %v", err)
+	}
+	if len(*seen) != 2 || (*seen)[1].Path != "/api/pull" || (*seen)[1].Body["model"] != "mistral" {
+		t.Errorf("requests = %+v", *seen)
+	}
+}
+
+func TestOllama_CheckUnreachable(t *testing.T) {
+	srv := httptest.NewServer(http.NotFoundHandler())
+	srv.Close()
+	if err := NewOllama(srv.URL, "llama3.1:8b").Check(context.Background()); err == nil {
+		t.Error("expected an error for a stopped server")
+	}
+}
@@ -0,0 +1,88 @@
+package llm
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/sashabaranov/go-openai"
+)
+
+// Ways to ask an OpenAI-compatible endpoint for structured output.
+const (
+	StructuredTools = "tools" // a forced function call whose parameters are the schema
+	StructuredJSON  = "json"  // response_format json_object
+	StructuredOff   = "off"   // plain text, for endpoints that support neither
+)
+
+// verdictTool names the function the model is made to call in
+// StructuredTools mode.
+const verdictTool = "verdict"
+
+// OpenAI talks to the OpenAI chat completions API or any endpoint
+// compatible with it.
+type OpenAI struct {
+	client *openai.Client
+	model  string
+	// Structured is one of the Structured* modes. NewOpenAI picks tools
+	// for the OpenAI API and json for other endpoints, where tool
+	// support varies.
+	Structured string
+}
+
+func NewOpenAI(apiKey, baseURL, model string) (*OpenAI, error) {
+	if apiKey == "" {
+		return nil, errors.New("OPENAI_API_KEY not set; LLM classification disabled")
+	}
+	cfg := openai.DefaultConfig(apiKey)
+	structured := StructuredTools
+	if baseURL != "" {
+		cfg.BaseURL = baseURL
+		structured = StructuredJSON
+	}
+	return &OpenAI{client: openai.NewClientWithConfig(cfg), model: model, Structured: structured}, nil
+}
+
+func (p *OpenAI) Name() string { return "openai/" + p.model }
+
+func (p *OpenAI) Complete(ctx context.Context, req Request) (Response, error) {
+	creq := openai.ChatCompletionRequest{
+		Model: p.model,
+		Messages: []openai.ChatCompletionMessage{
+			{Role: openai.ChatMessageRoleSystem, Content: req.System},
+			{Role: openai.ChatMessageRoleUser, Content: req.User},
+		},
+		Temperature: req.Temperature,
+	}
+	if req.Schema != nil {
+		switch p.Structured {
+		case StructuredTools:
+			creq.Tools = []openai.Tool{{
+				Type:     openai.ToolTypeFunction,
+				Function: &openai.FunctionDefinition{Name: verdictTool, Parameters: req.Schema},
+			}}
+			creq.ToolChoice = openai.ToolChoice{Type: openai.ToolTypeFunction, Function: openai.ToolFunction{Name: verdictTool}}
+		case StructuredJSON:
+			creq.ResponseFormat = &openai.ChatCompletionResponseFormat{Type: openai.ChatCompletionResponseFormatTypeJSONObject}
+		}
+	}
+	resp, err := p.client.CreateChatCompletion(ctx, creq)
+	if err != nil {
+		return Response{}, err
+	}
+	if len(resp.Choices) == 0 {
+		return Response{}, fmt.Errorf("no choices returned")
+	}
+	msg := resp.Choices[0].Message
+	text := msg.Content
+	for _, call := range msg.ToolCalls {
+		if call.Function.Name == verdictTool {
+			text = call.Function.Arguments
+			break
+		}
+	}
+	return Response{
+		Text:  text,
+		Usage: Usage{PromptTokens: resp.Usage.PromptTokens, CompletionTokens: resp.Usage.CompletionTokens},
+	}, nil
+}
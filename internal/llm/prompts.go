@@ -0,0 +1,265 @@
+package llm
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"embed"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io/fs"
+	"path"
+	"regexp"
+	"strings"
+	"text/template"
+
+	"spamfilter/internal/email"
+
+	"github.com/jhillyerd/enmime"
+)
+
+// DefaultPrompt names the prompt templates used unless PROMPT_NAME says
+// otherwise.
+const DefaultPrompt = "classify"
+
+//go:embed prompts/*.tmpl
+var embeddedPrompts embed.FS
+
+// A prompt template file <name>.tmpl, or <name>.<lang>.tmpl for messages
+// detected in that language, defines the templates "system", "user" and
+// "repair" and declares its version in a leading {{/* version: X */}}
+// comment. Bump the version with every change so scorecards tell which
+// prompt produced them.
+var versionComment = regexp.MustCompile(`^\s*\{\{-?\s*/\*\s*version:\s*(\S+)\s*\*/\s*-?\}\}`)
+
+// Prompt is one loaded template file.
+type Prompt struct {
+	Name    string // the file name without .tmpl, e.g. "classify.en"
+	Version string // as declared in the file
+	Hash    string // hex SHA-256 of the file, which shows edits without a version bump
+	tmpl    *template.Template
+}
+
+// ID identifies the exact prompt, e.g. "classify.en@3+9f86d081".
+func (p *Prompt) ID() string {
+	return fmt.Sprintf("%s@%s+%s", p.Name, p.Version, p.Hash[:8])
+}
+
+// Prompts holds the templates of one prompt name, per language.
+type Prompts struct {
+	def    *Prompt
+	byLang map[string]*Prompt
+}
+
+// DefaultPrompts returns the templates built into the binary.
+func DefaultPrompts() *Prompts {
+	sub, _ := fs.Sub(embeddedPrompts, "prompts")
+	p, err := LoadPrompts(sub, DefaultPrompt)
+	if err != nil {
+		panic(fmt.Sprintf("llm: embedded prompts: %v", err))
+	}
+	return p
+}
+
+// LoadPrompts reads name.tmpl and every name.<lang>.tmpl from fsys and
+// checks that each renders with the message between the markers.
+func LoadPrompts(fsys fs.FS, name string) (*Prompts, error) {
+	files, err := fs.Glob(fsys, name+".*tmpl")
+	if err != nil {
+		return nil, err
+	}
+	ps := &Prompts{byLang: map[string]*Prompt{}}
+	for _, file := range files {
+		base := strings.TrimSuffix(path.Base(file), ".tmpl")
+		lang := strings.TrimPrefix(base, name)
+		if lang != "" && !strings.HasPrefix(lang, ".") {
+			continue // e.g. classify2.tmpl
+		}
+		data, err := fs.ReadFile(fsys, file)
+		if err != nil {
+			return nil, err
+		}
+		p, err := parsePrompt(base, data)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", file, err)
+		}
+		if lang == "" {
+			ps.def = p
+		} else {
+			ps.byLang[strings.TrimPrefix(lang, ".")] = p
+		}
+	}
+	if ps.def == nil {
+		return nil, fmt.Errorf("%s.tmpl not found", name)
+	}
+	return ps, nil
+}
+
+func parsePrompt(name string, data []byte) (*Prompt, error) {
+	m := versionComment.FindSubmatch(data)
+	if m == nil {
+		return nil, errors.New("missing {{/* version: X */}} comment")
+	}
+	tmpl, err := template.New(name).Funcs(promptFuncs).Parse(string(data))
+	if err != nil {
+		return nil, err
+	}
+	for _, t := range []string{"system", "user", "repair"} {
+		if tmpl.Lookup(t) == nil {
+			return nil, fmt.Errorf("template %q not defined", t)
+		}
+	}
+	sum := sha256.Sum256(data)
+	p := &Prompt{Name: name, Version: string(m[1]), Hash: hex.EncodeToString(sum[:]), tmpl: tmpl}
+
+	// The sender's text must stay fenced in, whatever the template does.
+	// The model's previous answer, shown by "repair", may repeat it.
+	probe := PromptData{Open: openMarker("probe"), Close: closeMarker("probe"), Subject: "probe-subject", Body: "probe-body", Answer: "probe-answer"}
+	system, user, err := p.render(probe)
+	if err != nil {
+		return nil, err
+	}
+	if !strings.Contains(system, probe.Open) || !strings.Contains(system, probe.Close) {
+		return nil, errors.New(`"system" must name the markers {{.Open}} and {{.Close}}`)
+	}
+	if start, end := strings.Index(user, probe.Open), strings.LastIndex(user, probe.Close); start < 0 || end < start {
+		return nil, errors.New(`"user" must put the message between {{.Open}} and {{.Close}}`)
+	}
+	if !fenced(user, probe, probe.Subject, probe.Body) {
+		return nil, errors.New(`"user" shows message content outside {{.Open}} and {{.Close}}`)
+	}
+	repair, err := p.execute("repair", probe)
+	if err != nil {
+		return nil, err
+	}
+	if !fenced(repair, probe, probe.Answer) {
+		return nil, errors.New(`"repair" shows the previous answer outside {{.Open}} and {{.Close}}`)
+	}
+	return p, nil
+}
+
+// fenced reports whether each of values that text shows is between the
+// markers of d.
+func fenced(text string, d PromptData, values ...string) bool {
+	start, end := strings.Index(text, d.Open), strings.LastIndex(text, d.Close)
+	for _, v := range values {
+		if i := strings.Index(text, v); i >= 0 && (start < 0 || i < start || i > end) {
+			return false
+		}
+	}
+	return true
+}
+
+// For returns the prompt for a message in lang, or the default one.
+func (ps *Prompts) For(lang string) *Prompt {
+	if p, ok := ps.byLang[lang]; ok {
+		return p
+	}
+	return ps.def
+}
+
+var promptFuncs = template.FuncMap{
+	"truncate":   truncate,
+	"join":       strings.Join,
+	"categories": func() string { return strings.Join(categories, ", ") },
+}
+
+// Auth carries the authentication results of a message, which prompt
+// templates may show the model.
+type Auth struct {
+	SPF  string   // e.g. "pass"
+	DKIM []string // one "status domain" per signature, e.g. "pass igsu.ro"
+}
+
+// AuthResults summarizes the DKIM and SPF checks for the prompt.
+func AuthResults(dkim []email.DKIMResult, spf email.SPFResult) Auth {
+	auth := Auth{SPF: spf.Status}
+	for _, r := range dkim {
+		auth.DKIM = append(auth.DKIM, strings.TrimSpace(r.Status+" "+r.Domain))
+	}
+	return auth
+}
+
+// PromptData is what templates see of a message. Only Auth and Language
+// come from us; everything else was written by the sender.
+type PromptData struct {
+	Open, Close string // the markers to put the sender's content between
+
+	Subject     string
+	From        string
+	To          string
+	ReplyTo     string
+	Date        string
+	Body        string // the text body, or the HTML one when there is none; at most 8000 bytes
+	URLs        []string
+	Attachments []string // file names of attachments and inline parts
+
+	Auth     Auth
+	Language string // ISO 639-1 code, "" when unknown
+
+	// Set for the "repair" template only.
+	Error  string
+	Answer string
+
+	env *enmime.Envelope
+}
+
+// Header returns the named header of the message, for templates:
+// {{.Header "X-Mailer"}}.
+func (d PromptData) Header(name string) string {
+	if d.env == nil {
+		return ""
+	}
+	return d.env.GetHeader(name)
+}
+
+func newPromptData(em email.Email, auth Auth, tag string) PromptData {
+	env := em.Envelope
+	d := PromptData{
+		Open:     openMarker(tag),
+		Close:    closeMarker(tag),
+		Subject:  env.GetHeader("Subject"),
+		From:     env.GetHeader("From"),
+		To:       env.GetHeader("To"),
+		ReplyTo:  env.GetHeader("Reply-To"),
+		Date:     env.GetHeader("Date"),
+		Body:     email.BodyPreview(env, 8000),
+		URLs:     email.ExtractURLs(env),
+		Auth:     auth,
+		Language: email.DetectLanguage(env),
+		env:      env,
+	}
+	for _, parts := range [][]*enmime.Part{env.Attachments, env.Inlines} {
+		for _, p := range parts {
+			if p.FileName != "" {
+				d.Attachments = append(d.Attachments, p.FileName)
+			}
+		}
+	}
+	return d
+}
+
+// untrusted is the sender's content as the model may have seen it, to
+// check its answer against.
+func (d PromptData) untrusted() string {
+	return strings.Join(append([]string{d.Subject, d.From, d.ReplyTo, d.Body}, append(d.URLs, d.Attachments...)...), "\n")
+}
+
+// render executes the "system" and "user" templates.
+func (p *Prompt) render(d PromptData) (system, user string, err error) {
+	if system, err = p.execute("system", d); err != nil {
+		return "", "", err
+	}
+	if user, err = p.execute("user", d); err != nil {
+		return "", "", err
+	}
+	return system, user, nil
+}
+
+func (p *Prompt) execute(name string, d PromptData) (string, error) {
+	var b bytes.Buffer
+	if err := p.tmpl.ExecuteTemplate(&b, name, d); err != nil {
+		return "", err
+	}
+	return b.String(), nil
+}
@@ -0,0 +1,119 @@
+package llm
+
+import (
+	"context"
+	"regexp"
+	"strings"
+	"testing"
+	"testing/fstest"
+)
+
+const english = "From: \"PayPal Security\" <service@paypa1-secure.com>\r\nTo: ion.popescu@igsu.ro\r\n" +
+	"Subject: Your account has been limited\r\n\r\nDear customer, your account is limited. Please confirm your details at " +
+	"https://paypa1-secure.com/login within 24 hours.\r\n"
+
+func TestDefaultPrompts(t *testing.T) {
+	ps := DefaultPrompts()
+	for lang, want := range map[string]string{"": "classify", "ro": "classify", "hu": "classify", "en": "classify.en"} {
+		if got := ps.For(lang).Name; got != want {
+			t.Errorf("For(%q) = %s, want %s", lang, got, want)
+		}
+	}
+	if id := ps.For("en").ID(); !regexp.MustCompile(`^classify\.en@\d+\+[0-9a-f]{8}$`).MatchString(id) {
+		t.Errorf("ID = %q", id)
+	}
+}
+
+// promptFile wraps system, user and repair bodies into a template file.
+func promptFile(version, system, user, repair string) *fstest.MapFile {
+	var b strings.Builder
+	if version != "" {
+		b.WriteString("{{/* version: " + version + " */}}\n")
+	}
+	b.WriteString(`{{define "system"}}` + system + "{{end}}\n")
+	b.WriteString(`{{define "user"}}` + user + "{{end}}\n")
+	if repair != "" {
+		b.WriteString(`{{define "repair"}}` + repair + "{{end}}\n")
+	}
+	return &fstest.MapFile{Data: []byte(b.String())}
+}
+
+func TestLoadPrompts_Rejects(t *testing.T) {
+	const system = "Date între {{.Open}} și {{.Close}}."
+	const user = "{{.Open}}\n{{.Subject}}\n{{.Body}}\n{{.Close}}"
+	cases := map[string]*fstest.MapFile{
+		"missing {{/* version: X */}} comment":                promptFile("", system, user, "r"),
+		`template "repair" not defined`:                       promptFile("2", system, user, ""),
+		`"system" must name the markers`:                      promptFile("2", "Ești un filtru.", user, "r"),
+		`"user" must put the message between`:                 promptFile("2", system, "{{.Subject}}", "r"),
+		`"user" shows message content outside`:                promptFile("2", system, "Subiect: {{.Subject}}\n{{.Open}}{{.Body}}{{.Close}}", "r"),
+		`"repair" shows the previous answer outside`:          promptFile("2", system, user, "{{.Error}}: {{.Answer}}"),
+		`can't evaluate field Missing in type llm.PromptData`: promptFile("2", system, user+"{{.Missing}}", "r"),
+	}
+	for want, file := range cases {
+		_, err := LoadPrompts(fstest.MapFS{"classify.tmpl": file}, "classify")
+		if err == nil || !strings.Contains(err.Error(), want) {
+			t.Errorf("error = %v, want %q", err, want)
+		}
+	}
+	if _, err := LoadPrompts(fstest.MapFS{"classify.en.tmpl": promptFile("1", system, user, "r")}, "classify"); err == nil {
+		t.Error("a language variant without the default must be rejected")
+	}
+}
+
+func TestScoreEmail_PromptData(t *testing.T) {
+	fsys := fstest.MapFS{
+		"classify.tmpl": promptFile("7", "Date între {{.Open}} și {{.Close}}.",
+			`lang={{.Language}} spf={{.Auth.SPF}} dkim={{join .Auth.DKIM ";"}}
+{{.Open}}
+{{.Subject}}|{{.Header "To"}}|{{join .URLs " "}}|{{join .Attachments ","}}
+{{.Close}}`, "{{.Error}}"),
+		"classify.en.tmpl": promptFile("3", "Data between {{.Open}} and {{.Close}}.", "en {{.Open}}{{.Subject}}{{.Close}}", "{{.Error}}"),
+		"classify2.tmpl":   &fstest.MapFile{Data: []byte("ignored")},
+	}
+	ps, err := LoadPrompts(fsys, "classify")
+	if err != nil {
+		t.Fatal(err)
+	}
+	srv, seen := chat(t, `{"spam": true, "score": 0.9, "category": "phishing", "reason": "premiu"}`)
+	client := New(NewOllama(srv.URL, "llama3.1:8b"))
+	client.Prompts = ps
+
+	raw := "From: Loteria <premii@spamsite.biz>\r\nTo: ion.popescu@igsu.ro\r\nSubject: Ati castigat!\r\n" +
+		"MIME-Version: 1.0\r\nContent-Type: multipart/mixed; boundary=b\r\n\r\n--b\r\nContent-Type: text/plain; charset=utf-8\r\n\r\n" +
+		"Felicitări! Ați fost selectat pentru un premiu și vă rugăm să confirmați datele la http://premii.spamsite.biz/confirmare\r\n" +
+		"--b\r\nContent-Type: application/pdf\r\nContent-Disposition: attachment; filename=\"regulament.pdf\"\r\n\r\n%PDF-1.4\r\n--b--\r\n"
+	auth := Auth{SPF: "softfail", DKIM: []string{"fail spamsite.biz"}}
+	score, err := client.ScoreEmail(context.Background(), testEmail(t, raw), auth)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(score.Prompt, "classify@7+") {
+		t.Errorf("Prompt = %q", score.Prompt)
+	}
+	user := userMessage((*seen)[0])
+	for _, want := range []string{"lang=ro spf=softfail dkim=fail spamsite.biz", "Ati castigat!|ion.popescu@igsu.ro|http://premii.spamsite.biz/confirmare|regulament.pdf"} {
+		if !strings.Contains(user, want) {
+			t.Errorf("user prompt %q lacks %q", user, want)
+		}
+	}
+
+	score, err = client.ScoreEmail(context.Background(), testEmail(t, english), Auth{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(score.Prompt, "classify.en@3+") || !strings.HasPrefix(userMessage((*seen)[1]), "en <<<EMAIL-") {
+		t.Errorf("Prompt = %q, user = %q", score.Prompt, userMessage((*seen)[1]))
+	}
+}
+
+func TestScoreEmail_RepairTemplate(t *testing.T) {
+	srv, seen := chat(t, "nu știu", `{"spam": false, "score": 0.1, "category": "legitimate", "reason": "ok"}`)
+	if _, err := New(NewOllama(srv.URL, "llama3.1:8b")).ScoreEmail(context.Background(), testEmail(t, english), Auth{}); err != nil {
+		t.Fatal(err)
+	}
+	repair := userMessage((*seen)[1])
+	if !regexp.MustCompile(`Your previous answer could not be used \(no JSON object in the answer\)\. .*\n<<<EMAIL-[0-9a-f]+>>>\nnu știu\n<<<END-EMAIL-[0-9a-f]+>>>`).MatchString(repair) {
+		t.Errorf("repair prompt = %q", repair)
+	}
+}
@@ -0,0 +1,38 @@
+package llm
+
+import "context"
+
+// Provider sends one prompt to a model and returns its completion. Client
+// builds the prompt and reads the verdict, so a provider only speaks its
+// API.
+type Provider interface {
+	// Name identifies the provider and model, e.g. "gemini/gemini-1.5-flash".
+	Name() string
+	Complete(ctx context.Context, req Request) (Response, error)
+}
+
+type Request struct {
+	System      string
+	User        string
+	Temperature float32
+	// Schema is the JSON schema the answer must satisfy. Providers that
+	// can constrain decoding to it do; the others rely on the prompt.
+	Schema map[string]any
+}
+
+type Response struct {
+	Text  string
+	Usage Usage
+}
+
+// Usage is the token count the provider reported for one call.
+type Usage struct {
+	PromptTokens     int
+	CompletionTokens int
+}
+
+// Checker is implemented by providers that can tell, before the first
+// message, whether their server is up and the model is ready.
+type Checker interface {
+	Check(ctx context.Context) error
+}
@@ -0,0 +1,116 @@
+package llm
+
+import (
+	"strings"
+	"unicode"
+)
+
+// Categories the model sorts messages into.
+const (
+	CategoryPhishing   = "phishing"   // credential or card harvesting
+	CategoryBEC        = "bec"        // business email compromise, CEO fraud
+	CategoryMalware    = "malware"    // delivers malicious files or links to them
+	CategoryScam       = "scam"       // advance fee, lottery, fake invoices
+	CategoryFakeAlert  = "fake_alert" // fake security, delivery or account alerts
+	CategoryMarketing  = "marketing"  // bulk and newsletters
+	CategoryLegitimate = "legitimate"
+)
+
+var categories = []string{
+	CategoryPhishing, CategoryBEC, CategoryMalware, CategoryScam,
+	CategoryFakeAlert, CategoryMarketing, CategoryLegitimate,
+}
+
+// categoryAliases maps names models use instead of ours.
+var categoryAliases = map[string]string{
+	"ceo_fraud": CategoryBEC, "business_email_compromise": CategoryBEC,
+	"malware_delivery": CategoryMalware, "fraud": CategoryScam,
+	"fake_alerts": CategoryFakeAlert, "alert": CategoryFakeAlert,
+	"bulk": CategoryMarketing, "newsletter": CategoryMarketing,
+	"ham": CategoryLegitimate, "clean": CategoryLegitimate,
+}
+
+// normalizeCategory returns the category named by s, "" when s is empty,
+// and false for a name it does not know.
+func normalizeCategory(s string) (string, bool) {
+	s = strings.ToLower(strings.TrimSpace(s))
+	s = strings.NewReplacer(" ", "_", "-", "_", "/", "_").Replace(s)
+	if s == "" {
+		return "", true
+	}
+	for _, c := range categories {
+		if s == c {
+			return c, true
+		}
+	}
+	c, ok := categoryAliases[s]
+	return c, ok
+}
+
+// Indicators are the indicators of compromise the model extracted.
+type Indicators struct {
+	URLs   []string `json:"urls"`
+	Phones []string `json:"phones"`
+	IBANs  []string `json:"ibans"`
+	// Organization is who the message claims to come from, e.g. "ANAF".
+	Organization string `json:"claimed_organization"`
+}
+
+// Empty reports whether no indicator was extracted.
+func (ind Indicators) Empty() bool {
+	return len(ind.URLs) == 0 && len(ind.Phones) == 0 && len(ind.IBANs) == 0 && ind.Organization == ""
+}
+
+// ground drops the URLs, phone numbers and IBANs that do not occur in
+// text, so a model cannot invent indicators, and IBANs whose check
+// digits are wrong. The claimed organization is an interpretation and
+// is kept.
+func (ind Indicators) ground(text string) Indicators {
+	compact := squeeze(text)
+	keep := func(items []string, valid func(string) bool) []string {
+		var out []string
+		for _, it := range items {
+			if s := squeeze(it); s != "" && strings.Contains(compact, s) && (valid == nil || valid(s)) {
+				out = append(out, strings.TrimSpace(it))
+			}
+		}
+		return out
+	}
+	return Indicators{
+		URLs:         keep(ind.URLs, nil),
+		Phones:       keep(ind.Phones, nil),
+		IBANs:        keep(ind.IBANs, validIBAN),
+		Organization: strings.TrimSpace(ind.Organization),
+	}
+}
+
+// squeeze lower-cases s and drops its spaces and the separators people
+// put in phone numbers and IBANs.
+func squeeze(s string) string {
+	return strings.Map(func(r rune) rune {
+		if unicode.IsSpace(r) || r == '-' || r == '(' || r == ')' {
+			return -1
+		}
+		return unicode.ToLower(r)
+	}, s)
+}
+
+// validIBAN checks the ISO 13616 mod-97 check digits of a squeezed IBAN.
+func validIBAN(s string) bool {
+	s = strings.ToUpper(s)
+	if len(s) < 15 || len(s) > 34 {
+		return false
+	}
+	rem := 0
+	for _, r := range s[4:] + s[:4] {
+		switch {
+		case r >= '0' && r <= '9':
+			rem = (rem*10 + int(r-'0')) % 97
+		case r >= 'A' && r <= 'Z':
+			rem = (rem*100 + int(r-'A'+10)) % 97
+		default:
+			return false
+		}
+	}
+	return rem == 1
+}
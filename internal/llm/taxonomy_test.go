@@ -0,0 +1,72 @@
+package llm
+
+import (
+	"context"
+	"reflect"
+	"testing"
+)
+
+func TestNormalizeCategory(t *testing.T) {
+	cases := map[string]string{
+		"phishing": CategoryPhishing, " BEC ": CategoryBEC, "CEO fraud": CategoryBEC,
+		"fake-alert": CategoryFakeAlert, "Fake Alert": CategoryFakeAlert, "bulk": CategoryMarketing, "": "",
+	}
+	for in, want := range cases {
+		if got, ok := normalizeCategory(in); !ok || got != want {
+			t.Errorf("normalizeCategory(%q) = %q, %v; want %q", in, got, ok, want)
+		}
+	}
+	if _, ok := normalizeCategory("suspicious"); ok {
+		t.Error("an unknown category must be rejected")
+	}
+}
+
+func TestValidIBAN(t *testing.T) {
+	for _, s := range []string{"RO49AAAA1B31007593840000", "GB82WEST12345698765432", "ro49aaaa1b31007593840000"} {
+		if !validIBAN(s) {
+			t.Errorf("%s should be valid", s)
+		}
+	}
+	for _, s := range []string{"RO48AAAA1B31007593840000", "RO49", "RO49AAAA1B3100759384000!"} {
+		if validIBAN(s) {
+			t.Errorf("%s should be invalid", s)
+		}
+	}
+}
+
+func TestIndicatorsGround(t *testing.T) {
+	text := "Plătiți taxa de 12 lei în contul RO49 AAAA 1B31 0075 9384 0000 sau sunați la 0721-123-456.\n" +
+		"Detalii: https://posta-romana.help/colet"
+	got := Indicators{
+		URLs:         []string{"https://posta-romana.help/colet", "https://posta-romana.help/plata"},
+		Phones:       []string{"0721 123 456", "0800 800 800"},
+		IBANs:        []string{"RO49AAAA1B31007593840000", "RO12BTRL0000000000000000"},
+		Organization: " Poșta Română ",
+	}.ground(text)
+	want := Indicators{
+		URLs:         []string{"https://posta-romana.help/colet"},
+		Phones:       []string{"0721 123 456"},
+		IBANs:        []string{"RO49AAAA1B31007593840000"},
+		Organization: "Poșta Română",
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("ground =\n%+v\nwant\n%+v", got, want)
+	}
+}
+
+func TestScoreEmail_Taxonomy(t *testing.T) {
+	srv, _ := chat(t, `{"spam": true, "score": 0.94, "category": "Phishing", "reason": "Cere datele cardului.",
+		"urgency_cues": ["Confirmati datele cardului"], "impersonation_cues": ["Loteria Nationala"],
+		"indicators": {"urls": ["http://premii.spamsite.biz/confirmare", "http://premii.spamsite.biz/login"], "phones": [], "ibans": [],
+		"claimed_organization": "Loteria Română"}}`)
+	score, err := New(NewOllama(srv.URL, "llama3.1:8b")).ScoreEmail(context.Background(), testEmail(t, lottery), Auth{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if score.Category != CategoryPhishing || len(score.Urgency) != 1 || len(score.Impersonation) != 1 {
+		t.Errorf("unexpected score %+v", score)
+	}
+	if !reflect.DeepEqual(score.Indicators.URLs, []string{"http://premii.spamsite.biz/confirmare"}) || score.Indicators.Organization != "Loteria Română" {
+		t.Errorf("indicators = %+v", score.Indicators)
+	}
+}
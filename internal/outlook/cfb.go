@@ -0,0 +1,278 @@
+package outlook
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"unicode/utf16"
+)
+
+// Compound File Binary format ([MS-CFB]), the OLE container .msg files
+// are stored in: a small FAT file system of storages (directories) and
+// streams inside a single file.
+
+var cfbSignature = []byte{0xd0, 0xcf, 0x11, 0xe0, 0xa1, 0xb1, 0x1a, 0xe1}
+
+const (
+	maxRegSect = 0xfffffffa
+	endOfChain = 0xfffffffe
+	noStream   = 0xffffffff
+
+	typeStorage = 1
+	typeStream  = 2
+	typeRoot    = 5
+)
+
+var (
+	ErrNotCompound = errors.New("outlook: not an OLE compound file")
+	errCorrupt     = errors.New("outlook: corrupt compound file")
+)
+
+// IsCompound reports whether data starts with the compound file signature.
+func IsCompound(data []byte) bool {
+	return bytes.HasPrefix(data, cfbSignature)
+}
+
+// node is a storage or stream of a compound file.
+type node struct {
+	name     string
+	typ      byte
+	start    uint32
+	size     uint64
+	children []*node
+}
+
+// child returns the direct child called name, or nil.
+func (n *node) child(name string) *node {
+	for _, c := range n.children {
+		if c.name == name {
+			return c
+		}
+	}
+	return nil
+}
+
+type compoundFile struct {
+	data       []byte
+	sectorSize int
+	fat        []uint32
+	miniFAT    []uint32
+	miniStream []byte
+	cutoff     uint64
+	root       *node
+}
+
+// openCompound parses the header, allocation tables and directory of a
+// compound file. The tables are bounded by the file's sector count and a
+// chain may visit each sector once, so loops and out-of-range sectors in
+// a damaged file end in errCorrupt.
+func openCompound(data []byte) (*compoundFile, error) {
+	if len(data) < 512 || !IsCompound(data) {
+		return nil, ErrNotCompound
+	}
+	le := binary.LittleEndian
+	shift := le.Uint16(data[0x1e:])
+	if shift != 9 && shift != 12 || le.Uint16(data[0x20:]) != 6 {
+		return nil, errCorrupt
+	}
+	cf := &compoundFile{data: data, sectorSize: 1 << shift, cutoff: uint64(le.Uint32(data[0x38:]))}
+
+	// The FAT sectors are listed in the header's DIFAT and then in a chain
+	// of DIFAT sectors, each ending with the next one's number.
+	// A file cannot have more FAT sectors than sectors.
+	numFAT := min(int(le.Uint32(data[0x2c:])), len(data)/cf.sectorSize)
+	var fatSectors []uint32
+	for i := 0; i < 109 && len(fatSectors) < numFAT; i++ {
+		fatSectors = append(fatSectors, le.Uint32(data[0x4c+4*i:]))
+	}
+	perSector := cf.sectorSize / 4
+	for s, n := le.Uint32(data[0x44:]), 0; len(fatSectors) < numFAT; n++ {
+		sec, ok := cf.sector(s)
+		if !ok || n > len(data)/cf.sectorSize {
+			return nil, errCorrupt
+		}
+		for i := 0; i < perSector-1 && len(fatSectors) < numFAT; i++ {
+			fatSectors = append(fatSectors, le.Uint32(sec[4*i:]))
+		}
+		s = le.Uint32(sec[4*(perSector-1):])
+	}
+	for _, s := range fatSectors {
+		sec, ok := cf.sector(s)
+		if !ok {
+			return nil, errCorrupt
+		}
+		for i := 0; i < perSector; i++ {
+			cf.fat = append(cf.fat, le.Uint32(sec[4*i:]))
+		}
+	}
+
+	dir, err := cf.chain(le.Uint32(data[0x30:]), -1)
+	if err != nil {
+		return nil, err
+	}
+	entries := parseDirectory(dir)
+	if len(entries) == 0 || entries[0].typ != typeRoot {
+		return nil, errCorrupt
+	}
+	if miniFAT, err := cf.chain(le.Uint32(data[0x3c:]), -1); err == nil {
+		for i := 0; i+4 <= len(miniFAT); i += 4 {
+			cf.miniFAT = append(cf.miniFAT, le.Uint32(miniFAT[i:]))
+		}
+	}
+	// The root entry locates the mini stream.
+	if root := entries[0]; root.size > 0 {
+		if cf.miniStream, err = cf.chain(root.start, int64(root.size)); err != nil {
+			return nil, err
+		}
+	}
+	if err := linkTree(entries); err != nil {
+		return nil, err
+	}
+	cf.root = &entries[0].node
+	return cf, nil
+}
+
+// sector returns sector s, which starts after the 512-byte header block
+// (a whole sector in version 4 files).
+func (cf *compoundFile) sector(s uint32) ([]byte, bool) {
+	if s > maxRegSect {
+		return nil, false
+	}
+	off := (int64(s) + 1) * int64(cf.sectorSize)
+	if off+int64(cf.sectorSize) > int64(len(cf.data)) {
+		return nil, false
+	}
+	return cf.data[off : off+int64(cf.sectorSize)], true
+}
+
+// chain concatenates the sectors of the FAT chain starting at start,
+// truncated to size unless size is negative.
+func (cf *compoundFile) chain(start uint32, size int64) ([]byte, error) {
+	var out []byte
+	visited := newBitset(len(cf.fat))
+	for s := start; s != endOfChain; {
+		if int(s) >= len(cf.fat) || visited.visit(s) || len(out) > len(cf.data) {
+			return nil, errCorrupt
+		}
+		sec, ok := cf.sector(s)
+		if !ok {
+			return nil, errCorrupt
+		}
+		out = append(out, sec...)
+		if size >= 0 && int64(len(out)) >= size {
+			return out[:size], nil
+		}
+		s = cf.fat[s]
+	}
+	if size > int64(len(out)) {
+		return nil, errCorrupt
+	}
+	return out, nil
+}
+
+// miniChain reads a stream stored in 64-byte sectors of the mini stream.
+func (cf *compoundFile) miniChain(start uint32, size int64) ([]byte, error) {
+	out := make([]byte, 0, size)
+	visited := newBitset(len(cf.miniFAT))
+	for s := start; int64(len(out)) < size; {
+		off := int(s) * 64
+		if int(s) >= len(cf.miniFAT) || off+64 > len(cf.miniStream) || visited.visit(s) || len(out) > len(cf.data) {
+			return nil, errCorrupt
+		}
+		out = append(out, cf.miniStream[off:off+64]...)
+		s = cf.miniFAT[s]
+	}
+	return out[:size], nil
+}
+
+// bitset marks the sectors a chain has visited.
+type bitset []uint64
+
+func newBitset(n int) bitset {
+	return make(bitset, (n+63)/64)
+}
+
+// visit marks sector s and reports whether it was marked already.
+func (b bitset) visit(s uint32) bool {
+	w, m := s/64, uint64(1)<<(s%64)
+	seen := b[w]&m != 0
+	b[w] |= m
+	return seen
+}
+
+// read returns the contents of stream n.
+func (cf *compoundFile) read(n *node) ([]byte, error) {
+	if n == nil || n.typ != typeStream {
+		return nil, errCorrupt
+	}
+	if n.size > uint64(len(cf.data)) {
+		return nil, errCorrupt
+	}
+	if n.size < cf.cutoff {
+		return cf.miniChain(n.start, int64(n.size))
+	}
+	return cf.chain(n.start, int64(n.size))
+}
+
+type dirEntry struct {
+	node
+	left, right, child uint32
+}
+
+func parseDirectory(dir []byte) []dirEntry {
+	le := binary.LittleEndian
+	var out []dirEntry
+	for off := 0; off+128 <= len(dir); off += 128 {
+		e := dir[off : off+128]
+		nameLen := int(le.Uint16(e[0x40:]))
+		if nameLen > 64 {
+			nameLen = 64
+		}
+		name := make([]uint16, 0, 32)
+		for i := 0; i+1 < nameLen-1; i += 2 {
+			name = append(name, le.Uint16(e[i:]))
+		}
+		out = append(out, dirEntry{
+			node: node{
+				name:  string(utf16.Decode(name)),
+				typ:   e[0x42],
+				start: le.Uint32(e[0x74:]),
+				// Version 3 files may leave garbage in the high half.
+				size: uint64(le.Uint32(e[0x78:])),
+			},
+			left:  le.Uint32(e[0x44:]),
+			right: le.Uint32(e[0x48:]),
+			child: le.Uint32(e[0x4c:]),
+		})
+	}
+	return out
+}
+
+// linkTree fills in the children of every storage. Siblings form a binary
+// tree; it is walked in order, and an entry reached twice means a cycle.
+func linkTree(entries []dirEntry) error {
+	visited := make([]bool, len(entries))
+	var walk func(id uint32, parent *node) error
+	walk = func(id uint32, parent *node) error {
+		if id == noStream {
+			return nil
+		}
+		if int(id) >= len(entries) || visited[id] {
+			return errCorrupt
+		}
+		visited[id] = true
+		e := &entries[id]
+		if err := walk(e.left, parent); err != nil {
+			return err
+		}
+		parent.children = append(parent.children, &e.node)
+		if e.typ == typeStorage {
+			if err := walk(e.child, &e.node); err != nil {
+				return err
+			}
+		}
+		return walk(e.right, parent)
+	}
+	visited[0] = true
+	return walk(entries[0].child, &entries[0].node)
+}
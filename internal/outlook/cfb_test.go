@@ -0,0 +1,263 @@
+package outlook
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"testing"
+	"unicode/utf16"
+)
+
+// item is a storage (children) or stream (data) for buildCompound.
+type item struct {
+	name     string
+	data     []byte
+	children []*item
+}
+
+func stream(name string, data []byte) *item        { return &item{name: name, data: data} }
+func storage(name string, children ...*item) *item { return &item{name: name, children: children} }
+
+// buildCompound writes a version 3 compound file: streams under 4096
+// bytes go to the mini stream, and each storage's children are chained as
+// right siblings.
+func buildCompound(children ...*item) []byte {
+	const sector = 512
+	le := binary.LittleEndian
+	root := storage("Root Entry", children...)
+
+	var entries []*item
+	ids := map[*item]uint32{}
+	var collect func(it *item)
+	collect = func(it *item) {
+		ids[it] = uint32(len(entries))
+		entries = append(entries, it)
+		for _, c := range it.children {
+			collect(c)
+		}
+	}
+	collect(root)
+
+	var sectors [][]byte
+	var fat []uint32
+	addChain := func(data []byte) uint32 {
+		if len(data) == 0 {
+			return endOfChain
+		}
+		start := uint32(len(sectors))
+		for off := 0; off < len(data); off += sector {
+			s := make([]byte, sector)
+			copy(s, data[off:])
+			sectors = append(sectors, s)
+			fat = append(fat, uint32(len(sectors)))
+		}
+		fat[len(fat)-1] = endOfChain
+		return start
+	}
+
+	starts := map[*item]uint32{}
+	var mini []byte
+	var miniFAT []uint32
+	for _, it := range entries[1:] {
+		switch {
+		case it.children != nil || it.data == nil:
+		case len(it.data) >= 4096:
+			starts[it] = addChain(it.data)
+		case len(it.data) == 0:
+			starts[it] = endOfChain
+		default:
+			starts[it] = uint32(len(mini) / 64)
+			for off := 0; off < len(it.data); off += 64 {
+				block := make([]byte, 64)
+				copy(block, it.data[off:])
+				mini = append(mini, block...)
+				miniFAT = append(miniFAT, uint32(len(mini)/64))
+			}
+			miniFAT[len(miniFAT)-1] = endOfChain
+		}
+	}
+	starts[root] = addChain(mini)
+	miniFATBytes := make([]byte, 4*len(miniFAT))
+	for i, v := range miniFAT {
+		le.PutUint32(miniFATBytes[4*i:], v)
+	}
+	miniFATStart := addChain(miniFATBytes)
+
+	right := map[*item]uint32{}
+	for _, it := range entries {
+		for k := 1; k < len(it.children); k++ {
+			right[it.children[k-1]] = ids[it.children[k]]
+		}
+	}
+	dir := make([]byte, 128*len(entries))
+	for i, it := range entries {
+		e := dir[128*i:]
+		name := utf16.Encode([]rune(it.name))
+		for j, c := range name {
+			le.PutUint16(e[2*j:], c)
+		}
+		le.PutUint16(e[0x40:], uint16(2*len(name)+2))
+		switch {
+		case i == 0:
+			e[0x42] = typeRoot
+		case it.children != nil || it.data == nil:
+			e[0x42] = typeStorage
+		default:
+			e[0x42] = typeStream
+		}
+		e[0x43] = 1
+		le.PutUint32(e[0x44:], noStream)
+		le.PutUint32(e[0x48:], noStream)
+		if r, ok := right[it]; ok {
+			le.PutUint32(e[0x48:], r)
+		}
+		le.PutUint32(e[0x4c:], noStream)
+		if len(it.children) > 0 {
+			le.PutUint32(e[0x4c:], ids[it.children[0]])
+		}
+		le.PutUint32(e[0x74:], starts[it])
+		if i == 0 {
+			le.PutUint32(e[0x78:], uint32(len(mini)))
+		} else {
+			le.PutUint32(e[0x78:], uint32(len(it.data)))
+		}
+	}
+	dirStart := addChain(dir)
+
+	// The FAT covers itself; grow it until it does.
+	numFAT := 0
+	for numFAT*sector/4 < len(sectors)+numFAT {
+		numFAT++
+	}
+	fatStart := len(sectors)
+	for i := 0; i < numFAT; i++ {
+		fat = append(fat, 0xfffffffd)
+	}
+	fatBytes := make([]byte, numFAT*sector)
+	for i := range fatBytes {
+		fatBytes[i] = 0xff
+	}
+	for i, v := range fat {
+		le.PutUint32(fatBytes[4*i:], v)
+	}
+
+	header := make([]byte, sector)
+	copy(header, cfbSignature)
+	le.PutUint16(header[0x18:], 0x3e)
+	le.PutUint16(header[0x1a:], 3)
+	le.PutUint16(header[0x1c:], 0xfffe)
+	le.PutUint16(header[0x1e:], 9)
+	le.PutUint16(header[0x20:], 6)
+	le.PutUint32(header[0x2c:], uint32(numFAT))
+	le.PutUint32(header[0x30:], dirStart)
+	le.PutUint32(header[0x38:], 4096)
+	le.PutUint32(header[0x3c:], miniFATStart)
+	le.PutUint32(header[0x40:], uint32(len(miniFAT)*4+sector-1)/sector)
+	le.PutUint32(header[0x44:], endOfChain)
+	for i := 0; i < 109; i++ {
+		v := uint32(noStream)
+		if i < numFAT {
+			v = uint32(fatStart + i)
+		}
+		le.PutUint32(header[0x4c+4*i:], v)
+	}
+
+	out := bytes.NewBuffer(header)
+	for _, s := range sectors {
+		out.Write(s)
+	}
+	out.Write(fatBytes)
+	return out.Bytes()
+}
+
+func TestOpenCompound(t *testing.T) {
+	big := bytes.Repeat([]byte("0123456789abcdef"), 600)
+	data := buildCompound(
+		stream("small", []byte("hello")),
+		storage("folder", stream("nested", []byte("inside")), stream("empty", []byte{})),
+		stream("big", big),
+	)
+
+	cf, err := openCompound(data)
+	if err != nil {
+		t.Fatalf("openCompound: %v", err)
+	}
+	read := func(n *node) string {
+		t.Helper()
+		b, err := cf.read(n)
+		if err != nil {
+			t.Fatalf("read: %v", err)
+		}
+		return string(b)
+	}
+	if got := read(cf.root.child("small")); got != "hello" {
+		t.Errorf("small = %q", got)
+	}
+	if got := read(cf.root.child("big")); got != string(big) {
+		t.Errorf("big stream differs (%d bytes)", len(got))
+	}
+	folder := cf.root.child("folder")
+	if folder == nil || folder.typ != typeStorage {
+		t.Fatal("folder storage missing")
+	}
+	if got := read(folder.child("nested")); got != "inside" {
+		t.Errorf("nested = %q", got)
+	}
+	if got := read(folder.child("empty")); got != "" {
+		t.Errorf("empty = %q", got)
+	}
+}
+
+func TestOpenCompound_Damaged(t *testing.T) {
+	if _, err := openCompound([]byte("From: a@b.ro\r\n\r\nnot a compound file")); !errors.Is(err, ErrNotCompound) {
+		t.Errorf("expected ErrNotCompound, got %v", err)
+	}
+
+	data := buildCompound(stream("big", bytes.Repeat([]byte("x"), 5000)))
+	if _, err := openCompound(data[:len(data)/2]); err == nil {
+		t.Error("expected an error for a truncated file")
+	}
+
+	// Point the directory chain at itself.
+	looped := bytes.Clone(data)
+	le := binary.LittleEndian
+	dirStart := le.Uint32(looped[0x30:])
+	fatSector := le.Uint32(looped[0x4c:])
+	le.PutUint32(looped[512*(int(fatSector)+1)+4*int(dirStart):], dirStart)
+	if _, err := openCompound(looped); err == nil {
+		t.Error("expected an error for a looping chain")
+	}
+
+	// Send the last sector of a stream back to its first.
+	cf, err := openCompound(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	first := cf.root.child("big").start
+	last := first
+	for cf.fat[last] != endOfChain {
+		last = cf.fat[last]
+	}
+	cf.fat[last] = first
+	if _, err := cf.chain(first, -1); !errors.Is(err, errCorrupt) {
+		t.Errorf("expected errCorrupt for a chain visiting a sector twice, got %v", err)
+	}
+
+	// A FAT sector count beyond the file is capped rather than followed
+	// through a DIFAT sector that lists the FAT sector again and again
+	// and names itself as the next DIFAT sector.
+	inflated := bytes.Clone(data)
+	le.PutUint32(inflated[0x2c:], 109+5*127)
+	for i := 1; i < 109; i++ {
+		le.PutUint32(inflated[0x4c+4*i:], fatSector)
+	}
+	difat := first
+	le.PutUint32(inflated[0x44:], difat)
+	for i := 0; i < 128; i++ {
+		le.PutUint32(inflated[512*(int(difat)+1)+4*i:], fatSector)
+	}
+	le.PutUint32(inflated[512*(int(difat)+1)+4*127:], difat)
+	if cf, err := openCompound(inflated); err != nil || len(cf.fat) > len(data) {
+		t.Errorf("FAT for a %d byte file: %v", len(data), err)
+	}
+}
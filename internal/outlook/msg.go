@@ -0,0 +1,445 @@
+// Package outlook converts Outlook .msg files ([MS-OXMSG]) into RFC 822
+// messages, so that messages users save from Outlook go through the same
+// analysis as .eml files.
+package outlook
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"mime"
+	"mime/multipart"
+	"mime/quotedprintable"
+	"net/mail"
+	"net/textproto"
+	"sort"
+	"strings"
+	"time"
+	"unicode/utf16"
+	"unicode/utf8"
+
+	"golang.org/x/text/encoding"
+	"golang.org/x/text/encoding/charmap"
+	"golang.org/x/text/encoding/htmlindex"
+)
+
+// MAPI property IDs ([MS-OXPROPS]).
+const (
+	propSubject                 = 0x0037
+	propClientSubmitTime        = 0x0039
+	propSentRepresentingName    = 0x0042
+	propSentRepresentingAddType = 0x0064
+	propSentRepresentingEmail   = 0x0065
+	propTransportHeaders        = 0x007d
+	propRecipientType           = 0x0c15
+	propSenderName              = 0x0c1a
+	propSenderAddrType          = 0x0c1e
+	propSenderEmail             = 0x0c1f
+	propDisplayCc               = 0x0e03
+	propDisplayTo               = 0x0e04
+	propDeliveryTime            = 0x0e06
+	propBody                    = 0x1000
+	propRTFCompressed           = 0x1009
+	propHTML                    = 0x1013
+	propMessageID               = 0x1035
+	propDisplayName             = 0x3001
+	propAddrType                = 0x3002
+	propEmailAddress            = 0x3003
+	propAttachData              = 0x3701
+	propAttachFilename          = 0x3704
+	propAttachMethod            = 0x3705
+	propAttachLongFilename      = 0x3707
+	propAttachMimeTag           = 0x370e
+	propAttachContentID         = 0x3712
+	propSMTPAddress             = 0x39fe
+	propInternetCodepage        = 0x3fde
+	propMessageCodepage         = 0x3ffd
+	propSenderSMTP              = 0x5d01
+	propSentRepresentingSMTP    = 0x5d02
+)
+
+const (
+	attachEmbeddedMsg = 5
+	// maxEmbedded bounds how deep messages attached to messages are converted.
+	maxEmbedded = 8
+)
+
+var ErrNotMessage = errors.New("outlook: not an Outlook message")
+
+// Convert returns the message in an Outlook .msg file in RFC 822 form.
+// The original transport headers are kept when Outlook stored them, and
+// the headers missing from them are rebuilt from the message properties.
+// The bodies and attachments follow as MIME parts; attached Outlook items
+// become message/rfc822 parts.
+func Convert(data []byte) ([]byte, error) {
+	cf, err := openCompound(data)
+	if err != nil {
+		return nil, err
+	}
+	m := newMessage(cf, cf.root, 32)
+	if m == nil {
+		return nil, ErrNotMessage
+	}
+	return m.rfc822(0), nil
+}
+
+// message is the property view of a message, recipient or attachment
+// storage.
+type message struct {
+	cf    *compoundFile
+	dir   *node
+	fixed map[uint16][]byte // 8-byte values from the property stream
+	cp    encoding.Encoding // for PT_STRING8 values
+}
+
+// newMessage reads the property stream of dir, whose header is
+// headerSize bytes: 32 for the top-level message, 24 for an embedded one
+// and 8 for recipients and attachments.
+func newMessage(cf *compoundFile, dir *node, headerSize int) *message {
+	stream, err := cf.read(dir.child("__properties_version1.0"))
+	if err != nil || len(stream) < headerSize {
+		return nil
+	}
+	m := &message{cf: cf, dir: dir, fixed: map[uint16][]byte{}}
+	for off := headerSize; off+16 <= len(stream); off += 16 {
+		tag := binary.LittleEndian.Uint32(stream[off:])
+		m.fixed[uint16(tag>>16)] = stream[off+8 : off+16]
+	}
+	cp, ok := m.long(propInternetCodepage)
+	if !ok {
+		cp, _ = m.long(propMessageCodepage)
+	}
+	m.cp = codePage(cp)
+	return m
+}
+
+func (m *message) long(id uint16) (int, bool) {
+	v, ok := m.fixed[id]
+	if !ok {
+		return 0, false
+	}
+	return int(int32(binary.LittleEndian.Uint32(v))), true
+}
+
+// time reads a PT_SYSTIME, a count of 100ns intervals since 1601.
+func (m *message) time(id uint16) (time.Time, bool) {
+	v, ok := m.fixed[id]
+	if !ok {
+		return time.Time{}, false
+	}
+	const epochDiff = 116444736000000000
+	ft := int64(binary.LittleEndian.Uint64(v))
+	if ft <= epochDiff {
+		return time.Time{}, false
+	}
+	return time.Unix(0, (ft-epochDiff)*100).UTC(), true
+}
+
+// str reads a PT_UNICODE or PT_STRING8 property.
+func (m *message) str(id uint16) string {
+	if data, err := m.stream(id, 0x001f); err == nil {
+		u := make([]uint16, len(data)/2)
+		for i := range u {
+			u[i] = binary.LittleEndian.Uint16(data[2*i:])
+		}
+		return strings.TrimRight(string(utf16.Decode(u)), "\x00")
+	}
+	if data, err := m.stream(id, 0x001e); err == nil {
+		return strings.TrimRight(decode(data, m.cp), "\x00")
+	}
+	return ""
+}
+
+func (m *message) bin(id uint16) []byte {
+	data, _ := m.stream(id, 0x0102)
+	return data
+}
+
+func (m *message) stream(id, typ uint16) ([]byte, error) {
+	return m.cf.read(m.dir.child(fmt.Sprintf("__substg1.0_%04X%04X", id, typ)))
+}
+
+// storages returns the child storages whose names start with prefix, in
+// name order.
+func (m *message) storages(prefix string) []*node {
+	var out []*node
+	for _, c := range m.dir.children {
+		if c.typ == typeStorage && strings.HasPrefix(c.name, prefix) {
+			out = append(out, c)
+		}
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].name < out[j].name })
+	return out
+}
+
+// smtp returns the address in the email property unless its address type
+// is EX, an Exchange directory name rather than a mail address.
+func (m *message) smtp(smtp, email, addrType uint16) string {
+	if s := m.str(smtp); s != "" {
+		return s
+	}
+	if strings.EqualFold(m.str(addrType), "EX") {
+		return ""
+	}
+	return m.str(email)
+}
+
+func (m *message) rfc822(depth int) []byte {
+	var buf bytes.Buffer
+	present := map[string]bool{}
+	if h := transportHeaders(m.str(propTransportHeaders)); h != "" {
+		buf.WriteString(h)
+		for _, line := range strings.Split(h, "\r\n") {
+			if name, _, ok := strings.Cut(line, ":"); ok && !strings.HasPrefix(line, " ") && !strings.HasPrefix(line, "\t") {
+				present[strings.ToLower(name)] = true
+			}
+		}
+	}
+	header := func(name, value string) {
+		if value != "" && !present[strings.ToLower(name)] {
+			fmt.Fprintf(&buf, "%s: %s\r\n", name, value)
+		}
+	}
+
+	from := &mail.Address{Name: m.str(propSentRepresentingName), Address: m.smtp(propSentRepresentingSMTP, propSentRepresentingEmail, propSentRepresentingAddType)}
+	if from.Name == "" && from.Address == "" {
+		from = &mail.Address{Name: m.str(propSenderName), Address: m.smtp(propSenderSMTP, propSenderEmail, propSenderAddrType)}
+	}
+	if from.Address != "" {
+		header("From", from.String())
+	} else if from.Name != "" {
+		header("From", mime.QEncoding.Encode("utf-8", from.Name))
+	}
+	to, cc := m.recipients()
+	if to == "" {
+		to = mime.QEncoding.Encode("utf-8", m.str(propDisplayTo))
+	}
+	if cc == "" {
+		cc = mime.QEncoding.Encode("utf-8", m.str(propDisplayCc))
+	}
+	header("To", to)
+	header("Cc", cc)
+	header("Subject", mime.QEncoding.Encode("utf-8", m.str(propSubject)))
+	if t, ok := m.time(propClientSubmitTime); ok {
+		header("Date", t.Format(time.RFC1123Z))
+	} else if t, ok := m.time(propDeliveryTime); ok {
+		header("Date", t.Format(time.RFC1123Z))
+	}
+	header("Message-ID", m.str(propMessageID))
+
+	mw := multipart.NewWriter(&buf)
+	fmt.Fprintf(&buf, "MIME-Version: 1.0\r\nContent-Type: multipart/mixed; boundary=%q\r\n\r\n", mw.Boundary())
+
+	html := m.html()
+	var alt bytes.Buffer
+	aw := multipart.NewWriter(&alt)
+	if text := m.str(propBody); text != "" || html == "" {
+		writeText(aw, "text/plain", text)
+	}
+	if html != "" {
+		writeText(aw, "text/html", html)
+	}
+	aw.Close()
+	part, _ := mw.CreatePart(textproto.MIMEHeader{"Content-Type": {mime.FormatMediaType("multipart/alternative", map[string]string{"boundary": aw.Boundary()})}})
+	part.Write(alt.Bytes())
+
+	for i, dir := range m.storages("__attach_version1.0_#") {
+		a := newMessage(m.cf, dir, 8)
+		if a == nil {
+			continue
+		}
+		name := a.str(propAttachLongFilename)
+		if name == "" {
+			name = a.str(propAttachFilename)
+		}
+		if name == "" {
+			name = a.str(propDisplayName)
+		}
+		if method, _ := a.long(propAttachMethod); method == attachEmbeddedMsg {
+			inner := dir.child("__substg1.0_3701000D")
+			var embedded *message
+			if inner != nil && depth < maxEmbedded {
+				embedded = newMessage(m.cf, inner, 24)
+			}
+			if embedded == nil {
+				continue
+			}
+			if name == "" {
+				name = fmt.Sprintf("message %d", i+1)
+			}
+			if !strings.HasSuffix(strings.ToLower(name), ".eml") {
+				name += ".eml"
+			}
+			part, _ := mw.CreatePart(textproto.MIMEHeader{
+				"Content-Type":        {"message/rfc822"},
+				"Content-Disposition": {mime.FormatMediaType("attachment", map[string]string{"filename": name})},
+			})
+			part.Write(embedded.rfc822(depth + 1))
+			continue
+		}
+		writeAttachment(mw, name, a.str(propAttachMimeTag), a.str(propAttachContentID), html, a.bin(propAttachData))
+	}
+	mw.Close()
+	return buf.Bytes()
+}
+
+// recipients formats the To and Cc lists from the recipient storages.
+func (m *message) recipients() (to, cc string) {
+	var lists [2][]string
+	for _, dir := range m.storages("__recip_version1.0_#") {
+		r := newMessage(m.cf, dir, 8)
+		if r == nil {
+			continue
+		}
+		addr := &mail.Address{Name: r.str(propDisplayName), Address: r.smtp(propSMTPAddress, propEmailAddress, propAddrType)}
+		if addr.Address == "" {
+			continue
+		}
+		switch typ, _ := r.long(propRecipientType); typ {
+		case 1:
+			lists[0] = append(lists[0], addr.String())
+		case 2:
+			lists[1] = append(lists[1], addr.String())
+		}
+	}
+	return strings.Join(lists[0], ", "), strings.Join(lists[1], ", ")
+}
+
+// html returns the HTML body, from PidTagHtml or else from the HTML
+// encapsulated in the compressed RTF body.
+func (m *message) html() string {
+	if data := m.bin(propHTML); len(data) > 0 {
+		return decode(data, m.cp)
+	}
+	if rtf, ok := decompressRTF(m.bin(propRTFCompressed)); ok {
+		if html, ok := htmlFromRTF(rtf); ok {
+			return string(html)
+		}
+	}
+	return ""
+}
+
+// transportHeaders returns the stored Internet headers without the ones
+// describing the original MIME structure, which the conversion replaces,
+// and without DKIM and ARC signatures: they cover the original body, so
+// they could only fail on the rebuilt one.
+func transportHeaders(h string) string {
+	h = strings.ReplaceAll(strings.ReplaceAll(h, "\r\n", "\n"), "\n", "\r\n")
+	if end := strings.Index(h, "\r\n\r\n"); end >= 0 {
+		h = h[:end+2]
+	}
+	var out strings.Builder
+	drop := false
+	for _, line := range strings.SplitAfter(h, "\r\n") {
+		if line == "" || line == "\r\n" {
+			continue
+		}
+		if line[0] != ' ' && line[0] != '\t' {
+			name, _, _ := strings.Cut(line, ":")
+			switch strings.ToLower(strings.TrimSpace(name)) {
+			case "content-type", "content-transfer-encoding", "mime-version",
+				"dkim-signature", "arc-seal", "arc-message-signature", "arc-authentication-results":
+				drop = true
+			default:
+				drop = false
+			}
+		}
+		if !drop {
+			out.WriteString(line)
+		}
+	}
+	s := out.String()
+	if s != "" && !strings.HasSuffix(s, "\r\n") {
+		s += "\r\n"
+	}
+	return s
+}
+
+func writeText(w *multipart.Writer, contentType, text string) {
+	part, _ := w.CreatePart(textproto.MIMEHeader{
+		"Content-Type":              {contentType + "; charset=utf-8"},
+		"Content-Transfer-Encoding": {"quoted-printable"},
+	})
+	qp := quotedprintable.NewWriter(part)
+	qp.Write([]byte(text))
+	qp.Close()
+}
+
+// writeAttachment adds a base64 part; attachments the HTML body refers to
+// by Content-ID are inline.
+func writeAttachment(w *multipart.Writer, name, contentType, cid, html string, data []byte) {
+	if contentType == "" {
+		contentType = "application/octet-stream"
+	}
+	disposition := "attachment"
+	h := textproto.MIMEHeader{"Content-Transfer-Encoding": {"base64"}}
+	if cid != "" {
+		h.Set("Content-ID", "<"+strings.Trim(cid, "<>")+">")
+		if strings.Contains(html, "cid:"+strings.Trim(cid, "<>")) {
+			disposition = "inline"
+		}
+	}
+	params := map[string]string{}
+	if name != "" {
+		params["filename"] = name
+	}
+	h.Set("Content-Type", contentType)
+	if t, p, err := mime.ParseMediaType(contentType); err == nil && name != "" {
+		p["name"] = name
+		h.Set("Content-Type", mime.FormatMediaType(t, p))
+	}
+	h.Set("Content-Disposition", mime.FormatMediaType(disposition, params))
+	part, _ := w.CreatePart(h)
+	enc := base64.StdEncoding.EncodeToString(data)
+	for len(enc) > 76 {
+		part.Write([]byte(enc[:76] + "\r\n"))
+		enc = enc[76:]
+	}
+	part.Write([]byte(enc + "\r\n"))
+}
+
+// codePage returns the encoding of a Windows code page, Windows-1252 when
+// it is unknown.
+func codePage(cp int) encoding.Encoding {
+	var name string
+	switch {
+	case cp == 65001:
+		name = "utf-8"
+	case cp >= 1250 && cp <= 1258:
+		name = fmt.Sprintf("windows-%d", cp)
+	case cp >= 28591 && cp <= 28605:
+		name = fmt.Sprintf("iso-8859-%d", cp-28590)
+	case cp == 874:
+		name = "windows-874"
+	case cp == 932:
+		name = "shift_jis"
+	case cp == 936:
+		name = "gbk"
+	case cp == 949:
+		name = "euc-kr"
+	case cp == 950:
+		name = "big5"
+	case cp == 20866:
+		name = "koi8-r"
+	}
+	if e, err := htmlindex.Get(name); err == nil {
+		return e
+	}
+	return charmap.Windows1252
+}
+
+// decode converts text in the given code page to UTF-8. Text that is
+// already valid UTF-8 is taken as such, as Outlook often writes it
+// regardless of the declared code page.
+func decode(data []byte, cp encoding.Encoding) string {
+	if utf8.Valid(data) {
+		return string(data)
+	}
+	out, err := cp.NewDecoder().Bytes(data)
+	if err != nil {
+		return string(data)
+	}
+	return string(out)
+}
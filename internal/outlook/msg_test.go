@@ -0,0 +1,237 @@
+package outlook
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"strings"
+	"testing"
+	"unicode/utf16"
+
+	"github.com/jhillyerd/enmime"
+)
+
+// props builds a property stream with a header of headerSize bytes and
+// the given 4-byte (PT_LONG) values.
+func props(headerSize int, longs map[uint16]uint32) *item {
+	data := make([]byte, headerSize)
+	for id, v := range longs {
+		entry := make([]byte, 16)
+		binary.LittleEndian.PutUint32(entry, uint32(id)<<16|0x0003)
+		binary.LittleEndian.PutUint32(entry[8:], v)
+		data = append(data, entry...)
+	}
+	return stream("__properties_version1.0", data)
+}
+
+func unicodeProp(id uint16, s string) *item {
+	u := utf16.Encode([]rune(s + "\x00"))
+	data := make([]byte, 2*len(u))
+	for i, c := range u {
+		binary.LittleEndian.PutUint16(data[2*i:], c)
+	}
+	return stream(fmt.Sprintf("__substg1.0_%04X001F", id), data)
+}
+
+func binaryProp(id uint16, data []byte) *item {
+	return stream(fmt.Sprintf("__substg1.0_%04X0102", id), data)
+}
+
+func recipient(n int, typ uint32, name, addr string) *item {
+	return storage(fmt.Sprintf("__recip_version1.0_#%08X", n),
+		props(8, map[uint16]uint32{propRecipientType: typ}),
+		unicodeProp(propDisplayName, name), unicodeProp(propSMTPAddress, addr))
+}
+
+func parse(t *testing.T, msg []byte) *enmime.Envelope {
+	t.Helper()
+	raw, err := Convert(msg)
+	if err != nil {
+		t.Fatalf("Convert: %v", err)
+	}
+	env, err := enmime.ReadEnvelope(bytes.NewReader(raw))
+	if err != nil {
+		t.Fatalf("converted message does not parse: %v\n%s", err, raw)
+	}
+	return env
+}
+
+func TestConvert(t *testing.T) {
+	inner := storage("__substg1.0_3701000D",
+		props(24, nil),
+		unicodeProp(propSubject, "Factura restantă"),
+		unicodeProp(propSentRepresentingName, "Plăți ANAF"),
+		unicodeProp(propSentRepresentingEmail, "plati@anaf-ro.top"),
+		unicodeProp(propSentRepresentingAddType, "SMTP"),
+		unicodeProp(propBody, "Plătiți la http://anaf-ro.top/plata"),
+	)
+	msg := buildCompound(
+		props(32, nil),
+		unicodeProp(propSubject, "Fw: Factura restantă"),
+		unicodeProp(propSenderName, "Ion Popescu"),
+		unicodeProp(propSenderAddrType, "EX"),
+		unicodeProp(propSenderEmail, "/O=IGSU/OU=EXCHANGE/CN=RECIPIENTS/CN=IPOPESCU"),
+		unicodeProp(propSenderSMTP, "ion.popescu@igsu.ro"),
+		unicodeProp(propBody, "Vedeti mesajul atasat."),
+		binaryProp(propHTML, []byte(`<p>Vedeti <img src="cid:logo@igsu"> mesajul atasat.</p>`)),
+		recipient(0, 1, "SOC", "soc@igsu.ro"),
+		recipient(1, 2, "Ana Georgescu", "ana.georgescu@igsu.ro"),
+		storage("__attach_version1.0_#00000000",
+			props(8, map[uint16]uint32{propAttachMethod: 1}),
+			unicodeProp(propAttachLongFilename, "factură.pdf"),
+			unicodeProp(propAttachMimeTag, "application/pdf"),
+			binaryProp(propAttachData, []byte("%PDF-1.4 test")),
+		),
+		storage("__attach_version1.0_#00000001",
+			props(8, map[uint16]uint32{propAttachMethod: 1}),
+			unicodeProp(propAttachLongFilename, "logo.png"),
+			unicodeProp(propAttachMimeTag, "image/png"),
+			unicodeProp(propAttachContentID, "logo@igsu"),
+			binaryProp(propAttachData, bytes.Repeat([]byte{0x89}, 5000)),
+		),
+		storage("__attach_version1.0_#00000002",
+			props(8, map[uint16]uint32{propAttachMethod: attachEmbeddedMsg}),
+			unicodeProp(propDisplayName, "Factura restantă"),
+			inner,
+		),
+	)
+
+	env := parse(t, msg)
+	if got := env.GetHeader("From"); got != `"Ion Popescu" <ion.popescu@igsu.ro>` {
+		t.Errorf("From = %q", got)
+	}
+	if got := env.GetHeader("Subject"); got != "Fw: Factura restantă" {
+		t.Errorf("Subject = %q", got)
+	}
+	if to, cc := env.GetHeader("To"), env.GetHeader("Cc"); to != `"SOC" <soc@igsu.ro>` || cc != `"Ana Georgescu" <ana.georgescu@igsu.ro>` {
+		t.Errorf("To = %q, Cc = %q", to, cc)
+	}
+	if !strings.Contains(env.Text, "Vedeti mesajul atasat.") || !strings.Contains(env.HTML, `src="cid:logo@igsu"`) {
+		t.Errorf("bodies not converted: %q / %q", env.Text, env.HTML)
+	}
+
+	if len(env.Inlines) != 1 || env.Inlines[0].FileName != "logo.png" || len(env.Inlines[0].Content) != 5000 {
+		t.Errorf("expected logo.png inline, got %d inlines", len(env.Inlines))
+	}
+	var names []string
+	var embedded *enmime.Part
+	for _, a := range env.Attachments {
+		names = append(names, a.FileName)
+		if a.ContentType == "message/rfc822" {
+			embedded = a
+		}
+	}
+	if strings.Join(names, ",") != "factură.pdf,Factura restantă.eml" {
+		t.Errorf("attachments = %v", names)
+	}
+	if embedded == nil {
+		t.Fatal("embedded message not converted to message/rfc822")
+	}
+	child, err := enmime.ReadEnvelope(bytes.NewReader(embedded.Content))
+	if err != nil {
+		t.Fatalf("embedded message: %v", err)
+	}
+	if got := child.GetHeader("From"); got != "Plăți ANAF <plati@anaf-ro.top>" {
+		t.Errorf("embedded From = %q", got)
+	}
+	if !strings.Contains(child.Text, "http://anaf-ro.top/plata") {
+		t.Errorf("embedded body = %q", child.Text)
+	}
+}
+
+func TestConvert_TransportHeaders(t *testing.T) {
+	headers := "Received: from mx.anaf-ro.top\r\n\tby mx.igsu.ro; Mon, 19 Jan 2026 10:00:00 +0200\r\n" +
+		"DKIM-Signature: v=1; a=rsa-sha256; d=anaf-ro.top; s=mail;\r\n\tbh=47DEQpj8HBSa+/TImW+5JCeuQeRkm5NMpJWZG3hSuFU=; b=dGVzdA==\r\n" +
+		"ARC-Seal: i=1; a=rsa-sha256; d=igsu.ro; s=arc; cv=none; b=dGVzdA==\r\n" +
+		"ARC-Message-Signature: i=1; a=rsa-sha256; d=igsu.ro; s=arc; b=dGVzdA==\r\n" +
+		"ARC-Authentication-Results: i=1; mx.igsu.ro; dkim=pass\r\n" +
+		"From: Plati <plati@anaf-ro.top>\r\nReply-To: colectare@gmail.com\r\n" +
+		"Content-Type: multipart/alternative;\r\n boundary=\"original\"\r\nMIME-Version: 1.0\r\n\r\n"
+	msg := buildCompound(
+		props(32, nil),
+		unicodeProp(propTransportHeaders, headers),
+		unicodeProp(propSubject, "Factura"),
+		unicodeProp(propSentRepresentingName, "Altcineva"),
+		unicodeProp(propSentRepresentingSMTP, "other@example.com"),
+		unicodeProp(propBody, "text"),
+	)
+
+	env := parse(t, msg)
+	if got := env.GetHeader("From"); got != "Plati <plati@anaf-ro.top>" {
+		t.Errorf("From = %q, want the transport header", got)
+	}
+	if got := env.GetHeader("Reply-To"); got != "colectare@gmail.com" {
+		t.Errorf("Reply-To = %q", got)
+	}
+	if got := env.GetHeader("Subject"); got != "Factura" {
+		t.Errorf("Subject = %q, want it rebuilt from the properties", got)
+	}
+	if !strings.Contains(env.GetHeader("Received"), "by mx.igsu.ro") {
+		t.Errorf("Received = %q", env.GetHeader("Received"))
+	}
+	if env.Text != "text" {
+		t.Errorf("Text = %q; the original Content-Type must not survive", env.Text)
+	}
+	for _, h := range []string{"DKIM-Signature", "ARC-Seal", "ARC-Message-Signature", "ARC-Authentication-Results"} {
+		if got := env.GetHeader(h); got != "" {
+			t.Errorf("%s = %q; signatures over the original body must be dropped", h, got)
+		}
+	}
+}
+
+func TestConvert_NotMessage(t *testing.T) {
+	if _, err := Convert(buildCompound(stream("WordDocument", []byte("doc")))); err != ErrNotMessage {
+		t.Errorf("expected ErrNotMessage, got %v", err)
+	}
+	if _, err := Convert([]byte("From: a@b.ro\r\n\r\nbody")); err != ErrNotCompound {
+		t.Errorf("expected ErrNotCompound, got %v", err)
+	}
+}
+
+func TestDecompressRTF(t *testing.T) {
+	// Examples from [MS-OXRTFCP] 4.1 and 4.2.
+	cases := []struct{ in, want string }{
+		{"2d0000002b0000004c5a4675f1c5c7a703000a00726370673132354232" + "0af32068656c090020627705b06c647d0a800fa0",
+			"{\\rtf1\\ansi\\ansicpg1252\\pard hello world}\r\n"},
+		{"1a0000001c0000004c5a4675e2d44b51410004205758595a0d6e7d010eb0",
+			"{\\rtf1 WXYZWXYZWXYZWXYZWXYZ}"},
+	}
+	for _, tc := range cases {
+		data, _ := hex.DecodeString(tc.in)
+		got, ok := decompressRTF(data)
+		if !ok || string(got) != tc.want {
+			t.Errorf("decompressRTF = %q, %v; want %q", got, ok, tc.want)
+		}
+	}
+}
+
+func TestHTMLFromRTF(t *testing.T) {
+	rtf := `{\rtf1\ansi\ansicpg1250\fromhtml1 \deff0{\fonttbl{\f0\fswiss Arial;}}` + "\r\n" +
+		`{\*\htmltag19 <html>}{\*\htmltag34 <body>}\htmlrtf {\htmlrtf0` + "\r\n" +
+		`{\*\htmltag84 <a href="https://login.spamsite.biz/x">}\htmlrtf {\field{\fldinst HYPERLINK}}\htmlrtf0 Autentifica\'ba-te{\*\htmltag92 </a>}\par` + "\r\n" +
+		`Pre\u539? \{1\}{\*\htmltag38 </body>}{\*\htmltag27 </html>}}}`
+
+	got, ok := htmlFromRTF([]byte(rtf))
+	want := "<html><body><a href=\"https://login.spamsite.biz/x\">Autentificaş-te</a>\r\nPreț {1}</body></html>"
+	if !ok || string(got) != want {
+		t.Errorf("htmlFromRTF =\n%q\nwant\n%q", got, want)
+	}
+	if _, ok := htmlFromRTF([]byte(`{\rtf1\ansi plain}`)); ok {
+		t.Error("RTF without \\fromhtml must not be taken as HTML")
+	}
+}
+
+func TestConvert_RTFBody(t *testing.T) {
+	rtf := `{\rtf1\ansi\fromhtml1 {\*\htmltag64 <a href="https://x.example/login">}link{\*\htmltag64 </a>}}`
+	compressed := make([]byte, 16, 16+len(rtf))
+	binary.LittleEndian.PutUint32(compressed, uint32(12+len(rtf)))
+	binary.LittleEndian.PutUint32(compressed[4:], uint32(len(rtf)))
+	binary.LittleEndian.PutUint32(compressed[8:], rtfUncompressed)
+	compressed = append(compressed, rtf...)
+
+	env := parse(t, buildCompound(props(32, nil), binaryProp(propRTFCompressed, compressed)))
+	if env.HTML != `<a href="https://x.example/login">link</a>` {
+		t.Errorf("HTML = %q", env.HTML)
+	}
+}
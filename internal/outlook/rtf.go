@@ -0,0 +1,214 @@
+package outlook
+
+import (
+	"bytes"
+	"encoding/binary"
+	"strconv"
+	"strings"
+)
+
+// Outlook often keeps an HTML body only as compressed RTF
+// (PidTagRtfCompressed) with the HTML encapsulated in it ([MS-OXRTFCP],
+// [MS-OXRTFEX]).
+
+const rtfPrebuf = "{\\rtf1\\ansi\\mac\\deff0\\deftab720{\\fonttbl;}{\\f0\\fnil \\froman \\fswiss \\fmodern \\fscript \\fdecor MS Sans SerifSymbolArialTimes New RomanCourier{\\colortbl\\red0\\green0\\blue0\r\n\\par \\pard\\plain\\f0\\fs20\\b\\i\\u\\tab\\tx"
+
+const (
+	rtfCompressed   = 0x75465a4c // "LZFu"
+	rtfUncompressed = 0x414c454d // "MELA"
+)
+
+// decompressRTF expands PidTagRtfCompressed; the output is bounded by the
+// raw size the header declares.
+func decompressRTF(data []byte) ([]byte, bool) {
+	if len(data) < 16 {
+		return nil, false
+	}
+	le := binary.LittleEndian
+	rawSize := int(le.Uint32(data[4:]))
+	body := data[16:]
+	switch le.Uint32(data[8:]) {
+	case rtfUncompressed:
+		if rawSize > len(body) {
+			rawSize = len(body)
+		}
+		return body[:rawSize], true
+	case rtfCompressed:
+	default:
+		return nil, false
+	}
+	if rawSize > 64<<20 {
+		return nil, false
+	}
+
+	var dict [4096]byte
+	copy(dict[:], rtfPrebuf)
+	w := len(rtfPrebuf)
+	out := make([]byte, 0, rawSize)
+	for i := 0; i < len(body) && len(out) < rawSize; {
+		control := body[i]
+		i++
+		for bit := 0; bit < 8 && i < len(body); bit++ {
+			if control&(1<<bit) == 0 {
+				dict[w] = body[i]
+				w = (w + 1) % len(dict)
+				out = append(out, body[i])
+				i++
+				continue
+			}
+			if i+1 >= len(body) {
+				return out, true
+			}
+			ref := int(body[i])<<8 | int(body[i+1])
+			i += 2
+			offset, length := ref>>4, ref&0xf+2
+			if offset == w {
+				return out, true
+			}
+			for k := 0; k < length; k++ {
+				c := dict[(offset+k)%len(dict)]
+				dict[w] = c
+				w = (w + 1) % len(dict)
+				out = append(out, c)
+			}
+		}
+	}
+	return out, true
+}
+
+// htmlFromRTF recovers the HTML encapsulated in an RTF body written with
+// \fromhtml1, as UTF-8. It returns false for RTF that did not come from
+// HTML.
+func htmlFromRTF(rtf []byte) ([]byte, bool) {
+	if !bytes.Contains(rtf[:min(len(rtf), 1024)], []byte(`\fromhtml`)) {
+		return nil, false
+	}
+	type state struct {
+		skip    bool // ignorable destination or RTF-only text
+		htmltag bool
+		uc      int
+	}
+	var out bytes.Buffer
+	st := state{uc: 1}
+	var stack []state
+	pendingSkip := 0 // characters to drop after a \u escape
+	cp := codePage(1252)
+	emit := func(b ...byte) {
+		if pendingSkip > 0 {
+			pendingSkip--
+			return
+		}
+		if !st.skip || st.htmltag {
+			out.Write(b)
+		}
+	}
+	for i := 0; i < len(rtf); {
+		c := rtf[i]
+		switch c {
+		case '{':
+			stack = append(stack, st)
+			i++
+			// A destination is named by the group's first control word.
+			if word, _, n := rtfControl(rtf[i:]); n > 0 && word == "*" {
+				next, _, m := rtfControl(rtf[i+n:])
+				switch next {
+				case "htmltag":
+					st.htmltag, st.skip = true, false
+				default:
+					st.skip = true
+				}
+				i += n + m
+			} else if n > 0 && ignoredDestinations[word] {
+				st.skip = true
+			}
+		case '}':
+			if len(stack) > 0 {
+				st = stack[len(stack)-1]
+				stack = stack[:len(stack)-1]
+			}
+			i++
+		case '\\':
+			word, param, n := rtfControl(rtf[i:])
+			i += max(n, 1)
+			switch word {
+			case "htmlrtf":
+				if !st.htmltag {
+					st.skip = param != "0"
+				}
+			case "par", "line":
+				emit('\r', '\n')
+			case "tab":
+				emit('\t')
+			case "ansicpg":
+				if v, err := strconv.Atoi(param); err == nil {
+					cp = codePage(v)
+				}
+			case "'":
+				if v, err := strconv.ParseUint(param, 16, 8); err == nil {
+					b, _ := cp.NewDecoder().Bytes([]byte{byte(v)})
+					emit(b...)
+				}
+			case "u":
+				if v, err := strconv.Atoi(param); err == nil {
+					if v < 0 {
+						v += 65536
+					}
+					emit([]byte(string(rune(v)))...)
+					pendingSkip = st.uc
+				}
+			case "uc":
+				st.uc, _ = strconv.Atoi(param)
+			case "{", "}", "\\":
+				emit(word[0])
+			}
+		case '\r', '\n':
+			i++
+		default:
+			emit(c)
+			i++
+		}
+	}
+	return out.Bytes(), true
+}
+
+var ignoredDestinations = map[string]bool{
+	"fonttbl": true, "colortbl": true, "stylesheet": true, "info": true, "pict": true,
+}
+
+// rtfControl parses the control word or symbol at the start of s (which
+// begins with a backslash) and returns its name, its numeric or hex
+// parameter and its length including a delimiting space.
+func rtfControl(s []byte) (word, param string, n int) {
+	if len(s) < 2 || s[0] != '\\' {
+		return "", "", 0
+	}
+	c := s[1]
+	if c == '\'' {
+		if len(s) < 4 {
+			return "'", "", len(s)
+		}
+		return "'", string(s[2:4]), 4
+	}
+	if !isLetter(c) {
+		return string(c), "", 2
+	}
+	i := 1
+	for i < len(s) && isLetter(s[i]) {
+		i++
+	}
+	word = string(s[1:i])
+	j := i
+	if j < len(s) && s[j] == '-' {
+		j++
+	}
+	for j < len(s) && s[j] >= '0' && s[j] <= '9' {
+		j++
+	}
+	param = string(s[i:j])
+	if j < len(s) && s[j] == ' ' {
+		j++
+	}
+	return strings.ToLower(word), param, j
+}
+
+func isLetter(c byte) bool { return c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' }
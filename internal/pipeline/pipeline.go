@@ -0,0 +1,147 @@
+// Package pipeline runs the checks that look only at a message's content
+// (sender and link lists, impersonation, headers, attachments, calendar
+// invites, prompt injection), so that they can be applied to the messages
+// attached to it as well as to the message itself.
+package pipeline
+
+import (
+	"fmt"
+
+	"spamfilter/internal/adversarial"
+	"spamfilter/internal/attachment"
+	"spamfilter/internal/directory"
+	"spamfilter/internal/email"
+	"spamfilter/internal/lists"
+	"spamfilter/internal/recommendation"
+)
+
+// Checker holds what the content checks need.
+type Checker struct {
+	Store     *lists.Store
+	Directory *directory.Directory
+	Limits    attachment.Limits
+	// MaxDepth bounds how deep attached messages are followed, up to
+	// maxDepth; messages inside a message at that depth are reported but
+	// not analysed.
+	MaxDepth int
+}
+
+const (
+	// maxDepth clamps Checker.MaxDepth.
+	maxDepth = 10
+	// maxMessages bounds the attached messages analysed per message, at
+	// all depths together.
+	maxMessages = 20
+)
+
+// Content is the outcome of the content checks on one message.
+type Content struct {
+	Domain        email.DomainCheck
+	Impersonation email.ImpersonationCheck
+	Headers       email.HeaderCheck
+	Links         email.LinkCheck
+	Attachments   attachment.Report
+	Calendar      email.CalendarCheck
+	Adversarial   adversarial.Result
+}
+
+// Content runs the content checks on em. auth holds the authentication
+// results and SMTP envelope sender, empty for attached messages.
+func (c Checker) Content(em *email.Email, auth email.SenderAuth) Content {
+	return c.content(em, auth, nil)
+}
+
+// content is Content spending budget on the attachments, or a fresh one
+// when budget is nil.
+func (c Checker) content(em *email.Email, auth email.SenderAuth, budget *attachment.Budget) Content {
+	var ct Content
+	ct.Domain = email.CheckDomainBlocklist(em.Envelope, c.Store, auth)
+	ct.Impersonation = email.CheckImpersonation(em.Envelope, c.Directory)
+	ct.Headers = email.CheckHeaderConsistency(em.Envelope, auth.MailFrom)
+	ct.Attachments = attachment.Inspector{Limits: c.Limits, Hashes: c.Store, Budget: budget}.Inspect(em.Envelope)
+	ct.Calendar = email.CheckCalendar(em.Envelope, c.Directory)
+	// Links in the body, in HTML/PDF attachments and in calendar invites
+	urls := append(email.ExtractURLs(em.Envelope), ct.Attachments.URLs...)
+	ct.Links = email.CheckLinks(append(urls, ct.Calendar.URLs...), c.Store)
+	ct.Adversarial = adversarial.Check(string(em.Raw))
+	return ct
+}
+
+// Findings flattens the content checks into weighted findings, the form in
+// which they are rolled up from an attached message into its parent.
+func (ct Content) Findings() []email.Finding {
+	var out []email.Finding
+	if ct.Adversarial.IsAdversarial {
+		out = append(out, email.Finding{Check: "adversarial", Weight: 10.0, Reason: ct.Adversarial.Reason})
+	}
+	if ct.Domain.Malicious {
+		out = append(out, email.Finding{Check: "sender-blocklist", Weight: 10.0 * ct.Domain.Entry.Weight(), Reason: ct.Domain.Reason})
+	}
+	out = append(out, ct.Impersonation.Findings...)
+	out = append(out, ct.Headers.Findings...)
+	out = append(out, ct.Links.Findings...)
+	out = append(out, ct.Attachments.Findings...)
+	out = append(out, ct.Calendar.Findings...)
+	return out
+}
+
+// Nested runs the content checks on every message attached to em,
+// recursively, and returns one entry per message with its path from em.
+// Past maxMessages the walk stops, and one more entry for the first
+// message left out says so. The attachment limits apply to all the
+// attached messages together, not to each of them.
+func (c Checker) Nested(em *email.Email) []recommendation.Nested {
+	var out []recommendation.Nested
+	budget := &attachment.Budget{}
+	depthLimit := min(c.MaxDepth, maxDepth)
+	skipped := 0
+	var walk func(parent *email.Email, depth int)
+	walk = func(parent *email.Email, depth int) {
+		for _, child := range email.AttachedMessages(parent) {
+			if len(out) >= maxMessages {
+				if skipped++; skipped == 1 {
+					out = append(out, recommendation.Nested{
+						Path:    child.ID,
+						From:    child.Envelope.GetHeader("From"),
+						Subject: child.Envelope.GetHeader("Subject"),
+					})
+				}
+				continue
+			}
+			n := recommendation.Nested{
+				Path:     child.ID,
+				From:     child.Envelope.GetHeader("From"),
+				Subject:  child.Envelope.GetHeader("Subject"),
+				Findings: c.content(&child, email.SenderAuth{}, budget).Findings(),
+			}
+			if depth < depthLimit {
+				out = append(out, n)
+				walk(&child, depth+1)
+				continue
+			}
+			if inner := len(email.AttachedMessages(&child)); inner > 0 {
+				n.Findings = append(n.Findings, email.Finding{
+					Check:  "nested-depth-limit",
+					Weight: 1.0,
+					Reason: fmt.Sprintf("%d attached message(s) nested deeper than %d levels were not analysed", inner, depthLimit),
+				})
+			}
+			out = append(out, n)
+		}
+	}
+	if depthLimit > 0 {
+		// Paths are relative to em, so its own ID is left out.
+		root := *em
+		root.ID = ""
+		walk(&root, 1)
+	}
+	if skipped > 0 {
+		last := &out[len(out)-1]
+		last.Findings = append(last.Findings, email.Finding{
+			Check:  "nested-count-limit",
+			Weight: 1.0,
+			Reason: fmt.Sprintf("this and %d other attached message(s) were not analysed; at most %d are", skipped-1, maxMessages),
+		})
+	}
+	return out
+}
@@ -0,0 +1,195 @@
+package pipeline
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/base64"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"spamfilter/internal/attachment"
+	"spamfilter/internal/directory"
+	"spamfilter/internal/email"
+	"spamfilter/internal/lists"
+	"spamfilter/internal/recommendation"
+)
+
+const phish = "From: Plati <plati@anaf-ro.top>\r\nTo: ana@igsu.ro\r\nSubject: Factura restanta\r\n\r\n" +
+	"Platiti la http://anaf-ro.top/plata\r\n"
+
+// forward wraps inner as the attached message name of a new message.
+func forward(subject, name, inner string) string {
+	b := "b-" + subject
+	return "From: Ana <ana@igsu.ro>\r\nTo: soc@igsu.ro\r\nSubject: " + subject + "\r\n" +
+		"MIME-Version: 1.0\r\nContent-Type: multipart/mixed; boundary=\"" + b + "\"\r\n\r\n" +
+		"--" + b + "\r\nContent-Type: text/plain\r\n\r\nSee attached.\r\n" +
+		"--" + b + "\r\nContent-Type: message/rfc822\r\nContent-Disposition: attachment; filename=\"" + name + "\"\r\n\r\n" +
+		inner + "\r\n--" + b + "--\r\n"
+}
+
+func load(t *testing.T, raw string) *email.Email {
+	t.Helper()
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "top.eml"), []byte(raw), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	emails, err := email.LoadEmailsFromDir(dir)
+	if err != nil || len(emails) != 1 {
+		t.Fatalf("load: %v", err)
+	}
+	return &emails[0]
+}
+
+func checker(t *testing.T, depth int) Checker {
+	t.Helper()
+	store := lists.NewStore(lists.MatchSubdomain)
+	if err := store.AddStatic(lists.Block, []string{"anaf-ro.top"}, "test"); err != nil {
+		t.Fatal(err)
+	}
+	return Checker{Store: store, Directory: directory.New([]string{"igsu.ro"}), Limits: attachment.DefaultLimits, MaxDepth: depth}
+}
+
+func TestNested(t *testing.T) {
+	em := load(t, forward("outer", "fwd.eml", forward("middle", "original.eml", phish)))
+
+	nested := checker(t, 3).Nested(em)
+	if len(nested) != 2 {
+		t.Fatalf("expected 2 attached messages, got %d", len(nested))
+	}
+	if nested[0].Path != "fwd.eml" || nested[1].Path != "fwd.eml/original.eml" {
+		t.Errorf("paths = %q, %q", nested[0].Path, nested[1].Path)
+	}
+	if len(nested[0].Findings) != 0 {
+		t.Errorf("the forwarding message is clean, got %v", nested[0].Findings)
+	}
+	checks := map[string]bool{}
+	for _, f := range nested[1].Findings {
+		checks[f.Check] = true
+	}
+	if !checks["sender-blocklist"] || !checks["link-blocklist"] {
+		t.Errorf("expected sender and link findings in the original, got %v", nested[1].Findings)
+	}
+	if nested[1].Subject != "Factura restanta" {
+		t.Errorf("Subject = %q", nested[1].Subject)
+	}
+
+	sc := recommendation.Build(recommendation.Input{SPF: email.SPFResult{Status: "pass"}, Nested: nested})
+	if sc.Status != "SPAM" {
+		t.Errorf("expected SPAM from the attached phish, got %s (%.1f)", sc.Status, sc.DecisionScore)
+	}
+	if !strings.Contains(strings.Join(sc.Reasons, "\n"), "in fwd.eml/original.eml: ") {
+		t.Errorf("reasons do not name the attached message: %v", sc.Reasons)
+	}
+}
+
+func TestNested_DepthLimit(t *testing.T) {
+	em := load(t, forward("outer", "fwd.eml", forward("middle", "original.eml", phish)))
+
+	nested := checker(t, 1).Nested(em)
+	if len(nested) != 1 {
+		t.Fatalf("expected only the first level, got %d", len(nested))
+	}
+	f := nested[0].Findings
+	if len(f) != 1 || f[0].Check != "nested-depth-limit" {
+		t.Errorf("expected a depth limit finding, got %v", f)
+	}
+
+	if got := checker(t, 0).Nested(em); len(got) != 0 {
+		t.Errorf("depth 0 disables the check, got %v", got)
+	}
+}
+
+func TestNested_CountLimit(t *testing.T) {
+	b := "b-many"
+	raw := "From: Ana <ana@igsu.ro>\r\nTo: soc@igsu.ro\r\nSubject: many\r\n" +
+		"MIME-Version: 1.0\r\nContent-Type: multipart/mixed; boundary=\"" + b + "\"\r\n\r\n"
+	for i := 0; i < maxMessages+5; i++ {
+		raw += "--" + b + "\r\nContent-Type: message/rfc822\r\nContent-Disposition: attachment; filename=\"" +
+			fmt.Sprintf("m%02d.eml", i) + "\"\r\n\r\n" + phish + "\r\n"
+	}
+	em := load(t, raw+"--"+b+"--\r\n")
+
+	nested := checker(t, 3).Nested(em)
+	if len(nested) != maxMessages+1 {
+		t.Fatalf("expected %d entries, got %d", maxMessages+1, len(nested))
+	}
+	last := nested[maxMessages]
+	if last.Path != fmt.Sprintf("m%02d.eml", maxMessages) || len(last.Findings) != 1 || last.Findings[0].Check != "nested-count-limit" {
+		t.Errorf("expected a count limit entry, got %+v", last)
+	}
+	if !strings.Contains(last.Findings[0].Reason, "this and 4 other") {
+		t.Errorf("reason = %q", last.Findings[0].Reason)
+	}
+}
+
+func TestNested_SharedLimits(t *testing.T) {
+	var buf bytes.Buffer
+	zw := zip.NewWriter(&buf)
+	for i := 0; i < 3; i++ {
+		w, _ := zw.Create(fmt.Sprintf("doc%d.txt", i))
+		w.Write([]byte("continut"))
+	}
+	if err := zw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	withZip := "From: Ana <ana@igsu.ro>\r\nTo: soc@igsu.ro\r\nSubject: arhiva\r\n" +
+		"MIME-Version: 1.0\r\nContent-Type: multipart/mixed; boundary=\"z\"\r\n\r\n" +
+		"--z\r\nContent-Type: text/plain\r\n\r\nArhiva atasata.\r\n" +
+		"--z\r\nContent-Type: application/zip\r\nContent-Transfer-Encoding: base64\r\nContent-Disposition: attachment; filename=\"docs.zip\"\r\n\r\n" +
+		base64.StdEncoding.EncodeToString(buf.Bytes()) + "\r\n--z--\r\n"
+	b := "b-many"
+	raw := "From: Ana <ana@igsu.ro>\r\nTo: soc@igsu.ro\r\nSubject: many\r\n" +
+		"MIME-Version: 1.0\r\nContent-Type: multipart/mixed; boundary=\"" + b + "\"\r\n\r\n"
+	for i := 0; i < 3; i++ {
+		raw += "--" + b + "\r\nContent-Type: message/rfc822\r\nContent-Disposition: attachment; filename=\"" +
+			fmt.Sprintf("m%d.eml", i) + "\"\r\n\r\n" + withZip + "\r\n"
+	}
+	em := load(t, raw+"--"+b+"--\r\n")
+
+	// Each message fits the limit on its own; together they do not.
+	c := checker(t, 3)
+	c.Limits.MaxFiles = 5
+	nested := c.Nested(em)
+	if len(nested) != 3 {
+		t.Fatalf("expected 3 attached messages, got %d", len(nested))
+	}
+	var limited []string
+	for _, n := range nested {
+		for _, f := range n.Findings {
+			if f.Check == "archive-limit" {
+				limited = append(limited, n.Path)
+			}
+		}
+	}
+	if strings.Join(limited, ",") != "m1.eml,m2.eml" {
+		t.Errorf("archive limit reached in %v, want m1.eml and m2.eml", limited)
+	}
+}
+
+func TestContent_ESPStaysClean(t *testing.T) {
+	em := load(t, "From: Magazin <noutati@magazin.ro>\r\nTo: ana@igsu.ro\r\n"+
+		"Return-Path: <bounces+4471@bounces.sendgrid.net>\r\nSubject: Oferte\r\n\r\nOfertele saptamanii.\r\n")
+	// SPF passes for the ESP's bounce domain; the message is not signed.
+	auth := email.SenderAuth{
+		SPF:      email.SPFResult{Status: "pass"},
+		MailFrom: "bounces+4471@bounces.sendgrid.net",
+	}
+	ct := checker(t, 3).Content(em, auth)
+	sc := recommendation.Build(recommendation.Input{
+		DKIM:          auth.DKIM,
+		SPF:           auth.SPF,
+		Domain:        ct.Domain,
+		Adversarial:   &ct.Adversarial,
+		Impersonation: &ct.Impersonation,
+		Headers:       &ct.Headers,
+		Links:         &ct.Links,
+		Attachments:   &ct.Attachments,
+		Calendar:      &ct.Calendar,
+	})
+	if sc.Status != "CLEAN" {
+		t.Errorf("mail sent through an ESP: %s (%.1f) %v", sc.Status, sc.DecisionScore, sc.Reasons)
+	}
+}
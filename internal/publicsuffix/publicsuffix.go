@@ -0,0 +1,163 @@
+// Package publicsuffix implements Public Suffix List lookups used to derive
+// the organizational domain of a host (e.g. example.co.uk for
+// mail.example.co.uk). A snapshot of the list is embedded; a newer copy can
+// be loaded from disk with LoadFile and installed with SetDefault.
+package publicsuffix
+
+import (
+	"bufio"
+	_ "embed"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"sync/atomic"
+
+	"golang.org/x/net/idna"
+)
+
+//go:embed public_suffix_list.dat
+var embedded string
+
+type List struct {
+	rules      map[string]bool
+	wildcards  map[string]bool
+	exceptions map[string]bool
+}
+
+var defaultList atomic.Pointer[List]
+
+func init() {
+	l, err := Parse(strings.NewReader(embedded))
+	if err != nil {
+		panic(fmt.Sprintf("publicsuffix: embedded list: %v", err))
+	}
+	defaultList.Store(l)
+}
+
+// Default returns the list used by the package-level helpers.
+func Default() *List {
+	return defaultList.Load()
+}
+
+// SetDefault replaces the list used by the package-level helpers.
+func SetDefault(l *List) {
+	if l != nil {
+		defaultList.Store(l)
+	}
+}
+
+// LoadFile parses a public_suffix_list.dat file.
+func LoadFile(path string) (*List, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	l, err := Parse(f)
+	if err != nil {
+		return nil, fmt.Errorf("parse %s: %w", path, err)
+	}
+	return l, nil
+}
+
+// Parse reads rules in the publicsuffix.org format: one rule per line,
+// "//" comments, "*." wildcards and "!" exceptions. Both the ICANN and the
+// private sections are used. Unicode rules are stored in their ASCII form.
+func Parse(r io.Reader) (*List, error) {
+	l := &List{
+		rules:      map[string]bool{},
+		wildcards:  map[string]bool{},
+		exceptions: map[string]bool{},
+	}
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "//") {
+			continue
+		}
+		if i := strings.IndexAny(line, " \t"); i >= 0 {
+			line = line[:i]
+		}
+		switch {
+		case strings.HasPrefix(line, "!"):
+			l.exceptions[toASCII(line[1:])] = true
+		case strings.HasPrefix(line, "*."):
+			l.wildcards[toASCII(line[2:])] = true
+		default:
+			l.rules[toASCII(line)] = true
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	if len(l.rules) == 0 && len(l.wildcards) == 0 {
+		return nil, fmt.Errorf("no rules found")
+	}
+	return l, nil
+}
+
+// PublicSuffix returns the public suffix of host, e.g. "co.uk" for
+// "mail.example.co.uk". Unlisted TLDs fall back to the last label.
+func (l *List) PublicSuffix(host string) string {
+	host = normalize(host)
+	if host == "" {
+		return ""
+	}
+	labels := strings.Split(host, ".")
+	for i := range labels {
+		candidate := strings.Join(labels[i:], ".")
+		if l.exceptions[candidate] {
+			return strings.Join(labels[i+1:], ".")
+		}
+		if l.rules[candidate] {
+			return candidate
+		}
+		if i+1 < len(labels) && l.wildcards[strings.Join(labels[i+1:], ".")] {
+			return candidate
+		}
+	}
+	return labels[len(labels)-1]
+}
+
+// OrganizationalDomain returns the public suffix of host plus one label.
+// A host that is itself a public suffix is returned unchanged.
+func (l *List) OrganizationalDomain(host string) string {
+	host = normalize(host)
+	suffix := l.PublicSuffix(host)
+	if suffix == "" || host == suffix {
+		return host
+	}
+	rest := strings.TrimSuffix(host, "."+suffix)
+	if i := strings.LastIndex(rest, "."); i >= 0 {
+		rest = rest[i+1:]
+	}
+	return rest + "." + suffix
+}
+
+// PublicSuffix looks up host in the default list.
+func PublicSuffix(host string) string {
+	return Default().PublicSuffix(host)
+}
+
+// OrganizationalDomain looks up host in the default list.
+func OrganizationalDomain(host string) string {
+	return Default().OrganizationalDomain(host)
+}
+
+func normalize(host string) string {
+	host = strings.TrimSuffix(strings.ToLower(strings.TrimSpace(host)), ".")
+	return toASCII(host)
+}
+
+func toASCII(s string) string {
+	for _, r := range s {
+		if r >= 0x80 {
+			if ascii, err := idna.ToASCII(s); err == nil {
+				return strings.ToLower(ascii)
+			}
+			return s
+		}
+	}
+	return s
+}
@@ -0,0 +1,52 @@
+package publicsuffix
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestOrganizationalDomain(t *testing.T) {
+	cases := map[string]string{
+		"mail.spam.com":        "spam.com",
+		"spam.com":             "spam.com",
+		"a.b.example.co.uk":    "example.co.uk",
+		"relay.igsu.ro":        "igsu.ro",
+		"www.firma.com.ro":     "firma.com.ro",
+		"MAIL.Example.COM.":    "example.com",
+		"com":                  "com",
+		"host.unknown-tld-xyz": "host.unknown-tld-xyz",
+	}
+	for host, want := range cases {
+		if got := OrganizationalDomain(host); got != want {
+			t.Errorf("OrganizationalDomain(%q) = %q, want %q", host, got, want)
+		}
+	}
+}
+
+func TestRules(t *testing.T) {
+	l, err := Parse(strings.NewReader("// test list\ncom\nuk\nco.uk\n*.ck\n!www.ck\n"))
+	if err != nil {
+		t.Fatalf("Parse: %v", err)
+	}
+	cases := []struct{ host, suffix, org string }{
+		{"shop.example.co.uk", "co.uk", "example.co.uk"},
+		{"a.b.foo.ck", "foo.ck", "b.foo.ck"},
+		{"www.ck", "ck", "www.ck"},
+		{"x.www.ck", "ck", "www.ck"},
+		{"example.org", "org", "example.org"},
+	}
+	for _, tc := range cases {
+		if got := l.PublicSuffix(tc.host); got != tc.suffix {
+			t.Errorf("PublicSuffix(%q) = %q, want %q", tc.host, got, tc.suffix)
+		}
+		if got := l.OrganizationalDomain(tc.host); got != tc.org {
+			t.Errorf("OrganizationalDomain(%q) = %q, want %q", tc.host, got, tc.org)
+		}
+	}
+}
+
+func TestParse_Empty(t *testing.T) {
+	if _, err := Parse(strings.NewReader("// only comments\n")); err == nil {
+		t.Fatal("expected an error for a list without rules")
+	}
+}
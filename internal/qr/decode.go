@@ -0,0 +1,423 @@
+package qr
+
+import (
+	"errors"
+	"math/bits"
+	"strings"
+	"unicode/utf8"
+
+	"golang.org/x/text/encoding/japanese"
+)
+
+// Segment modes.
+const (
+	modeTerminator   = 0
+	modeNumeric      = 1
+	modeAlphanumeric = 2
+	modeStructured   = 3
+	modeByte         = 4
+	modeFNC1First    = 5
+	modeECI          = 7
+	modeKanji        = 8
+	modeFNC1Second   = 9
+)
+
+var (
+	errFormat  = errors.New("qr: unreadable format information")
+	errVersion = errors.New("qr: unreadable version information")
+	errData    = errors.New("qr: malformed data")
+)
+
+// matrix is a square grid of modules, true for dark, indexed [row][col].
+type matrix [][]bool
+
+func newMatrix(size int) matrix {
+	m := make(matrix, size)
+	cells := make([]bool, size*size)
+	for i := range m {
+		m[i] = cells[i*size : (i+1)*size]
+	}
+	return m
+}
+
+func (m matrix) transpose() matrix {
+	t := newMatrix(len(m))
+	for y := range m {
+		for x := range m {
+			t[x][y] = m[y][x]
+		}
+	}
+	return t
+}
+
+// readFormat returns the error correction level and mask of m, taking the
+// closer of the two format copies to a valid word.
+func (m matrix) readFormat() (level, mask int, err error) {
+	size := len(m)
+	var a, b int
+	for i := 0; i < 15; i++ {
+		var x1, y1, x2, y2 int
+		switch {
+		case i < 6:
+			x1, y1 = 8, i
+		case i < 8:
+			x1, y1 = 8, i+1
+		case i == 8:
+			x1, y1 = 7, 8
+		default:
+			x1, y1 = 14-i, 8
+		}
+		if i < 8 {
+			x2, y2 = size-1-i, 8
+		} else {
+			x2, y2 = 8, size-15+i
+		}
+		if m[y1][x1] {
+			a |= 1 << i
+		}
+		if m[y2][x2] {
+			b |= 1 << i
+		}
+	}
+	best, bestDist := -1, 4
+	for data := 0; data < 32; data++ {
+		word := formatBits(data>>3, data&7)
+		for _, got := range []int{a, b} {
+			if d := bits.OnesCount(uint(word ^ got)); d < bestDist {
+				best, bestDist = data, d
+			}
+		}
+	}
+	if best < 0 {
+		return 0, 0, errFormat
+	}
+	return best >> 3, best & 7, nil
+}
+
+// readVersion decodes the version blocks of a version 7+ symbol.
+func (m matrix) readVersion() (int, error) {
+	size := len(m)
+	var a, b int
+	for i := 0; i < 18; i++ {
+		x, y := size-11+i%3, i/3
+		if m[y][x] {
+			a |= 1 << i
+		}
+		if m[x][y] {
+			b |= 1 << i
+		}
+	}
+	best, bestDist := 0, 4
+	for v := 7; v <= 40; v++ {
+		word := versionBits(v)
+		for _, got := range []int{a, b} {
+			if d := bits.OnesCount(uint(word ^ got)); d < bestDist {
+				best, bestDist = v, d
+			}
+		}
+	}
+	if best == 0 {
+		return 0, errVersion
+	}
+	return best, nil
+}
+
+// functionModules marks the finder, timing, alignment, format and version
+// areas, which carry no data.
+func functionModules(version int) matrix {
+	size := version*4 + 17
+	f := newMatrix(size)
+	fill := func(x0, y0, w, h int) {
+		for y := max(y0, 0); y < min(y0+h, size); y++ {
+			for x := max(x0, 0); x < min(x0+w, size); x++ {
+				f[y][x] = true
+			}
+		}
+	}
+	fill(0, 6, size, 1)
+	fill(6, 0, 1, size)
+	fill(0, 0, 9, 9)
+	fill(size-8, 0, 8, 9)
+	fill(0, size-8, 9, 8)
+	pos := alignmentPositions(version)
+	last := len(pos) - 1
+	for i := range pos {
+		for j := range pos {
+			if i == 0 && j == 0 || i == 0 && j == last || i == last && j == 0 {
+				continue
+			}
+			fill(pos[i]-2, pos[j]-2, 5, 5)
+		}
+	}
+	if version >= 7 {
+		fill(size-11, 0, 3, 6)
+		fill(0, size-11, 6, 3)
+	}
+	return f
+}
+
+func masked(mask, x, y int) bool {
+	switch mask {
+	case 0:
+		return (x+y)%2 == 0
+	case 1:
+		return y%2 == 0
+	case 2:
+		return x%3 == 0
+	case 3:
+		return (x+y)%3 == 0
+	case 4:
+		return (x/3+y/2)%2 == 0
+	case 5:
+		return x*y%2+x*y%3 == 0
+	case 6:
+		return (x*y%2+x*y%3)%2 == 0
+	default:
+		return ((x+y)%2+x*y%3)%2 == 0
+	}
+}
+
+// decode reads the symbol in m, whose size determines the version.
+func (m matrix) decode() (string, error) {
+	size := len(m)
+	version := (size - 17) / 4
+	if version < 1 || version > 40 || size != version*4+17 {
+		return "", errVersion
+	}
+	level, mask, err := m.readFormat()
+	if err != nil {
+		return "", err
+	}
+
+	// Codewords are laid out in two-module columns, zigzagging up and down
+	// from the bottom right corner and skipping the timing column.
+	function := functionModules(version)
+	raw := make([]byte, rawCodewords(version))
+	i := 0
+	for right := size - 1; right >= 1; right -= 2 {
+		if right == 6 {
+			right = 5
+		}
+		upward := (right+1)&2 == 0
+		for vert := 0; vert < size; vert++ {
+			y := vert
+			if upward {
+				y = size - 1 - vert
+			}
+			for j := 0; j < 2; j++ {
+				x := right - j
+				if function[y][x] || i >= len(raw)*8 {
+					continue
+				}
+				if m[y][x] != masked(mask, x, y) {
+					raw[i>>3] |= 0x80 >> (i & 7)
+				}
+				i++
+			}
+		}
+	}
+
+	data, err := deinterleave(raw, version, level)
+	if err != nil {
+		return "", err
+	}
+	return parseSegments(data, version)
+}
+
+// deinterleave splits the codewords into their blocks, corrects each and
+// returns the data codewords in order.
+func deinterleave(raw []byte, version, level int) ([]byte, error) {
+	nb, ecc := numBlocks[level][version], eccPerBlock[level][version]
+	shortLen := len(raw) / nb
+	numShort := nb - len(raw)%nb
+	shortData := shortLen - ecc
+
+	// Short blocks hold one data codeword less; the gap is skipped while
+	// reading the interleaved stream.
+	blocks := make([][]byte, nb)
+	for j := range blocks {
+		blocks[j] = make([]byte, shortLen+1)
+	}
+	k := 0
+	for i := 0; i <= shortLen; i++ {
+		for j := range blocks {
+			if i == shortData && j < numShort {
+				continue
+			}
+			blocks[j][i] = raw[k]
+			k++
+		}
+	}
+
+	var data []byte
+	for j, b := range blocks {
+		if j < numShort {
+			b = append(b[:shortData], b[shortData+1:]...)
+		}
+		if err := correct(b, ecc); err != nil {
+			return nil, err
+		}
+		data = append(data, b[:len(b)-ecc]...)
+	}
+	return data, nil
+}
+
+type bitReader struct {
+	data []byte
+	pos  int
+}
+
+func (r *bitReader) left() int { return len(r.data)*8 - r.pos }
+
+func (r *bitReader) read(n int) int {
+	v := 0
+	for ; n > 0; n-- {
+		v <<= 1
+		if r.data[r.pos>>3]&(0x80>>(r.pos&7)) != 0 {
+			v |= 1
+		}
+		r.pos++
+	}
+	return v
+}
+
+// parseSegments decodes the data codewords. Byte segments are taken as
+// UTF-8 when valid, as the encoders in use write it regardless of ECI, and
+// as ISO-8859-1 otherwise.
+func parseSegments(data []byte, version int) (string, error) {
+	r := &bitReader{data: data}
+	var out strings.Builder
+	var bytes []byte
+	flush := func() {
+		if utf8.Valid(bytes) {
+			out.Write(bytes)
+		} else {
+			for _, c := range bytes {
+				out.WriteRune(rune(c))
+			}
+		}
+		bytes = bytes[:0]
+	}
+	for r.left() >= 4 {
+		mode := r.read(4)
+		if mode != modeByte {
+			flush()
+		}
+		switch mode {
+		case modeTerminator:
+			return out.String(), nil
+		case modeFNC1First:
+		case modeFNC1Second:
+			if r.left() < 8 {
+				return "", errData
+			}
+			r.read(8)
+		case modeStructured:
+			if r.left() < 16 {
+				return "", errData
+			}
+			r.read(16)
+		case modeECI:
+			if r.left() < 8 {
+				return "", errData
+			}
+			switch first := r.read(8); {
+			case first&0x80 == 0:
+			case first&0xc0 == 0x80 && r.left() >= 8:
+				r.read(8)
+			case first&0xe0 == 0xc0 && r.left() >= 16:
+				r.read(16)
+			default:
+				return "", errData
+			}
+		case modeNumeric, modeAlphanumeric, modeByte, modeKanji:
+			cb := countBits(mode, version)
+			if r.left() < cb {
+				return "", errData
+			}
+			if err := readSegment(r, mode, r.read(cb), &out, &bytes); err != nil {
+				return "", err
+			}
+		default:
+			return "", errData
+		}
+	}
+	flush()
+	return out.String(), nil
+}
+
+func readSegment(r *bitReader, mode, count int, out *strings.Builder, bytes *[]byte) error {
+	switch mode {
+	case modeNumeric:
+		for count > 0 {
+			n, digits := 10, 3
+			if count == 2 {
+				n, digits = 7, 2
+			} else if count == 1 {
+				n, digits = 4, 1
+			}
+			if r.left() < n {
+				return errData
+			}
+			v := r.read(n)
+			s := []byte{byte('0' + v/100%10), byte('0' + v/10%10), byte('0' + v%10)}
+			if v >= [4]int{0, 10, 100, 1000}[digits] {
+				return errData
+			}
+			out.Write(s[3-digits:])
+			count -= digits
+		}
+	case modeAlphanumeric:
+		for count > 0 {
+			if count == 1 {
+				if r.left() < 6 {
+					return errData
+				}
+				v := r.read(6)
+				if v >= 45 {
+					return errData
+				}
+				out.WriteByte(alphanumericChars[v])
+				break
+			}
+			if r.left() < 11 {
+				return errData
+			}
+			v := r.read(11)
+			if v >= 45*45 {
+				return errData
+			}
+			out.WriteByte(alphanumericChars[v/45])
+			out.WriteByte(alphanumericChars[v%45])
+			count -= 2
+		}
+	case modeByte:
+		if r.left() < count*8 {
+			return errData
+		}
+		for ; count > 0; count-- {
+			*bytes = append(*bytes, byte(r.read(8)))
+		}
+	case modeKanji:
+		if r.left() < count*13 {
+			return errData
+		}
+		sjis := make([]byte, 0, count*2)
+		for ; count > 0; count-- {
+			v := r.read(13)
+			c := v/0xc0<<8 | v%0xc0
+			if c < 0x1f00 {
+				c += 0x8140
+			} else {
+				c += 0xc140
+			}
+			sjis = append(sjis, byte(c>>8), byte(c))
+		}
+		s, err := japanese.ShiftJIS.NewDecoder().Bytes(sjis)
+		if err != nil {
+			return errData
+		}
+		out.Write(s)
+	}
+	return nil
+}
@@ -0,0 +1,386 @@
+package qr
+
+import (
+	"image"
+	"math"
+	"sort"
+)
+
+// bitmap is a binarized image, true for dark pixels.
+type bitmap struct {
+	w, h int
+	pix  []bool
+}
+
+func (b *bitmap) at(x, y int) bool {
+	if x < 0 || y < 0 || x >= b.w || y >= b.h {
+		return false
+	}
+	return b.pix[y*b.w+x]
+}
+
+func (b *bitmap) invert() *bitmap {
+	inv := &bitmap{w: b.w, h: b.h, pix: make([]bool, len(b.pix))}
+	for i, p := range b.pix {
+		inv.pix[i] = !p
+	}
+	return inv
+}
+
+// maxSide bounds the image side scanned; larger images are shrunk.
+const maxSide = 2048
+
+// grayscale converts img to 8-bit luminance, averaging blocks of pixels
+// when the image is larger than maxSide.
+func grayscale(img image.Image) (gray []uint8, w, h int) {
+	bounds := img.Bounds()
+	scale := 1
+	for bounds.Dx()/scale > maxSide || bounds.Dy()/scale > maxSide {
+		scale++
+	}
+	w, h = bounds.Dx()/scale, bounds.Dy()/scale
+	gray = make([]uint8, w*h)
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			var sum, n uint32
+			for dy := 0; dy < scale; dy++ {
+				for dx := 0; dx < scale; dx++ {
+					r, g, b, a := img.At(bounds.Min.X+x*scale+dx, bounds.Min.Y+y*scale+dy).RGBA()
+					// Transparent pixels are shown on a white background.
+					lum := (299*r + 587*g + 114*b) / 1000
+					lum = lum + (0xffff - a)
+					sum += min(lum, 0xffff) >> 8
+					n++
+				}
+			}
+			gray[y*w+x] = uint8(sum / n)
+		}
+	}
+	return gray, w, h
+}
+
+// otsu binarizes with the global threshold that best separates the two
+// luminance classes; fine for rendered codes on a plain background.
+func otsu(gray []uint8, w, h int) *bitmap {
+	var hist [256]int
+	for _, g := range gray {
+		hist[g]++
+	}
+	total := len(gray)
+	var sum float64
+	for i, n := range hist {
+		sum += float64(i * n)
+	}
+	var sumB float64
+	wB, best, threshold := 0, 0.0, 128
+	for t := 0; t < 256; t++ {
+		wB += hist[t]
+		if wB == 0 {
+			continue
+		}
+		wF := total - wB
+		if wF == 0 {
+			break
+		}
+		sumB += float64(t * hist[t])
+		mB, mF := sumB/float64(wB), (sum-sumB)/float64(wF)
+		if between := float64(wB) * float64(wF) * (mB - mF) * (mB - mF); between > best {
+			best, threshold = between, t
+		}
+	}
+	b := &bitmap{w: w, h: h, pix: make([]bool, len(gray))}
+	for i, g := range gray {
+		b.pix[i] = int(g) <= threshold
+	}
+	return b
+}
+
+// adaptive binarizes against the mean of a window around each pixel,
+// which copes with shading and gradients that defeat a global threshold.
+func adaptive(gray []uint8, w, h int) *bitmap {
+	integral := make([]int, (w+1)*(h+1))
+	for y := 0; y < h; y++ {
+		row := 0
+		for x := 0; x < w; x++ {
+			row += int(gray[y*w+x])
+			integral[(y+1)*(w+1)+x+1] = integral[y*(w+1)+x+1] + row
+		}
+	}
+	r := max(min(w, h)/16, 4)
+	b := &bitmap{w: w, h: h, pix: make([]bool, len(gray))}
+	for y := 0; y < h; y++ {
+		y0, y1 := max(y-r, 0), min(y+r+1, h)
+		for x := 0; x < w; x++ {
+			x0, x1 := max(x-r, 0), min(x+r+1, w)
+			s := integral[y1*(w+1)+x1] - integral[y0*(w+1)+x1] - integral[y1*(w+1)+x0] + integral[y0*(w+1)+x0]
+			mean := s / ((x1 - x0) * (y1 - y0))
+			b.pix[y*w+x] = int(gray[y*w+x])*100 < mean*92
+		}
+	}
+	return b
+}
+
+// finder is a candidate finder pattern centre.
+type finder struct {
+	x, y   float64
+	module float64 // estimated module size in pixels
+	count  int     // rows that confirmed it
+}
+
+// ratioOK reports whether five run lengths look like the 1:1:3:1:1 dark,
+// light, dark, light, dark profile of a finder pattern.
+func ratioOK(runs [5]int) bool {
+	total := 0
+	for _, r := range runs {
+		if r == 0 {
+			return false
+		}
+		total += r
+	}
+	if total < 7 {
+		return false
+	}
+	module := float64(total) / 7
+	tol := module / 2
+	for i, r := range runs {
+		want := module
+		if i == 2 {
+			want = 3 * module
+		}
+		if math.Abs(float64(r)-want) > tol*(want/module) {
+			return false
+		}
+	}
+	return true
+}
+
+// crossCheck counts the five runs through (x, y) along (dx, dy), returning
+// the centre offset of the middle run and the total length, or ok=false.
+func (b *bitmap) crossCheck(x, y, dx, dy, maxRun int) (center float64, total int, ok bool) {
+	if !b.at(x, y) {
+		return 0, 0, false
+	}
+	var runs [5]int
+	// Backwards from the centre: middle dark, light, outer dark.
+	i := 0
+	for ; b.at(x-i*dx, y-i*dy) && runs[2] <= maxRun; i++ {
+		runs[2]++
+	}
+	start := i
+	for ; !b.at(x-i*dx, y-i*dy) && runs[1] <= maxRun && inside(b, x-i*dx, y-i*dy); i++ {
+		runs[1]++
+	}
+	for ; b.at(x-i*dx, y-i*dy) && runs[0] <= maxRun; i++ {
+		runs[0]++
+	}
+	j := 1
+	for ; b.at(x+j*dx, y+j*dy) && runs[2] <= maxRun; j++ {
+		runs[2]++
+	}
+	end := j
+	for ; !b.at(x+j*dx, y+j*dy) && runs[3] <= maxRun && inside(b, x+j*dx, y+j*dy); j++ {
+		runs[3]++
+	}
+	for ; b.at(x+j*dx, y+j*dy) && runs[4] <= maxRun; j++ {
+		runs[4]++
+	}
+	if !ratioOK(runs) {
+		return 0, 0, false
+	}
+	for _, r := range runs {
+		total += r
+	}
+	// The middle run covers offsets -(start-1) to end-1.
+	return float64(end-start) / 2, total, true
+}
+
+func inside(b *bitmap, x, y int) bool {
+	return x >= 0 && y >= 0 && x < b.w && y < b.h
+}
+
+// maxFinders bounds the finder candidates collected from one bitmap, so
+// that an image tiled with finder patterns cannot make merging quadratic.
+const maxFinders = 64
+
+// findFinders scans every row for the finder profile and confirms each hit
+// vertically, then horizontally again through the refined centre. It stops
+// once maxFinders candidates were found.
+func (b *bitmap) findFinders() []finder {
+	var found []finder
+	runs := make([]int, 0, 64)
+	starts := make([]int, 0, 64)
+	for y := 0; y < b.h; y++ {
+		runs, starts = runs[:0], starts[:0]
+		for x := 0; x < b.w; {
+			start, dark := x, b.at(x, y)
+			for x < b.w && b.at(x, y) == dark {
+				x++
+			}
+			if len(runs) == 0 && !dark {
+				continue
+			}
+			runs = append(runs, x-start)
+			starts = append(starts, start)
+		}
+		// runs alternate starting with dark, so dark runs have even indices.
+		for i := 0; i+4 < len(runs); i += 2 {
+			window := [5]int{runs[i], runs[i+1], runs[i+2], runs[i+3], runs[i+4]}
+			if !ratioOK(window) {
+				continue
+			}
+			hTotal := window[0] + window[1] + window[2] + window[3] + window[4]
+			cx := starts[i+2] + runs[i+2]/2
+			dy, vTotal, ok := b.crossCheck(cx, y, 0, 1, hTotal)
+			if !ok || 5*abs(vTotal-hTotal) > 2*hTotal {
+				continue
+			}
+			cy := int(math.Round(float64(y) + dy))
+			dx, hTotal2, ok := b.crossCheck(cx, cy, 1, 0, hTotal)
+			if !ok {
+				continue
+			}
+			f := finder{x: float64(cx) + dx + 0.5, y: float64(y) + dy + 0.5, module: float64(hTotal2+vTotal) / 14, count: 1}
+			if found = merge(found, f); len(found) >= maxFinders {
+				return found
+			}
+		}
+	}
+	return found
+}
+
+func merge(found []finder, f finder) []finder {
+	for i := range found {
+		g := &found[i]
+		if math.Abs(g.x-f.x) <= g.module && math.Abs(g.y-f.y) <= g.module && math.Abs(g.module-f.module) <= math.Max(1, g.module/2) {
+			n := float64(g.count)
+			g.x = (g.x*n + f.x) / (n + 1)
+			g.y = (g.y*n + f.y) / (n + 1)
+			g.module = (g.module*n + f.module) / (n + 1)
+			g.count++
+			return found
+		}
+	}
+	return append(found, f)
+}
+
+func abs(x int) int {
+	if x < 0 {
+		return -x
+	}
+	return x
+}
+
+func dist(a, b finder) float64 {
+	return math.Hypot(a.x-b.x, a.y-b.y)
+}
+
+// maxCandidates bounds the finder candidates combined into triplets.
+const maxCandidates = 16
+
+// triplets returns the groups of three candidates that could be the
+// top-left, top-right and bottom-left finders of one symbol, best first.
+func triplets(found []finder) [][3]finder {
+	sort.SliceStable(found, func(i, j int) bool { return found[i].count > found[j].count })
+	if len(found) > maxCandidates {
+		found = found[:maxCandidates]
+	}
+	type scored struct {
+		t     [3]finder
+		score float64
+	}
+	var out []scored
+	for i := 0; i < len(found); i++ {
+		for j := i + 1; j < len(found); j++ {
+			for k := j + 1; k < len(found); k++ {
+				t, score, ok := orient(found[i], found[j], found[k])
+				if ok {
+					out = append(out, scored{t, score})
+				}
+			}
+		}
+	}
+	sort.SliceStable(out, func(i, j int) bool { return out[i].score < out[j].score })
+	res := make([][3]finder, len(out))
+	for i, s := range out {
+		res[i] = s.t
+	}
+	return res
+}
+
+// orient orders three finders as top-left, top-right, bottom-left: the
+// top-left one faces the longest side, and the other two follow the
+// reading direction. The score measures how far they are from the corners
+// of a square.
+func orient(a, b, c finder) ([3]finder, float64, bool) {
+	lo, hi := math.Min(a.module, math.Min(b.module, c.module)), math.Max(a.module, math.Max(b.module, c.module))
+	if hi > 2*lo {
+		return [3]finder{}, 0, false
+	}
+	ab, bc, ac := dist(a, b), dist(b, c), dist(a, c)
+	var tl, p, q finder
+	switch {
+	case bc >= ab && bc >= ac:
+		tl, p, q = a, b, c
+	case ac >= ab && ac >= bc:
+		tl, p, q = b, a, c
+	default:
+		tl, p, q = c, a, b
+	}
+	d1, d2 := dist(tl, p), dist(tl, q)
+	hyp := dist(p, q)
+	module := (a.module + b.module + c.module) / 3
+	if d1 < 7*module || d2 < 7*module {
+		return [3]finder{}, 0, false
+	}
+	sideErr := math.Abs(d1-d2) / math.Max(d1, d2)
+	hypErr := math.Abs(hyp*hyp-d1*d1-d2*d2) / (hyp * hyp)
+	if sideErr > 0.25 || hypErr > 0.25 {
+		return [3]finder{}, 0, false
+	}
+	// In image coordinates (y down) the top-right finder is clockwise from
+	// the bottom-left one as seen from the top-left.
+	if (p.x-tl.x)*(q.y-tl.y)-(p.y-tl.y)*(q.x-tl.x) < 0 {
+		p, q = q, p
+	}
+	return [3]finder{tl, p, q}, sideErr + hypErr, true
+}
+
+// dimensions lists the symbol sizes to try for a triplet, the estimate
+// from the finder spacing first.
+func dimensions(t [3]finder) []int {
+	module := (t[0].module + t[1].module + t[2].module) / 3
+	est := int(math.Round((dist(t[0], t[1])/module+dist(t[0], t[2])/module)/2)) + 7
+	switch est % 4 {
+	case 0:
+		est++
+	case 2:
+		est--
+	case 3:
+		est -= 2
+	}
+	var dims []int
+	for _, d := range []int{est, est + 4, est - 4, est + 8, est - 8} {
+		if d >= 21 && d <= 177 {
+			dims = append(dims, d)
+		}
+	}
+	return dims
+}
+
+// sample reads a dim×dim module grid, mapping grid coordinates onto the
+// image through the affine frame spanned by the three finder centres.
+func (b *bitmap) sample(t [3]finder, dim int) matrix {
+	m := newMatrix(dim)
+	tl, tr, bl := t[0], t[1], t[2]
+	span := float64(dim - 7)
+	for r := 0; r < dim; r++ {
+		for c := 0; c < dim; c++ {
+			u := (float64(c) + 0.5 - 3.5) / span
+			v := (float64(r) + 0.5 - 3.5) / span
+			x := tl.x + u*(tr.x-tl.x) + v*(bl.x-tl.x)
+			y := tl.y + u*(tr.y-tl.y) + v*(bl.y-tl.y)
+			m[r][c] = b.at(int(math.Floor(x)), int(math.Floor(y)))
+		}
+	}
+	return m
+}
@@ -0,0 +1,77 @@
+// Package qr finds and decodes QR codes in images. It targets codes that
+// were rendered rather than photographed, as in email images and PDFs:
+// any rotation, scale, mirroring or colour inversion, but no perspective
+// distortion. Damaged modules are repaired with the code's Reed-Solomon
+// error correction.
+package qr
+
+import (
+	"image"
+)
+
+// Decode returns the contents of every QR code found in img. A nil result
+// means none could be read.
+func Decode(img image.Image) []string {
+	gray, w, h := grayscale(img)
+	if w < 21 || h < 21 {
+		return nil
+	}
+	var out []string
+	seen := map[string]bool{}
+	for _, bin := range []func([]uint8, int, int) *bitmap{otsu, adaptive} {
+		b := bin(gray, w, h)
+		for _, bm := range []*bitmap{b, b.invert()} {
+			for _, s := range bm.decodeAll() {
+				if !seen[s] {
+					seen[s] = true
+					out = append(out, s)
+				}
+			}
+		}
+		if len(out) > 0 {
+			break
+		}
+	}
+	return out
+}
+
+// decodeAll tries the finder triplets in order of fit; finders of a code
+// that was read are not reused.
+func (b *bitmap) decodeAll() []string {
+	var out []string
+	used := map[finder]bool{}
+	for _, t := range triplets(b.findFinders()) {
+		if used[t[0]] || used[t[1]] || used[t[2]] {
+			continue
+		}
+		if s, ok := b.decodeTriplet(t); ok {
+			out = append(out, s)
+			used[t[0]], used[t[1]], used[t[2]] = true, true, true
+		}
+	}
+	return out
+}
+
+func (b *bitmap) decodeTriplet(t [3]finder) (string, bool) {
+	tried := map[int]bool{}
+	for _, dim := range dimensions(t) {
+		m := b.sample(t, dim)
+		if version := (dim - 17) / 4; version >= 7 {
+			// The version blocks are more reliable than the estimate.
+			if v, err := m.readVersion(); err == nil && v != version {
+				dim = v*4 + 17
+				m = b.sample(t, dim)
+			}
+		}
+		if tried[dim] {
+			continue
+		}
+		tried[dim] = true
+		for _, mm := range []matrix{m, m.transpose()} {
+			if s, err := mm.decode(); err == nil {
+				return s, true
+			}
+		}
+	}
+	return "", false
+}
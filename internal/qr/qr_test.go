@@ -0,0 +1,167 @@
+package qr
+
+import (
+	"bytes"
+	"image"
+	"image/color"
+	"image/draw"
+	"image/jpeg"
+	_ "image/png"
+	"math"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"testing"
+)
+
+// The fixtures were rendered by an independent encoder
+// (github.com/skip2/go-qrcode).
+var fixtures = map[string]string{
+	"url_m":     "https://igsu-alert-system.net/verificare?id=4471",
+	"alnum_h":   "HTTPS://EXAMPLE.COM/ABC-123",
+	"numeric_l": "0123456789012345678901234567890",
+	"utf8_q":    "Plătiți amenda: https://amenzi-ro.example/plata?ref=ĂÎȘȚ",
+	"long_l":    "https://login.evil.example/o365/auth?session=" + strings.Repeat("a1b2c3d4e5", 30),
+}
+
+func load(t *testing.T, name string) image.Image {
+	t.Helper()
+	f, err := os.Open(filepath.Join("testdata", name+".png"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	img, _, err := image.Decode(f)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return img
+}
+
+func TestDecodeFixtures(t *testing.T) {
+	for name, want := range fixtures {
+		got := Decode(load(t, name))
+		if len(got) != 1 || got[0] != want {
+			t.Errorf("%s: got %q, want %q", name, got, want)
+		}
+	}
+}
+
+// transform renders src into a w×h white canvas; at maps a canvas pixel
+// to the source pixel shown there.
+func transform(src image.Image, w, h int, at func(x, y float64) (float64, float64)) *image.Gray {
+	dst := image.NewGray(image.Rect(0, 0, w, h))
+	b := src.Bounds()
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			sx, sy := at(float64(x)+0.5, float64(y)+0.5)
+			p := image.Pt(int(math.Floor(sx)), int(math.Floor(sy)))
+			v := color.GrayModel.Convert(color.White).(color.Gray)
+			if p.In(b) {
+				v = color.GrayModel.Convert(src.At(p.X, p.Y)).(color.Gray)
+			}
+			dst.SetGray(x, y, v)
+		}
+	}
+	return dst
+}
+
+func TestDecodeTransformed(t *testing.T) {
+	src := load(t, "url_m")
+	want := fixtures["url_m"]
+	n := float64(src.Bounds().Dx())
+
+	rotate := func(deg float64) *image.Gray {
+		a := deg * math.Pi / 180
+		c := n * 0.75
+		return transform(src, int(n*1.5), int(n*1.5), func(x, y float64) (float64, float64) {
+			dx, dy := x-c, y-c
+			return dx*math.Cos(a) + dy*math.Sin(a) + n/2, -dx*math.Sin(a) + dy*math.Cos(a) + n/2
+		})
+	}
+	inverted := image.NewGray(src.Bounds())
+	for y := 0; y < int(n); y++ {
+		for x := 0; x < int(n); x++ {
+			g := color.GrayModel.Convert(src.At(x, y)).(color.Gray)
+			inverted.SetGray(x, y, color.Gray{Y: 255 - g.Y})
+		}
+	}
+	// skip2 renders a 4-module quiet zone; 256px at version 4 is 6px a module.
+	damaged := transform(src, int(n), int(n), func(x, y float64) (float64, float64) { return x, y })
+	for y := 150; y < 170; y++ {
+		for x := 150; x < 175; x++ {
+			damaged.SetGray(x, y, color.Gray{Y: 255})
+		}
+	}
+	var jpegBuf bytes.Buffer
+	jpeg.Encode(&jpegBuf, src, &jpeg.Options{Quality: 40})
+	jpegImg, _ := jpeg.Decode(&jpegBuf)
+
+	cases := map[string]image.Image{
+		"rotated 90":               rotate(90),
+		"rotated 180":              rotate(180),
+		"rotated 23":               rotate(23),
+		"scaled down":              transform(src, int(n/2), int(n/2), func(x, y float64) (float64, float64) { return x * 2, y * 2 }),
+		"mirrored":                 transform(src, int(n), int(n), func(x, y float64) (float64, float64) { return n - x, y }),
+		"inverted":                 inverted,
+		"damaged":                  damaged,
+		"jpeg":                     jpegImg,
+		"offset in a larger image": transform(src, 900, 500, func(x, y float64) (float64, float64) { return x - 500, y - 120 }),
+	}
+	for name, img := range cases {
+		if got := Decode(img); len(got) != 1 || got[0] != want {
+			t.Errorf("%s: got %q", name, got)
+		}
+	}
+}
+
+func TestDecodeTwoCodes(t *testing.T) {
+	a, b := load(t, "url_m"), load(t, "alnum_h")
+	img := image.NewGray(image.Rect(0, 0, 520, 300))
+	draw.Draw(img, img.Bounds(), image.White, image.Point{}, draw.Src)
+	draw.Draw(img, image.Rect(0, 0, 256, 256), a, image.Point{}, draw.Src)
+	draw.Draw(img, image.Rect(300, 40, 500, 240), b, image.Point{}, draw.Src)
+	got := Decode(img)
+	sort.Strings(got)
+	if len(got) != 2 || got[0] != fixtures["alnum_h"] || got[1] != fixtures["url_m"] {
+		t.Errorf("got %q", got)
+	}
+}
+
+func TestDecodeNothing(t *testing.T) {
+	img := image.NewGray(image.Rect(0, 0, 200, 100))
+	for y := 0; y < 100; y++ {
+		for x := 0; x < 200; x++ {
+			img.SetGray(x, y, color.Gray{Y: uint8((x*7 + y*13) % 256)})
+		}
+	}
+	if got := Decode(img); got != nil {
+		t.Errorf("expected nothing, got %q", got)
+	}
+}
+
+func TestFindFindersBounded(t *testing.T) {
+	// 20x20 finder patterns of 7 modules of 2 pixels, 2 modules apart.
+	const module, pitch = 2, 9 * 2
+	img := image.NewGray(image.Rect(0, 0, 20*pitch, 20*pitch))
+	draw.Draw(img, img.Bounds(), image.White, image.Point{}, draw.Src)
+	for ty := 0; ty < 20; ty++ {
+		for tx := 0; tx < 20; tx++ {
+			for my := 0; my < 7; my++ {
+				for mx := 0; mx < 7; mx++ {
+					ring := max(abs(mx-3), abs(my-3))
+					if ring == 2 {
+						continue
+					}
+					r := image.Rect(tx*pitch+mx*module, ty*pitch+my*module, tx*pitch+(mx+1)*module, ty*pitch+(my+1)*module)
+					draw.Draw(img, r, image.Black, image.Point{}, draw.Src)
+				}
+			}
+		}
+	}
+	gray, w, h := grayscale(img)
+	if n := len(otsu(gray, w, h).findFinders()); n != maxFinders {
+		t.Errorf("%d finder candidates, want the cap of %d", n, maxFinders)
+	}
+}
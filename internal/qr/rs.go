@@ -0,0 +1,137 @@
+package qr
+
+import "errors"
+
+var errTooManyErrors = errors.New("qr: too many errors to correct")
+
+// GF(256) with the QR polynomial x^8 + x^4 + x^3 + x^2 + 1 and generator 2.
+var gfExp, gfLog [512]byte
+
+func init() {
+	x := 1
+	for i := 0; i < 255; i++ {
+		gfExp[i] = byte(x)
+		gfLog[x] = byte(i)
+		x <<= 1
+		if x&0x100 != 0 {
+			x ^= 0x11d
+		}
+	}
+	for i := 255; i < 512; i++ {
+		gfExp[i] = gfExp[i-255]
+	}
+}
+
+func gfMul(a, b byte) byte {
+	if a == 0 || b == 0 {
+		return 0
+	}
+	return gfExp[int(gfLog[a])+int(gfLog[b])]
+}
+
+func gfDiv(a, b byte) byte {
+	if a == 0 {
+		return 0
+	}
+	return gfExp[int(gfLog[a])+255-int(gfLog[b])]
+}
+
+// evalPoly evaluates p, lowest degree first, at x.
+func evalPoly(p []byte, x byte) byte {
+	var y byte
+	for i := len(p) - 1; i >= 0; i-- {
+		y = gfMul(y, x) ^ p[i]
+	}
+	return y
+}
+
+// correct fixes up to ecc/2 byte errors in block, whose last ecc bytes are
+// the Reed-Solomon check bytes. block[0] is the highest degree coefficient.
+func correct(block []byte, ecc int) error {
+	n := len(block)
+	// Syndromes S_j = c(α^j); the generator's roots start at α^0.
+	syn := make([]byte, ecc)
+	clean := true
+	for j := range syn {
+		var s byte
+		for _, c := range block {
+			s = gfMul(s, gfExp[j]) ^ c
+		}
+		syn[j] = s
+		clean = clean && s == 0
+	}
+	if clean {
+		return nil
+	}
+
+	// Berlekamp-Massey: the error locator Λ, lowest degree first.
+	lambda, prev := []byte{1}, []byte{1}
+	l, m, b := 0, 1, byte(1)
+	for k := 0; k < ecc; k++ {
+		d := syn[k]
+		for i := 1; i <= l && i < len(lambda); i++ {
+			d ^= gfMul(lambda[i], syn[k-i])
+		}
+		if d == 0 {
+			m++
+			continue
+		}
+		t := append([]byte(nil), lambda...)
+		coef := gfDiv(d, b)
+		for len(lambda) < len(prev)+m {
+			lambda = append(lambda, 0)
+		}
+		for i, p := range prev {
+			lambda[i+m] ^= gfMul(coef, p)
+		}
+		if 2*l <= k {
+			l, prev, b, m = k+1-l, t, d, 1
+		} else {
+			m++
+		}
+	}
+	if 2*l > ecc {
+		return errTooManyErrors
+	}
+
+	// Ω = S·Λ mod x^ecc, and Λ' for Forney's formula.
+	omega := make([]byte, ecc)
+	for i := range omega {
+		for j := 0; j <= i && j < len(lambda); j++ {
+			omega[i] ^= gfMul(lambda[j], syn[i-j])
+		}
+	}
+	deriv := make([]byte, len(lambda))
+	for i := 1; i < len(lambda); i += 2 {
+		deriv[i-1] = lambda[i]
+	}
+
+	// Chien search over the positions of the block.
+	found := 0
+	for i := 0; i < n; i++ {
+		power := n - 1 - i // block[i] is the coefficient of x^power
+		xInv := gfExp[(255-power)%255]
+		if evalPoly(lambda, xInv) != 0 {
+			continue
+		}
+		den := evalPoly(deriv, xInv)
+		if den == 0 {
+			return errTooManyErrors
+		}
+		block[i] ^= gfMul(gfExp[power], gfDiv(evalPoly(omega, xInv), den))
+		found++
+	}
+	if found != l {
+		return errTooManyErrors
+	}
+	for j := 0; j < ecc; j++ {
+		var s byte
+		for _, c := range block {
+			s = gfMul(s, gfExp[j]) ^ c
+		}
+		if s != 0 {
+			return errTooManyErrors
+		}
+	}
+	return nil
+}
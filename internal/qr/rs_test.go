@@ -0,0 +1,57 @@
+package qr
+
+import (
+	"bytes"
+	"math/rand"
+	"testing"
+)
+
+// rsEncode appends ecc check bytes to data (generator roots α^0..α^(ecc-1)).
+func rsEncode(data []byte, ecc int) []byte {
+	gen := []byte{1}
+	for i := 0; i < ecc; i++ {
+		next := make([]byte, len(gen)+1)
+		for j, g := range gen {
+			next[j] ^= g
+			next[j+1] ^= gfMul(g, gfExp[i])
+		}
+		gen = next
+	}
+	rem := make([]byte, ecc)
+	for _, d := range data {
+		f := d ^ rem[0]
+		copy(rem, rem[1:])
+		rem[ecc-1] = 0
+		for j := range rem {
+			rem[j] ^= gfMul(gen[j+1], f)
+		}
+	}
+	return append(append([]byte{}, data...), rem...)
+}
+
+func TestCorrect(t *testing.T) {
+	rng := rand.New(rand.NewSource(1))
+	data := make([]byte, 40)
+	rng.Read(data)
+	const ecc = 16
+	block := rsEncode(data, ecc)
+	if err := correct(append([]byte{}, block...), ecc); err != nil {
+		t.Fatalf("clean block rejected: %v", err)
+	}
+	for errs := 1; errs <= ecc/2; errs++ {
+		damaged := append([]byte{}, block...)
+		for _, i := range rng.Perm(len(block))[:errs] {
+			damaged[i] ^= byte(rng.Intn(255) + 1)
+		}
+		if err := correct(damaged, ecc); err != nil || !bytes.Equal(damaged, block) {
+			t.Errorf("%d errors: not corrected (%v)", errs, err)
+		}
+	}
+	damaged := append([]byte{}, block...)
+	for _, i := range rng.Perm(len(block))[:ecc/2+2] {
+		damaged[i] ^= 0x5a
+	}
+	if err := correct(damaged, ecc); err == nil && !bytes.Equal(damaged, block) {
+		t.Error("too many errors were silently miscorrected")
+	}
+}
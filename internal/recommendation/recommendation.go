@@ -1,10 +1,13 @@
 package recommendation
 
 import (
+	"errors"
 	"fmt"
 	"strings"
 
 	"spamfilter/internal/adversarial"
+	"spamfilter/internal/attachment"
+	"spamfilter/internal/clamav"
 	"spamfilter/internal/email"
 	"spamfilter/internal/llm"
 	"spamfilter/internal/spamassassin"
@@ -13,30 +16,114 @@ import (
 type Scorecard struct {
 	Status        string
 	DecisionScore float64 // 0.0 (clean) - 10.0 (spam)
+	Action        Action
+	Category      string // the LLM category, when its verdict was trusted
 	Details       ResultDetails
 	Reasons       []string
 }
 
+// Action is what to do with a message once it is scored.
+type Action string
+
+const (
+	ActionDeliver    Action = "deliver"
+	ActionBulk       Action = "bulk" // deliver to the bulk folder
+	ActionJunk       Action = "junk"
+	ActionQuarantine Action = "quarantine" // hold for review
+	ActionReport     Action = "report"     // quarantine and send the indicators to the SOC
+	ActionVerify     Action = "verify"     // hold until the request is confirmed out of band
+	ActionIsolate    Action = "isolate"    // malware
+)
+
+// categoryActions refines the action for a message that is not clean
+// by the threat the LLM saw in it.
+var categoryActions = map[string]Action{
+	llm.CategoryPhishing:  ActionReport,
+	llm.CategoryFakeAlert: ActionReport,
+	llm.CategoryBEC:       ActionVerify,
+	llm.CategoryMalware:   ActionIsolate,
+	llm.CategoryScam:      ActionJunk,
+}
+
 type ResultDetails struct {
-	DKIM         string
-	SPF          string
-	Domain       string
-	LLMScore     *llm.Score
-	SpamAssassin *spamassassin.Result
-	Adversarial  *adversarial.Result
+	DKIM          string
+	SPF           string
+	Domain        string
+	LLMScore      *llm.Score
+	LLMError      string // why the LLM gave no score, e.g. an unusable answer
+	LLMPrompt     string // ID of the prompt template the LLM was asked with
+	LLMCache      string // "hit" when the LLM verdict came from the cache, "miss" when it did not
+	LLMVotes      []llm.Vote
+	LLMDisagree   float64 // share of the ensemble's weight against its verdict
+	LLMSkipped    string  // why the LLM was not asked, see Cascade
+	SpamAssassin  *spamassassin.Result
+	Adversarial   *adversarial.Result
+	Impersonation *email.ImpersonationCheck
+	Headers       *email.HeaderCheck
+	SourceIP      *email.IPCheck
+	Links         *email.LinkCheck
+	Attachments   *attachment.Report
+	Calendar      *email.CalendarCheck
+	ClamAV        *clamav.Report
+	Nested        []Nested
+}
+
+// Nested is the outcome of the content checks on a message attached to
+// the one being scored, at any depth.
+type Nested struct {
+	Path     string // e.g. "Fwd.eml/invoice.eml"
+	From     string
+	Subject  string
+	Findings []email.Finding
+}
+
+// Input carries the outcome of every check run against a message.
+// Optional checks are nil when they were skipped or unavailable.
+type Input struct {
+	DKIM          []email.DKIMResult
+	SPF           email.SPFResult
+	Domain        email.DomainCheck
+	LLM           *llm.Score
+	LLMError      error
+	LLMSkipped    string
+	SpamAssassin  *spamassassin.Result
+	Adversarial   *adversarial.Result
+	Impersonation *email.ImpersonationCheck
+	Headers       *email.HeaderCheck
+	SourceIP      *email.IPCheck
+	Links         *email.LinkCheck
+	Attachments   *attachment.Report
+	Calendar      *email.CalendarCheck
+	ClamAV        *clamav.Report
+	Nested        []Nested
 }
 
 // Build compiles a scorecard based on all check outcomes.
-func Build(dkim []email.DKIMResult, spf email.SPFResult, domain email.DomainCheck, score *llm.Score, saResult *spamassassin.Result, advResult *adversarial.Result) Scorecard {
+func Build(in Input) Scorecard {
+	dkim, spf, domain := in.DKIM, in.SPF, in.Domain
+	score, saResult, advResult := in.LLM, in.SpamAssassin, in.Adversarial
+
 	sc := Scorecard{
 		Status: "CLEAN",
 		Details: ResultDetails{
-			DKIM:         "NONE",
-			SPF:          spf.Status,
-			Domain:       "OK",
-			LLMScore:     score,
-			SpamAssassin: saResult,
-			Adversarial:  advResult,
+			DKIM:          "NONE",
+			SPF:           spf.Status,
+			Domain:        "OK",
+			LLMScore:      score,
+			LLMError:      errorString(in.LLMError),
+			LLMPrompt:     promptID(in.LLM, in.LLMError),
+			LLMCache:      llmCache(in.LLM),
+			LLMSkipped:    in.LLMSkipped,
+			SpamAssassin:  saResult,
+			Adversarial:   advResult,
+			Impersonation: in.Impersonation,
+			Headers:       in.Headers,
+			SourceIP:      in.SourceIP,
+			Links:         in.Links,
+			Attachments:   in.Attachments,
+			Calendar:      in.Calendar,
+			ClamAV:        in.ClamAV,
+			Nested:        in.Nested,
 		},
 		Reasons: []string{},
 	}
@@ -57,7 +144,12 @@ func Build(dkim []email.DKIMResult, spf email.SPFResult, domain email.DomainChec
 	if domain.Malicious {
 		sc.Details.Domain = "BLOCKED"
 		sc.Status = "SPAM"
-		totalScore += 10.0
+		// Entries imported from lower-confidence feeds count proportionally less.
+		totalScore += 10.0 * domain.Entry.Weight()
+		sc.Reasons = append(sc.Reasons, domain.Reason)
+	} else if domain.Allowlisted {
+		sc.Details.Domain = "ALLOWED"
+		totalScore -= 2.0
 	} else {
 		sc.Details.Domain = "OK"
 	}
@@ -106,14 +198,77 @@ func Build(dkim []email.DKIMResult, spf email.SPFResult, domain email.DomainChec
 		}
 	}
 
-	// 5. LLM
+	// 5. Display-name impersonation
+	if in.Impersonation != nil {
+		totalScore += addFindings(&sc, in.Impersonation.Findings)
+	}
+
+	// 6. From / Sender / Reply-To / Return-Path consistency
+	if in.Headers != nil {
+		totalScore += addFindings(&sc, in.Headers.Findings)
+	}
+
+	// 7. Source IP and link reputation lists
+	if in.SourceIP != nil {
+		if in.SourceIP.Allowlisted {
+			totalScore -= 1.0
+		}
+		totalScore += addFindings(&sc, in.SourceIP.Findings)
+	}
+	if in.Links != nil {
+		totalScore += addFindings(&sc, in.Links.Findings)
+	}
+
+	// 8. Attachments and calendar invites
+	if in.Attachments != nil {
+		totalScore += addFindings(&sc, in.Attachments.Findings)
+	}
+	if in.Calendar != nil {
+		totalScore += addFindings(&sc, in.Calendar.Findings)
+	}
+
+	// 9. Antivirus
+	if in.ClamAV != nil {
+		for _, d := range in.ClamAV.Detections {
+			sc.Reasons = append(sc.Reasons, fmt.Sprintf("[clamav] %s: %s FOUND", d.Object, d.Virus))
+		}
+		// A failed scan is not a clean one: say what was left unscanned.
+		if errs := in.ClamAV.Errors; len(errs) > 0 {
+			sc.Reasons = append(sc.Reasons, fmt.Sprintf("[clamav] error: %d of %d object(s) not scanned (%s)",
+				len(errs), len(errs)+in.ClamAV.Scanned, strings.Join(errs, "; ")))
+		}
+	}
+
+	// 10. Attached messages, each finding naming the message it came from
+	for _, n := range in.Nested {
+		for _, f := range n.Findings {
+			f.Reason = fmt.Sprintf("in %s: %s", n.Path, f.Reason)
+			totalScore += addFindings(&sc, []email.Finding{f})
+		}
+	}
+
+	// 11. LLM, weighed last so its verdict can be checked against the
+	// heuristics: a model talked into "clean" by the message itself must
+	// not lower the score.
 	if score != nil {
-		if score.Spam {
+		sc.Details.LLMVotes, sc.Details.LLMDisagree = score.Votes, score.Disagreement
+		if score.Compromised == "" && !score.Spam && totalScore >= 5.0 {
+			checked := *score
+			checked.Compromised = fmt.Sprintf("clean verdict against a heuristic score of %.1f", totalScore)
+			score, sc.Details.LLMScore = &checked, &checked
+		}
+		switch {
+		case score.Compromised != "":
+			totalScore += addFindings(&sc, []email.Finding{{Check: "llm-compromised", Weight: 2.0, Reason: "LLM result discarded: " + score.Compromised}})
+		case score.Spam:
 			totalScore += 4.0
 			sc.Reasons = append(sc.Reasons, fmt.Sprintf("LLM Analysis: SPAM (confidence: %.2f)", score.Score))
-		} else {
+		default:
 			totalScore -= 0.5
 		}
+		if score.Compromised == "" && score.Disagreement > 0 {
+			sc.Reasons = append(sc.Reasons, fmt.Sprintf("LLM models disagree: %s (%.0f%% of the weight against the verdict)", tally(score.Votes), score.Disagreement*100))
+		}
 	}
 
 	// Final Decision
@@ -128,13 +283,25 @@ func Build(dkim []email.DKIMResult, spf email.SPFResult, domain email.DomainChec
 	if totalScore < 0 {
 		totalScore = 0
 	}
+	if totalScore > 10.0 {
+		totalScore = 10.0
+	}
 	// Force SPAM if adversarial
 	if advResult != nil && advResult.IsAdversarial {
 		totalScore = 10.0
 		sc.Status = "SPAM"
 	}
+	// Malware overrides every other verdict.
+	if in.ClamAV.Infected() {
+		totalScore = 10.0
+		sc.Status = "MALWARE"
+	}
 
 	sc.DecisionScore = totalScore
+	if score != nil && score.Compromised == "" {
+		sc.Category = score.Category
+	}
+	sc.Action = decideAction(sc.Status, sc.Category)
 
 	if len(sc.Reasons) == 0 {
 		sc.Reasons = append(sc.Reasons, "No negative indicators found")
@@ -142,3 +309,103 @@ func Build(dkim []email.DKIMResult, spf email.SPFResult, domain email.DomainChec
 
 	return sc
 }
+
+// Cascade asks the LLM only about messages the other checks leave in
+// doubt: those whose provisional score, built without the LLM, falls in
+// [Low, High).
+type Cascade struct {
+	Low, High float64
+}
+
+// SkipLLM returns why the LLM need not be asked about a message scored
+// provisional without it, or "" when it should be.
+func (c Cascade) SkipLLM(provisional Scorecard) string {
+	switch {
+	case provisional.Status == "MALWARE":
+		return "malware found"
+	case provisional.DecisionScore >= c.High:
+		return fmt.Sprintf("provisional score %.1f is %.1f or more", provisional.DecisionScore, c.High)
+	case provisional.DecisionScore < c.Low:
+		return fmt.Sprintf("provisional score %.1f is below %.1f", provisional.DecisionScore, c.Low)
+	}
+	return ""
+}
+
+// decideAction maps the status to an action and lets the LLM category
+// refine it. The category never clears a message the score did not:
+// legitimate changes nothing, marketing only moves clean or borderline
+// mail to the bulk folder, and threat categories apply once the score
+// already holds the message back.
+func decideAction(status, category string) Action {
+	switch status {
+	case "MALWARE":
+		return ActionIsolate
+	case "CLEAN":
+		if category == llm.CategoryMarketing {
+			return ActionBulk
+		}
+		return ActionDeliver
+	}
+	if a, ok := categoryActions[category]; ok {
+		return a
+	}
+	if status == "SPAM" {
+		return ActionJunk
+	}
+	if category == llm.CategoryMarketing {
+		return ActionBulk
+	}
+	return ActionQuarantine
+}
+
+// addFindings records each finding as a reason and returns the summed weight.
+func addFindings(sc *Scorecard, findings []email.Finding) float64 {
+	total := 0.0
+	for _, f := range findings {
+		total += f.Weight
+		sc.Reasons = append(sc.Reasons, fmt.Sprintf("[%s] %s (+%.1f)", f.Check, f.Reason, f.Weight))
+	}
+	return total
+}
+
+// tally counts the spam verdicts of an ensemble, e.g. "2 of 3 say spam".
+func tally(votes []llm.Vote) string {
+	var spam, voted int
+	for _, v := range votes {
+		if v.Error != "" || v.Compromised != "" {
+			continue
+		}
+		voted++
+		if v.Spam {
+			spam++
+		}
+	}
+	return fmt.Sprintf("%d of %d say spam", spam, voted)
+}
+
+// llmCache returns the cache outcome of an LLM score.
+func llmCache(score *llm.Score) string {
+	if score == nil {
+		return ""
+	}
+	return score.Cache
+}
+
+// promptID returns the prompt behind an LLM score or parse failure.
+func promptID(score *llm.Score, err error) string {
+	var perr *llm.ParseError
+	switch {
+	case score != nil:
+		return score.Prompt
+	case errors.As(err, &perr):
+		return perr.Prompt
+	}
+	return ""
+}
+
+func errorString(err error) string {
+	if err == nil {
+		return ""
+	}
+	return err.Error()
+}
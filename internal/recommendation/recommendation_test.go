@@ -1,10 +1,13 @@
 package recommendation
 
 import (
+	"errors"
 	"strings"
 	"testing"
 
 	"spamfilter/internal/adversarial"
+	"spamfilter/internal/attachment"
+	"spamfilter/internal/clamav"
 	"spamfilter/internal/email"
 	"spamfilter/internal/llm"
 	"spamfilter/internal/spamassassin"
@@ -16,7 +19,7 @@ func TestBuild(t *testing.T) {
 	spf := email.SPFResult{Status: "pass"}
 	domain := email.DomainCheck{Malicious: false, Domain: "example.com"}
 
-	scorecard := Build(dkim, spf, domain, nil, nil, nil)
+	scorecard := Build(Input{DKIM: dkim, SPF: spf, Domain: domain})
 
 	if scorecard.Status != "CLEAN" {
 		t.Errorf("expected CLEAN, got %s", scorecard.Status)
@@ -29,7 +32,7 @@ func TestBuild_Spam(t *testing.T) {
 	spf := email.SPFResult{Status: "fail"}
 	domain := email.DomainCheck{Malicious: true, Domain: "bad.com"}
 
-	scorecard := Build(dkim, spf, domain, nil, nil, nil)
+	scorecard := Build(Input{DKIM: dkim, SPF: spf, Domain: domain})
 
 	if scorecard.Status != "SPAM" {
 		t.Errorf("expected SPAM, got %s", scorecard.Status)
@@ -43,7 +46,7 @@ func TestBuild_Adversarial(t *testing.T) {
 	domain := email.DomainCheck{Malicious: false}
 	adv := &adversarial.Result{IsAdversarial: true, Reason: "Injection"}
 
-	scorecard := Build(dkim, spf, domain, nil, nil, adv)
+	scorecard := Build(Input{DKIM: dkim, SPF: spf, Domain: domain, Adversarial: adv})
 
 	if scorecard.Status != "SPAM" {
 		t.Errorf("expected SPAM for adversarial, got %s", scorecard.Status)
@@ -59,7 +62,7 @@ func TestBuild_LLM_SpamAssassin(t *testing.T) {
 	llmScore := &llm.Score{Spam: true, Score: 0.9}
 	saResult := &spamassassin.Result{IsSpam: true, Score: 15.0, Rules: []string{"GTUBE"}}
 
-	scorecard := Build(dkim, spf, domain, llmScore, saResult, nil)
+	scorecard := Build(Input{DKIM: dkim, SPF: spf, Domain: domain, LLM: llmScore, SpamAssassin: saResult})
 
 	if scorecard.Status != "SPAM" {
 		t.Errorf("expected SPAM, got %s", scorecard.Status)
@@ -76,3 +79,206 @@ func TestBuild_LLM_SpamAssassin(t *testing.T) {
 		t.Error("Expected SpamAssassin reason in scorecard")
 	}
 }
+
+func TestBuild_LLMError(t *testing.T) {
+	err := &llm.ParseError{Text: "Sigur, iată analiza.", Attempts: 2, Prompt: "classify@2+0a1b2c3d", Err: errors.New("no JSON object in the answer")}
+	scorecard := Build(Input{SPF: email.SPFResult{Status: "pass"}, LLMError: err})
+
+	if scorecard.Details.LLMScore != nil {
+		t.Error("no score expected")
+	}
+	if scorecard.Details.LLMError != "unusable LLM answer after 2 attempt(s): no JSON object in the answer" {
+		t.Errorf("LLMError = %q", scorecard.Details.LLMError)
+	}
+	if scorecard.Details.LLMPrompt != "classify@2+0a1b2c3d" {
+		t.Errorf("LLMPrompt = %q", scorecard.Details.LLMPrompt)
+	}
+
+	scorecard = Build(Input{LLM: &llm.Score{Prompt: "classify.en@1+9f86d081", Cache: "hit"}})
+	if scorecard.Details.LLMPrompt != "classify.en@1+9f86d081" || scorecard.Details.LLMCache != "hit" {
+		t.Errorf("LLMPrompt = %q, LLMCache = %q", scorecard.Details.LLMPrompt, scorecard.Details.LLMCache)
+	}
+}
+
+func TestBuild_LLMCompromised(t *testing.T) {
+	pass := email.SPFResult{Status: "pass"}
+	blocked := email.DomainCheck{Malicious: true, Domain: "actor.com", Reason: "blocklisted"}
+
+	// A clean verdict against strong heuristics is not trusted.
+	clean := &llm.Score{Spam: false, Score: 0.0}
+	scorecard := Build(Input{SPF: pass, Domain: blocked, LLM: clean})
+	if got := scorecard.Details.LLMScore; got == nil || !strings.HasPrefix(got.Compromised, "clean verdict against a heuristic score of 10.0") {
+		t.Errorf("LLMScore = %+v", got)
+	}
+	if clean.Compromised != "" {
+		t.Error("Build must not modify its input")
+	}
+
+	// A verdict the model was talked into does not lower the score.
+	parroted := &llm.Score{Spam: false, Compromised: `reason repeats the message's instruction "spam: false"`}
+	trusted := Build(Input{SPF: pass, LLM: &llm.Score{Spam: false}})
+	scorecard = Build(Input{SPF: pass, LLM: parroted})
+	if scorecard.DecisionScore <= trusted.DecisionScore {
+		t.Errorf("compromised verdict scored %.1f, trusted one %.1f", scorecard.DecisionScore, trusted.DecisionScore)
+	}
+	found := false
+	for _, r := range scorecard.Reasons {
+		found = found || strings.HasPrefix(r, "[llm-compromised] LLM result discarded: reason repeats")
+	}
+	if !found {
+		t.Errorf("reasons = %v", scorecard.Reasons)
+	}
+}
+
+func TestBuild_CategoryActions(t *testing.T) {
+	pass := email.SPFResult{Status: "pass"}
+	blocked := email.DomainCheck{Malicious: true, Domain: "bad.com"}
+	cases := []struct {
+		name     string
+		in       Input
+		status   string
+		action   Action
+		category string
+	}{
+		{"clean", Input{SPF: pass}, "CLEAN", ActionDeliver, ""},
+		{"legitimate", Input{SPF: pass, LLM: &llm.Score{Category: llm.CategoryLegitimate}}, "CLEAN", ActionDeliver, llm.CategoryLegitimate},
+		{"newsletter", Input{SPF: pass, LLM: &llm.Score{Category: llm.CategoryMarketing}}, "CLEAN", ActionBulk, llm.CategoryMarketing},
+		{"phishing", Input{SPF: pass, LLM: &llm.Score{Spam: true, Category: llm.CategoryPhishing}}, "QUARANTINE", ActionReport, llm.CategoryPhishing},
+		{"bec", Input{SPF: pass, LLM: &llm.Score{Spam: true, Category: llm.CategoryBEC}}, "QUARANTINE", ActionVerify, llm.CategoryBEC},
+		{"fake alert", Input{SPF: pass, Domain: blocked, LLM: &llm.Score{Spam: true, Category: llm.CategoryFakeAlert}}, "SPAM", ActionReport, llm.CategoryFakeAlert},
+		{"malware", Input{SPF: pass, Domain: blocked, LLM: &llm.Score{Spam: true, Category: llm.CategoryMalware}}, "SPAM", ActionIsolate, llm.CategoryMalware},
+		{"scam", Input{SPF: pass, LLM: &llm.Score{Spam: true, Category: llm.CategoryScam}}, "QUARANTINE", ActionJunk, llm.CategoryScam},
+		{"bulk spam", Input{SPF: pass, Domain: blocked, LLM: &llm.Score{Spam: true, Category: llm.CategoryMarketing}}, "SPAM", ActionJunk, llm.CategoryMarketing},
+		{"blocked legitimate", Input{SPF: pass, Domain: blocked, LLM: &llm.Score{Category: llm.CategoryLegitimate}}, "SPAM", ActionJunk, ""},
+		{"compromised", Input{SPF: pass, LLM: &llm.Score{Category: llm.CategoryMarketing, Compromised: "x"}}, "QUARANTINE", ActionQuarantine, ""},
+	}
+	for _, tc := range cases {
+		sc := Build(tc.in)
+		if sc.Status != tc.status || sc.Action != tc.action || sc.Category != tc.category {
+			t.Errorf("%s: %s / %s / %q, want %s / %s / %q", tc.name, sc.Status, sc.Action, sc.Category, tc.status, tc.action, tc.category)
+		}
+	}
+}
+
+func TestBuild_LLMEnsemble(t *testing.T) {
+	votes := []llm.Vote{
+		{Provider: "openai/gpt-4o-mini", Weight: 1, Spam: true, Score: 0.9, Category: llm.CategoryScam},
+		{Provider: "ollama/llama3.1:8b", Weight: 1, Spam: true, Score: 0.8, Category: llm.CategoryScam},
+		{Provider: "ollama/qwen2.5:7b", Weight: 1, Spam: false, Score: 0.2, Category: llm.CategoryLegitimate},
+		{Provider: "gemini/gemini-1.5-flash", Weight: 1, Error: "context deadline exceeded"},
+	}
+	score := &llm.Score{Spam: true, Score: 0.85, Category: llm.CategoryScam, Votes: votes, Disagreement: 1.0 / 3}
+	sc := Build(Input{SPF: email.SPFResult{Status: "pass"}, LLM: score})
+
+	if len(sc.Details.LLMVotes) != 4 || sc.Details.LLMDisagree != 1.0/3 {
+		t.Errorf("LLMVotes = %+v, LLMDisagree = %g", sc.Details.LLMVotes, sc.Details.LLMDisagree)
+	}
+	found := false
+	for _, r := range sc.Reasons {
+		found = found || strings.HasPrefix(r, "LLM models disagree: 2 of 3 say spam")
+	}
+	if !found {
+		t.Errorf("reasons = %v", sc.Reasons)
+	}
+}
+
+func TestCascade_SkipLLM(t *testing.T) {
+	cascade := Cascade{Low: 1.0, High: 5.0}
+	pass := email.SPFResult{Status: "pass"}
+	cases := []struct {
+		name string
+		in   Input
+		skip string
+	}{
+		{"clean", Input{SPF: pass}, "provisional score 0.0 is below 1.0"},
+		{"blocklisted", Input{SPF: pass, Domain: email.DomainCheck{Malicious: true, Domain: "bad.com"}}, "provisional score 10.0 is 5.0 or more"},
+		{"borderline", Input{SPF: email.SPFResult{Status: "fail"}}, ""},
+		{"malware", Input{SPF: pass, ClamAV: &clamav.Report{Detections: []clamav.Detection{{Object: "a.exe", Virus: "Eicar-Signature"}}}}, "malware found"},
+	}
+	for _, tc := range cases {
+		if got := cascade.SkipLLM(Build(tc.in)); got != tc.skip {
+			t.Errorf("%s: SkipLLM = %q, want %q", tc.name, got, tc.skip)
+		}
+	}
+
+	sc := Build(Input{SPF: pass, LLMSkipped: "provisional score 0.0 is below 1.0"})
+	if sc.Details.LLMSkipped != "provisional score 0.0 is below 1.0" {
+		t.Errorf("LLMSkipped = %q", sc.Details.LLMSkipped)
+	}
+}
+
+func TestBuild_Impersonation(t *testing.T) {
+	// Case 5: External sender using the CEO's name
+	dkim := []email.DKIMResult{}
+	spf := email.SPFResult{Status: "none"}
+	domain := email.DomainCheck{Malicious: false, Domain: "gmail.com"}
+	imp := &email.ImpersonationCheck{
+		Findings: []email.Finding{{Check: "impersonation-external", Weight: 4.0, Reason: "external sender uses the name of internal person Ion Popescu"}},
+	}
+
+	scorecard := Build(Input{DKIM: dkim, SPF: spf, Domain: domain, Impersonation: imp})
+
+	if scorecard.Status != "QUARANTINE" {
+		t.Errorf("expected QUARANTINE, got %s", scorecard.Status)
+	}
+	if scorecard.DecisionScore != 4.0 {
+		t.Errorf("expected score 4.0, got %.1f", scorecard.DecisionScore)
+	}
+}
+
+func TestBuild_Attachments(t *testing.T) {
+	att := attachment.InspectFile("factura.pdf.exe", "application/pdf", []byte("MZ\x90\x00\x03\x00\x00\x00"))
+	rep := &attachment.Report{Attachments: []attachment.Attachment{att}, Findings: att.Findings}
+
+	scorecard := Build(Input{SPF: email.SPFResult{Status: "none"}, Attachments: rep})
+
+	if scorecard.Status != "SPAM" {
+		t.Errorf("expected SPAM for a disguised executable, got %s (%.1f)", scorecard.Status, scorecard.DecisionScore)
+	}
+	if scorecard.Details.Attachments == nil || len(scorecard.Details.Attachments.Attachments) != 1 {
+		t.Error("expected the attachment summary in the scorecard details")
+	}
+}
+
+func TestBuild_Malware(t *testing.T) {
+	av := &clamav.Report{Mode: clamav.ModeAttachments, Scanned: 1,
+		Detections: []clamav.Detection{{Object: "factura.zip", Virus: "Win.Trojan.Agent-123"}}}
+	domain := email.DomainCheck{Allowlisted: true}
+
+	scorecard := Build(Input{SPF: email.SPFResult{Status: "pass"}, Domain: domain, ClamAV: av})
+
+	if scorecard.Status != "MALWARE" || scorecard.DecisionScore != 10.0 {
+		t.Errorf("expected MALWARE 10.0 even for an allowlisted sender, got %s %.1f", scorecard.Status, scorecard.DecisionScore)
+	}
+	if !strings.Contains(strings.Join(scorecard.Reasons, "\n"), "[clamav] factura.zip: Win.Trojan.Agent-123 FOUND") {
+		t.Errorf("virus name missing from reasons: %v", scorecard.Reasons)
+	}
+}
+
+func TestBuild_ClamAVError(t *testing.T) {
+	av := &clamav.Report{Mode: clamav.ModeAttachments, Errors: []string{"factura.zip: INSTREAM size limit exceeded"}}
+
+	scorecard := Build(Input{SPF: email.SPFResult{Status: "pass"}, ClamAV: av})
+
+	want := "[clamav] error: 1 of 1 object(s) not scanned (factura.zip: INSTREAM size limit exceeded)"
+	if !strings.Contains(strings.Join(scorecard.Reasons, "\n"), want) {
+		t.Errorf("scan error missing from reasons: %v", scorecard.Reasons)
+	}
+}
+
+func TestBuild_Nested(t *testing.T) {
+	nested := []Nested{{
+		Path:     "Fwd.eml/factura.eml",
+		Findings: []email.Finding{{Check: "link-blocklist", Weight: 6.0, Reason: "link to blocklisted host anaf-ro.top"}},
+	}}
+
+	scorecard := Build(Input{SPF: email.SPFResult{Status: "pass"}, Nested: nested})
+
+	if scorecard.Status != "SPAM" {
+		t.Errorf("expected SPAM from the attached message, got %s (%.1f)", scorecard.Status, scorecard.DecisionScore)
+	}
+	want := "[link-blocklist] in Fwd.eml/factura.eml: link to blocklisted host anaf-ro.top (+6.0)"
+	if !strings.Contains(strings.Join(scorecard.Reasons, "\n"), want) {
+		t.Errorf("expected %q in reasons: %v", want, scorecard.Reasons)
+	}
+}
@@ -34,12 +34,6 @@ func New(host, port string) *Client {
 
 // Check sends the email to SpamAssassin daemon and parses the response.
 func (c *Client) Check(em *email.Email) (*Result, error) {
-	conn, err := net.DialTimeout("tcp", c.Host+":"+c.Port, 5*time.Second)
-	if err != nil {
-		return nil, fmt.Errorf("failed to connect to spamd: %w", err)
-	}
-	defer conn.Close()
-
 	// Construct SPAMC request
 	// Headers:
 	// CHECK SPAMC/1.2
@@ -49,14 +43,6 @@ func (c *Client) Check(em *email.Email) (*Result, error) {
 
 	// We need the raw bytes of the email. Assuming em.Raw contains the raw bytes including headers.
 	rawMsg := em.Raw
-	reqHeader := fmt.Sprintf("CHECK SPAMC/1.2\r\nContent-Length: %d\r\n\r\n", len(rawMsg))
-
-	if _, err := conn.Write([]byte(reqHeader)); err != nil {
-		return nil, fmt.Errorf("failed to write header: %w", err)
-	}
-	if _, err := conn.Write(rawMsg); err != nil {
-		return nil, fmt.Errorf("failed to write body: %w", err)
-	}
 
 	// Read response
 	// Example response:
@@ -119,7 +105,10 @@ func (c *Client) performCommand(cmd string, data []byte) (*Result, error) {
 	reqHeader := fmt.Sprintf("%s SPAMC/1.2\r\nContent-Length: %d\r\n\r\n", cmd, len(data))
 	conn.Write([]byte(reqHeader))
 	conn.Write(data)
-	// Signal end of write if needed, but Content-Length handles it.
+	// Half-close like spamc does, so servers that read until EOF see the end of the message.
+	if tcp, ok := conn.(*net.TCPConn); ok {
+		tcp.CloseWrite()
+	}
 
 	// Read response
 	scanner := bufio.NewScanner(conn)